@@ -1,12 +1,18 @@
 package main
 
 import (
-	// "os"
 	"context"
+	"errors"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"used2book-backend/internal/api"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/models"
 	"used2book-backend/internal/repository/mysql"
 	"used2book-backend/internal/twiliootp" // adjust the import path to your module name and structure
 	"used2book-backend/internal/utils"
@@ -25,6 +31,10 @@ import (
 //     }
 // }
 
+// serverShutdownTimeout is how long in-flight requests get to finish after a
+// shutdown signal
+const serverShutdownTimeout = 10 * time.Second
+
 func main() {
 
 	if err := godotenv.Load(); err != nil {
@@ -47,7 +57,10 @@ func main() {
         log.Fatal("Failed to connect to RabbitMQ:", err)
     }
 
-	router := api.SetupRouter(db, rabbitConn)
+	// Live notifications fan out over Redis so every instance can push them
+	notificationStream := services.NewNotificationStream(utils.RedisClient)
+
+	router := api.SetupRouter(db, rabbitConn, notificationStream)
 
 	utils.RunMigrations()
 
@@ -61,18 +74,89 @@ func main() {
 	
 	userRepo := mysql.NewUserRepository(db)
 
-	// Set up context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Start background cleanup as a goroutine
-	go userRepo.CleanupExpiredListings(ctx)
-
-
+	// Set up context for graceful shutdown: SIGINT or SIGTERM stops the
+	// workers below and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// End lapsed reservations, handing each listing to the next buyer on its
+	// waitlist or telling buyers whose offers come back, and remind buyers
+	// whose holds are about to run out
+	reservationService := services.NewReservationService(mysql.NewReservationRepository(db))
+	go reservationService.RunExpiryWorker(ctx, func(res models.HoldRelease) {
+		handlers.NotifyHoldRelease(rabbitConn, res)
+	}, func(hold models.ListingHold) {
+		handlers.NotifyHoldExpiring(rabbitConn, hold)
+	})
+
+	// Expire unanswered offers and accepted offers left unpaid
+	go services.NewUserService(userRepo).RunOfferExpiryWorker(ctx, func(update models.OfferUpdate) {
+		handlers.NotifyOfferUpdate(rabbitConn, update)
+	})
+
+	// Alert users about new listings matching their saved searches
+	savedSearchService := services.NewSavedSearchService(mysql.NewSavedSearchRepository(db))
+	go savedSearchService.RunMatchWorker(ctx, func(match models.SavedSearchMatch) {
+		handlers.NotifySavedSearchMatch(rabbitConn, match)
+	})
+
+	// Pay released escrow funds out to sellers through Omise
+	escrowService := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	go escrowService.RunPayoutWorker(ctx)
+
+	// Complete shipped orders the buyer never confirmed, releasing their funds
+	orderService := services.NewOrderService(mysql.NewOrderRepository(db), escrowService, services.NewPaymentProvidersFromEnv())
+	go orderService.RunAutoCompleteWorker(ctx, func(order *models.Order) {
+		handlers.NotifyOrderUpdate(rabbitConn, order)
+	})
+
+	// Store every event published on the notification queues in the
+	// recipient's notification center, push it to their open streams and
+	// email or text it as their preferences allow
+	go notificationStream.Run(ctx)
+	notificationRepo := mysql.NewNotificationRepository(db)
+	var notificationChannels []services.NotificationChannel
+	if mailer := services.NewMailerFromEnv(); mailer != nil {
+		emailTemplates, err := services.LoadEmailTemplates()
+		if err != nil {
+			log.Fatalf("Failed to load email templates: %v", err)
+		}
+		notificationChannels = append(notificationChannels, services.NewEmailChannel(mailer, emailTemplates, notificationRepo))
+	}
+	if os.Getenv("TWILIO_ACCOUNT_SID") != "" {
+		notificationChannels = append(notificationChannels, services.NewSMSChannel(notificationRepo))
+	}
+	notificationService := services.NewNotificationService(notificationRepo, notificationStream, notificationChannels...)
+	go notificationService.RunConsumer(ctx, rabbitConn)
+
+	// Send what quiet hours held back and the daily digests
+	go notificationService.RunDeliveryWorker(ctx)
+
+
+
+	srv := &http.Server{Addr: ":6951", Handler: router}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down server...")
+		// Notification streams never finish on their own, so whatever is
+		// still open when the timeout runs out is cut; clients reconnect
+		// with Last-Event-ID
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown timed out, closing remaining connections: %v", err)
+			srv.Close()
+		}
+	}()
 
 	log.Println("Server is listening on port 6951")
-	if err := http.ListenAndServe(":6951", router); err != nil {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed: %v", err)
 	}
+	// ListenAndServe returns as soon as Shutdown starts; wait for it to drain
+	<-shutdownDone
+	log.Println("Server stopped")
 }
 
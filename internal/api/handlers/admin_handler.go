@@ -1 +1,256 @@
-package handlers
\ No newline at end of file
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+type AdminHandler struct {
+	WebhookEventService *services.WebhookEventService
+	PaymentHandler      *PaymentHandler
+	DisputeService      *services.DisputeService
+	ReservationService  *services.ReservationService
+	RabbitMQConn        *amqp.Connection
+}
+
+// ListWebhookEventsHandler lists the webhook ledger, e.g. ?status=failed
+func (ah *AdminHandler) ListWebhookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.WebhookEventProcessing, models.WebhookEventProcessed, models.WebhookEventFailed:
+	default:
+		sendErrorResponse(w, http.StatusBadRequest, "status must be processing, processed or failed")
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, pageInfo, err := ah.WebhookEventService.ListEvents(r.Context(), status, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get webhook events")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"events":      events,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// GetWebhookEventHandler returns one ledger entry including its raw payload
+func (ah *AdminHandler) GetWebhookEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "eventID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+
+	event, err := ah.WebhookEventService.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get webhook event: "+err.Error())
+		return
+	}
+	if event == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Webhook event not found")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// ReplayWebhookEventHandler runs a failed webhook event again from its stored payload
+func (ah *AdminHandler) ReplayWebhookEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "eventID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+
+	event, err := ah.WebhookEventService.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get webhook event: "+err.Error())
+		return
+	}
+	if event == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Webhook event not found")
+		return
+	}
+
+	claimed, err := ah.WebhookEventService.ClaimEvent(r.Context(), eventID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to claim webhook event: "+err.Error())
+		return
+	}
+	if !claimed {
+		sendErrorResponse(w, http.StatusConflict, "Only failed events can be replayed (event is "+event.Status+")")
+		return
+	}
+
+	replayErr := ah.PaymentHandler.replayWebhookEvent(context.Background(), event)
+
+	// Reload to report the outcome and attempt count
+	event, err = ah.WebhookEventService.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get webhook event: "+err.Error())
+		return
+	}
+
+	if replayErr != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(replayErr, errInvalidWebhookPayload) {
+			status = http.StatusUnprocessableEntity
+		}
+		sendErrorResponse(w, status, "Replay failed: "+replayErr.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// ListDisputesHandler lists every dispute, e.g. ?status=open
+func (ah *AdminHandler) ListDisputesHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := parseDisputeStatus(w, r)
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	disputes, pageInfo, err := ah.DisputeService.ListDisputes(r.Context(), 0, status, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get disputes")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"disputes":    disputes,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// GetDisputeHandler returns any dispute with its full thread
+func (ah *AdminHandler) GetDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	disputeID, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+
+	dispute, err := ah.DisputeService.GetDisputeForAdmin(r.Context(), disputeID)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
+
+// AddDisputeNoteHandler adds an admin message to a dispute's thread
+func (ah *AdminHandler) AddDisputeNoteHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value("user_id").(int)
+	disputeID, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+
+	var req models.DisputeMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	dispute, err := ah.DisputeService.AddAdminNote(r.Context(), disputeID, adminID, req.Body)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	notifyDisputeUpdate(ah.RabbitMQConn, dispute, adminID, "Our support team added a message to your dispute.")
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
+
+// ResolveDisputeHandler settles a dispute with a full refund, a partial
+// refund or a rejection, refunding the buyer through the payment provider
+func (ah *AdminHandler) ResolveDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value("user_id").(int)
+	disputeID, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+
+	var req models.ResolveDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	dispute, err := ah.DisputeService.Resolve(r.Context(), disputeID, adminID, req)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	notifyDisputeUpdate(ah.RabbitMQConn, dispute, adminID, "Your dispute has been resolved.")
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
+
+// ReservationMetricsHandler reports how listing holds ended, overall and per
+// source and payment provider, over the last ?days= days (default 30)
+func (ah *AdminHandler) ReservationMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			sendErrorResponse(w, http.StatusBadRequest, "days must be a positive number")
+			return
+		}
+		days = parsed
+	}
+
+	metrics, err := ah.ReservationService.GetMetrics(r.Context(), days)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get reservation metrics")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"metrics": metrics,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sendBankAccountError maps payout account errors to a response
+func sendBankAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBankAccount):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrPayoutAccountsUnavailable):
+		sendErrorResponse(w, http.StatusServiceUnavailable, "Payout accounts are not available right now")
+	default:
+		sendErrorResponse(w, http.StatusBadGateway, "Failed to register payout account: "+err.Error())
+	}
+}
+
+// GetBankAccountsHandler lists the user's payout accounts with their
+// verification status
+func (uh *UserHandler) GetBankAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accounts, err := uh.BankAccountService.ListBankAccounts(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get bank accounts: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":       true,
+		"bank_accounts": accounts,
+	})
+}
+
+// CreateBankAccountHandler adds a payout account and registers it with Omise
+func (uh *UserHandler) CreateBankAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.BankAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := uh.BankAccountService.CreateBankAccount(r.Context(), userID, req)
+	if err != nil {
+		sendBankAccountError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"bank_account": account,
+	})
+}
+
+// UpdateBankAccountHandler changes a payout account's bank details
+func (uh *UserHandler) UpdateBankAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, err := strconv.Atoi(chi.URLParam(r, "accountID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid bank account ID")
+		return
+	}
+
+	var req models.BankAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := uh.BankAccountService.UpdateBankAccount(r.Context(), userID, accountID, req)
+	if err != nil {
+		sendBankAccountError(w, err)
+		return
+	}
+	if account == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Bank account not found")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"bank_account": account,
+	})
+}
+
+// DeleteBankAccountHandler removes a payout account
+func (uh *UserHandler) DeleteBankAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, err := strconv.Atoi(chi.URLParam(r, "accountID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid bank account ID")
+		return
+	}
+
+	deleted, err := uh.BankAccountService.DeleteBankAccount(r.Context(), userID, accountID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete bank account: "+err.Error())
+		return
+	}
+	if !deleted {
+		sendErrorResponse(w, http.StatusNotFound, "Bank account not found")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+	})
+}
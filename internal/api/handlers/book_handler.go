@@ -10,6 +10,8 @@ import (
 	"io"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 	"math/rand"
 	"github.com/go-chi/chi/v5"
 
@@ -26,20 +28,121 @@ type BookHandler struct {
 
 func (bh *BookHandler) GetAllBooks(w http.ResponseWriter, r *http.Request) {
 
-	// Call the BookService method to get the total book count
-	books, err := bh.BookService.GetAllBooks(r.Context())
+	page, err := parsePageRequest(r)
 	if err != nil {
-		// Handle the error, e.g., return a 500 Internal Server Error
-		http.Error(w, "Failed to get all books", http.StatusInternalServerError)
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	books, pageInfo, err := bh.BookService.GetAllBooks(r.Context(), page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get all books")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"books": books,
+		"books":       books,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 	
 }
 
+// SearchBooks handles GET /book/search?q=...&genre=...&language=...
+// genre and language may be repeated or comma-separated.
+func (bh *BookHandler) SearchBooks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	params := models.BookSearchParams{
+		Query:     strings.TrimSpace(query.Get("q")),
+		Genres:    splitQueryValues(query["genre"]),
+		Languages: splitQueryValues(query["language"]),
+		Page:      1,
+		Limit:     20,
+	}
+
+	if v := query.Get("published_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid published_from, expected YYYY-MM-DD")
+			return
+		}
+		params.PublishedFrom = &t
+	}
+	if v := query.Get("published_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid published_to, expected YYYY-MM-DD")
+			return
+		}
+		params.PublishedTo = &t
+	}
+
+	if v := query.Get("min_rating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid min_rating, expected 0-5")
+			return
+		}
+		params.MinRating = &rating
+	}
+	if v := query.Get("max_rating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid max_rating, expected 0-5")
+			return
+		}
+		params.MaxRating = &rating
+	}
+
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		params.Page = page
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > 100 {
+			limit = 100
+		}
+		params.Limit = limit
+	}
+
+	result, err := bh.BookService.SearchBooks(r.Context(), params)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to search books: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"books":  result.Books,
+		"total":  result.Total,
+		"page":   result.Page,
+		"limit":  result.Limit,
+		"facets": result.Facets,
+	})
+}
+
+// splitQueryValues flattens repeated and comma-separated query values
+func splitQueryValues(values []string) []string {
+	var out []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
 func (bh *BookHandler) GetAllGenres(w http.ResponseWriter, r *http.Request) {
 
 	// Call the BookService method to get the total book count
@@ -179,16 +282,22 @@ func (bh *BookHandler) GetReviewsByBookIDHandler(w http.ResponseWriter, r *http.
 
 	bookID, err := strconv.Atoi(bookIDStr)
 
-	// Call the BookService method to get the total book count
-	reviews, err := bh.BookService.GetReviewsByBookID(r.Context(), bookID)
+	page, err := parsePageRequest(r)
 	if err != nil {
-		// Handle the error, e.g., return a 500 Internal Server Error
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get reviews"+err.Error())
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reviews, pageInfo, err := bh.BookService.GetReviewsByBookID(r.Context(), bookID, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get reviews")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"reviews": reviews,
+		"reviews":     reviews,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 	
 }
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// maxDisputeImages caps the photos attached to one dispute message
+const maxDisputeImages = 5
+
+type DisputeHandler struct {
+	DisputeService *services.DisputeService
+	UploadService  *services.UploadService
+	RabbitMQConn   *amqp.Connection
+}
+
+// notifyDisputeUpdate tells the buyer and seller, other than the user who
+// made the change, that a dispute moved on
+func notifyDisputeUpdate(conn *amqp.Connection, d *models.Dispute, actorID int, message string) {
+	for _, userID := range []int{d.BuyerID, d.SellerID} {
+		if userID == 0 || userID == actorID {
+			continue
+		}
+		publishNotification(conn, models.QueueDispute, models.NewNotificationEvent(userID, "dispute_"+d.Status, message, models.DisputeEventData{
+			DisputeID: d.ID,
+			OrderID:   d.OrderID,
+			Status:    d.Status,
+		}))
+	}
+}
+
+// sendDisputeError maps dispute errors to a response
+func sendDisputeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrDisputeNotFound):
+		sendErrorResponse(w, http.StatusNotFound, "Dispute not found")
+	case errors.Is(err, services.ErrOrderNotFound):
+		sendErrorResponse(w, http.StatusNotFound, "Order not found")
+	case errors.Is(err, services.ErrDisputeNotAllowed), errors.Is(err, services.ErrDisputeResolved), errors.Is(err, services.ErrOrderTransition):
+		sendErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidDisputeRequest):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update dispute: "+err.Error())
+	}
+}
+
+// parseDisputeForm reads a multipart dispute form: JSON in the "data" field
+// into v and photos in the "images" files, which are uploaded. It answers the
+// request itself on failure.
+func (dh *DisputeHandler) parseDisputeForm(w http.ResponseWriter, r *http.Request, v interface{}) ([]string, bool) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid form data")
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("data")), v); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+		return nil, false
+	}
+
+	files := r.MultipartForm.File["images"]
+	if len(files) > maxDisputeImages {
+		sendErrorResponse(w, http.StatusBadRequest, "At most "+strconv.Itoa(maxDisputeImages)+" images can be attached")
+		return nil, false
+	}
+
+	var uploadURLs []string
+	for _, handler := range files {
+		file, err := handler.Open()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error opening file")
+			return nil, false
+		}
+		defer file.Close()
+
+		url, err := dh.UploadService.UploadImageURL(file, handler.Filename)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Image upload failed: "+err.Error())
+			return nil, false
+		}
+		uploadURLs = append(uploadURLs, url)
+	}
+	return uploadURLs, true
+}
+
+// parseDisputeStatus validates the ?status= filter of a dispute list
+func parseDisputeStatus(w http.ResponseWriter, r *http.Request) (string, bool) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DisputeOpen, models.DisputeResponded, models.DisputeResolved:
+		return status, true
+	}
+	sendErrorResponse(w, http.StatusBadRequest, "status must be open, responded or resolved")
+	return "", false
+}
+
+// OpenDisputeHandler lets the buyer dispute an order. It takes a multipart
+// form with the request JSON in "data" and photos in "images".
+func (dh *DisputeHandler) OpenDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.OpenDisputeRequest
+	imageURLs, ok := dh.parseDisputeForm(w, r, &req)
+	if !ok {
+		return
+	}
+
+	dispute, err := dh.DisputeService.Open(r.Context(), userID, req, imageURLs)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	notifyDisputeUpdate(dh.RabbitMQConn, dispute, userID, "The buyer opened a dispute on your order.")
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
+
+// ListDisputesHandler lists disputes the user is a party to, e.g. ?status=open
+func (dh *DisputeHandler) ListDisputesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status, ok := parseDisputeStatus(w, r)
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	disputes, pageInfo, err := dh.DisputeService.ListDisputes(r.Context(), userID, status, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get disputes")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"disputes":    disputes,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// GetDisputeHandler returns a dispute with its full thread
+func (dh *DisputeHandler) GetDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	disputeID, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+
+	dispute, err := dh.DisputeService.GetDispute(r.Context(), disputeID, userID)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
+
+// AddDisputeMessageHandler lets the buyer or seller add to a dispute's
+// thread, with optional photos, as a multipart form like OpenDisputeHandler
+func (dh *DisputeHandler) AddDisputeMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	disputeID, err := strconv.Atoi(chi.URLParam(r, "disputeID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+
+	var req models.DisputeMessageRequest
+	imageURLs, ok := dh.parseDisputeForm(w, r, &req)
+	if !ok {
+		return
+	}
+
+	dispute, err := dh.DisputeService.Reply(r.Context(), disputeID, userID, req.Body, imageURLs)
+	if err != nil {
+		sendDisputeError(w, err)
+		return
+	}
+
+	notifyDisputeUpdate(dh.RabbitMQConn, dispute, userID, "There is a new message on your dispute.")
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"dispute": dispute,
+	})
+}
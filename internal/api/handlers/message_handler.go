@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+type MessageHandler struct {
+	MessageService *services.MessageService
+	UploadService  *services.UploadService
+	RabbitMQConn   *amqp.Connection
+}
+
+// sendMessageError maps messaging errors to a response
+func sendMessageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrConversationNotFound), errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrNotBlocked):
+		sendErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrUserBlocked):
+		sendErrorResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrCannotMessage), errors.Is(err, services.ErrInvalidMessage):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, "Messaging error: "+err.Error())
+	}
+}
+
+// messageRequest reads the user and, when the route has one, the path ID
+// named param of a request. It writes the error response and returns false
+// when they are invalid.
+func messageRequest(w http.ResponseWriter, r *http.Request, param string) (int, int, bool) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	if param == "" {
+		return userID, 0, true
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid "+strings.ReplaceAll(param, "ID", " ID"))
+		return 0, 0, false
+	}
+	return userID, id, true
+}
+
+// truncateRunes cuts s to at most n characters
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n]) + "…"
+	}
+	return s
+}
+
+// notifyNewMessage tells the other side of a conversation about a message
+func (mh *MessageHandler) notifyNewMessage(c *models.Conversation, msg *models.Message) {
+	preview := truncateRunes(msg.Body, 100)
+	if preview == "" {
+		preview = "Sent a photo"
+	}
+	message := fmt.Sprintf("New message about \"%s\": %s", truncateRunes(c.ListingTitle, 60), preview)
+	publishNotification(mh.RabbitMQConn, models.QueueMessage, models.NewNotificationEvent(c.OtherUserID, models.NotificationMessage, message,
+		models.MessageEventData{
+			ConversationID: c.ID,
+			MessageID:      msg.ID,
+			ListingID:      c.ListingID,
+			SenderID:       msg.SenderID,
+		}))
+}
+
+// ListConversationsHandler returns the user's conversations, most recently
+// active first
+func (mh *MessageHandler) ListConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := messageRequest(w, r, "")
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversations, pageInfo, err := mh.MessageService.ListConversations(r.Context(), userID, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get conversations")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":       true,
+		"conversations": conversations,
+		"next_cursor":   pageInfo.NextCursor,
+		"has_more":      pageInfo.HasMore,
+	})
+}
+
+// StartConversationHandler opens the user's conversation about a listing or
+// an offer, returning the existing one when there is one.
+// Body: {"listing_id": 12} or {"offer_id": 34}
+func (mh *MessageHandler) StartConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := messageRequest(w, r, "")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ListingID int  `json:"listing_id"`
+		OfferID   *int `json:"offer_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ListingID == 0 && req.OfferID == nil {
+		sendErrorResponse(w, http.StatusBadRequest, "listing_id or offer_id is required")
+		return
+	}
+
+	conversation, err := mh.MessageService.StartConversation(r.Context(), userID, req.ListingID, req.OfferID)
+	if err != nil {
+		sendMessageError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"conversation": conversation,
+	})
+}
+
+// GetConversationHandler returns one of the user's conversations
+func (mh *MessageHandler) GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, conversationID, ok := messageRequest(w, r, "conversationID")
+	if !ok {
+		return
+	}
+
+	conversation, err := mh.MessageService.GetConversation(r.Context(), userID, conversationID)
+	if err != nil {
+		sendMessageError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"conversation": conversation,
+	})
+}
+
+// ListMessagesHandler returns a conversation's messages, newest first
+func (mh *MessageHandler) ListMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, conversationID, ok := messageRequest(w, r, "conversationID")
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messages, pageInfo, err := mh.MessageService.ListMessages(r.Context(), userID, conversationID, page)
+	if errors.Is(err, services.ErrConversationNotFound) {
+		sendMessageError(w, err)
+		return
+	}
+	if err != nil {
+		sendPageError(w, err, "Failed to get messages")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"messages":    messages,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// SendMessageHandler writes a message in a conversation. It takes a
+// multipart form with the text in "body" and an optional image in "image".
+func (mh *MessageHandler) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, conversationID, ok := messageRequest(w, r, "conversationID")
+	if !ok {
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	// Check before uploading so blocked users can't store images
+	if _, err := mh.MessageService.CanSend(r.Context(), userID, conversationID); err != nil {
+		sendMessageError(w, err)
+		return
+	}
+
+	var imageURL string
+	if files := r.MultipartForm.File["image"]; len(files) > 0 {
+		header := files[0]
+		if !strings.HasPrefix(header.Header.Get("Content-Type"), "image/") {
+			sendErrorResponse(w, http.StatusBadRequest, "Only images can be attached")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error opening file")
+			return
+		}
+		defer file.Close()
+
+		imageURL, err = mh.UploadService.UploadImageURL(file, header.Filename)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Image upload failed: "+err.Error())
+			return
+		}
+	}
+
+	msg, conversation, err := mh.MessageService.SendMessage(r.Context(), userID, conversationID, r.FormValue("body"), imageURL)
+	if err != nil {
+		sendMessageError(w, err)
+		return
+	}
+	mh.notifyNewMessage(conversation, msg)
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"message": msg,
+	})
+}
+
+// MarkConversationReadHandler marks the messages the user was sent in a
+// conversation read, which the sender sees as read receipts
+func (mh *MessageHandler) MarkConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, conversationID, ok := messageRequest(w, r, "conversationID")
+	if !ok {
+		return
+	}
+
+	updated, err := mh.MessageService.MarkRead(r.Context(), userID, conversationID)
+	if err != nil {
+		sendMessageError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"updated": updated,
+	})
+}
+
+// UnreadMessagesHandler returns how many messages the user hasn't read
+func (mh *MessageHandler) UnreadMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := messageRequest(w, r, "")
+	if !ok {
+		return
+	}
+
+	count, err := mh.MessageService.CountUnread(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to count messages: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"unread":  count,
+	})
+}
+
+// ListBlockedUsersHandler returns the users the user blocked
+func (mh *MessageHandler) ListBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := messageRequest(w, r, "")
+	if !ok {
+		return
+	}
+
+	blocked, err := mh.MessageService.ListBlockedUsers(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get blocked users: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"blocked": blocked,
+	})
+}
+
+// BlockUserHandler stops a user from messaging the user, and the user from
+// messaging them
+func (mh *MessageHandler) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	mh.updateBlock(w, r, mh.MessageService.BlockUser)
+}
+
+// UnblockUserHandler lifts a block
+func (mh *MessageHandler) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	mh.updateBlock(w, r, mh.MessageService.UnblockUser)
+}
+
+func (mh *MessageHandler) updateBlock(w http.ResponseWriter, r *http.Request, update func(ctx context.Context, userID int, blockedID int) error) {
+	userID, blockedID, ok := messageRequest(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	if err := update(r.Context(), userID, blockedID); err != nil {
+		sendMessageError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"used2book-backend/internal/models"
+
+	"github.com/dchest/uniuri"
+	"github.com/streadway/amqp"
+)
+
+// publishNotification pushes a notification event onto a durable RabbitMQ
+// queue, giving it an event ID. Errors are only logged: a lost notification
+// shouldn't fail the request that triggered it.
+func publishNotification(conn *amqp.Connection, queue string, noti models.NotificationEvent) {
+	if conn == nil {
+		log.Println("❌ RabbitMQ connection is nil, dropping notification for", queue)
+		return
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Println("❌ RabbitMQ Channel Error:", err)
+		return
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclare(
+		queue,
+		true, false, false, false, nil,
+	)
+	if err != nil {
+		log.Println("❌ Queue Declare Error:", err)
+		return
+	}
+
+	if noti.EventID == "" {
+		noti.EventID = uniuri.NewLen(32)
+	}
+	body, _ := json.Marshal(noti)
+
+	err = ch.Publish(
+		"", q.Name, false, false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
+		},
+	)
+	if err != nil {
+		log.Println("❌ Publish Error:", err)
+	}
+}
+
+// notificationBatch collects notifications while a database transaction is
+// open, so nothing is announced for changes that end up rolled back.
+type notificationBatch []queuedNotification
+
+type queuedNotification struct {
+	queue string
+	noti  models.NotificationEvent
+}
+
+func (b *notificationBatch) add(queue string, noti models.NotificationEvent) {
+	*b = append(*b, queuedNotification{queue: queue, noti: noti})
+}
+
+// publish sends everything in the batch; call it after the commit.
+func (b notificationBatch) publish(conn *amqp.Connection) {
+	for _, n := range b {
+		publishNotification(conn, n.queue, n.noti)
+	}
+}
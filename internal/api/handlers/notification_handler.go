@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// streamHeartbeat keeps idle notification streams from being closed by
+// proxies
+const streamHeartbeat = 25 * time.Second
+
+type NotificationHandler struct {
+	NotificationService *services.NotificationService
+}
+
+// ListNotificationsHandler returns the user's notifications, newest first.
+// ?unread=true limits them to unread ones.
+func (nh *NotificationHandler) ListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	unreadOnly := false
+	if v := r.URL.Query().Get("unread"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid unread filter")
+			return
+		}
+		unreadOnly = parsed
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, pageInfo, err := nh.NotificationService.ListNotifications(r.Context(), userID, unreadOnly, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get notifications")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+		"next_cursor":   pageInfo.NextCursor,
+		"has_more":      pageInfo.HasMore,
+	})
+}
+
+// UnreadCountHandler returns how many unread notifications the user has
+func (nh *NotificationHandler) UnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	count, err := nh.NotificationService.CountUnread(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to count notifications: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"unread":  count,
+	})
+}
+
+// MarkReadHandler marks one of the user's notifications read
+func (nh *NotificationHandler) MarkReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	notificationID, err := strconv.Atoi(chi.URLParam(r, "notificationID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	if err := nh.NotificationService.MarkRead(r.Context(), userID, notificationID); err != nil {
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			sendErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to mark notification read: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// MarkAllReadHandler marks all of the user's notifications read
+func (nh *NotificationHandler) MarkAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	updated, err := nh.NotificationService.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to mark notifications read: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"updated": updated,
+	})
+}
+
+// writeStreamEvent writes one Server-Sent Event and flushes it
+func writeStreamEvent(w http.ResponseWriter, flusher http.Flusher, event string, id int, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// StreamNotificationsHandler pushes the user's new notifications as
+// Server-Sent Events ("notification" events, with the notification ID as
+// the event ID). It starts with an "unread" event carrying the unread count.
+// A client reconnecting with Last-Event-ID is first sent what it missed.
+func (nh *NotificationHandler) StreamNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorResponse(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	lastID := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastID = parsed
+	}
+
+	// Subscribe before catching up so nothing stored in between is lost
+	notifications, unsubscribe, err := nh.NotificationService.Subscribe(userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer unsubscribe()
+
+	var missed []models.Notification
+	if lastID > 0 {
+		missed, err = nh.NotificationService.ListMissed(r.Context(), userID, lastID)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get notifications: "+err.Error())
+			return
+		}
+	}
+	unread, err := nh.NotificationService.CountUnread(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to count notifications: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeStreamEvent(w, flusher, "unread", 0, map[string]int{"unread": unread}); err != nil {
+		return
+	}
+	for _, n := range missed {
+		if err := writeStreamEvent(w, flusher, "notification", n.ID, n); err != nil {
+			return
+		}
+		lastID = n.ID
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case n := <-notifications:
+			// Already sent while catching up
+			if n.ID <= lastID {
+				continue
+			}
+			if err := writeStreamEvent(w, flusher, "notification", n.ID, n); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// notificationPreferencesRequest changes only the settings it carries.
+// Preferences may list just the categories and channels to change.
+type notificationPreferencesRequest struct {
+	Language     *string                    `json:"language"`
+	EmailEnabled *bool                      `json:"email_enabled"`
+	QuietHours   *models.QuietHours         `json:"quiet_hours"`
+	Digest       *models.DigestSettings     `json:"digest"`
+	Preferences  map[string]map[string]bool `json:"preferences"`
+}
+
+// GetPreferencesHandler returns the user's notification settings
+func (nh *NotificationHandler) GetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := nh.NotificationService.GetSettings(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get notification preferences: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"preferences": settings,
+	})
+}
+
+// UpdatePreferencesHandler changes which channels each kind of notification
+// goes out on, the email language, quiet hours and the daily digest
+func (nh *NotificationHandler) UpdatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req notificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings, err := nh.NotificationService.GetSettings(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get notification preferences: "+err.Error())
+		return
+	}
+	if req.Language != nil {
+		settings.Language = *req.Language
+	}
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+	if req.QuietHours != nil {
+		settings.QuietHours = *req.QuietHours
+	}
+	if req.Digest != nil {
+		settings.Digest = *req.Digest
+	}
+	for category, channels := range req.Preferences {
+		if settings.Preferences[category] == nil {
+			settings.Preferences[category] = map[string]bool{}
+		}
+		for channel, enabled := range channels {
+			settings.Preferences[category][channel] = enabled
+		}
+	}
+
+	if err := nh.NotificationService.UpdateSettings(r.Context(), userID, settings); err != nil {
+		if errors.Is(err, services.ErrInvalidNotificationSettings) {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update notification preferences: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"preferences": settings,
+	})
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+type OrderHandler struct {
+	OrderService *services.OrderService
+	RabbitMQConn *amqp.Connection
+}
+
+// orderNotifications builds the "order_queue" messages announcing an order's
+// new status to whoever needs to act on it or know about it
+func orderNotifications(order *models.Order) []models.NotificationEvent {
+	var recipients []int
+	var message string
+	switch order.Status {
+	case models.OrderShipped:
+		recipients = []int{order.BuyerID}
+		message = "Your order has shipped."
+	case models.OrderDelivered:
+		recipients = []int{order.BuyerID}
+		message = "Your order was delivered. Please confirm you received it."
+	case models.OrderCompleted:
+		recipients = []int{order.SellerID, order.BuyerID}
+		message = "The order is complete."
+	case models.OrderCancelled:
+		recipients = []int{order.BuyerID, order.SellerID}
+		message = "The order was cancelled and the payment refunded."
+	default:
+		return nil
+	}
+
+	data := models.OrderEventData{
+		OrderID:   order.ID,
+		ListingID: order.ListingID,
+		Status:    order.Status,
+	}
+	if order.TrackingNumber != nil {
+		data.Carrier = order.Carrier
+		data.TrackingNumber = order.TrackingNumber
+	}
+	notes := make([]models.NotificationEvent, 0, len(recipients))
+	for _, userID := range recipients {
+		notes = append(notes, models.NewNotificationEvent(userID, "order_"+order.Status, message, data))
+	}
+	return notes
+}
+
+// NotifyOrderUpdate publishes an order's status change. It is also used by
+// the auto-completion worker.
+func NotifyOrderUpdate(conn *amqp.Connection, order *models.Order) {
+	for _, noti := range orderNotifications(order) {
+		publishNotification(conn, models.QueueOrder, noti)
+	}
+}
+
+// sendOrderError maps order errors to a response
+func sendOrderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		sendErrorResponse(w, http.StatusNotFound, "Order not found")
+	case errors.Is(err, services.ErrOrderTransition):
+		sendErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidOrderRequest):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update order: "+err.Error())
+	}
+}
+
+// orderRequest reads the caller and the {orderID} URL parameter, answering
+// the request itself when either is missing
+func orderRequest(w http.ResponseWriter, r *http.Request) (userID int, orderID int, ok bool) {
+	userID, ok = r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	orderID, err := strconv.Atoi(chi.URLParam(r, "orderID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid order ID")
+		return 0, 0, false
+	}
+	return userID, orderID, true
+}
+
+func (oh *OrderHandler) sendOrderUpdate(w http.ResponseWriter, order *models.Order) {
+	NotifyOrderUpdate(oh.RabbitMQConn, order)
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"order":   order,
+	})
+}
+
+// ListOrdersHandler lists the user's orders, e.g. ?role=seller&status=paid.
+// role defaults to buyer.
+func (oh *OrderHandler) ListOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	role := query.Get("role")
+	if role != "" && role != "buyer" && role != "seller" {
+		sendErrorResponse(w, http.StatusBadRequest, "role must be buyer or seller")
+		return
+	}
+	status := query.Get("status")
+	switch status {
+	case "", models.OrderPaid, models.OrderShipped, models.OrderDelivered, models.OrderCompleted, models.OrderCancelled, models.OrderDisputed, models.OrderRefunded:
+	default:
+		sendErrorResponse(w, http.StatusBadRequest, "status must be paid, shipped, delivered, completed, cancelled, disputed or refunded")
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, pageInfo, err := oh.OrderService.ListOrders(r.Context(), userID, role == "seller", status, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get orders")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"orders":      orders,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// GetOrderHandler returns one of the user's orders
+func (oh *OrderHandler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, ok := orderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := oh.OrderService.GetOrder(r.Context(), orderID, userID)
+	if err != nil {
+		sendOrderError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"order":   order,
+	})
+}
+
+// ShipOrderHandler lets the seller add the carrier and tracking number
+func (oh *OrderHandler) ShipOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, ok := orderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ShipOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	order, err := oh.OrderService.Ship(r.Context(), orderID, userID, req)
+	if err != nil {
+		sendOrderError(w, err)
+		return
+	}
+	oh.sendOrderUpdate(w, order)
+}
+
+// MarkDeliveredHandler lets the seller record that the carrier delivered
+func (oh *OrderHandler) MarkDeliveredHandler(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, ok := orderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := oh.OrderService.MarkDelivered(r.Context(), orderID, userID)
+	if err != nil {
+		sendOrderError(w, err)
+		return
+	}
+	oh.sendOrderUpdate(w, order)
+}
+
+// ConfirmReceiptHandler lets the buyer confirm the book arrived, completing
+// the order and releasing the seller's funds
+func (oh *OrderHandler) ConfirmReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, ok := orderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := oh.OrderService.ConfirmReceipt(r.Context(), orderID, userID)
+	if err != nil {
+		sendOrderError(w, err)
+		return
+	}
+	oh.sendOrderUpdate(w, order)
+}
+
+// CancelOrderHandler lets either party cancel an order that hasn't shipped;
+// the buyer is refunded
+func (oh *OrderHandler) CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, ok := orderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CancelOrderRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+			return
+		}
+	}
+
+	order, err := oh.OrderService.Cancel(r.Context(), orderID, userID, req.Reason)
+	if err != nil {
+		sendOrderError(w, err)
+		return
+	}
+	oh.sendOrderUpdate(w, order)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+)
+
+// parsePageRequest reads ?cursor=&limit=&sort=&order= from the query string.
+// Sort keys are validated by the repository, which knows what each list allows.
+func parsePageRequest(r *http.Request) (models.PageRequest, error) {
+	query := r.URL.Query()
+	page := models.PageRequest{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// sendPageError answers 400 for a bad cursor/sort and 500 for anything else.
+func sendPageError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, models.ErrInvalidPageRequest) {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sendErrorResponse(w, http.StatusInternalServerError, message+": "+err.Error())
+}
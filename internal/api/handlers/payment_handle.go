@@ -5,16 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/joho/godotenv"
+	"github.com/go-chi/chi/v5"
 	"github.com/streadway/amqp"
-	"github.com/stripe/stripe-go/v76"
-	"github.com/stripe/stripe-go/v76/checkout/session"
-	"github.com/stripe/stripe-go/v76/webhook"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"used2book-backend/internal/models"
@@ -22,302 +19,864 @@ import (
 )
 
 type PaymentHandler struct {
-	UserService  *services.UserService
-	RabbitMQConn *amqp.Connection
+	UserService         *services.UserService
+	ReservationService  *services.ReservationService
+	WebhookEventService *services.WebhookEventService
+	EscrowService       *services.EscrowService
+	OrderService        *services.OrderService
+	Providers           *services.PaymentProviderRegistry
+	RabbitMQConn        *amqp.Connection
 }
 
-// CheckoutRequest represents the JSON request body structure
+// CheckoutRequest represents the JSON request body structure. The buyer is
+// the logged-in user. Provider is optional; without it the buyer's preferred
+// provider is used.
 type CheckoutRequest struct {
-	ListingID int `json:"listing_id"`
-	BuyerID   int `json:"buyer_id"`
-	OfferID   int `json:"offer_id,omitempty"`
+	ListingID int    `json:"listing_id"`
+	OfferID   int    `json:"offer_id,omitempty"`
+	Provider  string `json:"provider,omitempty"`
 }
 
-func (ph *PaymentHandler) CheckOutHandler(w http.ResponseWriter, r *http.Request) {
-	// reserve listing at = stripe expired_at
-
-	if err := godotenv.Load(); err != nil {
-		log.Println(errors.New("failed to load stripe_sk_key .env file"))
-
-	}
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-
-	var req CheckoutRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
-		return
-	}
-	log.Println("BuyerID:", req.BuyerID, "ListingID:", req.ListingID, "OfferID:", req.OfferID)
-
-	var amount float64
-	var listing *models.ListingDetails
-	var offerID *int
-	var offer *models.OfferItem
+// checkoutHold is a listing reserved for one buyer ahead of payment
+type checkoutHold struct {
+	Listing   *models.ListingDetails
+	ListingID int
+	Amount    float64
+	OfferID   *int
+}
 
-	listing, err := ph.UserService.GetListingByID(r.Context(), req.ListingID)
+// reserveForCheckout reserves a listing, or the listing behind the buyer's
+// accepted offer when offerID is set, before a payment is started. On failure
+// it returns the status and message to answer the request with.
+func (ph *PaymentHandler) reserveForCheckout(ctx context.Context, buyerID int, listingID int, offerID int) (*checkoutHold, int, string) {
+	listing, err := ph.UserService.GetListingByID(ctx, listingID)
 	if err != nil || listing == nil {
-		sendErrorResponse(w, http.StatusNotFound, "Listing not found")
-		return
+		return nil, http.StatusNotFound, "Listing not found"
 	}
+	hold := &checkoutHold{Listing: listing, ListingID: listingID}
 
-	if req.OfferID != 0 {
-		offer, err = ph.UserService.GetOfferByID(r.Context(), req.OfferID)
+	if offerID != 0 {
+		offer, err := ph.UserService.GetOfferByID(ctx, offerID)
 		if err != nil {
-			sendErrorResponse(w, http.StatusNotFound, "Offer not found")
-			return
+			return nil, http.StatusNotFound, "Offer not found"
 		}
-		log.Printf("offer buyerID: %d, req buyerID: %d", offer.BuyerID, req.BuyerID)
-		if offer.BuyerID != req.BuyerID {
-			sendErrorResponse(w, http.StatusForbidden, "You are not the buyer of this offer")
-			return
+		if offer.BuyerID != buyerID {
+			return nil, http.StatusForbidden, "You are not the buyer of this offer"
 		}
-		if offer.Status != "accepted" {
-			sendErrorResponse(w, http.StatusBadRequest, "Offer is not accepted")
-			return
+		if offer.Status != models.OfferAccepted {
+			return nil, http.StatusBadRequest, "Offer is not accepted"
 		}
-		amount = offer.OfferedPrice
+		if offer.PaymentDueAt != nil && offer.PaymentDueAt.Before(time.Now()) {
+			return nil, http.StatusBadRequest, "The payment deadline for this offer has passed"
+		}
+		hold.Amount = offer.OfferedPrice
+		hold.ListingID = offer.ListingID
 
-		success, err := ph.UserService.ReserveListing(r.Context(), offer.ListingID, offer.BuyerID)
+		tmpOfferID := offerID
+		success, suspended, err := ph.ReservationService.ReserveListing(ctx, offer.ListingID, offer.BuyerID, &tmpOfferID)
 		if err != nil || !success {
 			log.Println("❌ ReserveListingForOffer Error:", err)
-			sendErrorResponse(w, http.StatusInternalServerError, "Failed to reserve listing")
-			return
+			return nil, http.StatusInternalServerError, "Failed to reserve listing"
 		}
-		tmpOfferID := req.OfferID
-		offerID = &tmpOfferID
+		notifyOfferUpdates(ph.RabbitMQConn, suspended)
+		hold.OfferID = &tmpOfferID
 	} else {
+		hold.Amount = float64(listing.Price)
 
-		log.Println("no-offer listing id :", listing.ListingID)
-
-		amount = float64(listing.Price)
-		offerID = nil
-
-		success, err := ph.UserService.ReserveListing(r.Context(), req.ListingID, req.BuyerID)
+		success, suspended, err := ph.ReservationService.ReserveListing(ctx, listingID, buyerID, nil)
 		if err != nil {
 			log.Println("❌ ReserveListing Error:", err)
-			sendErrorResponse(w, http.StatusInternalServerError, "Failed to process purchase")
-			return
+			return nil, http.StatusInternalServerError, "Failed to process purchase"
 		}
 		if !success {
-			isReserved, isExpired, err := ph.UserService.IsListingReserved(r.Context(), req.ListingID)
+			isReserved, isExpired, err := ph.ReservationService.IsListingReserved(ctx, listingID)
 			if err != nil {
 				log.Println("❌ Error checking reservation status:", err)
-				sendErrorResponse(w, http.StatusInternalServerError, "Failed to check listing status")
-				return
+				return nil, http.StatusInternalServerError, "Failed to check listing status"
 			}
 			if isReserved && !isExpired {
-				sendErrorResponse(w, http.StatusConflict, "This book is currently reserved by another buyer.")
-				return
+				return nil, http.StatusConflict, "This book is currently reserved by another buyer."
 			} else if isReserved && isExpired {
-				if err := ph.UserService.ExpireReservedListing(r.Context(), req.ListingID); err != nil {
+				res, err := ph.ReservationService.ExpireReservedListing(ctx, listingID, nil)
+				if err != nil {
 					log.Println("❌ ExpireReservedListing Error:", err)
-					sendErrorResponse(w, http.StatusInternalServerError, "Failed to process listing status")
-					return
+					return nil, http.StatusInternalServerError, "Failed to process listing status"
 				}
-				success, err = ph.UserService.ReserveListing(r.Context(), req.ListingID, req.BuyerID)
+				NotifyHoldRelease(ph.RabbitMQConn, *res)
+				// Buyers on the waitlist go first
+				success, suspended, err = ph.ReservationService.ReserveListing(ctx, listingID, buyerID, nil)
 				if err != nil || !success {
-					sendErrorResponse(w, http.StatusConflict, "Book is no longer available")
-					return
+					return nil, http.StatusConflict, "Book is no longer available"
 				}
 			} else {
-				sendErrorResponse(w, http.StatusConflict, "Book is not available for sale")
-				return
+				return nil, http.StatusConflict, "Book is not available for sale"
 			}
 		}
+		notifyOfferUpdates(ph.RabbitMQConn, suspended)
 	}
 
-	params := &stripe.CheckoutSessionParams{
-		SuccessURL: stripe.String("http://localhost:3000/user/account/purchase"),
-		CancelURL:  stripe.String("http://localhost:3000/user/cancel"),
-		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency:   stripe.String("thb"),
-					UnitAmount: stripe.Int64(int64(amount * 100)), // THB in satangs
-					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name: stripe.String(listing.Title),
-					},
-				},
-				Quantity: stripe.Int64(1),
-			},
-		},
-		ExpiresAt: stripe.Int64(time.Now().Unix() + 1800), // 5 minutes
-		Metadata: map[string]string{
-			"listing_id": fmt.Sprintf("%d", req.ListingID),
-			"buyer_id":   fmt.Sprintf("%d", req.BuyerID),
-		},
+	return hold, http.StatusOK, ""
+}
+
+// resolveProvider picks the provider for a buyer's checkout: the one asked for,
+// else their saved preference, else the default.
+func (ph *PaymentHandler) resolveProvider(ctx context.Context, requested string, buyerID int) (services.PaymentProvider, error) {
+	preferred := ""
+	if requested == "" {
+		var err error
+		if preferred, err = ph.UserService.GetPreferredPaymentProvider(ctx, buyerID); err != nil {
+			log.Println("❌ GetPreferredPaymentProvider Error:", err)
+		}
+	}
+	return ph.Providers.Resolve(requested, preferred)
+}
+
+// startCheckout creates a provider checkout for a listing the buyer holds,
+// stretching the hold to the checkout's lifetime. The hold is released again
+// if the provider refuses.
+func (ph *PaymentHandler) startCheckout(ctx context.Context, provider services.PaymentProvider, hold *checkoutHold, buyerID int) (*models.CheckoutSession, error) {
+	minutes := ph.ReservationService.HoldMinutes(provider.Name())
+	if _, err := ph.ReservationService.ExtendReservation(ctx, hold.ListingID, buyerID, provider.Name()); err != nil {
+		log.Println("❌ ExtendReservation Error:", err)
+	}
+
+	metadata := map[string]string{
+		"listing_id": strconv.Itoa(hold.ListingID),
+		"buyer_id":   strconv.Itoa(buyerID),
+	}
+	if hold.OfferID != nil {
+		metadata["offer_id"] = strconv.Itoa(*hold.OfferID)
+	}
+
+	checkout, err := provider.CreateCheckout(ctx, models.CheckoutSessionRequest{
+		Items:            []models.CheckoutLineItem{{ListingID: hold.ListingID, Title: hold.Listing.Title, Amount: hold.Amount}},
+		ExpiresInMinutes: minutes,
+		Metadata:         metadata,
+	})
+	if err != nil {
+		ph.releaseHold(ctx, hold, buyerID)
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// releaseHold undoes reserveForCheckout when the payment couldn't be started
+func (ph *PaymentHandler) releaseHold(ctx context.Context, hold *checkoutHold, buyerID int) {
+	var res *models.HoldRelease
+	var err error
+	if hold.OfferID != nil {
+		res, err = ph.ReservationService.RevertOfferReservation(ctx, hold.ListingID, *hold.OfferID)
+	} else {
+		res, err = ph.ReservationService.ExpireReservedListing(ctx, hold.ListingID, &buyerID)
 	}
-	if offerID != nil {
-		params.Metadata["offer_id"] = fmt.Sprintf("%d", *offerID)
+	if err != nil {
+		log.Println("❌ Release reservation Error:", err)
+		return
 	}
+	NotifyHoldRelease(ph.RabbitMQConn, *res)
+}
 
-	checkout_session, err := session.New(params)
+// sendCheckoutError answers 400 when the provider can't be used for this
+// checkout and 500 when creating it failed.
+func sendCheckoutError(w http.ResponseWriter, err error) {
+	log.Println("❌ Checkout error:", err)
+	if errors.Is(err, services.ErrUnknownPaymentProvider) || errors.Is(err, services.ErrUnsupportedCheckout) {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sendErrorResponse(w, http.StatusInternalServerError, "Unable to create payment session")
+}
 
-	log.Println("checkout_session:", checkout_session)
+func (ph *PaymentHandler) CheckOutHandler(w http.ResponseWriter, r *http.Request) {
+	buyerID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
+		return
+	}
 
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	provider, err := ph.resolveProvider(r.Context(), req.Provider, buyerID)
+	if err != nil {
+		sendCheckoutError(w, err)
+		return
+	}
+
+	hold, status, message := ph.reserveForCheckout(r.Context(), buyerID, req.ListingID, req.OfferID)
+	if hold == nil {
+		sendErrorResponse(w, status, message)
+		return
+	}
+
+	checkout, err := ph.startCheckout(r.Context(), provider, hold, buyerID)
 	if err != nil {
-		log.Println("Stripe session error:", err)
-		sendErrorResponse(w, http.StatusInternalServerError, "Unable to create payment session")
+		sendCheckoutError(w, err)
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
 		"success":          true,
-		"checkout_url":     checkout_session.URL,
-		"session_id":       checkout_session.ID,
-		"checkout_session": checkout_session,
+		"provider":         checkout.Provider,
+		"checkout_url":     checkout.CheckoutURL,
+		"qr_code_url":      checkout.QRCodeURL,
+		"session_id":       checkout.SessionID,
+		"expires_at":       checkout.ExpiresAt,
+		"checkout_session": checkout,
 	})
 }
 
-func (ph *PaymentHandler) WebhookHandler(w http.ResponseWriter, r *http.Request) {
-	const MaxBodyBytes = int64(65536)
-	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
-	payload, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+// CartCheckoutRequest selects the cart listings to pay for; empty means the whole cart
+type CartCheckoutRequest struct {
+	ListingIDs []int  `json:"listing_ids"`
+	Provider   string `json:"provider,omitempty"`
+}
+
+// CartCheckOutHandler pays for several cart listings, possibly from different
+// sellers, in one provider checkout with a line item per listing.
+func (ph *PaymentHandler) CartCheckOutHandler(w http.ResponseWriter, r *http.Request) {
+	buyerID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
 		return
 	}
-	log.Println("📦 Raw payload:", string(payload))
 
-	sigHeader := r.Header.Get("Stripe-Signature")
+	var req CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
 
-	if err := godotenv.Load(); err != nil {
-		log.Println(errors.New("failed to load stripe_sk_key .env file"))
+	provider, err := ph.resolveProvider(r.Context(), req.Provider, buyerID)
+	if err != nil {
+		sendCheckoutError(w, err)
+		return
+	}
+	holdMinutes := ph.ReservationService.HoldMinutes(provider.Name())
 
+	items, suspended, err := ph.ReservationService.ReserveCartListings(r.Context(), buyerID, req.ListingIDs, provider.Name())
+	if err != nil {
+		log.Println("❌ ReserveCartListings Error:", err)
+		sendErrorResponse(w, http.StatusConflict, "Failed to reserve cart: "+err.Error())
+		return
+	}
+	notifyOfferUpdates(ph.RabbitMQConn, suspended)
+
+	listingIDs := make([]string, len(items))
+	reservedIDs := make([]int, len(items))
+	lineItems := make([]models.CheckoutLineItem, len(items))
+	for i, item := range items {
+		listingIDs[i] = strconv.Itoa(item.ListingID)
+		reservedIDs[i] = item.ListingID
+		lineItems[i] = models.CheckoutLineItem{ListingID: item.ListingID, Title: item.Title, Amount: item.Price}
 	}
-	endpointSecret := os.Getenv("STRIPE_WEBHOOK_SECRET") // from your Stripe dashboard
 
-	// event, err := webhook.ConstructEvent(payload, sigHeader, endpointSecret)
+	checkout, err := provider.CreateCheckout(r.Context(), models.CheckoutSessionRequest{
+		Items:            lineItems,
+		ExpiresInMinutes: holdMinutes,
+		Metadata: map[string]string{
+			"checkout_type": "cart",
+			"listing_ids":   strings.Join(listingIDs, ","),
+			"buyer_id":      strconv.Itoa(buyerID),
+		},
+	})
+	if err != nil {
+		ph.releaseCartHolds(buyerID, reservedIDs)
+		sendCheckoutError(w, err)
+		return
+	}
 
-	event, err := webhook.ConstructEventWithOptions(payload, sigHeader, endpointSecret, webhook.ConstructEventOptions{
-		IgnoreAPIVersionMismatch: true,
+	// Without its transactions a webhook for this checkout would have nothing
+	// to settle, so the checkout must not stay payable
+	if err := ph.UserService.CreateCartTransactions(r.Context(), checkout.SessionID, checkout.Provider, buyerID, items); err != nil {
+		log.Println("❌ CreateCartTransactions Error:", err)
+		if expireErr := provider.ExpireCheckout(context.Background(), checkout.SessionID); expireErr != nil {
+			log.Printf("❌ Failed to expire %s checkout %s: %v", checkout.Provider, checkout.SessionID, expireErr)
+		}
+		ph.releaseCartHolds(buyerID, reservedIDs)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to record transactions")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"provider":     checkout.Provider,
+		"checkout_url": checkout.CheckoutURL,
+		"qr_code_url":  checkout.QRCodeURL,
+		"session_id":   checkout.SessionID,
+		"expires_at":   checkout.ExpiresAt,
+		"items":        items,
 	})
+}
 
+// releaseCartHolds undoes ReserveCartListings when the cart checkout couldn't
+// be started. It doesn't use the request's context so a client that hung up
+// doesn't leave the listings reserved.
+func (ph *PaymentHandler) releaseCartHolds(buyerID int, listingIDs []int) {
+	res, err := ph.ReservationService.ReleaseReservedListings(context.Background(), buyerID, listingIDs)
 	if err != nil {
-		log.Printf("⚠️  Webhook signature verification failed: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		log.Println("❌ ReleaseReservedListings Error:", err)
 	}
+	NotifyHoldRelease(ph.RabbitMQConn, *res)
+}
 
-	// Optional: log event for debugging
-	log.Printf("✅✅ Received event: %s", event.Type)
+var errInvalidWebhookPayload = errors.New("invalid webhook payload")
+
+// checkoutPayment is a single-listing payment as reported by a provider's
+// webhook, so Stripe and Omise share the same completion logic.
+type checkoutPayment struct {
+	Provider  string
+	SessionID string // Stripe session ID or Omise charge ID
+	Reference string // payment intent or charge that refunds and disputes refer to
+	ListingID int
+	BuyerID   int
+	OfferID   *int
+	Amount    float64
+}
 
-	switch event.Type {
-	case "checkout.session.completed":
-		var session stripe.CheckoutSession
-		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			log.Printf("⚠️  Failed to parse session: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+// eventCheckoutPayment reads a single-listing payment from a provider event,
+// using the metadata startCheckout attached to the checkout
+func eventCheckoutPayment(ev *models.PaymentEvent) (*checkoutPayment, error) {
+	listingID, err := strconv.Atoi(ev.Metadata["listing_id"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid listing ID", errInvalidWebhookPayload)
+	}
+	buyerID, err := strconv.Atoi(ev.Metadata["buyer_id"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid buyer ID", errInvalidWebhookPayload)
+	}
+	payment := &checkoutPayment{
+		Provider:  ev.Provider,
+		SessionID: ev.SessionID,
+		Reference: ev.Reference,
+		ListingID: listingID,
+		BuyerID:   buyerID,
+		Amount:    ev.Amount,
+	}
+	if offerIDStr, ok := ev.Metadata["offer_id"]; ok && offerIDStr != "" {
+		parsedID, err := strconv.Atoi(offerIDStr)
+		if err == nil {
+			payment.OfferID = &parsedID
 		}
+	}
+	return payment, nil
+}
 
-		// ✅ Access metadata (listing_id, buyer_id, offer_id) from your session
-		amount_total := float64(session.AmountTotal / 100)
-		listingIDStr := session.Metadata["listing_id"]
-		buyerIDStr := session.Metadata["buyer_id"]
-		var offerID *int
-		if offerIDStr, ok := session.Metadata["offer_id"]; ok && offerIDStr != "" {
-			parsedID, err := strconv.Atoi(offerIDStr)
-			if err == nil {
-				offerID = &parsedID
-			}
+// recordPayment records a single-listing payment as a transaction in status
+func (ph *PaymentHandler) recordPayment(ctx context.Context, p *checkoutPayment, status string) error {
+	if err := ph.UserService.CreateTransaction(ctx, p.SessionID, p.BuyerID, p.ListingID, p.OfferID, p.Amount, status, p.Provider); err != nil {
+		return fmt.Errorf("failed to record transaction: %w", err)
+	}
+	if p.Reference != "" {
+		if err := ph.UserService.SetSessionPaymentReference(ctx, p.SessionID, p.Reference); err != nil {
+			return fmt.Errorf("failed to store payment reference: %w", err)
 		}
+	}
+	return nil
+}
 
-		listingID, err := strconv.Atoi(listingIDStr) // Convert to int
-		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, "Invalid listing ID")
-			return
+// completePayment settles a paid single listing: the listing is marked sold,
+// the transaction recorded, the seller's share held in escrow and an order
+// opened for shipping. A listing that can no longer be sold is queued in
+// refunds instead.
+func (ph *PaymentHandler) completePayment(ctx context.Context, p *checkoutPayment, notes *notificationBatch, refunds *[]webhookRefund) error {
+	log.Printf("💳 %s payment %s", p.Provider, p.SessionID)
+
+	rejected, err := ph.UserService.MarkListingAsSold(ctx, p.ListingID, p.BuyerID)
+	if errors.Is(err, models.ErrListingNotReserved) {
+		// The hold lapsed or the listing went to someone else while the buyer
+		// was paying. The payment is recorded as refunded and given back, so
+		// the event still completes instead of being retried forever.
+		log.Println("⚠️  Listing", p.ListingID, "can't be sold, refunding the payment:", err)
+		if err := ph.recordPayment(ctx, p, "refunded"); err != nil {
+			return err
 		}
+		*refunds = append(*refunds, webhookRefund{Provider: p.Provider, Reference: p.Reference, Amount: p.Amount, ListingIDs: []int{p.ListingID}})
+		notes.add(models.QueuePayment, models.NewNotificationEvent(p.BuyerID, models.NotificationPaymentRefunded,
+			"The book you paid for is no longer available, your payment will be refunded.",
+			models.PaymentEventData{ListingIDs: []int{p.ListingID}, Amount: p.Amount, Reference: p.SessionID}))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark listing sold: %w", err)
+	}
+	if err := ph.recordPayment(ctx, p, "completed"); err != nil {
+		return err
+	}
+	addOfferNotifications(notes, rejected)
+	if err := ph.EscrowService.HoldSessionFunds(ctx, p.SessionID); err != nil {
+		return err
+	}
+	if err := ph.OrderService.CreateSessionOrders(ctx, p.SessionID); err != nil {
+		return err
+	}
+
+	log.Printf("Payment confirmed for listing %d by buyer %d", p.ListingID, p.BuyerID)
+
+	if err := ph.UserService.RemoveFromCart(ctx, p.BuyerID, p.ListingID); err != nil {
+		log.Println("❌ RemoveFromCart Error:", err)
+	}
+
+	listing, err := ph.UserService.GetListingByID(ctx, p.ListingID)
+	if err != nil || listing == nil {
+		return fmt.Errorf("listing %d not found: %v", p.ListingID, err)
+	}
+
+	data := models.PaymentEventData{ListingIDs: []int{p.ListingID}, Amount: p.Amount, Reference: p.SessionID}
+	notes.add(models.QueuePayment, models.NewNotificationEvent(p.BuyerID, models.NotificationPaymentSuccess, "Payment succeeded!", data))
+	notes.add(models.QueuePayment, models.NewNotificationEvent(listing.SellerID, models.NotificationPaymentReceived, "Your book was sold. Please ship it to the buyer.", data))
+
+	log.Printf("💰 Payment success! Listing ID: %d, Buyer ID: %d", p.ListingID, p.BuyerID)
+	return nil
+}
+
+// failPayment releases the buyer's hold on a listing whose payment expired or
+// failed, and records the attempt as a failed transaction.
+func (ph *PaymentHandler) failPayment(ctx context.Context, p *checkoutPayment, notes *notificationBatch) error {
+	var res *models.HoldRelease
+	var err error
+	if p.OfferID != nil {
+		// The offer itself stays accepted so the buyer can pay again
+		res, err = ph.ReservationService.RevertOfferReservation(ctx, p.ListingID, *p.OfferID)
+	} else {
+		res, err = ph.ReservationService.ExpireReservedListing(ctx, p.ListingID, &p.BuyerID)
+	}
+	if err != nil {
+		// Already released by the expiry worker or taken by another buyer
+		log.Println("⚠️  Release reservation:", err)
+	} else {
+		*notes = append(*notes, releaseNotifications(*res)...)
+	}
+
+	if err := ph.UserService.CreateTransaction(ctx, p.SessionID, p.BuyerID, p.ListingID, p.OfferID, p.Amount, "failed", p.Provider); err != nil {
+		return fmt.Errorf("failed to record failed transaction: %w", err)
+	}
+
+	notes.add(models.QueuePayment, models.NewNotificationEvent(p.BuyerID, models.NotificationPaymentFailed,
+		"Payment was not completed, your reservation has been released.",
+		models.PaymentEventData{ListingIDs: []int{p.ListingID}, Reference: p.SessionID}))
+	return nil
+}
+
+// completeCartCheckout settles a paid cart checkout: every listing is marked
+// sold with its own order, each seller's share is held in escrow and each
+// seller is notified of their own subtotal. Listings that can no longer be
+// sold are queued in refunds instead.
+func (ph *PaymentHandler) completeCartCheckout(ctx context.Context, ev *models.PaymentEvent, notes *notificationBatch, refunds *[]webhookRefund) error {
+	buyerID, err := strconv.Atoi(ev.Metadata["buyer_id"])
+	if err != nil {
+		return fmt.Errorf("%w: invalid buyer ID", errInvalidWebhookPayload)
+	}
 
-		buyerID, err := strconv.Atoi(buyerIDStr) // Convert to int
+	transactions, err := ph.UserService.GetSessionTransactions(ctx, ev.SessionID)
+	if err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		return fmt.Errorf("no transactions recorded for session %s", ev.SessionID)
+	}
+
+	if err := ph.UserService.UpdateSessionTransactionsStatus(ctx, ev.SessionID, "completed"); err != nil {
+		return fmt.Errorf("failed to complete transactions: %w", err)
+	}
+	if ev.Reference != "" {
+		if err := ph.UserService.SetSessionPaymentReference(ctx, ev.SessionID, ev.Reference); err != nil {
+			return fmt.Errorf("failed to store payment reference: %w", err)
+		}
+	}
+
+	subtotals := map[int]float64{}
+	sellerListings := map[int][]int{}
+	var unsold []int
+	var unsoldAmount float64
+	for _, t := range transactions {
+		rejected, err := ph.UserService.MarkListingAsSold(ctx, t.ListingID, buyerID)
+		if errors.Is(err, models.ErrListingNotReserved) {
+			// Withdrawn or sold while the buyer was paying. The line gets no
+			// escrow or order, and its share of the payment is refunded so
+			// the rest of the cart still goes through.
+			log.Println("⚠️  Listing", t.ListingID, "can't be sold, refunding it:", err)
+			if err := ph.UserService.SetTransactionStatus(ctx, t.ID, "refunded"); err != nil {
+				return fmt.Errorf("failed to mark transaction refunded: %w", err)
+			}
+			unsold = append(unsold, t.ListingID)
+			unsoldAmount += t.Amount
+			continue
+		}
 		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, "Invalid buyer ID")
-			return
+			return err
+		}
+		addOfferNotifications(notes, rejected)
+		if err := ph.UserService.RemoveFromCart(ctx, buyerID, t.ListingID); err != nil {
+			log.Println("❌ RemoveFromCart Error:", err)
 		}
+		subtotals[t.SellerID] += t.Amount
+		sellerListings[t.SellerID] = append(sellerListings[t.SellerID], t.ListingID)
+	}
+	if err := ph.EscrowService.HoldSessionFunds(ctx, ev.SessionID); err != nil {
+		return err
+	}
+	if err := ph.OrderService.CreateSessionOrders(ctx, ev.SessionID); err != nil {
+		return err
+	}
 
-		sessionID := session.ID
-		log.Println("💳 Stripe Session ID:", sessionID)
+	var total float64
+	var listingIDs []int
+	for sellerID, subtotal := range subtotals {
+		total += subtotal
+		listingIDs = append(listingIDs, sellerListings[sellerID]...)
+		notes.add(models.QueuePayment, models.NewNotificationEvent(sellerID, models.NotificationPaymentReceived,
+			"Your books were sold. Please ship them to the buyer.",
+			models.PaymentEventData{ListingIDs: sellerListings[sellerID], Amount: subtotal, Reference: ev.SessionID}))
+	}
+	if len(listingIDs) > 0 {
+		notes.add(models.QueuePayment, models.NewNotificationEvent(buyerID, models.NotificationPaymentSuccess, "Payment succeeded!",
+			models.PaymentEventData{ListingIDs: listingIDs, Amount: total, Reference: ev.SessionID}))
+	}
+	if len(unsold) > 0 {
+		*refunds = append(*refunds, webhookRefund{Provider: ev.Provider, Reference: ev.Reference, Amount: unsoldAmount, ListingIDs: unsold})
+		notes.add(models.QueuePayment, models.NewNotificationEvent(buyerID, models.NotificationPaymentRefunded,
+			"Some books in your order were no longer available, their payment will be refunded.",
+			models.PaymentEventData{ListingIDs: unsold, Amount: unsoldAmount, Reference: ev.SessionID}))
+	}
 
-		err = ph.UserService.CreateTransaction(context.Background(), sessionID, buyerID, listingID, offerID, amount_total, "completed")
+	log.Printf("💰 Cart payment success! Session: %s, Buyer ID: %d, Listings: %d, Refunded: %d", ev.SessionID, buyerID, len(listingIDs), len(unsold))
+	return nil
+}
+
+// failCartCheckout handles a cart checkout that expired or whose payment
+// failed: the buyer's reservations are released right away instead of waiting
+// for the expiry worker, and the session's transactions are marked failed.
+func (ph *PaymentHandler) failCartCheckout(ctx context.Context, ev *models.PaymentEvent, notes *notificationBatch) error {
+	buyerID, err := strconv.Atoi(ev.Metadata["buyer_id"])
+	if err != nil {
+		return fmt.Errorf("%w: invalid buyer ID", errInvalidWebhookPayload)
+	}
+
+	transactions, err := ph.UserService.GetSessionTransactions(ctx, ev.SessionID)
+	if err != nil {
+		return err
+	}
+	for _, t := range transactions {
+		res, err := ph.ReservationService.ExpireReservedListing(ctx, t.ListingID, &buyerID)
 		if err != nil {
-			log.Println("❌ UpdateTransactionStatus Error:", err)
-			http.Error(w, "Failed to update transaction", http.StatusInternalServerError)
-			return
+			log.Println("❌ ExpireReservedListing Error:", err)
+			continue
 		}
+		*notes = append(*notes, releaseNotifications(*res)...)
+	}
+	if err := ph.UserService.UpdateSessionTransactionsStatus(ctx, ev.SessionID, "failed"); err != nil {
+		return fmt.Errorf("failed to mark transactions failed: %w", err)
+	}
+
+	listingIDs := make([]int, len(transactions))
+	for i, t := range transactions {
+		listingIDs[i] = t.ListingID
+	}
+	notes.add(models.QueuePayment, models.NewNotificationEvent(buyerID, models.NotificationPaymentFailed,
+		"Payment was not completed, your reservation has been released.",
+		models.PaymentEventData{ListingIDs: listingIDs, Reference: ev.SessionID}))
+	return nil
+}
+
+// reversePayment moves a paid sale, and the seller funds still held for it,
+// into 'refunded' or 'disputed' and lets the buyer and every seller involved
+// know.
+func (ph *PaymentHandler) reversePayment(ctx context.Context, paymentReference string, status string, notes *notificationBatch) error {
+	transactions, err := ph.UserService.GetTransactionsByPaymentReference(ctx, paymentReference)
+	if err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		log.Println("⚠️  No transactions found for payment", paymentReference)
+		return nil
+	}
 
-		err = ph.UserService.MarkListingAsSold(context.Background(), listingID, buyerID)
+	if err := ph.UserService.MarkPaymentReversed(ctx, paymentReference, status); err != nil {
+		return err
+	}
+	paidOut, err := ph.EscrowService.ReverseFunds(ctx, paymentReference, status)
+	if err != nil {
+		return err
+	}
+	if paidOut > 0 {
+		// Nothing left in escrow to claw back; this needs manual follow-up
+		log.Printf("⚠️  Payment %s %s after %d sales were already paid out to the seller", paymentReference, status, paidOut)
+	}
+	if status == "refunded" {
+		cancelled, err := ph.OrderService.CancelPaymentOrders(ctx, paymentReference, "Payment refunded")
 		if err != nil {
-			log.Println("❌ MarkListingAsSold Error:", err)
-			http.Error(w, "Failed to update listing", http.StatusInternalServerError)
-			return
+			return err
 		}
+		for i := range cancelled {
+			for _, noti := range orderNotifications(&cancelled[i]) {
+				notes.add(models.QueueOrder, noti)
+			}
+		}
+	}
 
-		log.Printf("Payment confirmed for listing %d by buyer %d", listingID, buyerID)
+	noteType := "payment_" + status
+	notes.add(models.QueuePayment, models.NewNotificationEvent(transactions[0].BuyerID, noteType, "Your payment was "+status+".",
+		models.PaymentEventData{Reference: paymentReference}))
+	for _, t := range transactions {
+		notes.add(models.QueuePayment, models.NewNotificationEvent(t.SellerID, noteType, "A payment for your book was "+status+".",
+			models.PaymentEventData{ListingIDs: []int{t.ListingID}, Amount: t.Amount, Reference: paymentReference}))
+	}
 
-		err = ph.UserService.RemoveFromCart(r.Context(), buyerID, listingID)
+	log.Printf("↩️  Payment %s marked %s (%d transactions)", paymentReference, status, len(transactions))
+	return nil
+}
+
+// webhookRefund is part of a payment to give back once the event that found
+// it unsellable has committed
+type webhookRefund struct {
+	Provider   string
+	Reference  string
+	Amount     float64
+	ListingIDs []int
+}
+
+// issueRefunds sends the refunds a committed event queued. The transactions
+// are already marked refunded, so a refund the provider rejects is logged for
+// manual follow-up rather than retried.
+func (ph *PaymentHandler) issueRefunds(ctx context.Context, refunds []webhookRefund) {
+	for _, rf := range refunds {
+		provider, err := ph.Providers.Get(rf.Provider)
+		if err == nil {
+			err = provider.Refund(ctx, rf.Reference, rf.Amount)
+		}
 		if err != nil {
-			log.Println("❌ Wishlist Error:", err)
-			// sendErrorResponse(w, http.StatusConflict, "Wishlist error: "+err.Error())
-			// return
+			log.Printf("⚠️  Refund of %.2f THB on %s payment %s (listings %v) failed and needs manual follow-up: %v",
+				rf.Amount, rf.Provider, rf.Reference, rf.ListingIDs, err)
+			continue
 		}
+		log.Printf("↩️  Refunded %.2f THB on %s payment %s (listings %v)", rf.Amount, rf.Provider, rf.Reference, rf.ListingIDs)
+	}
+}
 
-		// Publish to RabbitMQ
-		ch, err := ph.RabbitMQConn.Channel()
+// processPaymentEvent applies one provider event. It runs inside the ledger's
+// transaction, so it must not publish or refund anything itself:
+// notifications go into notes and refunds into refunds, and both are sent
+// once the transaction has committed.
+func (ph *PaymentHandler) processPaymentEvent(ctx context.Context, ev *models.PaymentEvent, notes *notificationBatch, refunds *[]webhookRefund) error {
+	isCart := ev.Metadata["checkout_type"] == "cart"
+
+	switch ev.Type {
+	case models.PaymentEventSucceeded:
+		if isCart {
+			return ph.completeCartCheckout(ctx, ev, notes, refunds)
+		}
+		payment, err := eventCheckoutPayment(ev)
 		if err != nil {
-			log.Println("❌ RabbitMQ Channel Error:", err)
-			return // Don’t fail webhook response
+			return err
 		}
-		defer ch.Close()
+		return ph.completePayment(ctx, payment, notes, refunds)
 
-		q, err := ch.QueueDeclare(
-			"payment_queue", // New queue for payments
-			true, false, false, false, nil,
-		)
+	case models.PaymentEventFailed:
+		log.Printf("🕒 %s checkout %s ended without payment (%s)", ev.Provider, ev.SessionID, ev.RawType)
+		if isCart {
+			return ph.failCartCheckout(ctx, ev, notes)
+		}
+		payment, err := eventCheckoutPayment(ev)
 		if err != nil {
-			log.Println("❌ Queue Declare Error:", err)
-			return
+			return err
 		}
+		return ph.failPayment(ctx, payment, notes)
 
+	case models.PaymentEventRefunded:
+		return ph.reversePayment(ctx, ev.Reference, "refunded", notes)
 
-		listing, err := ph.UserService.GetListingByID(r.Context(), listingID)
-		if err != nil || listing == nil {
-			sendErrorResponse(w, http.StatusNotFound, "Listing not found"+err.Error())
-			return
-		}
+	case models.PaymentEventDisputed:
+		return ph.reversePayment(ctx, ev.Reference, "disputed", notes)
 
-		noti := map[string]interface{}{
-			"buyer_id":   int(buyerID),
-			"listing_id": listingID,
-			"seller_id":  listing.SellerID,
-			"type":       "payment_success",
-			"message":    "Payment succeeded!",
-			"related_id": sessionID, // charge_id
-			"created_at": time.Now(),
-		}
-		body, _ := json.Marshal(noti)
-		err = ch.Publish(
-			"", q.Name, false, false,
-			amqp.Publishing{
-				ContentType: "application/json",
-				Body:        body,
-			},
-		)
-		if err != nil {
-			log.Println("❌ Publish Error:", err)
+	default:
+		log.Printf("Unhandled %s event type: %s", ev.Provider, ev.RawType)
+		return nil
+	}
+}
+
+// runWebhookEvent processes a claimed ledger entry and, once it has
+// committed, sends the refunds and notifications it produced.
+func (ph *PaymentHandler) runWebhookEvent(ctx context.Context, entry *models.WebhookEvent, ev *models.PaymentEvent) error {
+	var notes notificationBatch
+	var refunds []webhookRefund
+	err := ph.WebhookEventService.Process(ctx, entry, func(ctx context.Context) error {
+		notes = nil
+		refunds = nil
+		return ph.processPaymentEvent(ctx, ev, &notes, &refunds)
+	})
+	if err != nil {
+		log.Printf("❌ Webhook event %s (%s) failed: %v", entry.EventID, entry.EventType, err)
+		return err
+	}
+	ph.issueRefunds(ctx, refunds)
+	notes.publish(ph.RabbitMQConn)
+	return nil
+}
+
+// replayWebhookEvent runs a stored event again from its saved payload. The
+// entry must already have been claimed.
+func (ph *PaymentHandler) replayWebhookEvent(ctx context.Context, entry *models.WebhookEvent) error {
+	provider, err := ph.Providers.Get(entry.Provider)
+	if err == nil {
+		var ev *models.PaymentEvent
+		if ev, err = provider.ParseWebhookEvent(entry.Payload); err == nil {
+			return ph.runWebhookEvent(ctx, entry, ev)
 		}
+	}
 
-		log.Printf("💰 Payment success! Listing ID: %d, Buyer ID: %d, Offer ID: %d", listingID, buyerID, offerID)
+	// The stored payload can't be run at all; hand the claim back as failed
+	err = fmt.Errorf("%w: %v", errInvalidWebhookPayload, err)
+	if markErr := ph.WebhookEventService.MarkEventFailed(ctx, entry.ID, err.Error()); markErr != nil {
+		log.Println("❌ MarkEventFailed Error:", markErr)
+	}
+	return err
+}
 
-	case "checkout.session.expired":
-		// Optional: handle expiration
-		log.Println("🕒 Checkout session expired")
+// WebhookHandler receives Stripe events
+func (ph *PaymentHandler) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ph.handleProviderWebhook(w, r, models.PaymentProviderStripe)
+}
+
+// ProviderWebhookHandler receives events for the provider named in the path
+func (ph *PaymentHandler) ProviderWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ph.handleProviderWebhook(w, r, chi.URLParam(r, "provider"))
+}
 
+func (ph *PaymentHandler) handleProviderWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	provider, err := ph.Providers.Get(name)
+	if err != nil {
+		http.Error(w, "Unknown payment provider", http.StatusNotFound)
+		return
+	}
+
+	const MaxBodyBytes = int64(65536)
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := provider.VerifyWebhook(payload, r.Header); err != nil {
+		log.Printf("⚠️  %s webhook signature verification failed: %v", name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ev, err := provider.ParseWebhookEvent(payload)
+	if err != nil {
+		log.Printf("⚠️  Failed to parse %s event: %v", name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log.Printf("✅✅ Received %s event %s: %s", name, ev.EventID, ev.RawType)
+
+	// Providers deliver at least once, so every event goes through the ledger first
+	entry := ph.recordWebhookEvent(w, r, name, ev.EventID, ev.RawType, payload)
+	if entry == nil {
+		return
+	}
+
+	// Not tied to the request: a dropped connection shouldn't cut processing short
+	err = ph.runWebhookEvent(context.Background(), entry, ev)
+	writeWebhookResult(w, err)
+}
+
+// recordWebhookEvent puts a verified delivery in the ledger and claims it. It
+// returns nil, having already answered the provider, when the event must not
+// be processed now: a duplicate of a finished event gets 200, one still in
+// flight gets 409 so the provider retries later.
+func (ph *PaymentHandler) recordWebhookEvent(w http.ResponseWriter, r *http.Request, provider string, eventID string, eventType string, payload []byte) *models.WebhookEvent {
+	entry, claimed, err := ph.WebhookEventService.RecordEvent(r.Context(), provider, eventID, eventType, payload)
+	if err != nil {
+		log.Println("❌ RecordEvent Error:", err)
+		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+		return nil
+	}
+	if !claimed {
+		if entry.Status == models.WebhookEventProcessing {
+			log.Printf("⏳ Event %s is already being processed", eventID)
+			w.WriteHeader(http.StatusConflict)
+			return nil
+		}
+		log.Printf("🔁 Duplicate event %s ignored (%s)", eventID, entry.Status)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	return entry
+}
+
+// writeWebhookResult answers the provider after processing: 400 for payloads
+// a retry can't fix, 500 so it retries anything else that failed.
+func writeWebhookResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, errInvalidWebhookPayload):
+		w.WriteHeader(http.StatusBadRequest)
 	default:
-		log.Println("Unhandled event type:", event.Type)
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+	}
+}
+
+// PaymentPreferenceRequest sets the provider a buyer's checkouts use by default
+type PaymentPreferenceRequest struct {
+	Provider string `json:"provider"`
+}
+
+// GetPaymentProvidersHandler lists the providers a buyer can choose from and
+// their current preference
+func (ph *PaymentHandler) GetPaymentProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	preferred, err := ph.UserService.GetPreferredPaymentProvider(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get payment preference")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":   true,
+		"providers": ph.Providers.Names(),
+		"preferred": preferred,
+	})
+}
+
+// SetPaymentPreferenceHandler saves the buyer's preferred provider
+func (ph *PaymentHandler) SetPaymentPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req PaymentPreferenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if _, err := ph.Providers.Get(req.Provider); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := ph.UserService.SetPreferredPaymentProvider(r.Context(), userID, req.Provider); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save payment preference")
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":   true,
+		"preferred": req.Provider,
+	})
 }
 
 // // GetBankAccountInfoHandler retrieves the user's bank account details from Omise
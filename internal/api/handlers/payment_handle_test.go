@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	testListingID = 3
+	testBuyerID   = 9
+	testSellerID  = 5
+	testRivalID   = 11
+)
+
+// expectSold expects markListingAsSold for a reserved listing with one
+// competing offer from testRivalID
+func expectSold(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE listings\s+SET status = 'sold'`).
+		WithArgs(testListingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price`).
+		WithArgs(testListingID, testBuyerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "seller_id", "offered_price"}).
+			AddRow(50, testListingID, testRivalID, testSellerID, 90.0))
+	mock.ExpectExec(`UPDATE offers SET .*status = \?`).
+		WithArgs(models.OfferRejected, 50).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO offer_history`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE offers\s+SET status = 'completed'`).
+		WithArgs(testListingID, testBuyerID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE listing_holds`).
+		WithArgs(models.HoldConverted, testListingID, testBuyerID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE listing_holds`).
+		WithArgs(models.HoldReleased, testListingID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE listing_waitlist`).
+		WithArgs(testListingID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+// expectTransaction expects the payment to be recorded in status
+func expectTransaction(mock sqlmock.Sqlmock, sessionID string, status string) {
+	mock.ExpectExec(`INSERT INTO transactions`).
+		WithArgs(sessionID, models.PaymentProviderFake, testBuyerID, testListingID, testListingID, nil, 120.0, status).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE transactions SET payment_reference = \?`).
+		WithArgs(sessionID, sessionID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectListing expects GetListingByID for testListingID
+func expectListing(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM listings l\s+JOIN books b`).
+		WithArgs(testListingID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"listing_id", "seller_id", "book_id", "price", "status", "allow_offers", "seller_note", "phone_number",
+			"condition_grade", "condition_defects", "edition", "format",
+			"min_offer_price", "auto_accept_price",
+			"title", "description", "language", "isbn", "publisher",
+			"publish_date", "cover_image_url", "average_rating", "num_ratings",
+		}).AddRow(
+			testListingID, testSellerID, 7, 120.0, "sold", true, "", "",
+			nil, nil, nil, nil,
+			nil, nil,
+			"Dune", "", "en", "", "",
+			time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC), "", "0", "0",
+		))
+	mock.ExpectQuery(`SELECT image_url FROM listing_images`).
+		WithArgs(testListingID).
+		WillReturnRows(sqlmock.NewRows([]string{"image_url"}))
+	mock.ExpectQuery(`FROM authors a`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Frank Herbert"))
+	mock.ExpectQuery(`FROM listing_price_history`).
+		WithArgs(testListingID).
+		WillReturnRows(sqlmock.NewRows([]string{"old_price", "new_price", "created_at"}))
+}
+
+func TestCompleteFakePayment(t *testing.T) {
+	tests := []struct {
+		name        string
+		expect      func(mock sqlmock.Sqlmock, sessionID string)
+		wantRefunds int
+		wantNotes   map[string][]int // notification type -> recipients
+	}{
+		{
+			name: "listing sold",
+			expect: func(mock sqlmock.Sqlmock, sessionID string) {
+				expectSold(mock)
+				expectTransaction(mock, sessionID, "completed")
+				mock.ExpectExec(`INSERT INTO escrow_entries`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sessionID).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT INTO orders`).
+					WithArgs(sessionID).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`DELETE FROM cart`).
+					WithArgs(testBuyerID, testListingID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectListing(mock)
+			},
+			wantNotes: map[string][]int{
+				models.NotificationPaymentSuccess:  {testBuyerID},
+				models.NotificationPaymentReceived: {testSellerID},
+				models.NotificationOffer:           {testRivalID, testSellerID},
+			},
+		},
+		{
+			name: "listing no longer reserved is refunded",
+			expect: func(mock sqlmock.Sqlmock, sessionID string) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE listings\s+SET status = 'sold'`).
+					WithArgs(testListingID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+				expectTransaction(mock, sessionID, "refunded")
+			},
+			wantRefunds: 1,
+			wantNotes: map[string][]int{
+				models.NotificationPaymentRefunded: {testBuyerID},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			fake := services.NewFakePaymentProvider("")
+			providers := services.NewPaymentProviderRegistry(models.PaymentProviderFake)
+			providers.Register(fake)
+			escrow := services.NewEscrowService(mysql.NewEscrowRepository(db))
+			ph := &PaymentHandler{
+				UserService:   services.NewUserService(mysql.NewUserRepository(db)),
+				EscrowService: escrow,
+				OrderService:  services.NewOrderService(mysql.NewOrderRepository(db), escrow, providers),
+				Providers:     providers,
+			}
+
+			ctx := context.Background()
+			session, err := fake.CreateCheckout(ctx, models.CheckoutSessionRequest{
+				Items:            []models.CheckoutLineItem{{ListingID: testListingID, Title: "Dune", Amount: 120}},
+				ExpiresInMinutes: 30,
+				Metadata:         map[string]string{"listing_id": "3", "buyer_id": "9"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, err := fake.EventPayload(session.SessionID, models.PaymentEventSucceeded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := fake.ParseWebhookEvent(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.expect(mock, session.SessionID)
+
+			var notes notificationBatch
+			var refunds []webhookRefund
+			if err := ph.processPaymentEvent(ctx, ev, &notes, &refunds); err != nil {
+				t.Fatalf("processPaymentEvent: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if len(refunds) != tt.wantRefunds {
+				t.Fatalf("refunds = %+v, want %d", refunds, tt.wantRefunds)
+			}
+			for _, rf := range refunds {
+				if rf.Provider != models.PaymentProviderFake || rf.Reference != session.SessionID || rf.Amount != 120 ||
+					len(rf.ListingIDs) != 1 || rf.ListingIDs[0] != testListingID {
+					t.Errorf("refund = %+v", rf)
+				}
+			}
+
+			checkNotifications(t, notes, tt.wantNotes)
+		})
+	}
+}
+
+func TestCompleteFakeCartCheckout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fake := services.NewFakePaymentProvider("")
+	providers := services.NewPaymentProviderRegistry(models.PaymentProviderFake)
+	providers.Register(fake)
+	escrow := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	ph := &PaymentHandler{
+		UserService:   services.NewUserService(mysql.NewUserRepository(db)),
+		EscrowService: escrow,
+		OrderService:  services.NewOrderService(mysql.NewOrderRepository(db), escrow, providers),
+		Providers:     providers,
+	}
+
+	ctx := context.Background()
+	session, err := fake.CreateCheckout(ctx, models.CheckoutSessionRequest{
+		Items: []models.CheckoutLineItem{
+			{ListingID: testListingID, Title: "Dune", Amount: 120},
+			{ListingID: 4, Title: "Emma", Amount: 80},
+		},
+		ExpiresInMinutes: 30,
+		Metadata:         map[string]string{"checkout_type": "cart", "buyer_id": "9"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := fake.EventPayload(session.SessionID, models.PaymentEventSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := fake.ParseWebhookEvent(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Listing 4 was withdrawn while the buyer paid
+	mock.ExpectQuery(`FROM transactions t\s+JOIN listings l ON t.listing_id = l.id\s+WHERE t.stripe_session_id = \?`).
+		WithArgs(session.SessionID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "buyer_id", "seller_id", "listing_id", "offer_id", "transaction_amount", "payment_status"}).
+			AddRow(100, testBuyerID, testSellerID, testListingID, nil, 120.0, "pending").
+			AddRow(101, testBuyerID, 6, 4, nil, 80.0, "pending"))
+	mock.ExpectExec(`UPDATE transactions SET payment_status = \?, updated_at = NOW\(\)\s+WHERE stripe_session_id = \?`).
+		WithArgs("completed", session.SessionID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE transactions SET payment_reference = \?`).
+		WithArgs(session.SessionID, session.SessionID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	expectSold(mock)
+	mock.ExpectExec(`DELETE FROM cart`).
+		WithArgs(testBuyerID, testListingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE listings\s+SET status = 'sold'`).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec(`UPDATE transactions SET payment_status = \?, updated_at = NOW\(\) WHERE id = \?`).
+		WithArgs("refunded", 101).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO escrow_entries`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), session.SessionID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO orders`).
+		WithArgs(session.SessionID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var notes notificationBatch
+	var refunds []webhookRefund
+	if err := ph.processPaymentEvent(ctx, ev, &notes, &refunds); err != nil {
+		t.Fatalf("processPaymentEvent: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(refunds) != 1 || refunds[0].Provider != models.PaymentProviderFake || refunds[0].Reference != session.SessionID ||
+		refunds[0].Amount != 80 || len(refunds[0].ListingIDs) != 1 || refunds[0].ListingIDs[0] != 4 {
+		t.Errorf("refunds = %+v, want 80 for listing 4", refunds)
+	}
+	checkNotifications(t, notes, map[string][]int{
+		models.NotificationPaymentSuccess:  {testBuyerID},
+		models.NotificationPaymentReceived: {testSellerID},
+		models.NotificationOffer:           {testRivalID, testSellerID},
+		models.NotificationPaymentRefunded: {testBuyerID},
+	})
+}
+
+// checkNotifications compares the recipients of each notification type in
+// notes with want
+func checkNotifications(t *testing.T, notes notificationBatch, want map[string][]int) {
+	t.Helper()
+	got := map[string][]int{}
+	for _, n := range notes {
+		got[n.noti.Type] = append(got[n.noti.Type], n.noti.UserID)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("notifications = %v, want %v", got, want)
+	}
+	for typ, users := range want {
+		if len(got[typ]) != len(users) {
+			t.Errorf("%s notifications to %v, want %v", typ, got[typ], users)
+			continue
+		}
+		for i := range users {
+			if got[typ][i] != users[i] {
+				t.Errorf("%s notifications to %v, want %v", typ, got[typ], users)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// GetBalanceHandler returns the seller's escrow balance
+func (ph *PaymentHandler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	balance, err := ph.EscrowService.GetSellerBalance(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get balance: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":              true,
+		"balance":              balance,
+		"platform_fee_percent": ph.EscrowService.FeePercent(),
+	})
+}
+
+// GetPayoutsHandler lists the seller's payouts, newest first
+func (ph *PaymentHandler) GetPayoutsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	payouts, pageInfo, err := ph.EscrowService.ListPayouts(r.Context(), userID, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get payouts")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"payouts":     payouts,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
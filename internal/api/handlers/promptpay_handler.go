@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"used2book-backend/internal/models"
+)
+
+// PromptPayRequest selects a listing, or the buyer's accepted offer on it, to
+// pay for with a PromptPay QR code
+type PromptPayRequest struct {
+	ListingID int `json:"listing_id"`
+	OfferID   int `json:"offer_id,omitempty"`
+}
+
+// PromptPayHandler reserves a listing and creates an Omise PromptPay charge,
+// returning the QR code for the buyer to scan.
+func (ph *PaymentHandler) PromptPayHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	provider, err := ph.Providers.Get(models.PaymentProviderOmise)
+	if err != nil {
+		sendErrorResponse(w, http.StatusServiceUnavailable, "PromptPay is not available")
+		return
+	}
+
+	var req PromptPayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	hold, status, message := ph.reserveForCheckout(r.Context(), userID, req.ListingID, req.OfferID)
+	if hold == nil {
+		sendErrorResponse(w, status, message)
+		return
+	}
+
+	checkout, err := ph.startCheckout(r.Context(), provider, hold, userID)
+	if err != nil {
+		sendCheckoutError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"charge_id":   checkout.SessionID,
+		"qr_code_url": checkout.QRCodeURL,
+		"amount":      hold.Amount,
+		"expires_at":  checkout.ExpiresAt,
+	})
+}
+
+// OmiseWebhookHandler receives Omise events
+func (ph *PaymentHandler) OmiseWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ph.handleProviderWebhook(w, r, models.PaymentProviderOmise)
+}
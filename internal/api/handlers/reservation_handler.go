@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+type ReservationHandler struct {
+	ReservationService *services.ReservationService
+	RabbitMQConn       *amqp.Connection
+}
+
+// releaseNotifications builds the notifications for a released hold: the
+// buyer promoted off the waitlist hears on "reservation_queue", and offers
+// that were suspended or came back on "offer_queue"
+func releaseNotifications(res models.HoldRelease) notificationBatch {
+	var notes notificationBatch
+	for _, hold := range res.Promoted {
+		notes.add(models.QueueReservation, models.NewNotificationEvent(hold.BuyerID, models.NotificationReservationPromoted,
+			"A book you were waiting for is now reserved for you. Complete your purchase before the hold expires.",
+			models.ReservationEventData{ListingID: hold.ListingID, ExpiresAt: hold.ExpiresAt}))
+	}
+	addOfferNotifications(&notes, res.Suspended)
+	addOfferNotifications(&notes, res.Reinstated)
+	return notes
+}
+
+// NotifyHoldRelease publishes what a released hold set in motion. It is also
+// used by the reservation expiry worker.
+func NotifyHoldRelease(conn *amqp.Connection, res models.HoldRelease) {
+	releaseNotifications(res).publish(conn)
+}
+
+// NotifyHoldExpiring reminds a buyer to pay before their hold runs out. It
+// is used by the reservation expiry worker.
+func NotifyHoldExpiring(conn *amqp.Connection, hold models.ListingHold) {
+	publishNotification(conn, models.QueueReservation, models.NewNotificationEvent(hold.BuyerID, models.NotificationReservationExpiring,
+		"Your reservation is about to expire. Complete your purchase to keep the book.",
+		models.ReservationEventData{ListingID: hold.ListingID, ExpiresAt: hold.ExpiresAt}))
+}
+
+// sendWaitlistError maps waitlist errors to a response
+func sendWaitlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotOnWaitlist):
+		sendErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrWaitlistUnavailable):
+		sendErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update waitlist: "+err.Error())
+	}
+}
+
+// waitlistRequest reads the user and listing of a waitlist request. It
+// answers the request itself on failure.
+func waitlistRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	listingID, err := strconv.Atoi(chi.URLParam(r, "listingID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid listing ID")
+		return 0, 0, false
+	}
+	return userID, listingID, true
+}
+
+// JoinWaitlistHandler queues the user for a listing another buyer has
+// reserved. If that hold runs out the listing is reserved for them.
+func (rh *ReservationHandler) JoinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, listingID, ok := waitlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := rh.ReservationService.JoinWaitlist(r.Context(), listingID, userID)
+	if err != nil {
+		sendWaitlistError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+	})
+}
+
+// LeaveWaitlistHandler takes the user off a listing's waitlist
+func (rh *ReservationHandler) LeaveWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, listingID, ok := waitlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := rh.ReservationService.LeaveWaitlist(r.Context(), listingID, userID); err != nil {
+		sendWaitlistError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// GetWaitlistEntryHandler returns the user's place on a listing's waitlist
+func (rh *ReservationHandler) GetWaitlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, listingID, ok := waitlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := rh.ReservationService.GetWaitlistEntry(r.Context(), listingID, userID)
+	if err != nil {
+		sendWaitlistError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+	})
+}
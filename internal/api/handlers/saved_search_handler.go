@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+type SavedSearchHandler struct {
+	SavedSearchService *services.SavedSearchService
+}
+
+// NotifySavedSearchMatch tells a user about the new listings matching one of
+// their saved searches. It is used by the saved search worker.
+func NotifySavedSearchMatch(conn *amqp.Connection, match models.SavedSearchMatch) {
+	message := fmt.Sprintf("%d new listings match your saved search \"%s\".", match.Count, match.Name)
+	if match.Count == 1 {
+		message = fmt.Sprintf("A new listing matches your saved search \"%s\".", match.Name)
+	}
+	publishNotification(conn, models.QueueSavedSearch, models.NewNotificationEvent(match.UserID, models.NotificationSavedSearchMatch, message,
+		models.SavedSearchEventData{
+			SavedSearchID: match.SavedSearchID,
+			Name:          match.Name,
+			ListingIDs:    match.ListingIDs,
+			Count:         match.Count,
+		}))
+}
+
+// sendSavedSearchError maps saved search errors to a response
+func sendSavedSearchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrSavedSearchNotFound):
+		sendErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidSavedSearch):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrSavedSearchLimit):
+		sendErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save search: "+err.Error())
+	}
+}
+
+// savedSearchRequest reads the user and, when the route has one, the saved
+// search of a request. It writes the error response and returns false when
+// they are invalid.
+func savedSearchRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok || userID == 0 {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	if chi.URLParam(r, "searchID") == "" {
+		return userID, 0, true
+	}
+	searchID, err := strconv.Atoi(chi.URLParam(r, "searchID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid saved search ID")
+		return 0, 0, false
+	}
+	return userID, searchID, true
+}
+
+// ListSavedSearchesHandler returns the user's saved searches
+func (sh *SavedSearchHandler) ListSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := savedSearchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	searches, err := sh.SavedSearchService.ListSavedSearches(r.Context(), userID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get saved searches: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":        true,
+		"saved_searches": searches,
+	})
+}
+
+// GetSavedSearchHandler returns one of the user's saved searches
+func (sh *SavedSearchHandler) GetSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, searchID, ok := savedSearchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	search, err := sh.SavedSearchService.GetSavedSearch(r.Context(), userID, searchID)
+	if err != nil {
+		sendSavedSearchError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"saved_search": search,
+	})
+}
+
+// CreateSavedSearchHandler saves a search. The user is alerted about new
+// listings matching it unless notify is false.
+// Body: {"name": "Thai fantasy", "query": {"genres": ["Fantasy"], "language": "Thai", "max_price": 150}}
+func (sh *SavedSearchHandler) CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := savedSearchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var form models.SavedSearchForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	search, err := sh.SavedSearchService.CreateSavedSearch(r.Context(), userID, form)
+	if err != nil {
+		sendSavedSearchError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"saved_search": search,
+	})
+}
+
+// UpdateSavedSearchHandler changes the name, query or alerts of one of the
+// user's saved searches. Fields left out are kept.
+func (sh *SavedSearchHandler) UpdateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, searchID, ok := savedSearchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var form models.SavedSearchForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	search, err := sh.SavedSearchService.UpdateSavedSearch(r.Context(), userID, searchID, form)
+	if err != nil {
+		sendSavedSearchError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":      true,
+		"saved_search": search,
+	})
+}
+
+// DeleteSavedSearchHandler deletes one of the user's saved searches
+func (sh *SavedSearchHandler) DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, searchID, ok := savedSearchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := sh.SavedSearchService.DeleteSavedSearch(r.Context(), userID, searchID); err != nil {
+		sendSavedSearchError(w, err)
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+	})
+}
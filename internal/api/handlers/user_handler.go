@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/streadway/amqp"
 	"log"
@@ -14,9 +17,10 @@ import (
 )
 
 type UserHandler struct {
-	UserService   *services.UserService
-	UploadService *services.UploadService
-	RabbitMQConn  *amqp.Connection
+	UserService        *services.UserService
+	UploadService      *services.UploadService
+	BankAccountService *services.BankAccountService
+	RabbitMQConn       *amqp.Connection
 }
 
 type CreatePaymentRequest struct {
@@ -32,47 +36,22 @@ func (uh *UserHandler) TestPort(w http.ResponseWriter, r *http.Request) {
 
 func (uh *UserHandler) GetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 
-	// Call the BookService method to get the total book count
-	users, err := uh.UserService.GetAllUsers(r.Context())
+	page, err := parsePageRequest(r)
 	if err != nil {
-		// Handle the error, e.g., return a 500 Internal Server Error
-		http.Error(w, "Failed to get all users", http.StatusInternalServerError)
-		return
-	}
-
-	sendSuccessResponse(w, map[string]interface{}{
-		"users": users,
-	})
-
-}
-
-func (uh *UserHandler) CreateBankAccountHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int)
-	if !ok || userID == 0 {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Parse request body
-	var request *models.BankAccount
-
-	err := json.NewDecoder(r.Body).Decode(&request)
+	users, pageInfo, err := uh.UserService.GetAllUsers(r.Context(), page)
 	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	request.UserID = userID
-
-	// Call service to update preferences
-	_, err = uh.UserService.CreateBankAccount(r.Context(), request)
-	if err != nil {
-		http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+		sendPageError(w, err, "Failed to get all users")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"success": true,
+		"users":       users,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 
 }
@@ -107,7 +86,6 @@ func (uh *UserHandler) CreateBookRequestHandle(w http.ResponseWriter, r *http.Re
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create book request: "+err.Error())
 		return
 	}
-	
 
 	ch, err := uh.RabbitMQConn.Channel()
 	if err != nil {
@@ -125,7 +103,7 @@ func (uh *UserHandler) CreateBookRequestHandle(w http.ResponseWriter, r *http.Re
 		return
 	}
 	noti := map[string]interface{}{
-		"user_id":   userID,
+		"user_id":    userID,
 		"type":       "admin_request",
 		"related_id": strconv.Itoa(reqID),
 		"created_at": time.Now(),
@@ -203,7 +181,7 @@ func (uh *UserHandler) GetBookRequestHandler(w http.ResponseWriter, r *http.Requ
 
 	reqs, err := uh.UserService.GetBookRequests(r.Context())
 	if err != nil {
-		sendErrorResponse(w,  http.StatusInternalServerError, "Failed to retrieve user preferences"+err.Error())
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve user preferences"+err.Error())
 		return
 	}
 
@@ -427,9 +405,13 @@ func (uh *UserHandler) EditProfileHandler(w http.ResponseWriter, r *http.Request
 	log.Println("bio:", user.Bio)
 	log.Println("phone:", user.PhoneNumber)
 
+	if len([]rune(user.Province)) > 100 {
+		sendErrorResponse(w, http.StatusBadRequest, "province must be at most 100 characters")
+		return
+	}
 
 	// 2. Check if user with same email already exists
-	err := uh.UserService.EditProfile(r.Context(), userID, user.FirstName, user.LastName, user.Address, user.Quote, user.Bio, user.PhoneNumber)
+	err := uh.UserService.EditProfile(r.Context(), userID, user.FirstName, user.LastName, user.Address, strings.TrimSpace(user.Province), user.Quote, user.Bio, user.PhoneNumber)
 	if err != nil {
 		sendErrorResponse(w, http.StatusConflict, "Edit Preferrence "+err.Error()) // 409 Conflict if user exists
 		return
@@ -497,6 +479,29 @@ func (uh *UserHandler) AddBookToListingHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	condition := user.Condition
+	if msg := validateListingCondition(&condition); msg != "" {
+		sendErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := user.OfferThresholds.Validate(float64(user.Price)); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Sellers must be able to receive the money before listing a paid book
+	if user.Price > 0 {
+		verified, err := uh.BankAccountService.HasVerifiedPayoutAccount(r.Context(), userID)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to check payout account: "+err.Error())
+			return
+		}
+		if !verified {
+			sendErrorResponse(w, http.StatusForbidden, "Add a verified payout account before listing a book for sale")
+			return
+		}
+	}
+
 	files := r.MultipartForm.File["images"]
 
 	var uploadURLs []string
@@ -518,17 +523,42 @@ func (uh *UserHandler) AddBookToListingHandler(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	_, err = uh.UserService.AddBookToListing(r.Context(), userID, user.BookID, user.Price, user.AllowOffer, uploadURLs, user.SellerNote, user.PhoneNumber)
+	listingID, err := uh.UserService.AddBookToListing(r.Context(), userID, user.BookID, user.Price, user.AllowOffer, uploadURLs, user.SellerNote, user.PhoneNumber, condition, user.OfferThresholds)
 	if err != nil {
 		sendErrorResponse(w, http.StatusConflict, "Failed to process book: "+err.Error())
 		return
 	}
+	uh.notifyWishlists(r.Context(), listingID, models.NotificationWishlistMatch, nil)
 
 	sendSuccessResponse(w, map[string]interface{}{
 		"success": true,
 		"message": "Book listing added successfully!",
 	})
 }
+
+// validateListingCondition trims and checks a listing condition, returning an
+// error message or "". Condition is structured so buyers can filter on it, so
+// unknown values are rejected instead of letting MySQL coerce them to an
+// empty string.
+func validateListingCondition(condition *models.ListingCondition) string {
+	condition.Edition = strings.TrimSpace(condition.Edition)
+	if condition.Grade != "" && !models.IsValidConditionGrade(condition.Grade) {
+		return "Invalid condition grade: " + condition.Grade
+	}
+	if condition.Format != "" && !models.IsValidBookFormat(condition.Format) {
+		return "Invalid book format: " + condition.Format
+	}
+	for _, defect := range condition.Defects {
+		if !models.IsValidConditionDefect(defect) {
+			return "Invalid condition defect: " + defect
+		}
+	}
+	if len(condition.Edition) > 100 {
+		return "Edition must be at most 100 characters"
+	}
+	return ""
+}
+
 func (uh *UserHandler) AddBookToWishListHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("📡 Incoming request: AddBookToWishListHandler")
 
@@ -654,19 +684,134 @@ func (uh *UserHandler) DeleteUserLibraryByIDHandler(w http.ResponseWriter, r *ht
 
 func (uh *UserHandler) GetAllListingsHandler(w http.ResponseWriter, r *http.Request) {
 
-	listing, err := uh.UserService.GetAllListings(r.Context())
+	page, err := parsePageRequest(r)
 	if err != nil {
-		// Handle the error, e.g., return a 500 Internal Server Error
-		http.Error(w, "Failed to get listing", http.StatusInternalServerError)
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	listing, pageInfo, err := uh.UserService.GetAllListings(r.Context(), page)
+	if err != nil {
+		sendPageError(w, err, "Failed to get listing")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"listing": listing,
+		"listing":     listing,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 
 }
 
+// SearchListingsHandler handles GET /listings/search. Book filters: title,
+// author, genre, language. Listing filters: min_price, max_price,
+// allow_offers, status, seller_id, condition, format, without_defect,
+// location (the seller's province). sort is newest (default), price_asc or
+// price_desc.
+func (uh *UserHandler) SearchListingsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	params := models.ListingSearchParams{
+		Title:           strings.TrimSpace(query.Get("title")),
+		Author:          strings.TrimSpace(query.Get("author")),
+		Genres:          splitQueryValues(query["genre"]),
+		Language:        strings.TrimSpace(query.Get("language")),
+		Status:          "for_sale",
+		ConditionGrades: splitQueryValues(query["condition"]),
+		Formats:         splitQueryValues(query["format"]),
+		WithoutDefects:  splitQueryValues(query["without_defect"]),
+		Location:        strings.TrimSpace(query.Get("location")),
+	}
+
+	if v := query.Get("min_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid min_price")
+			return
+		}
+		params.MinPrice = &price
+	}
+	if v := query.Get("max_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid max_price")
+			return
+		}
+		params.MaxPrice = &price
+	}
+	if v := query.Get("allow_offers"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid allow_offers")
+			return
+		}
+		params.AllowOffers = &allow
+	}
+	if v := query.Get("status"); v != "" {
+		if v != "for_sale" && v != "reserved" && v != "sold" {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid status")
+			return
+		}
+		params.Status = v
+	}
+	if v := query.Get("seller_id"); v != "" {
+		sellerID, err := strconv.Atoi(v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid seller_id")
+			return
+		}
+		params.SellerID = &sellerID
+	}
+	for _, grade := range params.ConditionGrades {
+		if !models.IsValidConditionGrade(grade) {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid condition: "+grade)
+			return
+		}
+	}
+	for _, format := range params.Formats {
+		if !models.IsValidBookFormat(format) {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid format: "+format)
+			return
+		}
+	}
+	for _, defect := range params.WithoutDefects {
+		if !models.IsValidConditionDefect(defect) {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid without_defect: "+defect)
+			return
+		}
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch page.Sort {
+	case "", "newest":
+		page.Sort, page.Order = "created_at", "desc"
+	case "price_asc":
+		page.Sort, page.Order = "price", "asc"
+	case "price_desc":
+		page.Sort, page.Order = "price", "desc"
+	default:
+		sendErrorResponse(w, http.StatusBadRequest, "sort must be newest, price_asc or price_desc")
+		return
+	}
+
+	listings, pageInfo, err := uh.UserService.SearchListings(r.Context(), params, page)
+	if err != nil {
+		sendPageError(w, err, "Failed to search listings")
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"listings":    listings,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
 func (uh *UserHandler) GetMyListingsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Call the BookService method to get the total book count
@@ -802,9 +947,59 @@ func (uh *UserHandler) IsBookInWishlistHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	maxPrice, err := uh.UserService.GetWishlistMaxPrice(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, "Failed to check book wishlist status", http.StatusInternalServerError)
+		return
+	}
+
 	// Send the response indicating whether the book is in the wishlist
 	sendSuccessResponse(w, map[string]interface{}{
 		"in_wishlist": isInWishlist,
+		"max_price":   maxPrice,
+	})
+}
+
+// SetWishlistMaxPriceHandler sets the most the user will pay for a book,
+// adding it to their wishlist. They are only alerted about listings at or
+// below it.
+// Body: {"max_price": 150}, or {"max_price": null} to be alerted about every listing
+func (uh *UserHandler) SetWishlistMaxPriceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
+		return
+	}
+
+	bookID, err := strconv.Atoi(chi.URLParam(r, "bookID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+
+	var req struct {
+		MaxPrice *float64 `json:"max_price"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err = uh.UserService.SetWishlistMaxPrice(r.Context(), userID, bookID, req.MaxPrice)
+	if errors.Is(err, services.ErrInvalidMaxPrice) {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Wishlist error: "+err.Error())
+		return
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":     true,
+		"message":     "Wishlist max price updated",
+		"in_wishlist": true,
+		"max_price":   req.MaxPrice,
 	})
 }
 
@@ -866,6 +1061,13 @@ func (uh *UserHandler) GetListingByIDHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Buyers mustn't see where the seller's limits are, and reach the seller
+	// through a conversation rather than their phone number
+	if viewerID, _ := r.Context().Value("user_id").(int); viewerID != listing.SellerID {
+		listing.OfferThresholds = models.OfferThresholds{}
+		listing.PhoneNumber = ""
+	}
+
 	sendSuccessResponse(w, map[string]interface{}{
 		"listing": listing,
 	})
@@ -903,11 +1105,12 @@ func (uh *UserHandler) RemoveListingHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = uh.UserService.RemoveListing(r.Context(), userID, listingID)
+	rejected, err := uh.UserService.RemoveListing(r.Context(), userID, listingID)
 	if err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	notifyOfferUpdates(uh.RabbitMQConn, rejected)
 
 	sendSuccessResponse(w, map[string]interface{}{
 		"success": true,
@@ -915,6 +1118,162 @@ func (uh *UserHandler) RemoveListingHandler(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// UpdateListingHandler lets a seller edit their listing. Takes the same
+// multipart shape as add-listing: JSON in 'data' plus optional new 'images'.
+func (uh *UserHandler) UpdateListingHandler(w http.ResponseWriter, r *http.Request) {
+	sellerID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "listingID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	var form models.ListingUpdateForm
+	if err := json.Unmarshal([]byte(r.FormValue("data")), &form); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	if form.Price != nil && *form.Price <= 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Price must be greater than 0")
+		return
+	}
+	if form.Condition != nil {
+		if msg := validateListingCondition(form.Condition); msg != "" {
+			sendErrorResponse(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	var uploadURLs []string
+	for _, handler := range r.MultipartForm.File["images"] {
+		file, err := handler.Open()
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error opening file")
+			return
+		}
+		defer file.Close()
+
+		url, err := uh.UploadService.UploadImageURL(file, handler.Filename)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Image upload failed: "+err.Error())
+			return
+		}
+		uploadURLs = append(uploadURLs, url)
+	}
+
+	result, err := uh.UserService.UpdateListing(r.Context(), sellerID, listingID, form, uploadURLs)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Let buyers know their offer no longer stands
+	for _, offer := range result.RejectedOffers {
+		message := "The seller changed the price, so your offer was rejected."
+		if offer.Reason == "below_minimum" {
+			message = "Your offer is below the seller's new minimum and was rejected."
+		}
+		publishNotification(uh.RabbitMQConn, models.QueueOffer, models.NewNotificationEvent(offer.BuyerID, models.NotificationOffer, message, models.OfferEventData{
+			OfferID:   offer.OfferID,
+			ListingID: listingID,
+			Action:    models.OfferActionRejected,
+			Status:    models.OfferRejected,
+			Reason:    offer.Reason,
+		}))
+	}
+
+	if form.Price != nil && *form.Price < result.OldPrice {
+		oldPrice := float64(result.OldPrice)
+		uh.notifyWishlists(r.Context(), listingID, models.NotificationPriceDrop, &oldPrice)
+	}
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success":         true,
+		"message":         "Listing updated successfully",
+		"price_changed":   result.PriceChanged,
+		"rejected_offers": len(result.RejectedOffers),
+	})
+}
+
+// RelistListingHandler puts a removed listing back up for sale.
+// Body (optional): {"price": 120}
+func (uh *UserHandler) RelistListingHandler(w http.ResponseWriter, r *http.Request) {
+	sellerID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "listingID"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var req struct {
+		Price *float32 `json:"price"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Price must be greater than 0")
+		return
+	}
+
+	if err := uh.UserService.RelistListing(r.Context(), sellerID, listingID, req.Price); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	uh.notifyWishlists(r.Context(), listingID, models.NotificationWishlistMatch, nil)
+
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "Listing relisted successfully",
+	})
+}
+
+// notifyWishlists alerts the users who have a listing's book on their
+// wishlist that it is for sale, or cheaper when oldPrice is given
+func (uh *UserHandler) notifyWishlists(ctx context.Context, listingID int, alertType string, oldPrice *float64) {
+	alerts, err := uh.UserService.ClaimWishlistAlerts(ctx, listingID, alertType)
+	if err != nil {
+		log.Println("❌ Wishlist alert Error:", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		title := alert.Title
+		if runes := []rune(title); len(runes) > 100 {
+			title = string(runes[:100]) + "…"
+		}
+		message := fmt.Sprintf("%s from your wishlist is now for sale for ฿%.2f.", title, alert.Price)
+		if oldPrice != nil {
+			message = fmt.Sprintf("%s from your wishlist dropped from ฿%.2f to ฿%.2f.", title, *oldPrice, alert.Price)
+		}
+		publishNotification(uh.RabbitMQConn, models.QueueWishlist, models.NewNotificationEvent(alert.UserID, alertType, message, models.WishlistEventData{
+			ListingID: listingID,
+			BookID:    alert.BookID,
+			Title:     alert.Title,
+			Price:     alert.Price,
+			OldPrice:  oldPrice,
+		}))
+	}
+}
+
 func (uh *UserHandler) AddToCartHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
@@ -998,55 +1357,47 @@ func (uh *UserHandler) AddToOffersHandler(w http.ResponseWriter, r *http.Request
 
 	log.Println("listingID:", req.ListingID, "offeredPrice:", req.OfferedPrice)
 
-	id, err := uh.UserService.AddToOffers(r.Context(), buyerID, req.ListingID, req.OfferedPrice)
+	id, auto, err := uh.UserService.AddToOffers(r.Context(), buyerID, req.ListingID, req.OfferedPrice)
 	if err != nil {
 		log.Println("❌ Add offer error:", err)
+		if errors.Is(err, services.ErrInvalidOfferPrice) {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		sendErrorResponse(w, http.StatusConflict, "Offer error: "+err.Error())
 		return
 	}
 
-	listing, err := uh.UserService.GetListingByID(r.Context(), req.ListingID)
-	if err != nil {
-		// Handle the error, e.g., return a 500 Internal Server Error
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch listing")
+	// An offer the listing's thresholds answered never reaches the seller
+	if auto != nil {
+		NotifyOfferUpdate(uh.RabbitMQConn, *auto)
+		log.Println("✅ Added offer with ID:", id, "automatically", auto.Status)
+		sendSuccessResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Offer " + auto.Status + " automatically",
+			"offerId": id,
+			"offer":   auto,
+		})
 		return
 	}
 
-	// Publish to RabbitMQ
-	ch, err := uh.RabbitMQConn.Channel()
-	if err != nil {
-		log.Println("❌ RabbitMQ Channel Error:", err)
-		return // Don’t fail webhook response
-	}
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		"offer_queue", // New queue for offer_queue
-		true, false, false, false, nil,
-	)
+	listing, err := uh.UserService.GetListingByID(r.Context(), req.ListingID)
 	if err != nil {
-		log.Println("❌ Queue Declare Error:", err)
+		// Handle the error, e.g., return a 500 Internal Server Error
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch listing")
 		return
 	}
 
-	noti := map[string]interface{}{
-		"user_id":    int(listing.SellerID),
-		"type":       "offer",
-		"created_at": time.Now(),
-	}
-
-	body, _ := json.Marshal(noti)
-
-	err = ch.Publish(
-		"", q.Name, false, false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		log.Println("❌ Publish Error:", err)
-	}
+	NotifyOfferUpdate(uh.RabbitMQConn, models.OfferUpdate{
+		OfferID:   id,
+		ListingID: req.ListingID,
+		BuyerID:   buyerID,
+		SellerID:  int(listing.SellerID),
+		Price:     req.OfferedPrice,
+		Status:    models.OfferPending,
+		Action:    models.OfferActionOffered,
+		ActorID:   buyerID,
+	})
 
 	log.Println("✅ Added offer successfully with ID:", id)
 	sendSuccessResponse(w, map[string]interface{}{
@@ -1059,14 +1410,22 @@ func (uh *UserHandler) AddToOffersHandler(w http.ResponseWriter, r *http.Request
 func (uh *UserHandler) GetBuyerOffersHandler(w http.ResponseWriter, r *http.Request) {
 	buyerID := r.Context().Value("user_id").(int)
 
-	offers, err := uh.UserService.GetBuyerOffers(r.Context(), buyerID)
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offers, pageInfo, err := uh.UserService.GetBuyerOffers(r.Context(), buyerID, page)
 	if err != nil {
-		http.Error(w, "Failed to fetch user offers", http.StatusInternalServerError)
+		sendPageError(w, err, "Failed to fetch user offers")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"offers": offers,
+		"offers":      offers,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 }
 
@@ -1077,14 +1436,22 @@ func (uh *UserHandler) GetSellerOffersHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	offers, err := uh.UserService.GetSellerOffers(r.Context(), sellerID)
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offers, pageInfo, err := uh.UserService.GetSellerOffers(r.Context(), sellerID, page)
 	if err != nil {
-		http.Error(w, "Failed to fetch seller offers", http.StatusInternalServerError)
+		sendPageError(w, err, "Failed to fetch seller offers")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"offers": offers,
+		"offers":      offers,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 }
 
@@ -1117,129 +1484,176 @@ func (uh *UserHandler) RemoveFromOffersHandler(w http.ResponseWriter, r *http.Re
 	})
 }
 
-func (uh *UserHandler) AcceptOfferHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		OfferID int `json:"offerId"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
+// offerStepRequest is the body of the accept, reject and counter endpoints
+type offerStepRequest struct {
+	OfferID int     `json:"offerId"`
+	Price   float64 `json:"price"`
+}
 
-	sellerID, ok := r.Context().Value("user_id").(int)
-	if !ok {
-		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
-		return
+// offerNotifications builds the "offer_queue" notifications for a negotiation
+// step: to the party who has to react, or to both when the system took the
+// step. The seller also hears about offers their thresholds accepted, since
+// they now have a sale coming. Competing offers the step suspended or
+// reinstated only concern their buyers.
+func offerNotifications(update models.OfferUpdate) []models.NotificationEvent {
+	recipients := []int{update.BuyerID, update.SellerID}
+	if update.Action == models.OfferActionSuspended || update.Action == models.OfferActionReinstated {
+		recipients = []int{update.BuyerID}
+	}
+
+	data := models.OfferEventData{
+		OfferID:   update.OfferID,
+		ListingID: update.ListingID,
+		Action:    update.Action,
+		Status:    update.Status,
+		Price:     update.Price,
+		Automatic: update.Automatic,
+	}
+	var notes []models.NotificationEvent
+	for _, userID := range recipients {
+		if userID == update.ActorID && !(update.Automatic && update.Status == models.OfferAccepted) {
+			continue
+		}
+		notes = append(notes, models.NewNotificationEvent(userID, models.NotificationOffer, offerMessage(update.Action), data))
 	}
-
-	buyer_id, err := uh.UserService.AcceptOffer(r.Context(), sellerID, req.OfferID)
-	if err != nil {
-		log.Println("❌ Accept offer error:", err)
-		sendErrorResponse(w, http.StatusConflict, "Offer error: "+err.Error())
-		return
+	for _, competing := range update.Competing {
+		notes = append(notes, offerNotifications(competing)...)
 	}
+	return notes
+}
 
-	ch, err := uh.RabbitMQConn.Channel()
-	if err != nil {
-		log.Println("❌ RabbitMQ Channel Error:", err)
-		return // Don’t fail webhook response
-	}
-	defer ch.Close()
+// offerMessage describes an offer step for the inbox
+func offerMessage(action string) string {
+	switch action {
+	case models.OfferActionOffered:
+		return "You have a new offer."
+	case models.OfferActionCountered:
+		return "An offer was countered."
+	case models.OfferActionAccepted:
+		return "An offer was accepted."
+	case models.OfferActionRejected:
+		return "An offer was rejected."
+	case models.OfferActionExpired:
+		return "An offer expired without an answer."
+	case models.OfferActionPaymentExpired:
+		return "An accepted offer expired because it wasn't paid in time."
+	case models.OfferActionSuspended:
+		return "Your offer is on hold while the book is reserved by another buyer."
+	case models.OfferActionReinstated:
+		return "The book is available again and your offer is back on."
+	}
+	return "An offer was updated."
+}
 
-	q, err := ch.QueueDeclare(
-		"offer_queue", // New queue for offer_queue
-		true, false, false, false, nil,
-	)
-	if err != nil {
-		log.Println("❌ Queue Declare Error:", err)
-		return
+// NotifyOfferUpdate publishes a negotiation step on "offer_queue". It is also
+// used by the offer expiry worker.
+func NotifyOfferUpdate(conn *amqp.Connection, update models.OfferUpdate) {
+	for _, noti := range offerNotifications(update) {
+		publishNotification(conn, models.QueueOffer, noti)
 	}
+}
 
-	noti := map[string]interface{}{
-		"user_id":    buyer_id,
-		"type":       "offer",
-		"created_at": time.Now(),
+// notifyOfferUpdates publishes the steps a listing change forced on its offers
+func notifyOfferUpdates(conn *amqp.Connection, updates []models.OfferUpdate) {
+	for _, update := range updates {
+		NotifyOfferUpdate(conn, update)
 	}
+}
 
-	body, _ := json.Marshal(noti)
-
-	err = ch.Publish(
-		"", q.Name, false, false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		log.Println("❌ Publish Error:", err)
+// addOfferNotifications queues offer steps on a webhook's notification batch
+func addOfferNotifications(notes *notificationBatch, updates []models.OfferUpdate) {
+	for _, update := range updates {
+		for _, noti := range offerNotifications(update) {
+			notes.add(models.QueueOffer, noti)
+		}
 	}
-
-	sendSuccessResponse(w, map[string]interface{}{
-		"success": true,
-		"message": "Offer accepted successfully!",
-	})
 }
 
-func (uh *UserHandler) RejectOfferHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		OfferID int `json:"offerId"`
-	}
+// handleOfferStep decodes an offer step request, runs it and notifies the
+// other party
+func (uh *UserHandler) handleOfferStep(w http.ResponseWriter, r *http.Request, step func(ctx context.Context, userID int, req offerStepRequest) (*models.OfferUpdate, error), message string) {
+	var req offerStepRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	sellerID, ok := r.Context().Value("user_id").(int)
+	userID, ok := r.Context().Value("user_id").(int)
 	if !ok {
 		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
 		return
 	}
 
-	buyer_id, err := uh.UserService.RejectOffer(r.Context(), sellerID, req.OfferID)
+	update, err := step(r.Context(), userID, req)
 	if err != nil {
-		log.Println("❌ Reject offer error:", err)
+		log.Println("❌ Offer step error:", err)
+		if errors.Is(err, services.ErrInvalidOfferPrice) {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		sendErrorResponse(w, http.StatusConflict, "Offer error: "+err.Error())
 		return
 	}
 
-	ch, err := uh.RabbitMQConn.Channel()
-	if err != nil {
-		log.Println("❌ RabbitMQ Channel Error:", err)
-		return // Don’t fail webhook response
-	}
-	defer ch.Close()
+	NotifyOfferUpdate(uh.RabbitMQConn, *update)
+	sendSuccessResponse(w, map[string]interface{}{
+		"success": true,
+		"message": message,
+		"offer":   update,
+	})
+}
 
-	q, err := ch.QueueDeclare(
-		"offer_queue", // New queue for offer_queue
-		true, false, false, false, nil,
-	)
+// AcceptOfferHandler accepts an offer waiting on the user: the seller accepts
+// a pending offer, the buyer a counter-offer
+func (uh *UserHandler) AcceptOfferHandler(w http.ResponseWriter, r *http.Request) {
+	uh.handleOfferStep(w, r, func(ctx context.Context, userID int, req offerStepRequest) (*models.OfferUpdate, error) {
+		return uh.UserService.AcceptOffer(ctx, userID, req.OfferID)
+	}, "Offer accepted successfully!")
+}
+
+// RejectOfferHandler rejects an offer waiting on the user
+func (uh *UserHandler) RejectOfferHandler(w http.ResponseWriter, r *http.Request) {
+	uh.handleOfferStep(w, r, func(ctx context.Context, userID int, req offerStepRequest) (*models.OfferUpdate, error) {
+		return uh.UserService.RejectOffer(ctx, userID, req.OfferID)
+	}, "Offer rejected successfully!")
+}
+
+// CounterOfferHandler answers an offer waiting on the user with a new price
+func (uh *UserHandler) CounterOfferHandler(w http.ResponseWriter, r *http.Request) {
+	uh.handleOfferStep(w, r, func(ctx context.Context, userID int, req offerStepRequest) (*models.OfferUpdate, error) {
+		return uh.UserService.CounterOffer(ctx, userID, req.OfferID, req.Price)
+	}, "Counter-offer sent successfully!")
+}
+
+// GetOfferHandler returns an offer with its negotiation history to its buyer
+// or seller
+func (uh *UserHandler) GetOfferHandler(w http.ResponseWriter, r *http.Request) {
+	offerID, err := strconv.Atoi(chi.URLParam(r, "offerID"))
 	if err != nil {
-		log.Println("❌ Queue Declare Error:", err)
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid offer ID")
 		return
 	}
 
-	noti := map[string]interface{}{
-		"user_id":    buyer_id,
-		"type":       "offer",
-		"created_at": time.Now(),
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		sendErrorResponse(w, http.StatusUnauthorized, "User ID missing")
+		return
 	}
 
-	body, _ := json.Marshal(noti)
+	offer, err := uh.UserService.GetOfferByID(r.Context(), offerID)
+	if err != nil || (offer.BuyerID != userID && offer.SellerID != userID) {
+		sendErrorResponse(w, http.StatusNotFound, "Offer not found")
+		return
+	}
 
-	err = ch.Publish(
-		"", q.Name, false, false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	offer.History, err = uh.UserService.GetOfferHistory(r.Context(), offerID)
 	if err != nil {
-		log.Println("❌ Publish Error:", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch offer history: "+err.Error())
+		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"success": true,
-		"message": "Offer rejected successfully!",
+		"offer": offer,
 	})
 }
 
@@ -1338,11 +1752,12 @@ func (uh *UserHandler) MarkListingAsSoldHandler(w http.ResponseWriter, r *http.R
 	}
 
 	// Call service to mark listing as sold
-	err := uh.UserService.MarkListingAsSold(r.Context(), request.ListingID, buyerID)
+	rejected, err := uh.UserService.MarkListingAsSold(r.Context(), request.ListingID, buyerID)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to mark listing as sold: "+err.Error())
 		return
 	}
+	notifyOfferUpdates(uh.RabbitMQConn, rejected)
 
 	sendSuccessResponse(w, map[string]interface{}{
 		"success": true,
@@ -1394,7 +1809,7 @@ func (uh *UserHandler) CreatePostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	imageURLs := r.Form["image_urls"] 
+	imageURLs := r.Form["image_urls"]
 
 	// Get genre_id and book_id (optional)
 	var genreID *int
@@ -1441,17 +1856,25 @@ func (uh *UserHandler) CreatePostHandler(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// GetAllPostsHandler returns all posts
+// GetAllPostsHandler returns one page of the social feed
 func (uh *UserHandler) GetAllPostsHandler(w http.ResponseWriter, r *http.Request) {
-	posts, err := uh.UserService.GetAllPosts(r.Context())
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, pageInfo, err := uh.UserService.GetAllPosts(r.Context(), page)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch posts: "+err.Error())
+		sendPageError(w, err, "Failed to fetch posts")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"success": true,
-		"posts":   posts,
+		"success":     true,
+		"posts":       posts,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 }
 
@@ -1466,15 +1889,23 @@ func (uh *UserHandler) GetPostsByUserIDHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	posts, err := uh.UserService.GetPostsByUserID(r.Context(), userID)
+	page, err := parsePageRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, pageInfo, err := uh.UserService.GetPostsByUserID(r.Context(), userID, page)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch posts: "+err.Error())
+		sendPageError(w, err, "Failed to fetch posts")
 		return
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
-		"success": true,
-		"posts":   posts,
+		"success":     true,
+		"posts":       posts,
+		"next_cursor": pageInfo.NextCursor,
+		"has_more":    pageInfo.HasMore,
 	})
 }
 
@@ -1503,6 +1934,21 @@ func (uh *UserHandler) GetPostByPostIDHandler(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// notifyPostAuthor tells a post's author that someone else commented on or
+// liked it
+func (uh *UserHandler) notifyPostAuthor(ctx context.Context, postID, actorID int, notificationType, message string, commentID int) {
+	authorID, err := uh.UserService.GetPostAuthorID(ctx, postID)
+	if err != nil {
+		log.Println("❌ Post author lookup Error:", err)
+		return
+	}
+	if authorID == actorID {
+		return
+	}
+	publishNotification(uh.RabbitMQConn, models.QueueSocial, models.NewNotificationEvent(authorID, notificationType, message,
+		models.PostEventData{PostID: postID, ActorID: actorID, CommentID: commentID}))
+}
+
 // CreateCommentHandler handles comment creation
 func (uh *UserHandler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(10 << 20)
@@ -1535,6 +1981,7 @@ func (uh *UserHandler) CreateCommentHandler(w http.ResponseWriter, r *http.Reque
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create comment: "+err.Error())
 		return
 	}
+	uh.notifyPostAuthor(r.Context(), postID, userID, models.NotificationPostComment, "Someone commented on your post.", comment.ID)
 
 	sendSuccessResponse(w, map[string]interface{}{
 		"success": true,
@@ -1601,6 +2048,7 @@ func (uh *UserHandler) ToggleLikeHandler(w http.ResponseWriter, r *http.Request)
 			sendErrorResponse(w, http.StatusInternalServerError, "Failed to like: "+err.Error())
 			return
 		}
+		uh.notifyPostAuthor(r.Context(), postID, userID, models.NotificationPostLike, "Someone liked your post.", 0)
 	}
 
 	sendSuccessResponse(w, map[string]interface{}{
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"used2book-backend/internal/api/routes"
 	"used2book-backend/internal/config"
+	"used2book-backend/internal/services"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -13,7 +14,7 @@ import (
 	"github.com/streadway/amqp"
 )
 
-func SetupRouter(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+func SetupRouter(db *sql.DB, rabbitConn *amqp.Connection, notificationStream *services.NotificationStream) http.Handler {
 	config.InitOAuth()
 
 	r := chi.NewRouter()
@@ -25,7 +26,7 @@ func SetupRouter(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
     AllowedOrigins:   []string{"https://*", "http://*"},
     // AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
     AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-    AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+    AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
     ExposedHeaders:   []string{"Link"},
     AllowCredentials: true,
     MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -38,8 +39,15 @@ func SetupRouter(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
 	r.Mount("/auth", routes.AuthRoutes(db))
 	r.Mount("/user", routes.UserRoutes(db, rabbitConn))
 	r.Mount("/book", routes.BookRoutes(db))
+	r.Mount("/listings", routes.ListingRoutes(db, rabbitConn))
 	r.Mount("/auth-token", routes.TokenRoutes(db))
 	r.Mount("/payment", routes.PaymentRoutes(db, rabbitConn))
+	r.Mount("/admin", routes.AdminRoutes(db, rabbitConn))
+	r.Mount("/orders", routes.OrderRoutes(db, rabbitConn))
+	r.Mount("/disputes", routes.DisputeRoutes(db, rabbitConn))
+	r.Mount("/notifications", routes.NotificationRoutes(db, notificationStream))
+	r.Mount("/saved-searches", routes.SavedSearchRoutes(db))
+	r.Mount("/conversations", routes.MessageRoutes(db, rabbitConn))
 
 	// ✅ Debugging: Print all registered routes
 	fmt.Println("🔍 Registered Routes:")
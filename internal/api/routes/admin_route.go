@@ -1 +1,57 @@
-package routes
\ No newline at end of file
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// AdminRoutes initializes admin-only routes
+func AdminRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+	userRepo := mysql.NewUserRepository(db)
+	userService := services.NewUserService(userRepo)
+	webhookEventService := services.NewWebhookEventService(mysql.NewWebhookEventRepository(db))
+	escrowService := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	providers := services.NewPaymentProvidersFromEnv()
+	orderRepo := mysql.NewOrderRepository(db)
+	reservationService := services.NewReservationService(mysql.NewReservationRepository(db))
+
+	adminHandler := &handlers.AdminHandler{
+		WebhookEventService: webhookEventService,
+		PaymentHandler: &handlers.PaymentHandler{
+			UserService:         userService,
+			ReservationService:  reservationService,
+			WebhookEventService: webhookEventService,
+			EscrowService:       escrowService,
+			OrderService:        services.NewOrderService(orderRepo, escrowService, providers),
+			Providers:           providers,
+			RabbitMQConn:        rabbitConn,
+		},
+		DisputeService:     services.NewDisputeService(mysql.NewDisputeRepository(db), orderRepo, escrowService, providers),
+		ReservationService: reservationService,
+		RabbitMQConn:       rabbitConn,
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+	r.Use(middleware.AdminMiddleware(db))
+
+	r.Get("/webhook-events", adminHandler.ListWebhookEventsHandler)
+	r.Get("/webhook-events/{eventID:[0-9]+}", adminHandler.GetWebhookEventHandler)
+	r.Post("/webhook-events/{eventID:[0-9]+}/replay", adminHandler.ReplayWebhookEventHandler)
+
+	r.Get("/disputes", adminHandler.ListDisputesHandler)
+	r.Get("/disputes/{disputeID:[0-9]+}", adminHandler.GetDisputeHandler)
+	r.Post("/disputes/{disputeID:[0-9]+}/messages", adminHandler.AddDisputeNoteHandler)
+	r.Post("/disputes/{disputeID:[0-9]+}/resolve", adminHandler.ResolveDisputeHandler)
+
+	r.Get("/reservations/metrics", adminHandler.ReservationMetricsHandler)
+
+	return r
+}
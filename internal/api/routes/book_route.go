@@ -43,6 +43,7 @@ func BookRoutes(db *sql.DB) http.Handler {
 
 
 	r.Get("/all-books", bookHandler.GetAllBooks) // Get book details with ratings
+	r.Get("/search", bookHandler.SearchBooks)
 	r.Get("/get-book/{id:[0-9]+}", bookHandler.GetBookByID)
 	r.Get("/get-book-genres/{id:[0-9]+}", bookHandler.GetGenresByBookID)
 
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// DisputeRoutes initializes buyer and seller dispute routes
+func DisputeRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+	escrowService := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	disputeService := services.NewDisputeService(mysql.NewDisputeRepository(db), mysql.NewOrderRepository(db), escrowService, services.NewPaymentProvidersFromEnv())
+
+	disputeHandler := &handlers.DisputeHandler{
+		DisputeService: disputeService,
+		UploadService:  services.NewUploadService(mysql.NewUserRepository(db)),
+		RabbitMQConn:   rabbitConn,
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", disputeHandler.ListDisputesHandler)
+	r.Post("/", disputeHandler.OpenDisputeHandler)
+	r.Get("/{disputeID:[0-9]+}", disputeHandler.GetDisputeHandler)
+	r.Post("/{disputeID:[0-9]+}/messages", disputeHandler.AddDisputeMessageHandler)
+
+	return r
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// ListingRoutes sets up the marketplace routes that work across sellers
+func ListingRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+	userRepo := mysql.NewUserRepository(db)
+	userService := services.NewUserService(userRepo)
+	uploadService := services.NewUploadService(userRepo)
+
+	userHandler := &handlers.UserHandler{
+		UserService:   userService,
+		UploadService: uploadService,
+		RabbitMQConn:  rabbitConn,
+	}
+	reservationHandler := &handlers.ReservationHandler{
+		ReservationService: services.NewReservationService(mysql.NewReservationRepository(db)),
+		RabbitMQConn:       rabbitConn,
+	}
+
+	r := chi.NewRouter()
+
+	r.Get("/", userHandler.GetAllListingsHandler)
+	r.Get("/search", userHandler.SearchListingsHandler)
+
+	r.With(middleware.AuthMiddleware).Post("/{listingID:[0-9]+}/waitlist", reservationHandler.JoinWaitlistHandler)
+	r.With(middleware.AuthMiddleware).Delete("/{listingID:[0-9]+}/waitlist", reservationHandler.LeaveWaitlistHandler)
+	r.With(middleware.AuthMiddleware).Get("/{listingID:[0-9]+}/waitlist", reservationHandler.GetWaitlistEntryHandler)
+
+	return r
+}
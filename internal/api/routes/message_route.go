@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// MessageRoutes initializes the buyer-seller messaging routes
+func MessageRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+	messageHandler := &handlers.MessageHandler{
+		MessageService: services.NewMessageService(mysql.NewMessageRepository(db)),
+		UploadService:  services.NewUploadService(mysql.NewUserRepository(db)),
+		RabbitMQConn:   rabbitConn,
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", messageHandler.ListConversationsHandler)
+	r.Post("/", messageHandler.StartConversationHandler)
+	r.Get("/unread-count", messageHandler.UnreadMessagesHandler)
+	r.Get("/{conversationID:[0-9]+}", messageHandler.GetConversationHandler)
+	r.Get("/{conversationID:[0-9]+}/messages", messageHandler.ListMessagesHandler)
+	r.Post("/{conversationID:[0-9]+}/messages", messageHandler.SendMessageHandler)
+	r.Post("/{conversationID:[0-9]+}/read", messageHandler.MarkConversationReadHandler)
+
+	r.Get("/blocks", messageHandler.ListBlockedUsersHandler)
+	r.Post("/blocks/{userID:[0-9]+}", messageHandler.BlockUserHandler)
+	r.Delete("/blocks/{userID:[0-9]+}", messageHandler.UnblockUserHandler)
+
+	return r
+}
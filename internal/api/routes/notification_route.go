@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// NotificationRoutes initializes the in-app notification center routes
+func NotificationRoutes(db *sql.DB, stream *services.NotificationStream) http.Handler {
+	notificationHandler := &handlers.NotificationHandler{
+		NotificationService: services.NewNotificationService(mysql.NewNotificationRepository(db), stream),
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", notificationHandler.ListNotificationsHandler)
+	r.Get("/stream", notificationHandler.StreamNotificationsHandler)
+	r.Get("/unread-count", notificationHandler.UnreadCountHandler)
+	r.Post("/{notificationID:[0-9]+}/read", notificationHandler.MarkReadHandler)
+	r.Post("/read-all", notificationHandler.MarkAllReadHandler)
+
+	return r
+}
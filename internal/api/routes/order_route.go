@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/streadway/amqp"
+)
+
+// OrderRoutes initializes order fulfilment routes
+func OrderRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
+	escrowService := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	orderService := services.NewOrderService(mysql.NewOrderRepository(db), escrowService, services.NewPaymentProvidersFromEnv())
+
+	orderHandler := &handlers.OrderHandler{
+		OrderService: orderService,
+		RabbitMQConn: rabbitConn,
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", orderHandler.ListOrdersHandler)
+	r.Get("/{orderID:[0-9]+}", orderHandler.GetOrderHandler)
+	r.Post("/{orderID:[0-9]+}/ship", orderHandler.ShipOrderHandler)
+	r.Post("/{orderID:[0-9]+}/deliver", orderHandler.MarkDeliveredHandler)
+	r.Post("/{orderID:[0-9]+}/confirm-receipt", orderHandler.ConfirmReceiptHandler)
+	r.Post("/{orderID:[0-9]+}/cancel", orderHandler.CancelOrderHandler)
+
+	return r
+}
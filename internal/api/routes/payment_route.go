@@ -17,19 +17,37 @@ func PaymentRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
 	// Initialize required services and repositories
 	userRepo := mysql.NewUserRepository(db)
 	userService := services.NewUserService(userRepo)
-
+	webhookEventService := services.NewWebhookEventService(mysql.NewWebhookEventRepository(db))
+	escrowService := services.NewEscrowService(mysql.NewEscrowRepository(db))
+	providers := services.NewPaymentProvidersFromEnv()
+	orderService := services.NewOrderService(mysql.NewOrderRepository(db), escrowService, providers)
 
 	// Initialize payment handler
 	paymentHandler := &handlers.PaymentHandler{
-		UserService:  userService,
-		RabbitMQConn: rabbitConn,
+		UserService:         userService,
+		ReservationService:  services.NewReservationService(mysql.NewReservationRepository(db)),
+		WebhookEventService: webhookEventService,
+		EscrowService:       escrowService,
+		OrderService:        orderService,
+		Providers:           providers,
+		RabbitMQConn:        rabbitConn,
 	}
 
 	// Create a new router
 	r := chi.NewRouter()
 
 	r.With(middleware.AuthMiddleware).Post("/check-out", paymentHandler.CheckOutHandler)
+	r.With(middleware.AuthMiddleware).Post("/cart-check-out", paymentHandler.CartCheckOutHandler)
+	r.With(middleware.AuthMiddleware).Post("/promptpay", paymentHandler.PromptPayHandler)
 	r.Post("/webhook", paymentHandler.WebhookHandler)
+	r.Post("/omise/webhook", paymentHandler.OmiseWebhookHandler)
+	r.Post("/webhook/{provider}", paymentHandler.ProviderWebhookHandler)
+
+	r.With(middleware.AuthMiddleware).Get("/providers", paymentHandler.GetPaymentProvidersHandler)
+	r.With(middleware.AuthMiddleware).Post("/preference", paymentHandler.SetPaymentPreferenceHandler)
+
+	r.With(middleware.AuthMiddleware).Get("/balance", paymentHandler.GetBalanceHandler)
+	r.With(middleware.AuthMiddleware).Get("/payouts", paymentHandler.GetPayoutsHandler)
 
 
 	return r
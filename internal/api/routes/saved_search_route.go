@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"used2book-backend/internal/api/handlers"
+	"used2book-backend/internal/middleware"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SavedSearchRoutes initializes the saved search routes
+func SavedSearchRoutes(db *sql.DB) http.Handler {
+	savedSearchHandler := &handlers.SavedSearchHandler{
+		SavedSearchService: services.NewSavedSearchService(mysql.NewSavedSearchRepository(db)),
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", savedSearchHandler.ListSavedSearchesHandler)
+	r.Post("/", savedSearchHandler.CreateSavedSearchHandler)
+	r.Get("/{searchID:[0-9]+}", savedSearchHandler.GetSavedSearchHandler)
+	r.Put("/{searchID:[0-9]+}", savedSearchHandler.UpdateSavedSearchHandler)
+	r.Delete("/{searchID:[0-9]+}", savedSearchHandler.DeleteSavedSearchHandler)
+
+	return r
+}
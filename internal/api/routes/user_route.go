@@ -27,6 +27,7 @@ func UserRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
 	userHandler := &handlers.UserHandler{
 		UserService:  userService,
 		UploadService:  uploadService,
+		BankAccountService: services.NewBankAccountService(userRepo),
 		RabbitMQConn: rabbitConn,
 	}
 
@@ -37,7 +38,17 @@ func UserRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
 
 	r.With(middleware.AuthMiddleware).Get("/me", userHandler.GetMeHandler)
 
+	notificationHandler := &handlers.NotificationHandler{
+		NotificationService: services.NewNotificationService(mysql.NewNotificationRepository(db), nil),
+	}
+	r.With(middleware.AuthMiddleware).Get("/notification-preferences", notificationHandler.GetPreferencesHandler)
+	r.With(middleware.AuthMiddleware).Put("/notification-preferences", notificationHandler.UpdatePreferencesHandler)
+
 	r.With(middleware.AuthMiddleware).Post("/create-bank-account", userHandler.CreateBankAccountHandler)
+	r.With(middleware.AuthMiddleware).Get("/bank-accounts", userHandler.GetBankAccountsHandler)
+	r.With(middleware.AuthMiddleware).Post("/bank-accounts", userHandler.CreateBankAccountHandler)
+	r.With(middleware.AuthMiddleware).Put("/bank-accounts/{accountID:[0-9]+}", userHandler.UpdateBankAccountHandler)
+	r.With(middleware.AuthMiddleware).Delete("/bank-accounts/{accountID:[0-9]+}", userHandler.DeleteBankAccountHandler)
 
 	
 	r.With(middleware.AuthMiddleware).Post("/upload-profile-image", userHandler.UploadProfileImageHandler)
@@ -61,16 +72,21 @@ func UserRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
 	r.Get("/get-wishlist/{userID:[0-9]+}", userHandler.GetUserWishlist)
 
 	r.With(middleware.AuthMiddleware).Post("/listing/remove/{listingID:[0-9]+}", userHandler.RemoveListingHandler)
+	r.With(middleware.AuthMiddleware).Post("/listing/edit/{listingID:[0-9]+}", userHandler.UpdateListingHandler)
+	r.With(middleware.AuthMiddleware).Post("/listing/relist/{listingID:[0-9]+}", userHandler.RelistListingHandler)
 
 	r.Get("/user-info/{userID:[0-9]+}", userHandler.GetUserByIDHandler)
 
 
 	r.With(middleware.AuthMiddleware).Get("/book-wishlist/{bookID:[0-9]+}", userHandler.AddBookToWishListHandler)
 	r.With(middleware.AuthMiddleware).Get("/book-is-in-wishlist/{bookID:[0-9]+}", userHandler.IsBookInWishlistHandler)
+	r.With(middleware.AuthMiddleware).Post("/book-wishlist/{bookID:[0-9]+}/max-price", userHandler.SetWishlistMaxPriceHandler)
 
 	r.With(middleware.AuthMiddleware).Get("/get-listing-by-id/{listingID:[0-9]+}", userHandler.GetListingByIDHandler)
 
 	r.Get("/all-users", userHandler.GetAllUsersHandler)
+	// Same as GET /listings/, kept for existing clients
+	r.Get("/all-listings", userHandler.GetAllListingsHandler)
 
 	r.With(middleware.AuthMiddleware).With(middleware.AdminMiddleware(db)).Get("/user-count", userHandler.GetUserCount) // Sync books from Google Sheets
 
@@ -97,6 +113,8 @@ func UserRoutes(db *sql.DB, rabbitConn *amqp.Connection) http.Handler {
     r.With(middleware.AuthMiddleware).Post("/offers-rm", userHandler.RemoveFromOffersHandler)
 	r.With(middleware.AuthMiddleware).Post("/offers/accept", userHandler.AcceptOfferHandler)
 	r.With(middleware.AuthMiddleware).Post("/offers/reject", userHandler.RejectOfferHandler)
+	r.With(middleware.AuthMiddleware).Post("/offers/counter", userHandler.CounterOfferHandler)
+	r.With(middleware.AuthMiddleware).Get("/offers/{offerID:[0-9]+}", userHandler.GetOfferHandler)
 	r.With(middleware.AuthMiddleware).Get("/offers/{offerID:[0-9]+}/payment", userHandler.GetAcceptedOfferHandler)
 
 	r.With(middleware.AuthMiddleware).Post("/post-create", userHandler.CreatePostHandler)
@@ -91,7 +91,35 @@ type BookForm struct {
 	CoverImageURL string    `json:"cover_image_url,omitempty"`
 }
 
+// BookSearchParams holds the filters accepted by the catalog search endpoint.
+type BookSearchParams struct {
+	Query         string
+	Genres        []string
+	Languages     []string
+	PublishedFrom *time.Time
+	PublishedTo   *time.Time
+	MinRating     *float64
+	MaxRating     *float64
+	Page          int
+	Limit         int
+}
 
+// FacetCount is the number of matching books for a single facet value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
 
+type BookSearchFacets struct {
+	Genres    []FacetCount `json:"genres"`
+	Languages []FacetCount `json:"languages"`
+}
 
-
+// BookSearchResult is one page of relevance-ranked books plus facet counts.
+type BookSearchResult struct {
+	Books  []Book           `json:"books"`
+	Total  int              `json:"total"`
+	Page   int              `json:"page"`
+	Limit  int              `json:"limit"`
+	Facets BookSearchFacets `json:"facets"`
+}
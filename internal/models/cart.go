@@ -17,6 +17,7 @@ type CartItem struct {
 	CoverImageURL string  `json:"cover_image_url"`
 	ImageURL      string  `json:"image_url,omitempty"` // Added for first listing image
 	Status        string  `json:"status"`
+	Condition     ListingCondition `json:"condition"`
 
 }
 
@@ -29,7 +30,11 @@ type ListingDetails struct {
 	Status        string         `json:"status"`
 	AllowOffers   bool           `json:"allow_offers"`
 	SellerNote    string         `json:"seller_note" db:"seller_note"`
-	PhoneNumber   string `json:"phone_number" db:"phone_number"`
+	// Only shown to the seller; buyers use conversations instead
+	PhoneNumber   string `json:"phone_number,omitempty" db:"phone_number"`
+	Condition     ListingCondition `json:"condition"`
+	// Only shown to the seller
+	OfferThresholds
 
 	// Book details
 	Title         string    `json:"title"`
@@ -43,6 +48,7 @@ type ListingDetails struct {
 	AverageRating string    `json:"average_rating,omitempty"`
 	NumRatings    string    `json:"num_ratings,omitempty"`
 	ImageURLs     []string  `json:"image_urls"`
+	PriceHistory  []ListingPriceChange `json:"price_history"`
 }
 
 type OfferItem struct {
@@ -62,6 +68,10 @@ type OfferItem struct {
     BuyerPicture   string  `json:"buyer_picture_profile"` // New
 	InitialPrice   string  `json:"initial_price"`
 	Avaibility     string  `json:"avaibility"`
+	Condition      ListingCondition `json:"condition"`
+	ExpiresAt      *time.Time       `json:"expires_at,omitempty"`
+	PaymentDueAt   *time.Time       `json:"payment_due_at,omitempty"`
+	History        []OfferHistoryEntry `json:"history,omitempty"`
 }
 
 type MyPurchase struct {
@@ -77,6 +87,11 @@ type MyPurchase struct {
 
 	BookID            int     `json:"book_id"`           
 	SellerID          int     `json:"seller_id"`
+
+	OrderID        int    `json:"order_id"`
+	OrderStatus    string `json:"order_status"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"tracking_number,omitempty"`
 }
 
 type MyOrder struct {
@@ -94,4 +109,9 @@ type MyOrder struct {
 	BuyerProfileImage string  `json:"buyer_profile_image"`
 
 	BookID            int     `json:"book_id"`
+
+	OrderID        int    `json:"order_id"`
+	OrderStatus    string `json:"order_status"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"tracking_number,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// Dispute statuses: open → responded (once the seller answers) → resolved
+const (
+	DisputeOpen      = "open"
+	DisputeResponded = "responded"
+	DisputeResolved  = "resolved"
+)
+
+// Why the buyer opened a dispute
+const (
+	DisputeReasonNotReceived    = "not_received"
+	DisputeReasonDamaged        = "damaged"
+	DisputeReasonNotAsDescribed = "not_as_described"
+	DisputeReasonOther          = "other"
+)
+
+// How an admin resolved a dispute
+const (
+	DisputeFullRefund    = "full_refund"
+	DisputePartialRefund = "partial_refund"
+	DisputeRejected      = "rejected"
+)
+
+// Who wrote a dispute message
+const (
+	DisputeRoleBuyer  = "buyer"
+	DisputeRoleSeller = "seller"
+	DisputeRoleAdmin  = "admin"
+)
+
+// What a dispute message records
+const (
+	DisputeActionOpened    = "opened"
+	DisputeActionResponded = "responded"
+	DisputeActionCommented = "commented"
+	DisputeActionResolved  = "resolved"
+)
+
+// IsValidDisputeReason reports whether reason is one of the DisputeReason values
+func IsValidDisputeReason(reason string) bool {
+	switch reason {
+	case DisputeReasonNotReceived, DisputeReasonDamaged, DisputeReasonNotAsDescribed, DisputeReasonOther:
+		return true
+	}
+	return false
+}
+
+// Dispute is a buyer's complaint about an order, settled by an admin
+type Dispute struct {
+	ID            int        `json:"id"`
+	OrderID       int        `json:"order_id"`
+	TransactionID int        `json:"transaction_id"`
+	BuyerID       int        `json:"buyer_id"`
+	SellerID      int        `json:"seller_id"`
+	Reason        string     `json:"reason"`
+	Description   string     `json:"description"`
+	Status        string     `json:"status"`
+	Resolution    *string    `json:"resolution,omitempty"`
+	RefundAmount  *float64   `json:"refund_amount,omitempty"`
+	ResolvedBy    *int       `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	OrderAmount   float64    `json:"order_amount"`
+	BookTitle     string     `json:"book_title"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	Messages []DisputeMessage `json:"messages,omitempty"`
+}
+
+// DisputeMessage is one entry in a dispute's thread. Messages are never
+// edited or deleted, so the thread doubles as the dispute's audit log.
+type DisputeMessage struct {
+	ID         int       `json:"id"`
+	DisputeID  int       `json:"dispute_id"`
+	AuthorID   *int      `json:"author_id,omitempty"`
+	AuthorRole string    `json:"author_role"`
+	Action     string    `json:"action"`
+	Body       string    `json:"body"`
+	Images     []string  `json:"images"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OpenDisputeRequest is the "data" field of the multipart open-dispute form;
+// photos come in the "images" files
+type OpenDisputeRequest struct {
+	OrderID     int    `json:"order_id"`
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+}
+
+// DisputeMessageRequest is the "data" field of the multipart reply form
+type DisputeMessageRequest struct {
+	Body string `json:"body"`
+}
+
+// ResolveDisputeRequest settles a dispute. RefundAmount is only used for a
+// partial refund.
+type ResolveDisputeRequest struct {
+	Resolution   string  `json:"resolution"`
+	RefundAmount float64 `json:"refund_amount"`
+	Note         string  `json:"note"`
+}
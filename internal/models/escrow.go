@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Escrow entry statuses. Funds are 'held' until the sale's order completes,
+// then 'released' to be paid out to the seller.
+const (
+	EscrowHeld      = "held"
+	EscrowReleased  = "released"
+	EscrowPayingOut = "paying_out"
+	EscrowPaidOut   = "paid_out"
+	EscrowRefunded  = "refunded"
+	EscrowDisputed  = "disputed"
+)
+
+// Payout statuses
+const (
+	PayoutPending = "pending"
+	PayoutSent    = "sent"
+	PayoutFailed  = "failed"
+)
+
+// Payout is one Omise transfer of released escrow funds to a seller
+type Payout struct {
+	ID              int       `json:"id"`
+	SellerID        int       `json:"seller_id"`
+	Amount          float64   `json:"amount"`
+	RecipientID     string    `json:"-"`
+	OmiseTransferID *string   `json:"omise_transfer_id,omitempty"`
+	Status          string    `json:"status"`
+	FailureReason   *string   `json:"failure_reason,omitempty"`
+	EntryCount      int       `json:"entry_count"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SellerBalance sums a seller's escrow entries (net of the platform fee) by
+// where the money currently is.
+type SellerBalance struct {
+	Held        float64    `json:"held"`
+	Available   float64    `json:"available"`
+	InTransit   float64    `json:"in_transit"`
+	PaidOut     float64    `json:"paid_out"`
+	Disputed    float64    `json:"disputed"`
+	Refunded    float64    `json:"refunded"`
+	Fees        float64    `json:"fees"`
+	NextRelease *time.Time `json:"next_release,omitempty"`
+}
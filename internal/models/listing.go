@@ -0,0 +1,149 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrListingNotReserved is returned when a paid listing can't be marked sold
+// because it is no longer reserved, e.g. it was withdrawn or sold meanwhile.
+var ErrListingNotReserved = errors.New("listing is not in reserved state")
+
+// Condition grades a seller can give a listed copy, best to worst.
+var ConditionGrades = []string{"new", "like_new", "good", "fair", "poor"}
+
+// ConditionDefects are the known defects a listed copy can have.
+var ConditionDefects = []string{
+	"highlighting", "underlining", "notes_in_margin", "torn_pages", "missing_pages",
+	"water_damage", "stains", "loose_binding", "cover_wear", "name_written",
+}
+
+// BookFormats are the physical formats a listed copy can be.
+var BookFormats = []string{"hardcover", "paperback"}
+
+// ListingCondition describes the physical state of a listed copy.
+type ListingCondition struct {
+	Grade   string   `json:"grade,omitempty"`
+	Defects []string `json:"defects"`
+	Edition string   `json:"edition,omitempty"`
+	Format  string   `json:"format,omitempty"`
+}
+
+// IsValidConditionGrade reports whether grade is one of ConditionGrades.
+func IsValidConditionGrade(grade string) bool {
+	return slices.Contains(ConditionGrades, grade)
+}
+
+// IsValidConditionDefect reports whether defect is one of ConditionDefects.
+func IsValidConditionDefect(defect string) bool {
+	return slices.Contains(ConditionDefects, defect)
+}
+
+// IsValidBookFormat reports whether format is one of BookFormats.
+func IsValidBookFormat(format string) bool {
+	return slices.Contains(BookFormats, format)
+}
+
+// OfferThresholds let a seller have offers on a listing answered
+// automatically: offers below MinOfferPrice are rejected and offers at or
+// above AutoAcceptPrice are accepted. Nil means no threshold.
+type OfferThresholds struct {
+	MinOfferPrice   *float64 `json:"min_offer_price,omitempty"`
+	AutoAcceptPrice *float64 `json:"auto_accept_price,omitempty"`
+}
+
+// Validate checks the thresholds against the listing price
+func (t OfferThresholds) Validate(price float64) error {
+	if t.MinOfferPrice != nil && (*t.MinOfferPrice <= 0 || *t.MinOfferPrice >= price) {
+		return errors.New("min_offer_price must be more than 0 and less than the listing price")
+	}
+	if t.AutoAcceptPrice != nil && (*t.AutoAcceptPrice <= 0 || *t.AutoAcceptPrice > price) {
+		return errors.New("auto_accept_price must be more than 0 and at most the listing price")
+	}
+	if t.MinOfferPrice != nil && t.AutoAcceptPrice != nil && *t.MinOfferPrice >= *t.AutoAcceptPrice {
+		return errors.New("min_offer_price must be less than auto_accept_price")
+	}
+	return nil
+}
+
+// ListingSearchParams holds the filters accepted by the marketplace search.
+// Empty / nil fields are not filtered on.
+type ListingSearchParams struct {
+	// Book filters
+	Title    string
+	Author   string
+	Genres   []string
+	Language string
+
+	// Listing filters
+	MinPrice        *float64
+	MaxPrice        *float64
+	AllowOffers     *bool
+	Status          string
+	SellerID        *int
+	ConditionGrades []string
+	Formats         []string
+	WithoutDefects  []string
+	// Location is matched against the seller's province
+	Location string
+}
+
+// ListingSearchItem is one listing in the marketplace search results.
+type ListingSearchItem struct {
+	ListingID   int              `json:"listing_id"`
+	SellerID    int              `json:"seller_id"`
+	BookID      int              `json:"book_id"`
+	Price       float32          `json:"price"`
+	Status      string           `json:"status"`
+	AllowOffers bool             `json:"allow_offers"`
+	Condition   ListingCondition `json:"condition"`
+	CreatedAt   time.Time        `json:"created_at"`
+
+	// Book details
+	Title         string   `json:"title"`
+	Author        []string `json:"author"`
+	CoverImageURL string   `json:"cover_image_url"`
+	ImageURL      string   `json:"image_url,omitempty"`
+
+	// Seller details
+	SellerFirstName string `json:"seller_first_name"`
+	SellerLastName  string `json:"seller_last_name"`
+	SellerProvince  string `json:"seller_province,omitempty"`
+}
+
+// ListingUpdateForm is the body of the edit-listing endpoint. Nil fields are
+// left unchanged; an offer threshold of 0 removes it.
+type ListingUpdateForm struct {
+	Price           *float32          `json:"price"`
+	SellerNote      *string           `json:"seller_note"`
+	AllowOffers     *bool             `json:"allow_offers"`
+	PhoneNumber     *string           `json:"phone_number"`
+	Condition       *ListingCondition `json:"condition"`
+	RemoveImageURLs []string          `json:"remove_image_urls"`
+	OfferThresholds
+}
+
+// ListingUpdateResult tells the handler who needs to hear about an edit.
+type ListingUpdateResult struct {
+	PriceChanged bool
+	// OldPrice is the price before the edit
+	OldPrice       float32
+	RejectedOffers []RejectedOffer
+}
+
+// RejectedOffer is a pending offer that was rejected by a listing change.
+// Reason is "price_changed" or "below_minimum".
+type RejectedOffer struct {
+	OfferID int
+	BuyerID int
+	Reason  string
+}
+
+// ListingPriceChange is one entry in a listing's price history.
+// OldPrice is nil for the price the listing was created with.
+type ListingPriceChange struct {
+	OldPrice  *float32  `json:"old_price"`
+	NewPrice  float32   `json:"new_price"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// MaxMessageLength is the most characters a message's text can have
+const MaxMessageLength = 2000
+
+// Conversation is a buyer and seller talking about a listing, as seen by one
+// of them. The Other* fields describe the other participant.
+type Conversation struct {
+	ID        int  `json:"id"`
+	ListingID int  `json:"listing_id"`
+	OfferID   *int `json:"offer_id,omitempty"`
+	BuyerID   int  `json:"buyer_id"`
+	SellerID  int  `json:"seller_id"`
+
+	ListingTitle    string `json:"listing_title"`
+	ListingCoverURL string `json:"listing_cover_url,omitempty"`
+
+	OtherUserID    int    `json:"other_user_id"`
+	OtherFirstName string `json:"other_first_name"`
+	OtherLastName  string `json:"other_last_name"`
+	OtherPicture   string `json:"other_picture_profile,omitempty"`
+
+	LastMessage *Message `json:"last_message,omitempty"`
+	// UnreadCount is how many of the other participant's messages are unread
+	UnreadCount int `json:"unread_count"`
+	// Blocked is set when either participant blocked the other
+	Blocked bool `json:"blocked"`
+
+	LastMessageAt time.Time `json:"last_message_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Message is one message in a conversation. ReadAt is when the recipient
+// read it.
+type Message struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	SenderID       int        `json:"sender_id"`
+	Body           string     `json:"body"`
+	ImageURL       string     `json:"image_url,omitempty"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// BlockedUser is someone a user blocked
+type BlockedUser struct {
+	UserID         int       `json:"user_id"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	PictureProfile string    `json:"picture_profile,omitempty"`
+	BlockedAt      time.Time `json:"blocked_at"`
+}
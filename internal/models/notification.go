@@ -0,0 +1,327 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Notification queues. Handlers and workers publish NotificationEvents on
+// them and the notification consumer stores each one for its recipient.
+const (
+	QueueOffer       = "offer_queue"
+	QueuePayment     = "payment_queue"
+	QueueOrder       = "order_queue"
+	QueueDispute     = "dispute_queue"
+	QueueReservation = "reservation_queue"
+	QueueSocial      = "social_queue"
+	QueueWishlist    = "wishlist_queue"
+	QueueSavedSearch = "saved_search_queue"
+	QueueMessage     = "message_queue"
+)
+
+// NotificationQueues are the queues the notification consumer reads
+var NotificationQueues = []string{QueueOffer, QueuePayment, QueueOrder, QueueDispute, QueueReservation, QueueSocial, QueueWishlist, QueueSavedSearch, QueueMessage}
+
+// Notification types. Order and dispute notifications are typed
+// "order_<status>" and "dispute_<status>".
+const (
+	NotificationOffer               = "offer"
+	NotificationPaymentSuccess      = "payment_success"
+	NotificationPaymentReceived     = "payment_received"
+	NotificationPaymentFailed       = "payment_failed"
+	NotificationPaymentRefunded     = "payment_refunded"
+	NotificationPaymentDisputed     = "payment_disputed"
+	NotificationReservationPromoted = "reservation_promoted"
+	NotificationReservationExpiring = "reservation_expiring"
+	NotificationPostComment         = "post_comment"
+	NotificationPostLike            = "post_like"
+	NotificationWishlistMatch       = "wishlist_match"
+	NotificationPriceDrop           = "price_drop"
+	NotificationSavedSearchMatch    = "saved_search_match"
+	NotificationMessage             = "message"
+)
+
+// Notification categories users choose channels for. Notifications outside
+// them, e.g. disputes and reservations, always reach the inbox.
+const (
+	NotificationCategoryOffer         = "offer"
+	NotificationCategoryPayment       = "payment"
+	NotificationCategoryComment       = "comment"
+	NotificationCategoryLike          = "like"
+	NotificationCategoryWishlistMatch = "wishlist_match"
+	NotificationCategoryPriceDrop     = "price_drop"
+	NotificationCategorySavedSearch   = "saved_search"
+	NotificationCategoryMessage       = "message"
+)
+
+var NotificationCategories = []string{
+	NotificationCategoryOffer, NotificationCategoryPayment, NotificationCategoryComment,
+	NotificationCategoryLike, NotificationCategoryWishlistMatch, NotificationCategoryPriceDrop,
+	NotificationCategorySavedSearch, NotificationCategoryMessage,
+}
+
+// NotificationCategoryOf returns the category of a notification type, or ""
+// for types outside the categories. Orders count as payments.
+func NotificationCategoryOf(notificationType string) string {
+	switch {
+	case notificationType == NotificationOffer:
+		return NotificationCategoryOffer
+	case strings.HasPrefix(notificationType, "payment_"), strings.HasPrefix(notificationType, "order_"):
+		return NotificationCategoryPayment
+	case notificationType == NotificationPostComment:
+		return NotificationCategoryComment
+	case notificationType == NotificationPostLike:
+		return NotificationCategoryLike
+	case notificationType == NotificationWishlistMatch:
+		return NotificationCategoryWishlistMatch
+	case notificationType == NotificationPriceDrop:
+		return NotificationCategoryPriceDrop
+	case notificationType == NotificationSavedSearchMatch:
+		return NotificationCategorySavedSearch
+	case notificationType == NotificationMessage:
+		return NotificationCategoryMessage
+	}
+	return ""
+}
+
+// Notification channels
+const (
+	NotificationChannelInApp = "in_app"
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+	NotificationChannelPush  = "push"
+)
+
+var NotificationChannels = []string{NotificationChannelInApp, NotificationChannelEmail, NotificationChannelSMS, NotificationChannelPush}
+
+// DefaultChannelPreference is whether a category goes out on a channel for
+// users who never chose. Social activity and messages stay in the app and SMS
+// is opt-in.
+func DefaultChannelPreference(category string, channel string) bool {
+	switch channel {
+	case NotificationChannelInApp, NotificationChannelPush:
+		return true
+	case NotificationChannelEmail:
+		return category != NotificationCategoryComment && category != NotificationCategoryLike &&
+			category != NotificationCategoryMessage
+	}
+	return false
+}
+
+// Languages notifications are written in
+const (
+	LanguageThai    = "th"
+	LanguageEnglish = "en"
+)
+
+// NotificationEvent is the message published on a notification queue: one
+// notification for one user. Data holds the type's payload, one of the
+// *EventData structs below.
+type NotificationEvent struct {
+	// EventID identifies the event so redelivered messages are stored once
+	EventID   string          `json:"event_id"`
+	UserID    int             `json:"user_id"`
+	Type      string          `json:"type"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewNotificationEvent builds an event for userID with data as its payload
+func NewNotificationEvent(userID int, notificationType string, message string, data interface{}) NotificationEvent {
+	e := NotificationEvent{
+		UserID:    userID,
+		Type:      notificationType,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	if data != nil {
+		e.Data, _ = json.Marshal(data)
+	}
+	return e
+}
+
+// Validate checks an event read off a queue
+func (e NotificationEvent) Validate() error {
+	if e.EventID == "" || len(e.EventID) > 64 {
+		return errors.New("event_id is required and must be at most 64 characters")
+	}
+	if e.UserID <= 0 {
+		return errors.New("user_id is required")
+	}
+	if e.Type == "" || len(e.Type) > 50 {
+		return errors.New("type is required and must be at most 50 characters")
+	}
+	if len(e.Message) > 255 {
+		return errors.New("message must be at most 255 characters")
+	}
+	if len(e.Data) > 0 && !json.Valid(e.Data) {
+		return errors.New("data must be valid JSON")
+	}
+	return nil
+}
+
+// OfferEventData is the payload of "offer" notifications
+type OfferEventData struct {
+	OfferID   int     `json:"offer_id"`
+	ListingID int     `json:"listing_id"`
+	Action    string  `json:"action"`
+	Status    string  `json:"status"`
+	Price     float64 `json:"price,omitempty"`
+	Automatic bool    `json:"automatic,omitempty"`
+	// Reason says why the seller's listing change rejected the offer
+	Reason string `json:"reason,omitempty"`
+}
+
+// PaymentEventData is the payload of "payment_*" notifications. Buyers get
+// "payment_success" and sellers "payment_received".
+type PaymentEventData struct {
+	ListingIDs []int   `json:"listing_ids,omitempty"`
+	Amount     float64 `json:"amount,omitempty"`
+	// Reference is the provider's checkout session or payment
+	Reference string `json:"reference"`
+}
+
+// OrderEventData is the payload of "order_*" notifications
+type OrderEventData struct {
+	OrderID        int     `json:"order_id"`
+	ListingID      int     `json:"listing_id"`
+	Status         string  `json:"status"`
+	Carrier        *string `json:"carrier,omitempty"`
+	TrackingNumber *string `json:"tracking_number,omitempty"`
+}
+
+// DisputeEventData is the payload of "dispute_*" notifications
+type DisputeEventData struct {
+	DisputeID int    `json:"dispute_id"`
+	OrderID   int    `json:"order_id"`
+	Status    string `json:"status"`
+}
+
+// ReservationEventData is the payload of "reservation_*" notifications
+type ReservationEventData struct {
+	ListingID int       `json:"listing_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PostEventData is the payload of "post_*" notifications
+type PostEventData struct {
+	PostID    int `json:"post_id"`
+	ActorID   int `json:"actor_id"`
+	CommentID int `json:"comment_id,omitempty"`
+}
+
+// WishlistEventData is the payload of "wishlist_match" and "price_drop"
+// notifications. OldPrice is set for price drops.
+type WishlistEventData struct {
+	ListingID int      `json:"listing_id"`
+	BookID    int      `json:"book_id"`
+	Title     string   `json:"title"`
+	Price     float64  `json:"price"`
+	OldPrice  *float64 `json:"old_price,omitempty"`
+}
+
+// SavedSearchEventData is the payload of "saved_search_match" notifications
+type SavedSearchEventData struct {
+	SavedSearchID int    `json:"saved_search_id"`
+	Name          string `json:"name"`
+	ListingIDs    []int  `json:"listing_ids"`
+	Count         int    `json:"count"`
+}
+
+// MessageEventData is the payload of "message" notifications
+type MessageEventData struct {
+	ConversationID int `json:"conversation_id"`
+	MessageID      int `json:"message_id"`
+	ListingID      int `json:"listing_id"`
+	SenderID       int `json:"sender_id"`
+}
+
+// Notification is a stored notification as shown in the user's inbox
+type Notification struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Type      string          `json:"type"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	IsRead    bool            `json:"is_read"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NotificationSettings are a user's notification choices
+type NotificationSettings struct {
+	// Language is the language of emails, "th" or "en"
+	Language string `json:"language"`
+	// EmailEnabled turns all notification email on or off
+	EmailEnabled bool           `json:"email_enabled"`
+	QuietHours   QuietHours     `json:"quiet_hours"`
+	Digest       DigestSettings `json:"digest"`
+	// Preferences says, per category, which channels it goes out on
+	Preferences map[string]map[string]bool `json:"preferences"`
+}
+
+// QuietHours is a daily window, in Bangkok time, during which email, SMS and
+// push notifications are held back until it ends. Start and End are "HH:MM";
+// a window may run past midnight.
+type QuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start,omitempty"`
+	End     string `json:"end,omitempty"`
+}
+
+// DigestSettings collects notification emails into one email a day, sent at
+// Hour o'clock Bangkok time
+type DigestSettings struct {
+	Enabled bool `json:"enabled"`
+	Hour    int  `json:"hour"`
+}
+
+// Wants reports whether notifications of category go out on channel.
+// Notifications outside the categories only follow the email switch.
+func (s NotificationSettings) Wants(category string, channel string) bool {
+	if channel == NotificationChannelEmail && !s.EmailEnabled {
+		return false
+	}
+	if category == "" {
+		return channel == NotificationChannelInApp || channel == NotificationChannelEmail
+	}
+	if enabled, ok := s.Preferences[category][channel]; ok {
+		return enabled
+	}
+	return DefaultChannelPreference(category, channel)
+}
+
+// NotificationRecipient is who a notification outside the app goes to
+type NotificationRecipient struct {
+	UserID      int
+	Email       string
+	PhoneNumber string
+	FirstName   string
+	Language    string
+}
+
+// NotificationDelivery is a notification held back for a channel by quiet
+// hours or the daily digest
+type NotificationDelivery struct {
+	ID             int
+	NotificationID *int
+	UserID         int
+	Channel        string
+	Type           string
+	Message        string
+	Data           json.RawMessage
+	Digest         bool
+	DeliverAfter   time.Time
+	CreatedAt      time.Time
+}
+
+// EmailMessage is one rendered email
+type EmailMessage struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
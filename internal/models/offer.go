@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Offer statuses. A 'pending' offer waits on the seller and a 'countered' one
+// on the buyer; either side can accept, reject or counter while it's their
+// turn. Unanswered offers, and accepted ones left unpaid, end up 'expired'.
+// While the listing is promised to another buyer, through an accepted offer
+// or a reservation, open offers are 'suspended' and go back to where they
+// were if that falls through.
+const (
+	OfferPending   = "pending"
+	OfferCountered = "countered"
+	OfferAccepted  = "accepted"
+	OfferRejected  = "rejected"
+	OfferCompleted = "completed"
+	OfferExpired   = "expired"
+	OfferSuspended = "suspended"
+)
+
+// Offer history actions
+const (
+	OfferActionOffered        = "offered"
+	OfferActionCountered      = "countered"
+	OfferActionAccepted       = "accepted"
+	OfferActionRejected       = "rejected"
+	OfferActionExpired        = "expired"
+	OfferActionPaymentExpired = "payment_expired"
+	OfferActionSuspended      = "suspended"
+	OfferActionReinstated     = "reinstated"
+)
+
+// Who took an offer step
+const (
+	OfferRoleBuyer  = "buyer"
+	OfferRoleSeller = "seller"
+	OfferRoleSystem = "system"
+)
+
+// OfferHistoryEntry is one step of an offer's negotiation
+type OfferHistoryEntry struct {
+	ID        int       `json:"id"`
+	OfferID   int       `json:"offer_id"`
+	ActorID   *int      `json:"actor_id,omitempty"`
+	ActorRole string    `json:"actor_role"`
+	Action    string    `json:"action"`
+	Price     *float64  `json:"price,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OfferUpdate describes an offer after a negotiation step, for notifying the
+// parties
+type OfferUpdate struct {
+	OfferID   int     `json:"offer_id"`
+	ListingID int     `json:"listing_id"`
+	BuyerID   int     `json:"buyer_id"`
+	SellerID  int     `json:"seller_id"`
+	Price     float64 `json:"price"`
+	Status    string  `json:"status"`
+	Action    string  `json:"action"`
+	// ActorID is 0 when the system took the step
+	ActorID int `json:"actor_id"`
+	// Automatic is set when the listing's offer thresholds answered the offer
+	// on the seller's behalf
+	Automatic bool `json:"automatic"`
+	// Competing are other offers on the listing that this step suspended or
+	// reinstated
+	Competing []OfferUpdate `json:"-"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Order statuses: paid → shipped → delivered → completed, or cancelled
+// before shipping. A buyer's dispute holds the order in disputed until an
+// admin completes it or refunds it.
+const (
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+	OrderDisputed  = "disputed"
+	OrderRefunded  = "refunded"
+)
+
+// Order follows one sold listing from payment to the buyer receiving it
+type Order struct {
+	ID             int        `json:"id"`
+	TransactionID  int        `json:"transaction_id"`
+	ListingID      int        `json:"listing_id"`
+	BuyerID        int        `json:"buyer_id"`
+	SellerID       int        `json:"seller_id"`
+	Amount         float64    `json:"amount"`
+	Status         string     `json:"status"`
+	Carrier        *string    `json:"carrier,omitempty"`
+	TrackingNumber *string    `json:"tracking_number,omitempty"`
+	CancelReason   *string    `json:"cancel_reason,omitempty"`
+	BookTitle      string     `json:"book_title"`
+	ImageURL       string     `json:"image_url"`
+	ShippedAt      *time.Time `json:"shipped_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+	AutoCompleteAt *time.Time `json:"auto_complete_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// How the order was paid, for refunds
+	PaymentProvider  string `json:"-"`
+	PaymentReference string `json:"-"`
+}
+
+// ShipOrderRequest adds tracking to an order
+type ShipOrderRequest struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+// CancelOrderRequest cancels an order that hasn't shipped yet
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "errors"
+
+// ErrInvalidPageRequest is returned when a cursor, sort key or order can't be used.
+var ErrInvalidPageRequest = errors.New("invalid page request")
+
+// PageRequest is the cursor pagination input shared by list endpoints.
+// Cursor is the opaque next_cursor from a previous page; Sort must be one of
+// the keys the endpoint whitelists and Order is "asc" or "desc".
+type PageRequest struct {
+	Cursor string
+	Limit  int
+	Sort   string
+	Order  string
+}
+
+// PageInfo is returned next to a page of results.
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Limit      int    `json:"limit"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// CartCheckoutItem is a cart listing reserved for a multi-item checkout.
+type CartCheckoutItem struct {
+	ListingID int     `json:"listing_id"`
+	SellerID  int     `json:"seller_id"`
+	Price     float64 `json:"price"`
+	Title     string  `json:"title"`
+}
+
+// SessionTransaction is one per-listing transaction row belonging to a
+// payment session.
+type SessionTransaction struct {
+	ID        int     `json:"id"`
+	BuyerID   int     `json:"buyer_id"`
+	SellerID  int     `json:"seller_id"`
+	ListingID int     `json:"listing_id"`
+	OfferID   *int    `json:"offer_id,omitempty"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+// Payment providers a checkout can go through
+const (
+	PaymentProviderStripe = "stripe"
+	PaymentProviderOmise  = "omise"
+	PaymentProviderFake   = "fake"
+)
+
+// Provider-neutral webhook event types. Anything a provider reports that
+// doesn't change a payment maps to PaymentEventIgnored.
+const (
+	PaymentEventSucceeded = "payment_succeeded"
+	PaymentEventFailed    = "payment_failed"
+	PaymentEventRefunded  = "payment_refunded"
+	PaymentEventDisputed  = "payment_disputed"
+	PaymentEventIgnored   = "ignored"
+)
+
+// Provider-neutral payment statuses
+const (
+	PaymentStatusPending   = "pending"
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusRefunded  = "refunded"
+)
+
+// CheckoutLineItem is one listing being paid for in a checkout
+type CheckoutLineItem struct {
+	ListingID int     `json:"listing_id"`
+	Title     string  `json:"title"`
+	Amount    float64 `json:"amount"`
+}
+
+// CheckoutSessionRequest is what a payment provider needs to start a
+// checkout. Metadata comes back unchanged on the provider's webhook events.
+type CheckoutSessionRequest struct {
+	Items            []CheckoutLineItem
+	ExpiresInMinutes int
+	Metadata         map[string]string
+}
+
+// CheckoutSession is a started checkout: a hosted payment page, a QR code to
+// scan, or both, depending on the provider.
+type CheckoutSession struct {
+	Provider    string    `json:"provider"`
+	SessionID   string    `json:"session_id"`
+	CheckoutURL string    `json:"checkout_url,omitempty"`
+	QRCodeURL   string    `json:"qr_code_url,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// PaymentEvent is a verified webhook event translated out of the provider's
+// own format. SessionID matches CheckoutSession.SessionID; Reference is the
+// provider's payment ID that refunds and disputes refer to.
+type PaymentEvent struct {
+	Provider  string
+	EventID   string
+	RawType   string
+	Type      string
+	SessionID string
+	Reference string
+	Metadata  map[string]string
+	Amount    float64
+}
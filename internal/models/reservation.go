@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// Hold statuses. An active hold keeps a listing reserved for one buyer; it
+// ends converted when they pay, expired when it lapses and released when
+// their checkout is abandoned or fails, or the listing is taken down.
+const (
+	HoldActive    = "active"
+	HoldConverted = "converted"
+	HoldExpired   = "expired"
+	HoldReleased  = "released"
+)
+
+// What a hold was taken for
+const (
+	HoldSourceCheckout = "checkout"
+	HoldSourceCart     = "cart"
+	HoldSourceWaitlist = "waitlist"
+)
+
+// Waitlist entry statuses. 'closed' entries were still waiting when the
+// listing sold or was removed.
+const (
+	WaitlistWaiting  = "waiting"
+	WaitlistPromoted = "promoted"
+	WaitlistLeft     = "left"
+	WaitlistClosed   = "closed"
+)
+
+// ListingHold is one reservation of a listing for a buyer
+type ListingHold struct {
+	ID              int        `json:"id"`
+	ListingID       int        `json:"listing_id"`
+	BuyerID         int        `json:"buyer_id"`
+	OfferID         *int       `json:"offer_id,omitempty"`
+	Source          string     `json:"source"`
+	PaymentProvider *string    `json:"payment_provider,omitempty"`
+	Status          string     `json:"status"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+}
+
+// HoldRelease is what ending a hold set in motion: the waitlisted buyer who
+// was handed the listing, with any offers their hold suspended, or, when
+// nobody was waiting, the competing offers that came back
+type HoldRelease struct {
+	Promoted   []ListingHold
+	Suspended  []OfferUpdate
+	Reinstated []OfferUpdate
+}
+
+// Add merges another release into r
+func (r *HoldRelease) Add(other *HoldRelease) {
+	if other == nil {
+		return
+	}
+	r.Promoted = append(r.Promoted, other.Promoted...)
+	r.Suspended = append(r.Suspended, other.Suspended...)
+	r.Reinstated = append(r.Reinstated, other.Reinstated...)
+}
+
+// WaitlistEntry is a buyer's place in line for a reserved listing
+type WaitlistEntry struct {
+	ListingID int    `json:"listing_id"`
+	UserID    int    `json:"user_id"`
+	Status    string `json:"status"`
+	// Position is 1 for the next buyer in line and 0 when not waiting
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HoldCounts tallies holds by how they ended
+type HoldCounts struct {
+	Active    int `json:"active"`
+	Converted int `json:"converted"`
+	Expired   int `json:"expired"`
+	Released  int `json:"released"`
+	// ConversionRate is converted holds over holds that have ended
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ReservationMetrics summarises the holds taken since a point in time
+type ReservationMetrics struct {
+	Since      time.Time             `json:"since"`
+	Overall    HoldCounts            `json:"overall"`
+	BySource   map[string]HoldCounts `json:"by_source"`
+	ByProvider map[string]HoldCounts `json:"by_provider"`
+	// AvgSecondsToConvert is how long converted holds took to be paid
+	AvgSecondsToConvert float64 `json:"avg_seconds_to_convert"`
+	// Waiting is how many buyers are on a waitlist right now
+	Waiting int `json:"waiting"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxSavedSearches is how many searches a user can save
+const MaxSavedSearches = 20
+
+// SavedSearchQuery is the part of a marketplace search a user saves. Empty /
+// nil fields are not filtered on.
+type SavedSearchQuery struct {
+	// Book filters
+	Title    string   `json:"title,omitempty"`
+	Author   string   `json:"author,omitempty"`
+	Genres   []string `json:"genres,omitempty"`
+	Language string   `json:"language,omitempty"`
+
+	// Listing filters
+	MinPrice        *float64 `json:"min_price,omitempty"`
+	MaxPrice        *float64 `json:"max_price,omitempty"`
+	AllowOffers     *bool    `json:"allow_offers,omitempty"`
+	ConditionGrades []string `json:"conditions,omitempty"`
+	Formats         []string `json:"formats,omitempty"`
+	WithoutDefects  []string `json:"without_defects,omitempty"`
+	Location        string   `json:"location,omitempty"`
+}
+
+// Normalize trims the query's text filters and checks that it is a search
+// worth running
+func (q *SavedSearchQuery) Normalize() error {
+	q.Title = strings.TrimSpace(q.Title)
+	q.Author = strings.TrimSpace(q.Author)
+	q.Language = strings.TrimSpace(q.Language)
+	q.Location = strings.TrimSpace(q.Location)
+
+	for _, grade := range q.ConditionGrades {
+		if !IsValidConditionGrade(grade) {
+			return fmt.Errorf("invalid condition: %s", grade)
+		}
+	}
+	for _, format := range q.Formats {
+		if !IsValidBookFormat(format) {
+			return fmt.Errorf("invalid format: %s", format)
+		}
+	}
+	for _, defect := range q.WithoutDefects {
+		if !IsValidConditionDefect(defect) {
+			return fmt.Errorf("invalid without_defect: %s", defect)
+		}
+	}
+	if (q.MinPrice != nil && *q.MinPrice < 0) || (q.MaxPrice != nil && *q.MaxPrice < 0) {
+		return errors.New("prices can't be negative")
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return errors.New("min_price must not be above max_price")
+	}
+
+	if q.Title == "" && q.Author == "" && len(q.Genres) == 0 && q.Language == "" &&
+		q.MinPrice == nil && q.MaxPrice == nil && q.Location == "" {
+		return errors.New("a saved search needs at least a title, author, genre, language, price or location")
+	}
+	return nil
+}
+
+// Params returns the search over for-sale listings the query describes
+func (q SavedSearchQuery) Params() ListingSearchParams {
+	return ListingSearchParams{
+		Title:           q.Title,
+		Author:          q.Author,
+		Genres:          q.Genres,
+		Language:        q.Language,
+		MinPrice:        q.MinPrice,
+		MaxPrice:        q.MaxPrice,
+		AllowOffers:     q.AllowOffers,
+		Status:          "for_sale",
+		ConditionGrades: q.ConditionGrades,
+		Formats:         q.Formats,
+		WithoutDefects:  q.WithoutDefects,
+		Location:        q.Location,
+	}
+}
+
+// SavedSearch is a search a user asked to be told about new matches for
+type SavedSearch struct {
+	ID     int              `json:"id"`
+	UserID int              `json:"user_id"`
+	Name   string           `json:"name"`
+	Query  SavedSearchQuery `json:"query"`
+	// Notify turns match alerts on or off
+	Notify bool `json:"notify"`
+	// ListedAfter is when listings start counting as new matches
+	ListedAfter time.Time  `json:"-"`
+	LastRunAt   *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// SavedSearchForm creates or updates a saved search. On update nil fields
+// are left as they are.
+type SavedSearchForm struct {
+	Name   *string           `json:"name"`
+	Query  *SavedSearchQuery `json:"query"`
+	Notify *bool             `json:"notify"`
+}
+
+// SavedSearchMatch is the new listings a saved search found in one run.
+// ListingIDs holds the newest few of them; Count is how many there were.
+type SavedSearchMatch struct {
+	SavedSearchID int
+	UserID        int
+	Name          string
+	ListingIDs    []int
+	Count         int
+}
@@ -14,6 +14,7 @@ type User struct {
 	FirstName         string         `json:"first_name,omitempty" db:"first_name"`
 	LastName          string         `json:"last_name,omitempty" db:"last_name"`
 	Address          string         `json:"address,omitempty" db:"address"`
+	Province          string         `json:"province,omitempty" db:"province"`
 	PhoneNumber       string `json:"phone_number" db:"phone_number"`
 	Quote             string         `json:"quote" db:"quote"`
 	Bio               string         `json:"bio" db:"bio"`
@@ -23,14 +24,35 @@ type User struct {
 	UpdatedAt         time.Time      `json:"updated_at" db:"updated_at"`
 }
 
+// Payout account verification statuses, mirroring the Omise recipient.
+// 'unregistered' accounts have no recipient yet and must be re-entered.
+const (
+	BankAccountUnregistered = "unregistered"
+	BankAccountPending      = "pending"
+	BankAccountVerified     = "verified"
+	BankAccountRejected     = "rejected"
+)
+
+// BankAccount is a seller's payout account. The full account number is only
+// passed through to Omise; just the masked form is stored.
 type BankAccount struct {
-	ID                int
-	UserID            int
-	BankName          string
-	AccountNumber     string
-	AccountHolderName string
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	ID                  int        `json:"id"`
+	UserID              int        `json:"user_id"`
+	BankName            string     `json:"bank_name"`
+	AccountNumberMasked string     `json:"account_number"`
+	AccountHolderName   string     `json:"account_holder_name"`
+	OmiseRecipientID    string     `json:"-"`
+	VerificationStatus  string     `json:"verification_status"`
+	VerifiedAt          *time.Time `json:"verified_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// BankAccountRequest creates or updates a payout account
+type BankAccountRequest struct {
+	BankName          string `json:"bank_name"`
+	AccountNumber     string `json:"account_number"`
+	AccountHolderName string `json:"account_holder_name"`
 }
 
 // User represents a user in the system.
@@ -48,7 +70,9 @@ type GetMe struct {
 	Bio               string         `json:"bio" db:"bio"`
 	Role              string         `json:"role,omitempty" db:"role"`
 	HasBankAccount    bool    `json:"has_bank_account"` // ✅ just a boolean
+	PayoutAccountStatus string `json:"payout_account_status"` // best verification_status, "" without an account
 	Address          string         `json:"address,omitempty" db:"address"`
+	Province          string         `json:"province,omitempty" db:"province"`
 }
 
 type WishlistUser struct {
@@ -59,6 +83,15 @@ type WishlistUser struct {
 	ProfilePicture  string `json:"picture_profile" db:"picture_profile"`
 }
 
+// WishlistAlert is a user to tell that a listing matches their wishlist
+type WishlistAlert struct {
+	UserID    int
+	ListingID int
+	BookID    int
+	Title     string
+	Price     float64
+}
+
 type BookRequest struct {
 	ID              int    `json:"id"`
 	UserID          int    `json:"user_id"`
@@ -124,7 +157,8 @@ type UserAddListingForm struct {
 	AllowOffer bool    `json:"allow_offers" db:"allow_offers"`
 	SellerNote string  `json:"seller_note" db:"seller_note"`
 	PhoneNumber  string `json:"phone_number" db:"phone_number"`
-
+	Condition    ListingCondition `json:"condition"`
+	OfferThresholds
 }
 
 type UserLibrary struct {
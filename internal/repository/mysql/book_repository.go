@@ -200,45 +200,71 @@ func (br *BookRepository) GetOrInsertAuthor(ctx context.Context, authorName stri
 // 	return books, nil
 // }
 
-func (br *BookRepository) GetAllBooks(ctx context.Context) ([]models.Book, error) {
+func (br *BookRepository) GetAllBooks(ctx context.Context, page models.PageRequest) ([]models.Book, *models.PageInfo, error) {
+	if page.Sort == "" && page.Order == "" {
+		page.Sort, page.Order = "title", "asc"
+	}
+	kp, err := newKeysetPage(page, bookSortKeys, "title", "b.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
 	query := `
 		SELECT b.id, b.title, b.description, b.language, b.isbn, 
 			   b.publisher, b.publish_date, b.cover_image_url,
 			   COALESCE(br.average_rating, 0), 
-			   COALESCE(br.num_ratings, 0)
+			   COALESCE(br.num_ratings, 0),
+			   ` + kp.SortValue + `
 		FROM books b
 		LEFT JOIN book_ratings br ON b.id = br.book_id
+		WHERE 1 = 1` + kp.Where + `
+		ORDER BY ` + kp.OrderBy + `
+		LIMIT ?
 	`
+	args := append(kp.Args, kp.LimitArg())
 
-	rows, err := br.db.QueryContext(ctx, query)
+	rows, err := br.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying books: %w", err)
+		return nil, nil, fmt.Errorf("error querying books: %w", err)
 	}
 	defer rows.Close()
 
-	// 🧠 Fetch authors only once
-	authorsMap, err := br.GetAllBookAuthorsHelper(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("error loading book authors: %w", err)
-	}
-
-	var books []models.Book
+	books := []models.Book{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var book models.Book
+		var sortValue string
 		err := rows.Scan(
 			&book.ID, &book.Title, &book.Description,
 			&book.Language, &book.ISBN, &book.Publisher,
 			&book.PublishDate, &book.CoverImageURL,
 			&book.AverageRating, &book.NumRatings,
+			&sortValue,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning book: %w", err)
+			return nil, nil, fmt.Errorf("error scanning book: %w", err)
 		}
-		book.Author = authorsMap[book.ID]
 		books = append(books, book)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, book.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating books: %w", err)
+	}
+
+	books, info := trimPage(kp, books, sortValues, ids)
+
+	// 🧠 Fetch authors only for the books on this page
+	authorsMap, err := authorsByBookIDs(ctx, br.db, ids[:len(books)])
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading book authors: %w", err)
+	}
+	for i := range books {
+		books[i].Author = authorsMap[books[i].ID]
 	}
 
-	return books, nil
+	return books, info, nil
 }
 
 func (br *BookRepository) GetAllBookAuthorsHelper(ctx context.Context) (map[int][]string, error) {
@@ -324,34 +350,48 @@ func (br *BookRepository) NumberOfBooks(ctx context.Context) (int, error) {
 	return count, nil // Return the count and no error
 }
 
-func (br *BookRepository) GetReviewsByBookID(ctx context.Context, bookID int) ([]models.BookReview, error) {
-	query := `SELECT br.id, br.user_id, u.first_name, u.last_name, u.picture_profile, br.rating, br.comment, br.created_at, br.updated_at
+func (br *BookRepository) GetReviewsByBookID(ctx context.Context, bookID int, page models.PageRequest) ([]models.BookReview, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, reviewSortKeys, "created_at", "br.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `SELECT br.id, br.user_id, u.first_name, u.last_name, u.picture_profile, br.rating, br.comment, br.created_at, br.updated_at, ` + kp.SortValue + `
 			  FROM book_reviews br
 			  JOIN users u ON br.user_id = u.id
-			  WHERE br.book_id = ? 
-			  ORDER BY br.created_at DESC`
+			  WHERE br.book_id = ?` + kp.Where + `
+			  ORDER BY ` + kp.OrderBy + `
+			  LIMIT ?`
+	args := append([]interface{}{bookID}, kp.Args...)
+	args = append(args, kp.LimitArg())
 
-	rows, err := br.db.QueryContext(ctx, query, bookID)
+	rows, err := br.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var reviews []models.BookReview
+	reviews := []models.BookReview{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var review models.BookReview
-		err := rows.Scan(&review.ID, &review.UserID, &review.FirstName, &review.LastName, &review.UserProfile, &review.Rating, &review.Comment, &review.CreatedAt, &review.UpdatedAt)
+		var sortValue string
+		err := rows.Scan(&review.ID, &review.UserID, &review.FirstName, &review.LastName, &review.UserProfile, &review.Rating, &review.Comment, &review.CreatedAt, &review.UpdatedAt, &sortValue)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		reviews = append(reviews, review)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, review.ID)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return reviews, nil
+	reviews, info := trimPage(kp, reviews, sortValues, ids)
+	return reviews, info, nil
 }
 
 func (br *BookRepository) GetReviewsByUserID(ctx context.Context, userID int) ([]models.BookReview, error) {
@@ -725,3 +765,249 @@ func (br *BookRepository) ClearBookGenres(ctx context.Context, bookID int) error
 	_, err := br.db.ExecContext(ctx, `DELETE FROM book_genres WHERE book_id = ?`, bookID)
 	return err
 }
+
+const (
+	bookTextMatch   = `MATCH(b.title, b.description, b.publisher) AGAINST (? IN NATURAL LANGUAGE MODE)`
+	bookTitleMatch  = `MATCH(b.title) AGAINST (? IN NATURAL LANGUAGE MODE)`
+	authorTextMatch = `MATCH(a.name) AGAINST (? IN NATURAL LANGUAGE MODE)`
+)
+
+// buildBookSearchWhere turns the search params into a WHERE clause over
+// books b / book_ratings br. The genre or language filter can be skipped so
+// facet counts for that dimension still show the other options.
+func buildBookSearchWhere(params models.BookSearchParams, skipGenres bool, skipLanguages bool) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if params.Query != "" {
+		conditions = append(conditions, `(`+bookTextMatch+` OR EXISTS (
+			SELECT 1 FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id AND `+authorTextMatch+`))`)
+		args = append(args, params.Query, params.Query)
+	}
+
+	if !skipGenres && len(params.Genres) > 0 {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM book_genres bg
+			JOIN genres g ON g.id = bg.genre_id
+			WHERE bg.book_id = b.id AND g.name IN (`+placeholders(len(params.Genres))+`))`)
+		for _, genre := range params.Genres {
+			args = append(args, genre)
+		}
+	}
+
+	if !skipLanguages && len(params.Languages) > 0 {
+		conditions = append(conditions, `b.language IN (`+placeholders(len(params.Languages))+`)`)
+		for _, language := range params.Languages {
+			args = append(args, language)
+		}
+	}
+
+	if params.PublishedFrom != nil {
+		conditions = append(conditions, "b.publish_date >= ?")
+		args = append(args, *params.PublishedFrom)
+	}
+	if params.PublishedTo != nil {
+		conditions = append(conditions, "b.publish_date <= ?")
+		args = append(args, *params.PublishedTo)
+	}
+
+	if params.MinRating != nil {
+		conditions = append(conditions, "COALESCE(br.average_rating, 0) >= ?")
+		args = append(args, *params.MinRating)
+	}
+	if params.MaxRating != nil {
+		conditions = append(conditions, "COALESCE(br.average_rating, 0) <= ?")
+		args = append(args, *params.MaxRating)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// placeholders returns "?, ?, ..." for an IN clause with n values
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SearchBooks runs a full-text, faceted search over the catalog. Results are
+// ranked by relevance when a query is given (title matches weigh double), and
+// by title otherwise.
+func (br *BookRepository) SearchBooks(ctx context.Context, params models.BookSearchParams) (*models.BookSearchResult, error) {
+	where, args := buildBookSearchWhere(params, false, false)
+
+	relevance := "0"
+	var relevanceArgs []interface{}
+	orderBy := "b.title ASC, b.id ASC"
+	if params.Query != "" {
+		relevance = `(2 * ` + bookTitleMatch + ` + ` + bookTextMatch + ` + COALESCE((
+			SELECT MAX(` + authorTextMatch + `)
+			FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id), 0))`
+		relevanceArgs = []interface{}{params.Query, params.Query, params.Query}
+		orderBy = "relevance DESC, b.id ASC"
+	}
+
+	query := `
+		SELECT b.id, b.title, b.description, b.language, b.isbn,
+			   b.publisher, b.publish_date, b.cover_image_url,
+			   COALESCE(br.average_rating, 0),
+			   COALESCE(br.num_ratings, 0),
+			   ` + relevance + ` AS relevance
+		FROM books b
+		LEFT JOIN book_ratings br ON b.id = br.book_id
+		WHERE ` + where + `
+		ORDER BY ` + orderBy + `
+		LIMIT ? OFFSET ?
+	`
+	queryArgs := append(append([]interface{}{}, relevanceArgs...), args...)
+	queryArgs = append(queryArgs, params.Limit, (params.Page-1)*params.Limit)
+
+	rows, err := br.db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching books: %w", err)
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	var bookIDs []int
+	for rows.Next() {
+		var book models.Book
+		var relevanceScore float64
+		err := rows.Scan(
+			&book.ID, &book.Title, &book.Description,
+			&book.Language, &book.ISBN, &book.Publisher,
+			&book.PublishDate, &book.CoverImageURL,
+			&book.AverageRating, &book.NumRatings,
+			&relevanceScore,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning book: %w", err)
+		}
+		books = append(books, book)
+		bookIDs = append(bookIDs, book.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating books: %w", err)
+	}
+
+	// Only load authors for the books on this page
+	authorsMap, err := authorsByBookIDs(ctx, br.db, bookIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error loading book authors: %w", err)
+	}
+	for i := range books {
+		books[i].Author = authorsMap[books[i].ID]
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM books b LEFT JOIN book_ratings br ON b.id = br.book_id WHERE ` + where
+	if err := br.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("error counting books: %w", err)
+	}
+
+	genreFacets, err := br.searchGenreFacets(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	languageFacets, err := br.searchLanguageFacets(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BookSearchResult{
+		Books: books,
+		Total: total,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Facets: models.BookSearchFacets{
+			Genres:    genreFacets,
+			Languages: languageFacets,
+		},
+	}, nil
+}
+
+func (br *BookRepository) searchGenreFacets(ctx context.Context, params models.BookSearchParams) ([]models.FacetCount, error) {
+	where, args := buildBookSearchWhere(params, true, false)
+	query := `
+		SELECT g.name, COUNT(DISTINCT b.id) AS book_count
+		FROM books b
+		LEFT JOIN book_ratings br ON b.id = br.book_id
+		JOIN book_genres bg ON bg.book_id = b.id
+		JOIN genres g ON g.id = bg.genre_id
+		WHERE ` + where + `
+		GROUP BY g.id, g.name
+		ORDER BY book_count DESC, g.name ASC
+	`
+	return br.queryFacets(ctx, query, args)
+}
+
+func (br *BookRepository) searchLanguageFacets(ctx context.Context, params models.BookSearchParams) ([]models.FacetCount, error) {
+	where, args := buildBookSearchWhere(params, false, true)
+	query := `
+		SELECT COALESCE(b.language, ''), COUNT(*) AS book_count
+		FROM books b
+		LEFT JOIN book_ratings br ON b.id = br.book_id
+		WHERE ` + where + `
+		GROUP BY b.language
+		ORDER BY book_count DESC
+	`
+	return br.queryFacets(ctx, query, args)
+}
+
+func (br *BookRepository) queryFacets(ctx context.Context, query string, args []interface{}) ([]models.FacetCount, error) {
+	rows, err := br.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying facets: %w", err)
+	}
+	defer rows.Close()
+
+	facets := []models.FacetCount{}
+	for rows.Next() {
+		var facet models.FacetCount
+		if err := rows.Scan(&facet.Value, &facet.Count); err != nil {
+			return nil, fmt.Errorf("error scanning facet: %w", err)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
+
+// authorsByBookIDs loads authors for a set of books in one query
+func authorsByBookIDs(ctx context.Context, db dbtx, bookIDs []int) (map[int][]string, error) {
+	authorsMap := make(map[int][]string)
+	if len(bookIDs) == 0 {
+		return authorsMap, nil
+	}
+
+	query := `
+		SELECT ba.book_id, a.name
+		FROM book_authors ba
+		JOIN authors a ON ba.author_id = a.id
+		WHERE ba.book_id IN (` + placeholders(len(bookIDs)) + `)
+	`
+	args := make([]interface{}, len(bookIDs))
+	for i, id := range bookIDs {
+		args[i] = id
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int
+		var authorName string
+		if err := rows.Scan(&bookID, &authorName); err != nil {
+			return nil, err
+		}
+		authorsMap[bookID] = append(authorsMap[bookID], authorName)
+	}
+	return authorsMap, rows.Err()
+}
@@ -0,0 +1,247 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"used2book-backend/internal/models"
+)
+
+var disputeSortKeys = map[string]string{
+	"created_at": "d.created_at",
+}
+
+const disputeColumns = `
+        SELECT d.id, d.order_id, d.transaction_id, COALESCE(d.buyer_id, 0), COALESCE(d.seller_id, 0),
+               d.reason, d.description, d.status, d.resolution, d.refund_amount, d.resolved_by, d.resolved_at,
+               o.amount, COALESCE(b.title, ''), d.created_at, d.updated_at`
+
+const disputeJoins = `
+        FROM disputes d
+        JOIN orders o ON d.order_id = o.id
+        LEFT JOIN listings l ON o.listing_id = l.id
+        LEFT JOIN books b ON l.book_id = b.id`
+
+type DisputeRepository struct {
+	txRunner
+}
+
+func NewDisputeRepository(db *sql.DB) *DisputeRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &DisputeRepository{txRunner{db}}
+}
+
+// CreateDispute opens a dispute on an order and returns its ID
+func (dr *DisputeRepository) CreateDispute(ctx context.Context, order *models.Order, reason string, description string) (int, error) {
+	result, err := conn(ctx, dr.db).ExecContext(ctx, `
+        INSERT INTO disputes (order_id, transaction_id, buyer_id, seller_id, reason, description, status)
+        VALUES (?, ?, ?, ?, ?, ?, 'open')`,
+		order.ID, order.TransactionID, order.BuyerID, order.SellerID, reason, description)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create dispute: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dispute ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// AddMessage appends a message with its images to a dispute's thread
+func (dr *DisputeRepository) AddMessage(ctx context.Context, disputeID int, authorID int, role string, action string, body string, imageURLs []string) error {
+	tx := conn(ctx, dr.db)
+	result, err := tx.ExecContext(ctx, `
+        INSERT INTO dispute_messages (dispute_id, author_id, author_role, action, body)
+        VALUES (?, ?, ?, ?, ?)`, disputeID, authorID, role, action, body)
+	if err != nil {
+		return fmt.Errorf("failed to add dispute message: %w", err)
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get dispute message ID: %w", err)
+	}
+
+	for _, url := range imageURLs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO dispute_message_images (message_id, image_url) VALUES (?, ?)`, messageID, url)
+		if err != nil {
+			return fmt.Errorf("failed to add dispute image: %w", err)
+		}
+	}
+	return nil
+}
+
+// ExistsForOrder reports whether an order has ever been disputed
+func (dr *DisputeRepository) ExistsForOrder(ctx context.Context, orderID int) (bool, error) {
+	var exists bool
+	err := conn(ctx, dr.db).QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM disputes WHERE order_id = ?)`, orderID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for dispute: %w", err)
+	}
+	return exists, nil
+}
+
+func scanDispute(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.Dispute, error) {
+	var d models.Dispute
+	var resolution sql.NullString
+	var refundAmount sql.NullFloat64
+	var resolvedBy sql.NullInt64
+	var resolvedAt sql.NullTime
+	dest := []interface{}{
+		&d.ID, &d.OrderID, &d.TransactionID, &d.BuyerID, &d.SellerID,
+		&d.Reason, &d.Description, &d.Status, &resolution, &refundAmount, &resolvedBy, &resolvedAt,
+		&d.OrderAmount, &d.BookTitle, &d.CreatedAt, &d.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if resolution.Valid {
+		d.Resolution = &resolution.String
+	}
+	if refundAmount.Valid {
+		d.RefundAmount = &refundAmount.Float64
+	}
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		d.ResolvedBy = &id
+	}
+	if resolvedAt.Valid {
+		d.ResolvedAt = &resolvedAt.Time
+	}
+	return &d, nil
+}
+
+// GetDisputeByID returns a dispute with its full thread, or nil if not found
+func (dr *DisputeRepository) GetDisputeByID(ctx context.Context, disputeID int) (*models.Dispute, error) {
+	query := disputeColumns + disputeJoins + ` WHERE d.id = ?`
+	d, err := scanDispute(conn(ctx, dr.db).QueryRowContext(ctx, query, disputeID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching dispute: %w", err)
+	}
+
+	d.Messages, err = dr.getMessages(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// getMessages returns a dispute's thread, oldest first
+func (dr *DisputeRepository) getMessages(ctx context.Context, disputeID int) ([]models.DisputeMessage, error) {
+	rows, err := conn(ctx, dr.db).QueryContext(ctx, `
+        SELECT m.id, m.dispute_id, m.author_id, m.author_role, m.action, m.body, m.created_at,
+               COALESCE(GROUP_CONCAT(i.image_url ORDER BY i.id SEPARATOR '\n'), '')
+        FROM dispute_messages m
+        LEFT JOIN dispute_message_images i ON i.message_id = m.id
+        WHERE m.dispute_id = ?
+        GROUP BY m.id
+        ORDER BY m.created_at, m.id`, disputeID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dispute messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.DisputeMessage{}
+	for rows.Next() {
+		var m models.DisputeMessage
+		var authorID sql.NullInt64
+		var images string
+		if err := rows.Scan(&m.ID, &m.DisputeID, &authorID, &m.AuthorRole, &m.Action, &m.Body, &m.CreatedAt, &images); err != nil {
+			return nil, fmt.Errorf("error scanning dispute message: %w", err)
+		}
+		if authorID.Valid {
+			id := int(authorID.Int64)
+			m.AuthorID = &id
+		}
+		m.Images = []string{}
+		if images != "" {
+			m.Images = strings.Split(images, "\n")
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// ListDisputes returns one page of disputes, newest first by default. A
+// userID above zero limits it to disputes the user is a party to.
+func (dr *DisputeRepository) ListDisputes(ctx context.Context, userID int, status string, page models.PageRequest) ([]models.Dispute, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, disputeSortKeys, "created_at", "d.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := disputeColumns + `, ` + kp.SortValue + disputeJoins + ` WHERE 1 = 1`
+	var args []interface{}
+	if userID > 0 {
+		query += ` AND (d.buyer_id = ? OR d.seller_id = ?)`
+		args = append(args, userID, userID)
+	}
+	if status != "" {
+		query += ` AND d.status = ?`
+		args = append(args, status)
+	}
+	query += kp.Where + ` ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := dr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying disputes: %w", err)
+	}
+	defer rows.Close()
+
+	var disputes []models.Dispute
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var sortValue string
+		d, err := scanDispute(rows, &sortValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning dispute: %w", err)
+		}
+		disputes = append(disputes, *d)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	disputes, info := trimPage(kp, disputes, sortValues, ids)
+	return disputes, info, nil
+}
+
+// MarkResponded moves an open dispute to 'responded' once the seller answers
+func (dr *DisputeRepository) MarkResponded(ctx context.Context, disputeID int) error {
+	_, err := conn(ctx, dr.db).ExecContext(ctx, `
+        UPDATE disputes SET status = 'responded' WHERE id = ? AND status = 'open'`, disputeID)
+	if err != nil {
+		return fmt.Errorf("failed to update dispute: %w", err)
+	}
+	return nil
+}
+
+// ResolveDispute records an admin's resolution and reports whether the
+// dispute was still unresolved
+func (dr *DisputeRepository) ResolveDispute(ctx context.Context, disputeID int, adminID int, resolution string, refundAmount float64) (bool, error) {
+	result, err := conn(ctx, dr.db).ExecContext(ctx, `
+        UPDATE disputes
+        SET status = 'resolved', resolution = ?, refund_amount = ?, resolved_by = ?, resolved_at = NOW()
+        WHERE id = ? AND status IN ('open', 'responded')`,
+		resolution, refundAmount, adminID, disputeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve dispute: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
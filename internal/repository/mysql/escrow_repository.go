@@ -0,0 +1,394 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"used2book-backend/internal/models"
+)
+
+var payoutSortKeys = map[string]string{
+	"created_at": "p.created_at",
+}
+
+type EscrowRepository struct {
+	db *sql.DB
+}
+
+func NewEscrowRepository(db *sql.DB) *EscrowRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &EscrowRepository{db}
+}
+
+// HoldSessionFunds opens an escrow entry for every completed transaction of a
+// checkout session. The platform takes feePercent of each sale; the rest is
+// held for the seller until the sale's order completes. Entries that already
+// exist are left alone, so replays are harmless.
+func (er *EscrowRepository) HoldSessionFunds(ctx context.Context, sessionID string, feePercent float64) error {
+	query := `
+        INSERT INTO escrow_entries (transaction_id, seller_id, buyer_id, listing_id,
+                                    gross_amount, fee_amount, net_amount, status)
+        SELECT t.id, COALESCE(t.seller_id, l.seller_id), t.buyer_id, t.listing_id,
+               t.transaction_amount,
+               ROUND(t.transaction_amount * ? / 100, 2),
+               t.transaction_amount - ROUND(t.transaction_amount * ? / 100, 2),
+               'held'
+        FROM transactions t
+        JOIN listings l ON t.listing_id = l.id
+        WHERE t.stripe_session_id = ? AND t.payment_status = 'completed'
+        ON DUPLICATE KEY UPDATE id = id
+    `
+	_, err := conn(ctx, er.db).ExecContext(ctx, query, feePercent, feePercent, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to hold escrow funds: %w", err)
+	}
+	return nil
+}
+
+// ReverseFunds moves the unpaid escrow entries of a payment into status
+// ('refunded' or 'disputed'). It returns how many of the payment's entries
+// had already been paid out to the seller and so could not be stopped.
+func (er *EscrowRepository) ReverseFunds(ctx context.Context, reference string, status string) (int, error) {
+	tx := conn(ctx, er.db)
+
+	_, err := tx.ExecContext(ctx, `
+        UPDATE escrow_entries e
+        JOIN transactions t ON e.transaction_id = t.id
+        SET e.status = ?
+        WHERE t.payment_reference = ? AND e.status IN ('held', 'released', 'disputed')`, status, reference)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reverse escrow funds: %w", err)
+	}
+
+	var paidOut int
+	err = tx.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM escrow_entries e
+        JOIN transactions t ON e.transaction_id = t.id
+        WHERE t.payment_reference = ? AND e.status IN ('paying_out', 'paid_out')`, reference).Scan(&paidOut)
+	if err != nil {
+		return 0, fmt.Errorf("error counting paid out escrow entries: %w", err)
+	}
+	return paidOut, nil
+}
+
+// ReleaseTransactionFunds releases the funds held for one sale so the next
+// payout run pays them to the seller
+func (er *EscrowRepository) ReleaseTransactionFunds(ctx context.Context, transactionID int) error {
+	_, err := conn(ctx, er.db).ExecContext(ctx, `
+        UPDATE escrow_entries SET status = 'released', released_at = NOW()
+        WHERE transaction_id = ? AND status = 'held'`, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to release escrow funds: %w", err)
+	}
+	return nil
+}
+
+// RefundTransactionFunds takes back the funds held for one sale when its
+// order is cancelled or refunded before the seller was paid
+func (er *EscrowRepository) RefundTransactionFunds(ctx context.Context, transactionID int) error {
+	_, err := conn(ctx, er.db).ExecContext(ctx, `
+        UPDATE escrow_entries SET status = 'refunded'
+        WHERE transaction_id = ? AND status IN ('held', 'released', 'disputed')`, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to refund escrow funds: %w", err)
+	}
+	return nil
+}
+
+// DisputeTransactionFunds freezes the unpaid funds of a sale while its
+// dispute is open, so no payout picks them up
+func (er *EscrowRepository) DisputeTransactionFunds(ctx context.Context, transactionID int) error {
+	_, err := conn(ctx, er.db).ExecContext(ctx, `
+        UPDATE escrow_entries SET status = 'disputed'
+        WHERE transaction_id = ? AND status IN ('held', 'released')`, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to freeze escrow funds: %w", err)
+	}
+	return nil
+}
+
+// ReleaseDisputedFunds releases the funds of a sale whose dispute went the
+// seller's way, less any partial refund given to the buyer
+func (er *EscrowRepository) ReleaseDisputedFunds(ctx context.Context, transactionID int, refundAmount float64) error {
+	_, err := conn(ctx, er.db).ExecContext(ctx, `
+        UPDATE escrow_entries
+        SET status = 'released', released_at = NOW(), net_amount = GREATEST(net_amount - ?, 0)
+        WHERE transaction_id = ? AND status = 'disputed'`, refundAmount, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to release disputed funds: %w", err)
+	}
+	return nil
+}
+
+// IsTransactionPaidOut reports whether the seller has already been paid for
+// a sale
+func (er *EscrowRepository) IsTransactionPaidOut(ctx context.Context, transactionID int) (bool, error) {
+	var paidOut bool
+	err := conn(ctx, er.db).QueryRowContext(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM escrow_entries
+            WHERE transaction_id = ? AND status IN ('paying_out', 'paid_out')
+        )`, transactionID).Scan(&paidOut)
+	if err != nil {
+		return false, fmt.Errorf("error checking escrow payout: %w", err)
+	}
+	return paidOut, nil
+}
+
+// GetSellersWithReleasedFunds lists sellers that have released funds waiting
+// for a payout.
+func (er *EscrowRepository) GetSellersWithReleasedFunds(ctx context.Context) ([]int, error) {
+	rows, err := er.db.QueryContext(ctx, `SELECT DISTINCT seller_id FROM escrow_entries WHERE status = 'released'`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sellers with released funds: %w", err)
+	}
+	defer rows.Close()
+
+	var sellerIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning seller ID: %w", err)
+		}
+		sellerIDs = append(sellerIDs, id)
+	}
+	return sellerIDs, rows.Err()
+}
+
+// GetPayoutRecipient returns the Omise recipient of the seller's newest
+// verified payout account, or "" if they have none.
+func (er *EscrowRepository) GetPayoutRecipient(ctx context.Context, sellerID int) (string, error) {
+	var recipientID string
+	err := er.db.QueryRowContext(ctx, `
+        SELECT omise_recipient_id FROM bank_accounts
+        WHERE user_id = ? AND verification_status = 'verified' AND omise_recipient_id IS NOT NULL
+        ORDER BY id DESC LIMIT 1`, sellerID).Scan(&recipientID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error fetching payout recipient: %w", err)
+	}
+	return recipientID, nil
+}
+
+// CreatePayout gathers all of a seller's released entries into a pending
+// payout to recipientID. It returns nil when there is nothing to pay out.
+func (er *EscrowRepository) CreatePayout(ctx context.Context, sellerID int, recipientID string) (*models.Payout, error) {
+	var payout *models.Payout
+	err := runInTx(ctx, er.db, func(ctx context.Context) error {
+		tx := conn(ctx, er.db)
+
+		rows, err := tx.QueryContext(ctx, `
+            SELECT net_amount FROM escrow_entries
+            WHERE seller_id = ? AND status = 'released'
+            FOR UPDATE`, sellerID)
+		if err != nil {
+			return fmt.Errorf("error querying released funds: %w", err)
+		}
+		var count int
+		var amount float64
+		for rows.Next() {
+			var net float64
+			if err := rows.Scan(&net); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning released funds: %w", err)
+			}
+			count++
+			amount += net
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		amount = math.Round(amount*100) / 100
+		if count == 0 || amount <= 0 {
+			return nil
+		}
+
+		result, err := tx.ExecContext(ctx, `
+            INSERT INTO payouts (seller_id, amount, recipient_id, status)
+            VALUES (?, ?, ?, 'pending')`, sellerID, amount, recipientID)
+		if err != nil {
+			return fmt.Errorf("failed to create payout: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting payout ID: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+            UPDATE escrow_entries SET status = 'paying_out', payout_id = ?
+            WHERE seller_id = ? AND status = 'released'`, id, sellerID)
+		if err != nil {
+			return fmt.Errorf("failed to attach escrow entries to payout: %w", err)
+		}
+
+		payout = &models.Payout{
+			ID:          int(id),
+			SellerID:    sellerID,
+			Amount:      amount,
+			RecipientID: recipientID,
+			Status:      models.PayoutPending,
+			EntryCount:  count,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+// CompletePayout records the Omise transfer that paid a payout
+func (er *EscrowRepository) CompletePayout(ctx context.Context, payoutID int, transferID string) error {
+	return runInTx(ctx, er.db, func(ctx context.Context) error {
+		tx := conn(ctx, er.db)
+		_, err := tx.ExecContext(ctx, `
+            UPDATE payouts SET status = 'sent', omise_transfer_id = ?, failure_reason = NULL
+            WHERE id = ?`, transferID, payoutID)
+		if err != nil {
+			return fmt.Errorf("failed to complete payout: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE escrow_entries SET status = 'paid_out'
+            WHERE payout_id = ? AND status = 'paying_out'`, payoutID)
+		if err != nil {
+			return fmt.Errorf("failed to mark escrow entries paid out: %w", err)
+		}
+		return nil
+	})
+}
+
+// FailPayout records why a transfer failed and puts its entries back to
+// 'released' so the next run retries them.
+func (er *EscrowRepository) FailPayout(ctx context.Context, payoutID int, reason string) error {
+	return runInTx(ctx, er.db, func(ctx context.Context) error {
+		tx := conn(ctx, er.db)
+		_, err := tx.ExecContext(ctx, `UPDATE payouts SET status = 'failed', failure_reason = ? WHERE id = ?`, reason, payoutID)
+		if err != nil {
+			return fmt.Errorf("failed to mark payout failed: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE escrow_entries SET status = 'released', payout_id = NULL
+            WHERE payout_id = ? AND status = 'paying_out'`, payoutID)
+		if err != nil {
+			return fmt.Errorf("failed to release escrow entries: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetSellerBalance sums a seller's escrow entries by status
+func (er *EscrowRepository) GetSellerBalance(ctx context.Context, sellerID int) (*models.SellerBalance, error) {
+	rows, err := er.db.QueryContext(ctx, `
+        SELECT status, SUM(net_amount), SUM(fee_amount)
+        FROM escrow_entries
+        WHERE seller_id = ?
+        GROUP BY status`, sellerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying seller balance: %w", err)
+	}
+	defer rows.Close()
+
+	var balance models.SellerBalance
+	for rows.Next() {
+		var status string
+		var net, fee float64
+		if err := rows.Scan(&status, &net, &fee); err != nil {
+			return nil, fmt.Errorf("error scanning seller balance: %w", err)
+		}
+		switch status {
+		case models.EscrowHeld:
+			balance.Held = net
+		case models.EscrowReleased:
+			balance.Available = net
+		case models.EscrowPayingOut:
+			balance.InTransit = net
+		case models.EscrowPaidOut:
+			balance.PaidOut = net
+		case models.EscrowDisputed:
+			balance.Disputed = net
+		case models.EscrowRefunded:
+			balance.Refunded = net
+			// The fee is returned along with the refund
+			continue
+		}
+		balance.Fees += fee
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Held funds release at the latest when their shipped order auto-completes
+	var nextRelease sql.NullTime
+	err = er.db.QueryRowContext(ctx, `
+        SELECT MIN(o.auto_complete_at)
+        FROM escrow_entries e
+        JOIN orders o ON o.transaction_id = e.transaction_id
+        WHERE e.seller_id = ? AND e.status = 'held'`, sellerID).Scan(&nextRelease)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching next release: %w", err)
+	}
+	if nextRelease.Valid {
+		balance.NextRelease = &nextRelease.Time
+	}
+	return &balance, nil
+}
+
+// ListPayouts returns one page of a seller's payouts, newest first by default
+func (er *EscrowRepository) ListPayouts(ctx context.Context, sellerID int, page models.PageRequest) ([]models.Payout, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, payoutSortKeys, "created_at", "p.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+        SELECT p.id, p.seller_id, p.amount, p.omise_transfer_id, p.status, p.failure_reason,
+               (SELECT COUNT(*) FROM escrow_entries e WHERE e.payout_id = p.id),
+               p.created_at, p.updated_at, ` + kp.SortValue + `
+        FROM payouts p
+        WHERE p.seller_id = ?` + kp.Where + ` ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args := []interface{}{sellerID}
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := er.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying payouts: %w", err)
+	}
+	defer rows.Close()
+
+	var payouts []models.Payout
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var p models.Payout
+		var transferID, failureReason sql.NullString
+		var sortValue string
+		if err := rows.Scan(&p.ID, &p.SellerID, &p.Amount, &transferID, &p.Status, &failureReason,
+			&p.EntryCount, &p.CreatedAt, &p.UpdatedAt, &sortValue); err != nil {
+			return nil, nil, fmt.Errorf("error scanning payout: %w", err)
+		}
+		if transferID.Valid {
+			p.OmiseTransferID = &transferID.String
+		}
+		if failureReason.Valid {
+			p.FailureReason = &failureReason.String
+		}
+		payouts = append(payouts, p)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, p.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	payouts, info := trimPage(kp, payouts, sortValues, ids)
+	return payouts, info, nil
+}
@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"used2book-backend/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreatePayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		released   []float64
+		wantAmount float64 // 0 means no payout
+	}{
+		{name: "nothing released", released: nil},
+		{name: "sums released entries", released: []float64{95.1, 47.55, 0.2}, wantAmount: 142.85},
+		{name: "nets to nothing", released: []float64{10, -10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			rows := sqlmock.NewRows([]string{"net_amount"})
+			for _, net := range tt.released {
+				rows.AddRow(net)
+			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT net_amount FROM escrow_entries\s+WHERE seller_id = \? AND status = 'released'\s+FOR UPDATE`).
+				WithArgs(5).
+				WillReturnRows(rows)
+			if tt.wantAmount > 0 {
+				mock.ExpectExec(`INSERT INTO payouts`).
+					WithArgs(5, tt.wantAmount, "recp_1").
+					WillReturnResult(sqlmock.NewResult(40, 1))
+				mock.ExpectExec(`UPDATE escrow_entries SET status = 'paying_out', payout_id = \?`).
+					WithArgs(40, 5).
+					WillReturnResult(sqlmock.NewResult(0, int64(len(tt.released))))
+			}
+			mock.ExpectCommit()
+
+			payout, err := NewEscrowRepository(db).CreatePayout(context.Background(), 5, "recp_1")
+			if err != nil {
+				t.Fatalf("CreatePayout: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantAmount == 0 {
+				if payout != nil {
+					t.Errorf("payout = %+v, want none", payout)
+				}
+				return
+			}
+			want := models.Payout{ID: 40, SellerID: 5, Amount: tt.wantAmount, RecipientID: "recp_1", Status: models.PayoutPending, EntryCount: len(tt.released)}
+			if payout == nil || *payout != want {
+				t.Errorf("payout = %+v, want %+v", payout, want)
+			}
+		})
+	}
+}
+
+func TestCreatePayoutRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT net_amount FROM escrow_entries`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"net_amount"}).AddRow(80.0))
+	mock.ExpectExec(`INSERT INTO payouts`).
+		WillReturnResult(sqlmock.NewResult(40, 1))
+	mock.ExpectExec(`UPDATE escrow_entries SET status = 'paying_out'`).
+		WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	if _, err := NewEscrowRepository(db).CreatePayout(context.Background(), 5, "recp_1"); err == nil {
+		t.Fatal("CreatePayout succeeded, want error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFailPayout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE payouts SET status = 'failed', failure_reason = \? WHERE id = \?`).
+		WithArgs("insufficient balance", 40).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE escrow_entries SET status = 'released', payout_id = NULL\s+WHERE payout_id = \? AND status = 'paying_out'`).
+		WithArgs(40).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := NewEscrowRepository(db).FailPayout(context.Background(), 40, "insufficient balance"); err != nil {
+		t.Fatalf("FailPayout: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
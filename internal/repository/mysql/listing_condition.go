@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+	"used2book-backend/internal/models"
+)
+
+// listingConditionColumns selects the condition columns of listings l, in the
+// order conditionScan expects them.
+const listingConditionColumns = "l.condition_grade, l.condition_defects, l.edition, l.format"
+
+// conditionScan receives the nullable condition columns of a listing row.
+type conditionScan struct {
+	Grade   sql.NullString
+	Defects sql.NullString
+	Edition sql.NullString
+	Format  sql.NullString
+}
+
+func (c conditionScan) toModel() models.ListingCondition {
+	condition := models.ListingCondition{
+		Grade:   c.Grade.String,
+		Defects: []string{},
+		Edition: c.Edition.String,
+		Format:  c.Format.String,
+	}
+	// SET columns come back comma-separated
+	if c.Defects.String != "" {
+		condition.Defects = strings.Split(c.Defects.String, ",")
+	}
+	return condition
+}
+
+// conditionArgs turns a condition into insert/update args in column order,
+// storing blanks as NULL.
+func conditionArgs(c models.ListingCondition) []interface{} {
+	return []interface{}{
+		nullString(c.Grade),
+		strings.Join(c.Defects, ","),
+		nullString(c.Edition),
+		nullString(c.Format),
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,374 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"used2book-backend/internal/models"
+)
+
+type MessageRepository struct {
+	db *sql.DB
+}
+
+func NewMessageRepository(db *sql.DB) *MessageRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &MessageRepository{db}
+}
+
+// conversationQuery and conversationFrom select the conversations a user is
+// in, as seen by them; the user's ID is the only argument.
+const conversationQuery = `
+        SELECT c.id, c.listing_id, c.offer_id, c.buyer_id, c.seller_id,
+               b.title, COALESCE(b.cover_image_url, ''),
+               other.id, COALESCE(other.first_name, ''), COALESCE(other.last_name, ''), COALESCE(other.picture_profile, ''),
+               (SELECT COUNT(*) FROM conversation_messages um
+                WHERE um.conversation_id = c.id AND um.sender_id <> viewer.id AND um.read_at IS NULL),
+               EXISTS (SELECT 1 FROM user_blocks ub
+                WHERE (ub.blocker_id = c.buyer_id AND ub.blocked_id = c.seller_id)
+                   OR (ub.blocker_id = c.seller_id AND ub.blocked_id = c.buyer_id)),
+               c.last_message_at, c.created_at,
+               lm.id, lm.sender_id, lm.body, lm.image_url, lm.read_at, lm.created_at`
+
+const conversationFrom = `
+        FROM conversations c
+        JOIN (SELECT ? AS id) viewer
+        JOIN listings l ON l.id = c.listing_id
+        JOIN books b ON b.id = l.book_id
+        JOIN users other ON other.id = IF(c.buyer_id = viewer.id, c.seller_id, c.buyer_id)
+        LEFT JOIN conversation_messages lm ON lm.id = (
+            SELECT MAX(id) FROM conversation_messages WHERE conversation_id = c.id)
+        WHERE (c.buyer_id = viewer.id OR c.seller_id = viewer.id)`
+
+func scanConversation(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Conversation, error) {
+	var c models.Conversation
+	var offerID sql.NullInt64
+	var lastID, lastSender sql.NullInt64
+	var lastBody, lastImage sql.NullString
+	var lastReadAt, lastCreatedAt sql.NullTime
+	dest := []interface{}{
+		&c.ID, &c.ListingID, &offerID, &c.BuyerID, &c.SellerID,
+		&c.ListingTitle, &c.ListingCoverURL,
+		&c.OtherUserID, &c.OtherFirstName, &c.OtherLastName, &c.OtherPicture,
+		&c.UnreadCount, &c.Blocked,
+		&c.LastMessageAt, &c.CreatedAt,
+		&lastID, &lastSender, &lastBody, &lastImage, &lastReadAt, &lastCreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return c, err
+	}
+	if offerID.Valid {
+		id := int(offerID.Int64)
+		c.OfferID = &id
+	}
+	if lastID.Valid {
+		c.LastMessage = &models.Message{
+			ID:             int(lastID.Int64),
+			ConversationID: c.ID,
+			SenderID:       int(lastSender.Int64),
+			Body:           lastBody.String,
+			ImageURL:       lastImage.String,
+			CreatedAt:      lastCreatedAt.Time,
+		}
+		if lastReadAt.Valid {
+			c.LastMessage.ReadAt = &lastReadAt.Time
+		}
+	}
+	return c, nil
+}
+
+// GetListingSeller returns who is selling a listing and whether it exists
+func (mr *MessageRepository) GetListingSeller(ctx context.Context, listingID int) (int, bool, error) {
+	var sellerID int
+	err := mr.db.QueryRowContext(ctx, `SELECT seller_id FROM listings WHERE id = ?`, listingID).Scan(&sellerID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error loading listing: %w", err)
+	}
+	return sellerID, true, nil
+}
+
+// GetOfferParties returns an offer's listing, buyer and seller and whether
+// the offer exists
+func (mr *MessageRepository) GetOfferParties(ctx context.Context, offerID int) (listingID, buyerID, sellerID int, found bool, err error) {
+	err = mr.db.QueryRowContext(ctx, `
+        SELECT o.listing_id, o.buyer_id, l.seller_id
+        FROM offers o JOIN listings l ON l.id = o.listing_id
+        WHERE o.id = ?`, offerID).Scan(&listingID, &buyerID, &sellerID)
+	if err == sql.ErrNoRows {
+		return 0, 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, 0, false, fmt.Errorf("error loading offer: %w", err)
+	}
+	return listingID, buyerID, sellerID, true, nil
+}
+
+// OpenConversation returns the ID of the buyer's conversation about a
+// listing, starting it when there is none. An offer ID replaces the one the
+// conversation was opened from.
+func (mr *MessageRepository) OpenConversation(ctx context.Context, listingID int, offerID *int, buyerID int, sellerID int) (int, error) {
+	result, err := mr.db.ExecContext(ctx, `
+        INSERT INTO conversations (listing_id, offer_id, buyer_id, seller_id)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE offer_id = COALESCE(VALUES(offer_id), offer_id), id = LAST_INSERT_ID(id)`,
+		listingID, offerID, buyerID, sellerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open conversation: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading conversation ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetConversation returns a conversation as seen by userID, or nil when they
+// aren't in it
+func (mr *MessageRepository) GetConversation(ctx context.Context, userID int, conversationID int) (*models.Conversation, error) {
+	c, err := scanConversation(mr.db.QueryRowContext(ctx,
+		conversationQuery+conversationFrom+` AND c.id = ?`, userID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading conversation: %w", err)
+	}
+	return &c, nil
+}
+
+// ListConversations returns one page of a user's conversations, most recently
+// active first. Sellers only see conversations the buyer wrote something in.
+func (mr *MessageRepository) ListConversations(ctx context.Context, userID int, page models.PageRequest) ([]models.Conversation, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, conversationSortKeys, "last_message_at", "c.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := conversationQuery + `, ` + kp.SortValue + conversationFrom + `
+          AND (c.buyer_id = viewer.id OR lm.id IS NOT NULL)` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args := append([]interface{}{userID}, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := mr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var sortValue string
+		c, err := scanConversation(rows, &sortValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, c)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	conversations, info := trimPage(kp, conversations, sortValues, ids)
+	return conversations, info, nil
+}
+
+// CreateMessage adds a message to a conversation and returns it
+func (mr *MessageRepository) CreateMessage(ctx context.Context, conversationID int, senderID int, body string, imageURL string) (*models.Message, error) {
+	var image interface{}
+	if imageURL != "" {
+		image = imageURL
+	}
+
+	msg := &models.Message{ConversationID: conversationID, SenderID: senderID, Body: body, ImageURL: imageURL}
+	err := runInTx(ctx, mr.db, func(ctx context.Context) error {
+		tx := conn(ctx, mr.db)
+
+		result, err := tx.ExecContext(ctx, `
+            INSERT INTO conversation_messages (conversation_id, sender_id, body, image_url)
+            VALUES (?, ?, ?, ?)`, conversationID, senderID, body, image)
+		if err != nil {
+			return fmt.Errorf("failed to store message: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error reading message ID: %w", err)
+		}
+		msg.ID = int(id)
+
+		if err := tx.QueryRowContext(ctx, `
+            SELECT created_at FROM conversation_messages WHERE id = ?`, msg.ID).Scan(&msg.CreatedAt); err != nil {
+			return fmt.Errorf("error loading message: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE conversations SET last_message_at = ? WHERE id = ?`, msg.CreatedAt, conversationID)
+		if err != nil {
+			return fmt.Errorf("error updating conversation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ListMessages returns one page of a conversation's messages, newest first
+// by default
+func (mr *MessageRepository) ListMessages(ctx context.Context, conversationID int, page models.PageRequest) ([]models.Message, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, messageSortKeys, "created_at", "m.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+        SELECT m.id, m.conversation_id, m.sender_id, m.body, COALESCE(m.image_url, ''), m.read_at, m.created_at, ` + kp.SortValue + `
+        FROM conversation_messages m
+        WHERE m.conversation_id = ?` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args := append([]interface{}{conversationID}, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := mr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var m models.Message
+		var readAt sql.NullTime
+		var sortValue string
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.ImageURL, &readAt, &m.CreatedAt, &sortValue); err != nil {
+			return nil, nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		if readAt.Valid {
+			m.ReadAt = &readAt.Time
+		}
+		messages = append(messages, m)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, m.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	messages, info := trimPage(kp, messages, sortValues, ids)
+	return messages, info, nil
+}
+
+// MarkConversationRead marks the messages a user was sent in a conversation
+// read and returns how many were unread
+func (mr *MessageRepository) MarkConversationRead(ctx context.Context, conversationID int, userID int) (int, error) {
+	result, err := mr.db.ExecContext(ctx, `
+        UPDATE conversation_messages SET read_at = NOW()
+        WHERE conversation_id = ? AND sender_id <> ? AND read_at IS NULL`, conversationID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark messages read: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return int(rowsAffected), nil
+}
+
+// CountUnreadMessages returns how many messages sent to a user are unread
+func (mr *MessageRepository) CountUnreadMessages(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := mr.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM conversation_messages m
+        JOIN conversations c ON c.id = m.conversation_id
+        WHERE (c.buyer_id = ? OR c.seller_id = ?) AND m.sender_id <> ? AND m.read_at IS NULL`,
+		userID, userID, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %w", err)
+	}
+	return count, nil
+}
+
+// IsBlocked reports whether either user blocked the other
+func (mr *MessageRepository) IsBlocked(ctx context.Context, userID int, otherID int) (bool, error) {
+	var blocked bool
+	err := mr.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM user_blocks
+        WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		userID, otherID, otherID, userID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("error checking blocks: %w", err)
+	}
+	return blocked, nil
+}
+
+// BlockUser stops blockedID from messaging blockerID. Blocking someone twice
+// is a no-op.
+func (mr *MessageRepository) BlockUser(ctx context.Context, blockerID int, blockedID int) error {
+	_, err := mr.db.ExecContext(ctx, `
+        INSERT IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser lifts a block and reports whether there was one
+func (mr *MessageRepository) UnblockUser(ctx context.Context, blockerID int, blockedID int) (bool, error) {
+	result, err := mr.db.ExecContext(ctx, `
+        DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unblock user: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// ListBlockedUsers returns the users someone blocked, most recent first
+func (mr *MessageRepository) ListBlockedUsers(ctx context.Context, blockerID int) ([]models.BlockedUser, error) {
+	rows, err := mr.db.QueryContext(ctx, `
+        SELECT u.id, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.picture_profile, ''), ub.created_at
+        FROM user_blocks ub
+        JOIN users u ON u.id = ub.blocked_id
+        WHERE ub.blocker_id = ?
+        ORDER BY ub.created_at DESC`, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	blocked := []models.BlockedUser{}
+	for rows.Next() {
+		var b models.BlockedUser
+		if err := rows.Scan(&b.UserID, &b.FirstName, &b.LastName, &b.PictureProfile, &b.BlockedAt); err != nil {
+			return nil, fmt.Errorf("error scanning blocked user: %w", err)
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
+
+// UserExists reports whether there is a user with the ID
+func (mr *MessageRepository) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := mr.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error loading user: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,407 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"used2book-backend/internal/models"
+)
+
+var notificationSortKeys = map[string]string{
+	"created_at": "created_at",
+}
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &NotificationRepository{db}
+}
+
+// CreateNotification stores an event for its recipient and returns the new
+// notification's ID, or 0 when the event was already stored. A hidden
+// notification is kept out of the inbox; it only records that the event was
+// handled.
+func (nr *NotificationRepository) CreateNotification(ctx context.Context, e models.NotificationEvent, hidden bool) (int, error) {
+	var data interface{}
+	if len(e.Data) > 0 {
+		data = string(e.Data)
+	}
+	result, err := conn(ctx, nr.db).ExecContext(ctx, `
+        INSERT IGNORE INTO notifications (event_id, user_id, type, message, data, hidden, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.EventID, e.UserID, e.Type, e.Message, data, hidden, e.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store notification: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading notification ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// ListNotifications returns one page of a user's notifications, newest first
+// by default
+func (nr *NotificationRepository) ListNotifications(ctx context.Context, userID int, unreadOnly bool, page models.PageRequest) ([]models.Notification, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, notificationSortKeys, "created_at", "id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+        SELECT id, user_id, type, message, data, is_read, read_at, created_at, ` + kp.SortValue + `
+        FROM notifications
+        WHERE user_id = ? AND hidden = false`
+	args := []interface{}{userID}
+	if unreadOnly {
+		query += ` AND is_read = false`
+	}
+	query += kp.Where + ` ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := nr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var n models.Notification
+		var data sql.NullString
+		var readAt sql.NullTime
+		var sortValue string
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &data, &n.IsRead, &readAt, &n.CreatedAt, &sortValue); err != nil {
+			return nil, nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		if data.Valid {
+			n.Data = []byte(data.String)
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, n.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	notifications, info := trimPage(kp, notifications, sortValues, ids)
+	return notifications, info, nil
+}
+
+// ListNotificationsAfter returns up to limit of a user's notifications newer
+// than afterID, oldest first. A reconnecting stream uses it to catch up.
+func (nr *NotificationRepository) ListNotificationsAfter(ctx context.Context, userID int, afterID int, limit int) ([]models.Notification, error) {
+	rows, err := nr.db.QueryContext(ctx, `
+        SELECT id, user_id, type, message, data, is_read, read_at, created_at
+        FROM notifications
+        WHERE user_id = ? AND id > ? AND hidden = false
+        ORDER BY id ASC
+        LIMIT ?`, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data sql.NullString
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &data, &n.IsRead, &readAt, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		if data.Valid {
+			n.Data = []byte(data.String)
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnread returns how many of a user's notifications are unread
+func (nr *NotificationRepository) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := nr.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = false AND hidden = false`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications read and reports whether
+// they have it. Marking a read notification again is a no-op.
+func (nr *NotificationRepository) MarkRead(ctx context.Context, userID int, notificationID int) (bool, error) {
+	var exists bool
+	err := nr.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM notifications WHERE id = ? AND user_id = ? AND hidden = false)`, notificationID, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error loading notification: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	_, err = nr.db.ExecContext(ctx, `
+        UPDATE notifications SET is_read = true, read_at = NOW()
+        WHERE id = ? AND is_read = false`, notificationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	return true, nil
+}
+
+// MarkAllRead marks all of a user's notifications read and returns how many
+// were unread
+func (nr *NotificationRepository) MarkAllRead(ctx context.Context, userID int) (int, error) {
+	result, err := nr.db.ExecContext(ctx, `
+        UPDATE notifications SET is_read = true, read_at = NOW()
+        WHERE user_id = ? AND is_read = false AND hidden = false`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return int(rowsAffected), nil
+}
+
+// GetNotificationSettings returns a user's notification settings, with the
+// defaults for whatever they never changed
+func (nr *NotificationRepository) GetNotificationSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	settings := models.NotificationSettings{
+		Language:     models.LanguageThai,
+		EmailEnabled: true,
+		Digest:       models.DigestSettings{Hour: 8},
+		Preferences:  map[string]map[string]bool{},
+	}
+	for _, category := range models.NotificationCategories {
+		settings.Preferences[category] = map[string]bool{}
+		for _, channel := range models.NotificationChannels {
+			settings.Preferences[category][channel] = models.DefaultChannelPreference(category, channel)
+		}
+	}
+
+	var quietStart, quietEnd sql.NullString
+	err := nr.db.QueryRowContext(ctx, `
+        SELECT language, email_enabled, TIME_FORMAT(quiet_hours_start, '%H:%i'), TIME_FORMAT(quiet_hours_end, '%H:%i'),
+               digest_enabled, digest_hour
+        FROM notification_settings WHERE user_id = ?`, userID).Scan(
+		&settings.Language, &settings.EmailEnabled, &quietStart, &quietEnd, &settings.Digest.Enabled, &settings.Digest.Hour)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, fmt.Errorf("error loading notification settings: %w", err)
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		settings.QuietHours = models.QuietHours{Enabled: true, Start: quietStart.String, End: quietEnd.String}
+	}
+
+	rows, err := nr.db.QueryContext(ctx, `
+        SELECT category, channel, enabled FROM notification_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return settings, fmt.Errorf("error loading notification preferences: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category, channel string
+		var enabled bool
+		if err := rows.Scan(&category, &channel, &enabled); err != nil {
+			return settings, fmt.Errorf("error scanning notification preference: %w", err)
+		}
+		if prefs, ok := settings.Preferences[category]; ok {
+			prefs[channel] = enabled
+		}
+	}
+	return settings, rows.Err()
+}
+
+// SaveNotificationSettings stores a user's notification settings
+func (nr *NotificationRepository) SaveNotificationSettings(ctx context.Context, userID int, settings models.NotificationSettings) error {
+	return runInTx(ctx, nr.db, func(ctx context.Context) error {
+		tx := conn(ctx, nr.db)
+
+		var quietStart, quietEnd interface{}
+		if settings.QuietHours.Enabled {
+			quietStart, quietEnd = settings.QuietHours.Start, settings.QuietHours.End
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO notification_settings (user_id, language, email_enabled, quiet_hours_start, quiet_hours_end, digest_enabled, digest_hour)
+            VALUES (?, ?, ?, ?, ?, ?, ?)
+            ON DUPLICATE KEY UPDATE language = VALUES(language), email_enabled = VALUES(email_enabled),
+                quiet_hours_start = VALUES(quiet_hours_start), quiet_hours_end = VALUES(quiet_hours_end),
+                digest_enabled = VALUES(digest_enabled), digest_hour = VALUES(digest_hour)`,
+			userID, settings.Language, settings.EmailEnabled, quietStart, quietEnd, settings.Digest.Enabled, settings.Digest.Hour)
+		if err != nil {
+			return fmt.Errorf("failed to save notification settings: %w", err)
+		}
+
+		for category, channels := range settings.Preferences {
+			for channel, enabled := range channels {
+				_, err := tx.ExecContext(ctx, `
+                    INSERT INTO notification_preferences (user_id, category, channel, enabled)
+                    VALUES (?, ?, ?, ?)
+                    ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`, userID, category, channel, enabled)
+				if err != nil {
+					return fmt.Errorf("failed to save notification preference: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetRecipient returns how to reach a user outside the app
+func (nr *NotificationRepository) GetRecipient(ctx context.Context, userID int) (*models.NotificationRecipient, error) {
+	r := models.NotificationRecipient{UserID: userID}
+	var firstName, phoneNumber sql.NullString
+	err := nr.db.QueryRowContext(ctx, `
+        SELECT u.email, u.phone_number, u.first_name, COALESCE(s.language, 'th')
+        FROM users u
+        LEFT JOIN notification_settings s ON s.user_id = u.id
+        WHERE u.id = ?`, userID).Scan(&r.Email, &phoneNumber, &firstName, &r.Language)
+	if err != nil {
+		return nil, fmt.Errorf("error loading notification recipient: %w", err)
+	}
+	r.FirstName = firstName.String
+	r.PhoneNumber = phoneNumber.String
+	return &r, nil
+}
+
+// CreateDelivery holds a notification back for a channel until
+// d.DeliverAfter
+func (nr *NotificationRepository) CreateDelivery(ctx context.Context, d models.NotificationDelivery) error {
+	var data interface{}
+	if len(d.Data) > 0 {
+		data = string(d.Data)
+	}
+	_, err := nr.db.ExecContext(ctx, `
+        INSERT INTO notification_deliveries (notification_id, user_id, channel, type, message, data, digest, deliver_after)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.NotificationID, d.UserID, d.Channel, d.Type, d.Message, data, d.Digest, d.DeliverAfter)
+	if err != nil {
+		return fmt.Errorf("failed to hold notification back: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries marks up to limit held back notifications that are due
+// sent and returns them. Digest deliveries are left for ClaimDigest.
+func (nr *NotificationRepository) ClaimDueDeliveries(ctx context.Context, limit int) ([]models.NotificationDelivery, error) {
+	return nr.claimDeliveries(ctx, `
+        WHERE status = 'pending' AND digest = false AND deliver_after <= NOW()
+        ORDER BY deliver_after
+        LIMIT ?`, limit)
+}
+
+// ListDueDigests returns the users whose daily digest is due
+func (nr *NotificationRepository) ListDueDigests(ctx context.Context) ([]int, error) {
+	rows, err := nr.db.QueryContext(ctx, `
+        SELECT DISTINCT user_id FROM notification_deliveries
+        WHERE status = 'pending' AND digest = true AND deliver_after <= NOW()`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying digests: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning user ID: %w", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// ClaimDigest marks a user's due digest notifications sent and returns them,
+// oldest first
+func (nr *NotificationRepository) ClaimDigest(ctx context.Context, userID int) ([]models.NotificationDelivery, error) {
+	return nr.claimDeliveries(ctx, `
+        WHERE status = 'pending' AND digest = true AND deliver_after <= NOW() AND user_id = ?
+        ORDER BY created_at`, userID)
+}
+
+// claimDeliveries locks the deliveries matched by where, skipping ones
+// another instance is claiming, and marks them sent
+func (nr *NotificationRepository) claimDeliveries(ctx context.Context, where string, args ...interface{}) ([]models.NotificationDelivery, error) {
+	var deliveries []models.NotificationDelivery
+	err := runInTx(ctx, nr.db, func(ctx context.Context) error {
+		tx := conn(ctx, nr.db)
+
+		rows, err := tx.QueryContext(ctx, `
+            SELECT id, notification_id, user_id, channel, type, message, data, digest, deliver_after, created_at
+            FROM notification_deliveries `+where+`
+            FOR UPDATE SKIP LOCKED`, args...)
+		if err != nil {
+			return fmt.Errorf("error querying deliveries: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var d models.NotificationDelivery
+			var notificationID sql.NullInt64
+			var data sql.NullString
+			if err := rows.Scan(&d.ID, &notificationID, &d.UserID, &d.Channel, &d.Type, &d.Message, &data, &d.Digest, &d.DeliverAfter, &d.CreatedAt); err != nil {
+				return fmt.Errorf("error scanning delivery: %w", err)
+			}
+			if notificationID.Valid {
+				id := int(notificationID.Int64)
+				d.NotificationID = &id
+			}
+			if data.Valid {
+				d.Data = []byte(data.String)
+			}
+			deliveries = append(deliveries, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, d := range deliveries {
+			_, err := tx.ExecContext(ctx, `
+                UPDATE notification_deliveries SET status = 'sent', sent_at = NOW() WHERE id = ?`, d.ID)
+			if err != nil {
+				return fmt.Errorf("failed to claim delivery: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// MarkDeliveryFailed records that a claimed delivery couldn't be sent
+func (nr *NotificationRepository) MarkDeliveryFailed(ctx context.Context, deliveryID int) error {
+	_, err := nr.db.ExecContext(ctx, `
+        UPDATE notification_deliveries SET status = 'failed' WHERE id = ?`, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery failed: %w", err)
+	}
+	return nil
+}
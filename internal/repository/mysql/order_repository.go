@@ -0,0 +1,350 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+var orderSortKeys = map[string]string{
+	"created_at": "o.created_at",
+}
+
+const orderColumns = `
+        SELECT o.id, o.transaction_id, COALESCE(o.listing_id, 0), COALESCE(o.buyer_id, 0), COALESCE(o.seller_id, 0),
+               o.amount, o.status, o.carrier, o.tracking_number, o.cancel_reason,
+               COALESCE(b.title, ''),
+               COALESCE((SELECT image_url FROM listing_images WHERE listing_id = o.listing_id LIMIT 1), ''),
+               o.shipped_at, o.delivered_at, o.completed_at, o.cancelled_at, o.auto_complete_at,
+               o.created_at, o.updated_at, t.payment_provider, COALESCE(t.payment_reference, '')`
+
+const orderJoins = `
+        FROM orders o
+        JOIN transactions t ON o.transaction_id = t.id
+        LEFT JOIN listings l ON o.listing_id = l.id
+        LEFT JOIN books b ON l.book_id = b.id`
+
+type OrderRepository struct {
+	txRunner
+}
+
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &OrderRepository{txRunner{db}}
+}
+
+// CreateSessionOrders opens a 'paid' order for every completed transaction of
+// a checkout session. Existing orders are left alone, so replays are harmless.
+func (or *OrderRepository) CreateSessionOrders(ctx context.Context, sessionID string) error {
+	query := `
+        INSERT INTO orders (transaction_id, listing_id, buyer_id, seller_id, amount, status)
+        SELECT t.id, t.listing_id, t.buyer_id, COALESCE(t.seller_id, l.seller_id), t.transaction_amount, 'paid'
+        FROM transactions t
+        JOIN listings l ON t.listing_id = l.id
+        WHERE t.stripe_session_id = ? AND t.payment_status = 'completed'
+        ON DUPLICATE KEY UPDATE id = id
+    `
+	_, err := conn(ctx, or.db).ExecContext(ctx, query, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to create orders: %w", err)
+	}
+	return nil
+}
+
+func scanOrder(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.Order, error) {
+	var o models.Order
+	var carrier, trackingNumber, cancelReason sql.NullString
+	var shippedAt, deliveredAt, completedAt, cancelledAt, autoCompleteAt sql.NullTime
+	dest := []interface{}{
+		&o.ID, &o.TransactionID, &o.ListingID, &o.BuyerID, &o.SellerID,
+		&o.Amount, &o.Status, &carrier, &trackingNumber, &cancelReason,
+		&o.BookTitle, &o.ImageURL,
+		&shippedAt, &deliveredAt, &completedAt, &cancelledAt, &autoCompleteAt,
+		&o.CreatedAt, &o.UpdatedAt, &o.PaymentProvider, &o.PaymentReference,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if carrier.Valid {
+		o.Carrier = &carrier.String
+	}
+	if trackingNumber.Valid {
+		o.TrackingNumber = &trackingNumber.String
+	}
+	if cancelReason.Valid {
+		o.CancelReason = &cancelReason.String
+	}
+	for _, t := range []struct {
+		src sql.NullTime
+		dst **time.Time
+	}{
+		{shippedAt, &o.ShippedAt},
+		{deliveredAt, &o.DeliveredAt},
+		{completedAt, &o.CompletedAt},
+		{cancelledAt, &o.CancelledAt},
+		{autoCompleteAt, &o.AutoCompleteAt},
+	} {
+		if t.src.Valid {
+			v := t.src.Time
+			*t.dst = &v
+		}
+	}
+	return &o, nil
+}
+
+// GetOrderByID returns an order, or nil if not found
+func (or *OrderRepository) GetOrderByID(ctx context.Context, orderID int) (*models.Order, error) {
+	query := orderColumns + orderJoins + ` WHERE o.id = ?`
+	o, err := scanOrder(conn(ctx, or.db).QueryRowContext(ctx, query, orderID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching order: %w", err)
+	}
+	return o, nil
+}
+
+// ListOrders returns one page of a user's orders as buyer or seller, newest
+// first by default, optionally filtered by status
+func (or *OrderRepository) ListOrders(ctx context.Context, userID int, asSeller bool, status string, page models.PageRequest) ([]models.Order, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, orderSortKeys, "created_at", "o.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := orderColumns + `, ` + kp.SortValue + orderJoins
+	if asSeller {
+		query += ` WHERE o.seller_id = ?`
+	} else {
+		query += ` WHERE o.buyer_id = ?`
+	}
+	args := []interface{}{userID}
+	if status != "" {
+		query += ` AND o.status = ?`
+		args = append(args, status)
+	}
+	query += kp.Where + ` ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := or.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var sortValue string
+		o, err := scanOrder(rows, &sortValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, *o)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, o.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	orders, info := trimPage(kp, orders, sortValues, ids)
+	return orders, info, nil
+}
+
+// transition runs an order state change and reports whether it applied
+func (or *OrderRepository) transition(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := conn(ctx, or.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update order: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// ShipOrder records the seller's carrier and tracking number. A shipped order
+// can have its tracking corrected; the auto-completion clock starts at the
+// first shipment.
+func (or *OrderRepository) ShipOrder(ctx context.Context, orderID int, sellerID int, carrier string, trackingNumber string, autoCompleteDays int) (bool, error) {
+	return or.transition(ctx, `
+        UPDATE orders
+        SET status = 'shipped', carrier = ?, tracking_number = ?,
+            shipped_at = COALESCE(shipped_at, NOW()),
+            auto_complete_at = COALESCE(auto_complete_at, NOW() + INTERVAL ? DAY)
+        WHERE id = ? AND seller_id = ? AND status IN ('paid', 'shipped')`,
+		carrier, trackingNumber, autoCompleteDays, orderID, sellerID)
+}
+
+// MarkDelivered records that the carrier delivered a shipped order
+func (or *OrderRepository) MarkDelivered(ctx context.Context, orderID int, sellerID int) (bool, error) {
+	return or.transition(ctx, `
+        UPDATE orders SET status = 'delivered', delivered_at = NOW()
+        WHERE id = ? AND seller_id = ? AND status = 'shipped'`, orderID, sellerID)
+}
+
+// CompleteOrder closes a shipped or delivered order once the buyer confirms
+// receipt
+func (or *OrderRepository) CompleteOrder(ctx context.Context, orderID int, buyerID int) (bool, error) {
+	return or.transition(ctx, `
+        UPDATE orders
+        SET status = 'completed', completed_at = NOW(), delivered_at = COALESCE(delivered_at, NOW())
+        WHERE id = ? AND buyer_id = ? AND status IN ('shipped', 'delivered')`, orderID, buyerID)
+}
+
+// AutoCompleteOrder closes an order whose auto-completion time has passed
+// without the buyer confirming receipt
+func (or *OrderRepository) AutoCompleteOrder(ctx context.Context, orderID int) (bool, error) {
+	return or.transition(ctx, `
+        UPDATE orders
+        SET status = 'completed', completed_at = NOW(), delivered_at = COALESCE(delivered_at, NOW())
+        WHERE id = ? AND status IN ('shipped', 'delivered') AND auto_complete_at <= NOW()`, orderID)
+}
+
+// GetOrdersDueForCompletion lists shipped orders past their auto-completion time
+func (or *OrderRepository) GetOrdersDueForCompletion(ctx context.Context) ([]int, error) {
+	rows, err := or.db.QueryContext(ctx, `
+        SELECT id FROM orders
+        WHERE status IN ('shipped', 'delivered') AND auto_complete_at <= NOW()`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due orders: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning order ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CancelOrder cancels an order that hasn't shipped, marks its transaction
+// refunded and puts the listing back on sale
+func (or *OrderRepository) CancelOrder(ctx context.Context, order *models.Order, reason string) (bool, error) {
+	cancelled, err := or.transition(ctx, `
+        UPDATE orders SET status = 'cancelled', cancel_reason = ?, cancelled_at = NOW()
+        WHERE id = ? AND status = 'paid'`, nullString(reason), order.ID)
+	if err != nil || !cancelled {
+		return cancelled, err
+	}
+
+	tx := conn(ctx, or.db)
+	_, err = tx.ExecContext(ctx, `
+        UPDATE transactions SET payment_status = 'refunded', updated_at = NOW()
+        WHERE id = ? AND payment_status = 'completed'`, order.TransactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to refund transaction: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE listings SET status = 'for_sale', updated_at = NOW()
+        WHERE id = ? AND status = 'sold'`, order.ListingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to relist listing: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, forgetSavedSearchMatchesQuery, order.ListingID); err != nil {
+		return false, fmt.Errorf("failed to reset saved search matches: %w", err)
+	}
+	return true, nil
+}
+
+// OpenDispute holds a buyer's order in 'disputed'. Shipped and delivered
+// orders can always be disputed; completed ones only within windowDays.
+func (or *OrderRepository) OpenDispute(ctx context.Context, orderID int, buyerID int, windowDays int) (bool, error) {
+	return or.transition(ctx, `
+        UPDATE orders SET status = 'disputed'
+        WHERE id = ? AND buyer_id = ?
+          AND (status IN ('shipped', 'delivered')
+               OR (status = 'completed' AND completed_at >= NOW() - INTERVAL ? DAY))`,
+		orderID, buyerID, windowDays)
+}
+
+// RefundDisputedOrder closes a disputed order with a full refund and marks
+// its transaction refunded
+func (or *OrderRepository) RefundDisputedOrder(ctx context.Context, order *models.Order) (bool, error) {
+	refunded, err := or.transition(ctx, `
+        UPDATE orders SET status = 'refunded'
+        WHERE id = ? AND status = 'disputed'`, order.ID)
+	if err != nil || !refunded {
+		return refunded, err
+	}
+
+	_, err = conn(ctx, or.db).ExecContext(ctx, `
+        UPDATE transactions
+        SET payment_status = 'refunded', refunded_amount = transaction_amount, updated_at = NOW()
+        WHERE id = ?`, order.TransactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to refund transaction: %w", err)
+	}
+	return true, nil
+}
+
+// SettleDisputedOrder completes a disputed order. A refundAmount above zero
+// records a partial refund on its transaction.
+func (or *OrderRepository) SettleDisputedOrder(ctx context.Context, order *models.Order, refundAmount float64) (bool, error) {
+	settled, err := or.transition(ctx, `
+        UPDATE orders
+        SET status = 'completed', completed_at = COALESCE(completed_at, NOW()), delivered_at = COALESCE(delivered_at, NOW())
+        WHERE id = ? AND status = 'disputed'`, order.ID)
+	if err != nil || !settled || refundAmount <= 0 {
+		return settled, err
+	}
+
+	_, err = conn(ctx, or.db).ExecContext(ctx, `
+        UPDATE transactions
+        SET payment_status = 'partially_refunded', refunded_amount = ?, updated_at = NOW()
+        WHERE id = ?`, refundAmount, order.TransactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record partial refund: %w", err)
+	}
+	return true, nil
+}
+
+// CancelPaymentOrders cancels the open orders of a payment the provider
+// refunded, returning the orders that were cancelled
+func (or *OrderRepository) CancelPaymentOrders(ctx context.Context, reference string, reason string) ([]models.Order, error) {
+	query := orderColumns + orderJoins + `
+        WHERE t.payment_reference = ? AND o.status IN ('paid', 'shipped', 'delivered')`
+	rows, err := conn(ctx, or.db).QueryContext(ctx, query, reference)
+	if err != nil {
+		return nil, fmt.Errorf("error querying payment orders: %w", err)
+	}
+	var orders []models.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, *o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		_, err := conn(ctx, or.db).ExecContext(ctx, `
+            UPDATE orders SET status = 'cancelled', cancel_reason = ?, cancelled_at = NOW()
+            WHERE id = ?`, reason, orders[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to cancel order: %w", err)
+		}
+		orders[i].Status = models.OrderCancelled
+	}
+	return orders, nil
+}
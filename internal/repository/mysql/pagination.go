@@ -0,0 +1,167 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"used2book-backend/internal/models"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Whitelisted sort keys per list, mapped to the SQL expression they order by.
+// Expressions must never be NULL, otherwise keyset comparisons skip rows.
+var (
+	listingSortKeys = map[string]string{
+		"created_at": "l.created_at",
+		"price":      "CAST(l.price AS DECIMAL(12,2))",
+	}
+	postSortKeys = map[string]string{
+		"created_at": "p.created_at",
+	}
+	userSortKeys = map[string]string{
+		"created_at": "u.created_at",
+		"first_name": "COALESCE(u.first_name, '')",
+	}
+	reviewSortKeys = map[string]string{
+		"created_at": "br.created_at",
+		"rating":     "br.rating",
+	}
+	offerSortKeys = map[string]string{
+		"created_at": "o.created_at",
+		"price":      "o.offered_price",
+	}
+	conversationSortKeys = map[string]string{
+		"last_message_at": "c.last_message_at",
+	}
+	messageSortKeys = map[string]string{
+		"created_at": "m.created_at",
+	}
+	bookSortKeys = map[string]string{
+		"title":  "b.title",
+		"rating": "COALESCE(br.average_rating, 0)",
+	}
+)
+
+// pageCursor is what an opaque cursor decodes to: the sort value and id of the
+// last row on the previous page.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// keysetPage holds the SQL fragments for one page of a keyset-paginated query.
+// SortValue goes at the end of the SELECT list, Where after the query's own
+// conditions (it starts with AND), OrderBy after ORDER BY.
+type keysetPage struct {
+	SortValue string
+	Where     string
+	OrderBy   string
+	Args      []interface{}
+	Limit     int
+
+	sort  string
+	order string
+}
+
+// newKeysetPage validates the request against the whitelisted sort keys and
+// builds the WHERE/ORDER BY fragments. idColumn breaks ties so pages are stable.
+func newKeysetPage(page models.PageRequest, sortKeys map[string]string, defaultSort string, idColumn string) (*keysetPage, error) {
+	sort := page.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	expr, ok := sortKeys[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort key %q", models.ErrInvalidPageRequest, sort)
+	}
+
+	order := strings.ToLower(page.Order)
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", models.ErrInvalidPageRequest)
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	kp := &keysetPage{
+		SortValue: "CAST(" + expr + " AS CHAR)",
+		OrderBy:   fmt.Sprintf("%s %s, %s %s", expr, order, idColumn, order),
+		Limit:     limit,
+		sort:      sort,
+		order:     order,
+	}
+
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", models.ErrInvalidPageRequest)
+		}
+		// A cursor only makes sense for the ordering it was issued for
+		if c.Sort != sort || c.Order != order {
+			return nil, fmt.Errorf("%w: cursor does not match sort order", models.ErrInvalidPageRequest)
+		}
+		cmp := "<"
+		if order == "asc" {
+			cmp = ">"
+		}
+		kp.Where = fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND %s %s ?))", expr, cmp, expr, idColumn, cmp)
+		kp.Args = []interface{}{c.Value, c.Value, c.ID}
+	}
+
+	return kp, nil
+}
+
+// LimitArg is the LIMIT to query with; one extra row tells us if there's more.
+func (kp *keysetPage) LimitArg() int {
+	return kp.Limit + 1
+}
+
+// trimPage cuts the extra row off items and builds the PageInfo. sortValues
+// and ids must line up with items.
+func trimPage[T any](kp *keysetPage, items []T, sortValues []string, ids []int) ([]T, *models.PageInfo) {
+	info := &models.PageInfo{Limit: kp.Limit}
+	if len(items) > kp.Limit {
+		items = items[:kp.Limit]
+		last := kp.Limit - 1
+		info.HasMore = true
+		info.NextCursor = encodeCursor(pageCursor{
+			Sort:  kp.sort,
+			Order: kp.order,
+			Value: sortValues[last],
+			ID:    ids[last],
+		})
+	}
+	return items, info
+}
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"used2book-backend/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []pageCursor{
+		{Sort: "created_at", Order: "desc", Value: "2024-05-01 10:00:00", ID: 42},
+		{Sort: "price", Order: "asc", Value: "199.50", ID: 7},
+		{Sort: "first_name", Order: "asc", Value: "สมชาย \"quoted\"", ID: 1},
+		{Sort: "title", Order: "desc", Value: "", ID: 0},
+	}
+	for _, want := range tests {
+		encoded := encodeCursor(want)
+		if strings.ContainsAny(encoded, "+/=") {
+			t.Errorf("cursor %q is not URL safe", encoded)
+		}
+		got, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", encoded, err)
+		}
+		if *got != want {
+			t.Errorf("round trip = %+v, want %+v", *got, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "e30=="} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded, want error", cursor)
+		}
+	}
+}
+
+func TestNewKeysetPage(t *testing.T) {
+	descCursor := encodeCursor(pageCursor{Sort: "created_at", Order: "desc", Value: "2024-05-01 10:00:00", ID: 42})
+	ascCursor := encodeCursor(pageCursor{Sort: "price", Order: "asc", Value: "100.00", ID: 9})
+
+	tests := []struct {
+		name      string
+		page      models.PageRequest
+		wantErr   bool
+		wantOrder string
+		wantWhere string
+		wantArgs  []interface{}
+		wantLimit int
+	}{
+		{
+			name:      "defaults",
+			page:      models.PageRequest{},
+			wantOrder: "l.created_at desc, l.id desc",
+			wantLimit: defaultPageLimit,
+		},
+		{
+			name:      "limit is capped",
+			page:      models.PageRequest{Sort: "price", Order: "ASC", Limit: 1000},
+			wantOrder: "CAST(l.price AS DECIMAL(12,2)) asc, l.id asc",
+			wantLimit: maxPageLimit,
+		},
+		{
+			name:      "descending cursor",
+			page:      models.PageRequest{Cursor: descCursor, Limit: 5},
+			wantOrder: "l.created_at desc, l.id desc",
+			wantWhere: " AND (l.created_at < ? OR (l.created_at = ? AND l.id < ?))",
+			wantArgs:  []interface{}{"2024-05-01 10:00:00", "2024-05-01 10:00:00", 42},
+			wantLimit: 5,
+		},
+		{
+			name:      "ascending cursor",
+			page:      models.PageRequest{Sort: "price", Order: "asc", Cursor: ascCursor},
+			wantOrder: "CAST(l.price AS DECIMAL(12,2)) asc, l.id asc",
+			wantWhere: " AND (CAST(l.price AS DECIMAL(12,2)) > ? OR (CAST(l.price AS DECIMAL(12,2)) = ? AND l.id > ?))",
+			wantArgs:  []interface{}{"100.00", "100.00", 9},
+			wantLimit: defaultPageLimit,
+		},
+		{name: "unknown sort key", page: models.PageRequest{Sort: "seller_id"}, wantErr: true},
+		{name: "sort key is not SQL", page: models.PageRequest{Sort: "l.id; DROP TABLE listings"}, wantErr: true},
+		{name: "unknown order", page: models.PageRequest{Order: "sideways"}, wantErr: true},
+		{name: "malformed cursor", page: models.PageRequest{Cursor: "%%%"}, wantErr: true},
+		{name: "cursor for another sort", page: models.PageRequest{Sort: "price", Cursor: descCursor}, wantErr: true},
+		{name: "cursor for another order", page: models.PageRequest{Order: "asc", Cursor: descCursor}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kp, err := newKeysetPage(tt.page, listingSortKeys, "created_at", "l.id")
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrInvalidPageRequest) {
+					t.Fatalf("err = %v, want ErrInvalidPageRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newKeysetPage: %v", err)
+			}
+			if kp.OrderBy != tt.wantOrder {
+				t.Errorf("OrderBy = %q, want %q", kp.OrderBy, tt.wantOrder)
+			}
+			if kp.Where != tt.wantWhere {
+				t.Errorf("Where = %q, want %q", kp.Where, tt.wantWhere)
+			}
+			if len(kp.Args) != len(tt.wantArgs) {
+				t.Fatalf("Args = %v, want %v", kp.Args, tt.wantArgs)
+			}
+			for i := range kp.Args {
+				if kp.Args[i] != tt.wantArgs[i] {
+					t.Errorf("Args[%d] = %v, want %v", i, kp.Args[i], tt.wantArgs[i])
+				}
+			}
+			if kp.Limit != tt.wantLimit || kp.LimitArg() != tt.wantLimit+1 {
+				t.Errorf("Limit = %d, LimitArg = %d, want %d and %d", kp.Limit, kp.LimitArg(), tt.wantLimit, tt.wantLimit+1)
+			}
+		})
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	kp, err := newKeysetPage(models.PageRequest{Sort: "price", Order: "asc", Limit: 2}, listingSortKeys, "created_at", "l.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, info := trimPage(kp, []string{"a", "b"}, []string{"10.00", "20.00"}, []int{1, 2})
+	if len(items) != 2 || info.HasMore || info.NextCursor != "" {
+		t.Errorf("full last page: items = %v, info = %+v", items, info)
+	}
+
+	items, info = trimPage(kp, []string{"a", "b", "c"}, []string{"10.00", "20.00", "30.00"}, []int{1, 2, 3})
+	if len(items) != 2 || !info.HasMore {
+		t.Fatalf("page with more: items = %v, info = %+v", items, info)
+	}
+
+	// The next cursor continues after the last row kept, in the same ordering
+	next, err := newKeysetPage(models.PageRequest{Sort: "price", Order: "asc", Limit: 2, Cursor: info.NextCursor}, listingSortKeys, "created_at", "l.id")
+	if err != nil {
+		t.Fatalf("next cursor rejected: %v", err)
+	}
+	if next.Args[0] != "20.00" || next.Args[2] != 2 {
+		t.Errorf("next page args = %v, want to continue after 20.00 / id 2", next.Args)
+	}
+}
@@ -0,0 +1,683 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+// liveAcceptedOffer matches an accepted offer on listing l whose buyer can
+// still pay for it
+const liveAcceptedOffer = `
+        SELECT 1 FROM offers a
+        WHERE a.listing_id = l.id AND a.status = 'accepted'
+          AND (a.payment_due_at IS NULL OR a.payment_due_at > NOW())`
+
+// ReservationRepository keeps listing holds and waitlists. A hold is mirrored
+// on the listing as status 'reserved' with reserved_by and
+// reserved_expires_at, which the rest of the marketplace reads; the
+// listing_holds rows keep the history behind the metrics.
+type ReservationRepository struct {
+	txRunner
+}
+
+func NewReservationRepository(db *sql.DB) *ReservationRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &ReservationRepository{txRunner{db}}
+}
+
+// nullableString stores an empty string as NULL
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// startHold records buyerID's hold on a listing that was just reserved for
+// them, taking its expiry from the listing. A hold the buyer already has is
+// carried on; one another buyer left behind is marked expired.
+func startHold(ctx context.Context, q dbtx, listingID int, buyerID int, offerID *int, source string, provider string) error {
+	var holdID int
+	err := q.QueryRowContext(ctx, `
+        SELECT id FROM listing_holds
+        WHERE listing_id = ? AND buyer_id = ? AND status = 'active'
+        FOR UPDATE`, listingID, buyerID).Scan(&holdID)
+	if err == nil {
+		_, err = q.ExecContext(ctx, `
+        UPDATE listing_holds h
+        JOIN listings l ON h.listing_id = l.id
+        SET h.expires_at = l.reserved_expires_at,
+            h.reminded_at = NULL,
+            h.offer_id = COALESCE(?, h.offer_id),
+            h.payment_provider = COALESCE(?, h.payment_provider)
+        WHERE h.id = ?`, offerID, nullableString(provider), holdID)
+		if err != nil {
+			return fmt.Errorf("failed to update hold: %w", err)
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("error loading hold: %w", err)
+	}
+
+	if err := resolveHolds(ctx, q, listingID, 0, models.HoldExpired); err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+        INSERT INTO listing_holds (listing_id, buyer_id, offer_id, source, payment_provider, expires_at)
+        SELECT id, ?, ?, ?, ?, reserved_expires_at FROM listings WHERE id = ?`,
+		buyerID, offerID, source, nullableString(provider), listingID)
+	if err != nil {
+		return fmt.Errorf("failed to record hold: %w", err)
+	}
+	return nil
+}
+
+// resolveHolds ends the active holds on a listing with status: only buyerID's
+// when it's above zero, otherwise all of them
+func resolveHolds(ctx context.Context, q dbtx, listingID int, buyerID int, status string) error {
+	query := `UPDATE listing_holds SET status = ?, resolved_at = NOW() WHERE listing_id = ? AND status = 'active'`
+	args := []interface{}{status, listingID}
+	if buyerID > 0 {
+		query += ` AND buyer_id = ?`
+		args = append(args, buyerID)
+	}
+	if _, err := q.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to resolve holds: %w", err)
+	}
+	return nil
+}
+
+// closeWaitlist takes everyone still waiting off a listing that's gone
+func closeWaitlist(ctx context.Context, q dbtx, listingID int) error {
+	_, err := q.ExecContext(ctx, `
+        UPDATE listing_waitlist SET status = 'closed'
+        WHERE listing_id = ? AND status = 'waiting'`, listingID)
+	if err != nil {
+		return fmt.Errorf("failed to close waitlist: %w", err)
+	}
+	return nil
+}
+
+// lockListing reads a listing's status and holder, locking it for the rest of
+// the transaction. found is false when there is no such listing.
+func lockListing(ctx context.Context, q dbtx, listingID int) (status string, reservedBy int, found bool, err error) {
+	var holder sql.NullInt64
+	err = q.QueryRowContext(ctx, `SELECT status, reserved_by FROM listings WHERE id = ? FOR UPDATE`, listingID).Scan(&status, &holder)
+	if err == sql.ErrNoRows {
+		return "", 0, false, nil
+	}
+	if err != nil {
+		return "", 0, false, fmt.Errorf("error loading listing: %w", err)
+	}
+	return status, int(holder.Int64), true, nil
+}
+
+// ReserveListing holds a listing for buyerID for the given minutes. A listing
+// the buyer already holds has its hold carried on, never shortened. It
+// reports false when the listing is sold, removed or held by someone else.
+func (rr *ReservationRepository) ReserveListing(ctx context.Context, listingID int, buyerID int, offerID *int, source string, minutes int) (bool, error) {
+	reserved := false
+	err := runInTx(ctx, rr.db, func(ctx context.Context) error {
+		tx := conn(ctx, rr.db)
+		status, reservedBy, found, err := lockListing(ctx, tx, listingID)
+		if err != nil || !found {
+			return err
+		}
+
+		query := `
+        UPDATE listings
+        SET status = 'reserved',
+            reserved_by = ?,
+            reserved_expires_at = NOW() + INTERVAL ? MINUTE,
+            updated_at = NOW()
+        WHERE id = ?`
+		switch {
+		case status == "for_sale":
+		case status == "reserved" && reservedBy == buyerID:
+			query = `
+        UPDATE listings
+        SET reserved_by = ?,
+            reserved_expires_at = GREATEST(COALESCE(reserved_expires_at, NOW()), NOW() + INTERVAL ? MINUTE),
+            updated_at = NOW()
+        WHERE id = ?`
+		default:
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, query, buyerID, minutes, listingID); err != nil {
+			return fmt.Errorf("failed to reserve listing: %w", err)
+		}
+		if err := startHold(ctx, tx, listingID, buyerID, offerID, source, ""); err != nil {
+			return err
+		}
+		reserved = true
+		return nil
+	})
+	if err != nil || !reserved {
+		return false, err
+	}
+
+	log.Printf("Listing %d reserved for buyer %d for %d minutes", listingID, buyerID, minutes)
+	return true, nil
+}
+
+// ExtendReservation sets the hold buyerID has on a listing to run for the
+// given minutes, e.g. the lifetime of the payment they started with provider.
+// It reports false when they don't hold the listing.
+func (rr *ReservationRepository) ExtendReservation(ctx context.Context, listingID int, buyerID int, minutes int, provider string) (bool, error) {
+	extended := false
+	err := runInTx(ctx, rr.db, func(ctx context.Context) error {
+		tx := conn(ctx, rr.db)
+		status, reservedBy, found, err := lockListing(ctx, tx, listingID)
+		if err != nil || !found || status != "reserved" || reservedBy != buyerID {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+        UPDATE listings
+        SET reserved_expires_at = NOW() + INTERVAL ? MINUTE,
+            updated_at = NOW()
+        WHERE id = ?`, minutes, listingID)
+		if err != nil {
+			return fmt.Errorf("failed to extend reservation: %w", err)
+		}
+		extended = true
+		return startHold(ctx, tx, listingID, buyerID, nil, models.HoldSourceCheckout, provider)
+	})
+	if err != nil {
+		return false, err
+	}
+	return extended, nil
+}
+
+// SuspendCompetingOffers puts other buyers' open offers on a listing on hold
+// while buyerID has it reserved
+func (rr *ReservationRepository) SuspendCompetingOffers(ctx context.Context, listingID int, buyerID int) ([]models.OfferUpdate, error) {
+	return suspendCompetingOffers(ctx, conn(ctx, rr.db), listingID, buyerID)
+}
+
+// ReinstateCompetingOffers brings back the offers suspended on a listing that
+// is for sale again
+func (rr *ReservationRepository) ReinstateCompetingOffers(ctx context.Context, listingID int) ([]models.OfferUpdate, error) {
+	return reinstateCompetingOffers(ctx, conn(ctx, rr.db), listingID)
+}
+
+// IsListingReserved checks if a listing is reserved and whether that hold has
+// lapsed
+func (rr *ReservationRepository) IsListingReserved(ctx context.Context, listingID int) (bool, bool, error) {
+	var status string
+	var reservedExpiresAt *time.Time
+	query := `
+        SELECT status, reserved_expires_at
+        FROM listings
+        WHERE id = ?
+    `
+	err := conn(ctx, rr.db).QueryRowContext(ctx, query, listingID).Scan(&status, &reservedExpiresAt)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check listing status: %w", err)
+	}
+	if status != "reserved" {
+		return false, false, nil
+	}
+	if reservedExpiresAt == nil || time.Now().Before(*reservedExpiresAt) {
+		return true, false, nil // Reserved and not expired
+	}
+	return true, true, nil // Reserved but expired
+}
+
+// ReserveCartListings reserves every selected listing in the buyer's cart:
+// either all of them are held for the given minutes or none are. An empty
+// listingIDs selects the whole cart. It must run in a transaction.
+func (rr *ReservationRepository) ReserveCartListings(ctx context.Context, buyerID int, listingIDs []int, minutes int, provider string) ([]models.CartCheckoutItem, error) {
+	tx := conn(ctx, rr.db)
+
+	query := `
+        SELECT l.id, l.seller_id, l.price, l.status, l.reserved_by, l.reserved_expires_at, b.title
+        FROM cart c
+        JOIN listings l ON c.listing_id = l.id
+        JOIN books b ON l.book_id = b.id
+        WHERE c.user_id = ?`
+	args := []interface{}{buyerID}
+	if len(listingIDs) > 0 {
+		query += ` AND l.id IN (` + placeholders(len(listingIDs)) + `)`
+		for _, id := range listingIDs {
+			args = append(args, id)
+		}
+	}
+	query += ` ORDER BY l.id FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading cart listings: %w", err)
+	}
+
+	var items []models.CartCheckoutItem
+	var unavailable []int
+	for rows.Next() {
+		var item models.CartCheckoutItem
+		var status string
+		var reservedBy sql.NullInt64
+		var reservedExpiresAt *time.Time
+		if err := rows.Scan(&item.ListingID, &item.SellerID, &item.Price, &status, &reservedBy, &reservedExpiresAt, &item.Title); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning cart listing: %w", err)
+		}
+		// A lapsed hold counts as available; the expiry worker just hasn't
+		// got to it yet. So does one the buyer already has.
+		ownHold := status == "reserved" && int(reservedBy.Int64) == buyerID
+		expiredHold := status == "reserved" && reservedExpiresAt != nil && !reservedExpiresAt.After(time.Now())
+		if (status != "for_sale" && !ownHold && !expiredHold) || item.SellerID == buyerID {
+			unavailable = append(unavailable, item.ListingID)
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("error iterating cart listings: %w", err)
+	}
+	rows.Close()
+
+	if len(unavailable) > 0 {
+		return nil, fmt.Errorf("listings %v are not available for purchase", unavailable)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no cart listings selected for checkout")
+	}
+	if len(listingIDs) > 0 && len(items) != len(listingIDs) {
+		return nil, fmt.Errorf("some selected listings are not in the cart")
+	}
+
+	reserveArgs := []interface{}{minutes, buyerID}
+	for _, item := range items {
+		reserveArgs = append(reserveArgs, item.ListingID)
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE listings
+        SET status = 'reserved',
+            reserved_expires_at = NOW() + INTERVAL ? MINUTE,
+            reserved_by = ?,
+            updated_at = NOW()
+        WHERE id IN (`+placeholders(len(items))+`)`, reserveArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve cart listings: %w", err)
+	}
+	for _, item := range items {
+		if err := startHold(ctx, tx, item.ListingID, buyerID, nil, models.HoldSourceCart, provider); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Reserved %d cart listings for buyer %d for %d minutes", len(items), buyerID, minutes)
+	return items, nil
+}
+
+// release puts a reserved listing back on sale if the extra condition holds
+// and ends its holds with status. It reports whether the listing was released.
+func (rr *ReservationRepository) release(ctx context.Context, listingID int, status string, cond string, args ...interface{}) (bool, error) {
+	tx := conn(ctx, rr.db)
+	result, err := tx.ExecContext(ctx, `
+        UPDATE listings
+        SET status = 'for_sale',
+            reserved_expires_at = NULL,
+            reserved_by = NULL,
+            updated_at = NOW()
+        WHERE id = ?
+        AND status = 'reserved'
+        `+cond, append([]interface{}{listingID}, args...)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to release listing: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	return true, resolveHolds(ctx, tx, listingID, 0, status)
+}
+
+// ExpireReservation puts a listing whose hold has lapsed back on sale
+func (rr *ReservationRepository) ExpireReservation(ctx context.Context, listingID int) (bool, error) {
+	return rr.release(ctx, listingID, models.HoldExpired, `AND reserved_expires_at <= NOW()`)
+}
+
+// ReleaseReservation ends buyerID's hold on a listing right away, e.g. when
+// their payment failed. A listing since reserved by someone else is left alone.
+func (rr *ReservationRepository) ReleaseReservation(ctx context.Context, listingID int, buyerID int) (bool, error) {
+	return rr.release(ctx, listingID, models.HoldReleased, `AND (reserved_by IS NULL OR reserved_by = ?)`, buyerID)
+}
+
+// ReleaseOfferReservation ends the hold an accepted offer's buyer has on a
+// listing
+func (rr *ReservationRepository) ReleaseOfferReservation(ctx context.Context, listingID int, offerID int) (bool, error) {
+	return rr.release(ctx, listingID, models.HoldReleased,
+		`AND (reserved_by IS NULL OR reserved_by = (SELECT buyer_id FROM offers WHERE id = ?))`, offerID)
+}
+
+// ListExpiredReservations returns the listings whose hold has lapsed
+func (rr *ReservationRepository) ListExpiredReservations(ctx context.Context) ([]int, error) {
+	return rr.listIDs(ctx, `
+        SELECT id
+        FROM listings
+        WHERE status = 'reserved'
+        AND reserved_expires_at IS NOT NULL
+        AND reserved_expires_at <= NOW()`)
+}
+
+// ListStalledWaitlists returns listings that are for sale with buyers still
+// waiting for them, e.g. because an accepted offer kept the listing from
+// being handed on when the last hold lapsed
+func (rr *ReservationRepository) ListStalledWaitlists(ctx context.Context) ([]int, error) {
+	return rr.listIDs(ctx, `
+        SELECT DISTINCT l.id
+        FROM listing_waitlist w
+        JOIN listings l ON w.listing_id = l.id
+        WHERE w.status = 'waiting' AND l.status = 'for_sale'
+          AND NOT EXISTS (`+liveAcceptedOffer+`)`)
+}
+
+func (rr *ReservationRepository) listIDs(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := rr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// NextReservationExpiry returns when the soonest hold runs out, or nil when
+// no listing is reserved
+func (rr *ReservationRepository) NextReservationExpiry(ctx context.Context) (*time.Time, error) {
+	var next *time.Time
+	err := rr.db.QueryRowContext(ctx, `
+        SELECT MIN(reserved_expires_at) FROM listings WHERE status = 'reserved'`).Scan(&next)
+	if err != nil {
+		return nil, fmt.Errorf("error loading next reservation expiry: %w", err)
+	}
+	return next, nil
+}
+
+// ClaimExpiringReservations returns the active holds running out within
+// window that haven't been reminded yet, marking them reminded. Holds that
+// last less than twice the window are never reminded.
+func (rr *ReservationRepository) ClaimExpiringReservations(ctx context.Context, window time.Duration) ([]models.ListingHold, error) {
+	seconds := int(window.Seconds())
+	ids, err := rr.listIDs(ctx, `
+        SELECT id
+        FROM listing_holds
+        WHERE status = 'active'
+          AND reminded_at IS NULL
+          AND expires_at > NOW()
+          AND expires_at <= NOW() + INTERVAL ? SECOND
+          AND expires_at >= created_at + INTERVAL ? SECOND`, seconds, 2*seconds)
+	if err != nil {
+		return nil, err
+	}
+
+	var holds []models.ListingHold
+	for _, id := range ids {
+		// Another instance may have claimed it in the meantime
+		result, err := rr.db.ExecContext(ctx, `
+            UPDATE listing_holds SET reminded_at = NOW()
+            WHERE id = ? AND status = 'active' AND reminded_at IS NULL`, id)
+		if err != nil {
+			return holds, fmt.Errorf("failed to claim hold reminder: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return holds, fmt.Errorf("error checking rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			continue
+		}
+		hold, err := getHold(ctx, rr.db, id)
+		if err != nil {
+			return holds, err
+		}
+		holds = append(holds, *hold)
+	}
+	return holds, nil
+}
+
+// getHold loads a hold by ID
+func getHold(ctx context.Context, q dbtx, holdID int) (*models.ListingHold, error) {
+	var h models.ListingHold
+	var offerID sql.NullInt64
+	var provider sql.NullString
+	var resolvedAt sql.NullTime
+	err := q.QueryRowContext(ctx, `
+        SELECT id, listing_id, buyer_id, offer_id, source, payment_provider, status, expires_at, created_at, resolved_at
+        FROM listing_holds WHERE id = ?`, holdID).Scan(
+		&h.ID, &h.ListingID, &h.BuyerID, &offerID, &h.Source, &provider, &h.Status, &h.ExpiresAt, &h.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error loading hold: %w", err)
+	}
+	if offerID.Valid {
+		id := int(offerID.Int64)
+		h.OfferID = &id
+	}
+	if provider.Valid {
+		h.PaymentProvider = &provider.String
+	}
+	if resolvedAt.Valid {
+		h.ResolvedAt = &resolvedAt.Time
+	}
+	return &h, nil
+}
+
+// PromoteNextWaiting reserves a listing that's for sale again for the buyer
+// who has waited longest, for the given minutes. Nobody is promoted while an
+// accepted offer on the listing can still be paid. It returns the new hold,
+// or nil when there was nobody to promote. It must run in a transaction.
+func (rr *ReservationRepository) PromoteNextWaiting(ctx context.Context, listingID int, minutes int) (*models.ListingHold, error) {
+	tx := conn(ctx, rr.db)
+
+	var entryID, userID int
+	err := tx.QueryRowContext(ctx, `
+        SELECT w.id, w.user_id
+        FROM listing_waitlist w
+        JOIN listings l ON w.listing_id = l.id
+        WHERE w.listing_id = ? AND w.status = 'waiting' AND w.user_id != l.seller_id
+        ORDER BY w.created_at, w.id
+        LIMIT 1
+        FOR UPDATE`, listingID).Scan(&entryID, &userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading waitlist: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE listings l
+        SET l.status = 'reserved',
+            l.reserved_by = ?,
+            l.reserved_expires_at = NOW() + INTERVAL ? MINUTE,
+            l.updated_at = NOW()
+        WHERE l.id = ? AND l.status = 'for_sale'
+          AND NOT EXISTS (`+liveAcceptedOffer+`)`, userID, minutes, listingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve listing: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE listing_waitlist SET status = 'promoted', promoted_at = NOW() WHERE id = ?`, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update waitlist: %w", err)
+	}
+	if err := startHold(ctx, tx, listingID, userID, nil, models.HoldSourceWaitlist, ""); err != nil {
+		return nil, err
+	}
+
+	var holdID int
+	err = tx.QueryRowContext(ctx, `
+        SELECT id FROM listing_holds WHERE listing_id = ? AND buyer_id = ? AND status = 'active'`, listingID, userID).Scan(&holdID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading hold: %w", err)
+	}
+
+	log.Printf("Listing %d handed to waitlisted buyer %d for %d minutes", listingID, userID, minutes)
+	return getHold(ctx, tx, holdID)
+}
+
+// JoinWaitlist queues userID for a listing someone else has reserved. Joining
+// again after leaving or being promoted goes to the back of the line. It
+// reports false when the listing isn't reserved by another buyer or is the
+// user's own.
+func (rr *ReservationRepository) JoinWaitlist(ctx context.Context, listingID int, userID int) (bool, error) {
+	var status string
+	var sellerID int
+	var reservedBy sql.NullInt64
+	err := rr.db.QueryRowContext(ctx, `SELECT status, seller_id, reserved_by FROM listings WHERE id = ?`, listingID).Scan(&status, &sellerID, &reservedBy)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error loading listing: %w", err)
+	}
+	if status != "reserved" || sellerID == userID || int(reservedBy.Int64) == userID {
+		return false, nil
+	}
+
+	// MySQL assigns left to right, so the IFs see the old status
+	_, err = rr.db.ExecContext(ctx, `
+        INSERT INTO listing_waitlist (listing_id, user_id, status) VALUES (?, ?, 'waiting')
+        ON DUPLICATE KEY UPDATE
+            created_at = IF(status = 'waiting', created_at, NOW()),
+            promoted_at = IF(status = 'waiting', promoted_at, NULL),
+            status = 'waiting'`, listingID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to join waitlist: %w", err)
+	}
+	return true, nil
+}
+
+// LeaveWaitlist takes userID out of a listing's line and reports whether they
+// were waiting
+func (rr *ReservationRepository) LeaveWaitlist(ctx context.Context, listingID int, userID int) (bool, error) {
+	result, err := rr.db.ExecContext(ctx, `
+        UPDATE listing_waitlist SET status = 'left'
+        WHERE listing_id = ? AND user_id = ? AND status = 'waiting'`, listingID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to leave waitlist: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// GetWaitlistEntry returns userID's entry on a listing's waitlist with their
+// place in line, or nil if they never joined
+func (rr *ReservationRepository) GetWaitlistEntry(ctx context.Context, listingID int, userID int) (*models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	err := rr.db.QueryRowContext(ctx, `
+        SELECT w.listing_id, w.user_id, w.status, w.created_at,
+               CASE WHEN w.status = 'waiting' THEN (
+                   SELECT COUNT(*) FROM listing_waitlist o
+                   WHERE o.listing_id = w.listing_id AND o.status = 'waiting'
+                     AND (o.created_at < w.created_at OR (o.created_at = w.created_at AND o.id <= w.id))
+               ) ELSE 0 END
+        FROM listing_waitlist w
+        WHERE w.listing_id = ? AND w.user_id = ?`, listingID, userID).Scan(&e.ListingID, &e.UserID, &e.Status, &e.CreatedAt, &e.Position)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading waitlist entry: %w", err)
+	}
+	return &e, nil
+}
+
+// countHolds adds n holds that ended with status to c
+func countHolds(c *models.HoldCounts, status string, n int) {
+	switch status {
+	case models.HoldActive:
+		c.Active += n
+	case models.HoldConverted:
+		c.Converted += n
+	case models.HoldExpired:
+		c.Expired += n
+	case models.HoldReleased:
+		c.Released += n
+	}
+	if ended := c.Converted + c.Expired + c.Released; ended > 0 {
+		c.ConversionRate = float64(c.Converted) / float64(ended)
+	}
+}
+
+// GetMetrics tallies the holds taken since a point in time by outcome,
+// overall and per source and payment provider. Holds that never reached a
+// payment are counted under provider "none".
+func (rr *ReservationRepository) GetMetrics(ctx context.Context, since time.Time) (*models.ReservationMetrics, error) {
+	rows, err := rr.db.QueryContext(ctx, `
+        SELECT source, COALESCE(payment_provider, 'none'), status, COUNT(*),
+               COALESCE(SUM(CASE WHEN status = 'converted' THEN TIMESTAMPDIFF(SECOND, created_at, resolved_at) END), 0)
+        FROM listing_holds
+        WHERE created_at >= ?
+        GROUP BY source, COALESCE(payment_provider, 'none'), status`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying hold metrics: %w", err)
+	}
+	defer rows.Close()
+
+	m := &models.ReservationMetrics{
+		Since:      since,
+		BySource:   map[string]models.HoldCounts{},
+		ByProvider: map[string]models.HoldCounts{},
+	}
+	var secondsToConvert float64
+	for rows.Next() {
+		var source, provider, status string
+		var n int
+		var seconds float64
+		if err := rows.Scan(&source, &provider, &status, &n, &seconds); err != nil {
+			return nil, fmt.Errorf("error scanning hold metrics: %w", err)
+		}
+		countHolds(&m.Overall, status, n)
+		bySource := m.BySource[source]
+		countHolds(&bySource, status, n)
+		m.BySource[source] = bySource
+		byProvider := m.ByProvider[provider]
+		countHolds(&byProvider, status, n)
+		m.ByProvider[provider] = byProvider
+		secondsToConvert += seconds
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if m.Overall.Converted > 0 {
+		m.AvgSecondsToConvert = secondsToConvert / float64(m.Overall.Converted)
+	}
+
+	err = rr.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM listing_waitlist WHERE status = 'waiting'`).Scan(&m.Waiting)
+	if err != nil {
+		return nil, fmt.Errorf("error counting waitlist: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,268 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+type SavedSearchRepository struct {
+	db *sql.DB
+}
+
+func NewSavedSearchRepository(db *sql.DB) *SavedSearchRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &SavedSearchRepository{db}
+}
+
+const savedSearchColumns = `id, user_id, name, query, notify, listed_after, last_run_at, created_at, updated_at`
+
+// savedSearchOverlap is how far before its last run a search looks again, so
+// listings committed after a run but stamped before it are not missed. Rows
+// in saved_search_matches keep them from alerting twice.
+const savedSearchOverlap = 10 * time.Minute
+
+// forgetSavedSearchMatchesQuery lets a relisted listing alert saved searches
+// again
+const forgetSavedSearchMatchesQuery = `DELETE FROM saved_search_matches WHERE listing_id = ?`
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (models.SavedSearch, error) {
+	var s models.SavedSearch
+	var query []byte
+	var lastRunAt sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &query, &s.Notify, &s.ListedAfter, &lastRunAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(query, &s.Query); err != nil {
+		return s, fmt.Errorf("invalid query in saved search %d: %w", s.ID, err)
+	}
+	if lastRunAt.Valid {
+		s.LastRunAt = &lastRunAt.Time
+	}
+	return s, nil
+}
+
+// ListSavedSearches returns a user's saved searches, oldest first
+func (sr *SavedSearchRepository) ListSavedSearches(ctx context.Context, userID int) ([]models.SavedSearch, error) {
+	rows, err := sr.db.QueryContext(ctx, `
+        SELECT `+savedSearchColumns+` FROM saved_searches WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	searches := []models.SavedSearch{}
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning saved search: %w", err)
+		}
+		searches = append(searches, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved searches: %w", err)
+	}
+	return searches, nil
+}
+
+// GetSavedSearch returns one of a user's saved searches, or nil when they
+// have no such search
+func (sr *SavedSearchRepository) GetSavedSearch(ctx context.Context, userID int, searchID int) (*models.SavedSearch, error) {
+	s, err := scanSavedSearch(conn(ctx, sr.db).QueryRowContext(ctx, `
+        SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = ? AND user_id = ?`, searchID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading saved search: %w", err)
+	}
+	return &s, nil
+}
+
+// CountSavedSearches returns how many searches a user has saved
+func (sr *SavedSearchRepository) CountSavedSearches(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := sr.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM saved_searches WHERE user_id = ?`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting saved searches: %w", err)
+	}
+	return count, nil
+}
+
+// CreateSavedSearch saves a search and returns its ID. Only listings put up
+// from now on count as new matches.
+func (sr *SavedSearchRepository) CreateSavedSearch(ctx context.Context, s models.SavedSearch) (int, error) {
+	query, err := json.Marshal(s.Query)
+	if err != nil {
+		return 0, err
+	}
+	result, err := sr.db.ExecContext(ctx, `
+        INSERT INTO saved_searches (user_id, name, query, notify)
+        VALUES (?, ?, ?, ?)`,
+		s.UserID, s.Name, string(query), s.Notify)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save search: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading saved search ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateSavedSearch saves changes to a user's saved search. With
+// skipExisting the listings already up are no longer new matches, e.g.
+// because the query changed.
+func (sr *SavedSearchRepository) UpdateSavedSearch(ctx context.Context, s models.SavedSearch, skipExisting bool) error {
+	query, err := json.Marshal(s.Query)
+	if err != nil {
+		return err
+	}
+	sets := []string{"name = ?", "query = ?", "notify = ?", "updated_at = NOW()"}
+	args := []interface{}{s.Name, string(query), s.Notify}
+	if skipExisting {
+		sets = append(sets, "listed_after = NOW()")
+	}
+	args = append(args, s.ID, s.UserID)
+
+	_, err = sr.db.ExecContext(ctx, `
+        UPDATE saved_searches SET `+strings.Join(sets, ", ")+` WHERE id = ? AND user_id = ?`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update saved search: %w", err)
+	}
+	return nil
+}
+
+// DeleteSavedSearch deletes one of a user's saved searches and reports
+// whether they had it
+func (sr *SavedSearchRepository) DeleteSavedSearch(ctx context.Context, userID int, searchID int) (bool, error) {
+	result, err := sr.db.ExecContext(ctx, `DELETE FROM saved_searches WHERE id = ? AND user_id = ?`, searchID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RunSavedSearches checks up to limit saved searches with alerts on, that
+// haven't been checked in the last minAge, against the listings put up or
+// changed since their last check. It returns the searches that found
+// listings they haven't alerted about before, with at most listingLimit of
+// the newest each, and records those listings as alerted. Searches being run
+// elsewhere are skipped.
+func (sr *SavedSearchRepository) RunSavedSearches(ctx context.Context, minAge time.Duration, limit int, listingLimit int) ([]models.SavedSearchMatch, int, error) {
+	var matches []models.SavedSearchMatch
+	var run int
+	err := runInTx(ctx, sr.db, func(ctx context.Context) error {
+		tx := conn(ctx, sr.db)
+
+		rows, err := tx.QueryContext(ctx, `
+            SELECT `+savedSearchColumns+` FROM saved_searches
+            WHERE notify = true AND (last_run_at IS NULL OR last_run_at < NOW() - INTERVAL ? SECOND)
+            ORDER BY last_run_at IS NOT NULL, last_run_at, id
+            LIMIT ?
+            FOR UPDATE SKIP LOCKED`, int(minAge.Seconds()), limit)
+		if err != nil {
+			return fmt.Errorf("error claiming saved searches: %w", err)
+		}
+		var searches []models.SavedSearch
+		for rows.Next() {
+			s, err := scanSavedSearch(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning saved search: %w", err)
+			}
+			searches = append(searches, s)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return fmt.Errorf("error iterating saved searches: %w", err)
+		}
+		rows.Close()
+		run = len(searches)
+
+		for _, s := range searches {
+			match, err := matchSavedSearch(ctx, tx, s, listingLimit)
+			if err != nil {
+				return err
+			}
+			if match.Count > 0 {
+				matches = append(matches, match)
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE saved_searches SET last_run_at = NOW() WHERE id = ?`, s.ID)
+			if err != nil {
+				return fmt.Errorf("error updating saved search: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return matches, run, nil
+}
+
+// matchSavedSearch finds the for-sale listings changed since the search's
+// last run, less savedSearchOverlap, that match it and that it hasn't alerted
+// about, and records them as alerted. The user's own listings don't count.
+func matchSavedSearch(ctx context.Context, tx dbtx, s models.SavedSearch, listingLimit int) (models.SavedSearchMatch, error) {
+	match := models.SavedSearchMatch{SavedSearchID: s.ID, UserID: s.UserID, Name: s.Name, ListingIDs: []int{}}
+
+	since := s.ListedAfter
+	if s.LastRunAt != nil && s.LastRunAt.Add(-savedSearchOverlap).After(since) {
+		since = s.LastRunAt.Add(-savedSearchOverlap)
+	}
+
+	conditions, args := listingSearchConditions(s.Query.Params())
+	conditions = append(conditions, "l.updated_at >= ?", "l.seller_id <> ?",
+		"NOT EXISTS (SELECT 1 FROM saved_search_matches m WHERE m.saved_search_id = ? AND m.listing_id = l.id)")
+	args = append(args, since, s.UserID, s.ID)
+	from := `
+        FROM listings l
+        JOIN books b ON l.book_id = b.id
+        JOIN users u ON l.seller_id = u.id
+        WHERE ` + strings.Join(conditions, " AND ")
+
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*)`+from, args...).Scan(&match.Count); err != nil {
+		return match, fmt.Errorf("error matching saved search %d: %w", s.ID, err)
+	}
+	if match.Count == 0 {
+		return match, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT l.id`+from+` ORDER BY l.updated_at DESC, l.id DESC LIMIT ?`, append(args, listingLimit)...)
+	if err != nil {
+		return match, fmt.Errorf("error matching saved search %d: %w", s.ID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return match, fmt.Errorf("error scanning matching listing: %w", err)
+		}
+		match.ListingIDs = append(match.ListingIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return match, fmt.Errorf("error iterating matching listings: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT IGNORE INTO saved_search_matches (saved_search_id, listing_id)
+        SELECT ?, l.id`+from, append([]interface{}{s.ID}, args...)...)
+	if err != nil {
+		return match, fmt.Errorf("error recording saved search %d matches: %w", s.ID, err)
+	}
+	return match, nil
+}
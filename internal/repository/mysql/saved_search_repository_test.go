@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMatchSavedSearch(t *testing.T) {
+	listedAfter := time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC)
+	lastRun := time.Date(2024, time.May, 2, 10, 0, 0, 0, time.UTC)
+	justAfterListed := listedAfter.Add(5 * time.Minute)
+
+	tests := []struct {
+		name      string
+		lastRunAt *time.Time
+		wantSince time.Time
+		count     int
+		wantIDs   []int
+	}{
+		{name: "never run", wantSince: listedAfter, count: 0, wantIDs: []int{}},
+		{name: "looks back past the last run", lastRunAt: &lastRun, wantSince: lastRun.Add(-savedSearchOverlap), count: 3, wantIDs: []int{8, 6}},
+		{name: "not before listed_after", lastRunAt: &justAfterListed, wantSince: listedAfter, count: 1, wantIDs: []int{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			s := models.SavedSearch{ID: 12, UserID: 9, Name: "Dune", ListedAfter: listedAfter, LastRunAt: tt.lastRunAt}
+			mock.ExpectQuery(`SELECT COUNT\(\*\)\s+FROM listings l.*l.updated_at >= \? AND l.seller_id <> \? AND NOT EXISTS`).
+				WithArgs("for_sale", tt.wantSince, 9, 12).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+			if tt.count > 0 {
+				rows := sqlmock.NewRows([]string{"id"})
+				for _, id := range tt.wantIDs {
+					rows.AddRow(id)
+				}
+				mock.ExpectQuery(`SELECT l.id\s+FROM listings l.*ORDER BY l.updated_at DESC, l.id DESC LIMIT \?`).
+					WithArgs("for_sale", tt.wantSince, 9, 12, 2).
+					WillReturnRows(rows)
+				mock.ExpectExec(`INSERT IGNORE INTO saved_search_matches \(saved_search_id, listing_id\)\s+SELECT \?, l.id`).
+					WithArgs(12, "for_sale", tt.wantSince, 9, 12).
+					WillReturnResult(sqlmock.NewResult(0, int64(tt.count)))
+			}
+
+			match, err := matchSavedSearch(context.Background(), db, s, 2)
+			if err != nil {
+				t.Fatalf("matchSavedSearch: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if match.Count != tt.count || len(match.ListingIDs) != len(tt.wantIDs) {
+				t.Fatalf("match = %+v, want %d matches %v", match, tt.count, tt.wantIDs)
+			}
+			for i := range tt.wantIDs {
+				if match.ListingIDs[i] != tt.wantIDs[i] {
+					t.Errorf("listings = %v, want %v", match.ListingIDs, tt.wantIDs)
+					break
+				}
+			}
+		})
+	}
+}
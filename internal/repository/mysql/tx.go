@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dbtx is what repository methods query through: the *sql.DB itself, or the
+// *sql.Tx a caller has opened with runInTx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// conn returns the transaction carried by ctx, or db when there is none.
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// runInTx runs fn inside a transaction that repository methods pick up from
+// the context it is given. If ctx already carries a transaction fn joins it,
+// and the outermost caller decides whether to commit.
+func runInTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// txRunner is embedded by repositories whose callers need to group several
+// calls into one transaction.
+type txRunner struct {
+	db *sql.DB
+}
+
+// RunInTx runs fn in a single database transaction. Repository methods called
+// with the ctx handed to fn take part in it.
+func (t txRunner) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return runInTx(ctx, t.db, fn)
+}
@@ -22,45 +22,60 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db}
 }
 
-// GetAllUsers retrieves all users from the database
-func (ur *UserRepository) GetAllUsers(ctx context.Context) ([]models.GetAllUsers, error) {
+// GetAllUsers retrieves one page of users from the database
+func (ur *UserRepository) GetAllUsers(ctx context.Context, page models.PageRequest) ([]models.GetAllUsers, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, userSortKeys, "created_at", "u.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
 	query := `
     SELECT 
-        id, email, first_name, last_name, picture_profile, picture_background,
-        phone_number, gender, quote, bio, role
-    FROM users
+        u.id, u.email, u.first_name, u.last_name, u.picture_profile, u.picture_background,
+        u.phone_number, u.gender, u.quote, u.bio, u.role, ` + kp.SortValue + `
+    FROM users u
+    WHERE 1 = 1` + kp.Where + `
+    ORDER BY ` + kp.OrderBy + `
+    LIMIT ?
     `
+	args := append(kp.Args, kp.LimitArg())
 
 	// Execute the query
-	rows, err := ur.db.QueryContext(ctx, query)
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying users: %w", err)
+		return nil, nil, fmt.Errorf("error querying users: %w", err)
 	}
 	defer rows.Close()
 
 	// Slice to hold the results
-	var users []models.GetAllUsers
+	users := []models.GetAllUsers{}
+	var sortValues []string
+	var ids []int
 
 	// Iterate through the result set
 	for rows.Next() {
 		var user models.GetAllUsers
+		var sortValue string
 		err := rows.Scan(
 			&user.ID, &user.Email, &user.FirstName, &user.LastName,
 			&user.ProfilePicture, &user.BackgroundPicture, &user.PhoneNumber,
-			&user.Gender, &user.Quote, &user.Bio, &user.Role,
+			&user.Gender, &user.Quote, &user.Bio, &user.Role, &sortValue,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning user: %w", err)
+			return nil, nil, fmt.Errorf("error scanning user: %w", err)
 		}
 		users = append(users, user)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, user.ID)
 	}
 
 	// Check for errors during iteration
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating users: %w", err)
+		return nil, nil, fmt.Errorf("error iterating users: %w", err)
 	}
 
-	return users, nil
+	users, info := trimPage(kp, users, sortValues, ids)
+	return users, info, nil
 }
 
 func (ur *UserRepository) getAuthorsByBookID(ctx context.Context, bookID int) ([]string, error) {
@@ -157,13 +172,17 @@ func (ur *UserRepository) GetBookRequests(ctx context.Context) ([]*models.BookRe
 
     return requests, nil
 }
+// CreateBankAccount stores a payout account. Only the masked number is kept;
+// the full number goes to the Omise recipient.
 func (ur *UserRepository) CreateBankAccount(ctx context.Context, bank *models.BankAccount) (int, error) {
 	query := `
-		INSERT INTO bank_accounts (user_id, bank_name, account_number, account_holder_name, created_at, updated_at)
-		VALUES (?, ?, ?, ?, NOW(), NOW())
+		INSERT INTO bank_accounts (user_id, bank_name, account_number_masked, account_holder_name,
+		                           omise_recipient_id, verification_status, verified_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
 	`
 
-	result, err := ur.db.ExecContext(ctx, query, bank.UserID, bank.BankName, bank.AccountNumber, bank.AccountHolderName)
+	result, err := ur.db.ExecContext(ctx, query, bank.UserID, bank.BankName, bank.AccountNumberMasked, bank.AccountHolderName,
+		nullString(bank.OmiseRecipientID), bank.VerificationStatus, bank.VerifiedAt)
 	if err != nil {
 		return 0, err
 	}
@@ -177,6 +196,104 @@ func (ur *UserRepository) CreateBankAccount(ctx context.Context, bank *models.Ba
 	return int(id), nil
 }
 
+const bankAccountColumns = `id, user_id, bank_name, account_number_masked, account_holder_name,
+		       omise_recipient_id, verification_status, verified_at, created_at, updated_at`
+
+func scanBankAccount(row interface{ Scan(...interface{}) error }) (*models.BankAccount, error) {
+	var b models.BankAccount
+	var recipientID sql.NullString
+	var verifiedAt sql.NullTime
+	err := row.Scan(&b.ID, &b.UserID, &b.BankName, &b.AccountNumberMasked, &b.AccountHolderName,
+		&recipientID, &b.VerificationStatus, &verifiedAt, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	b.OmiseRecipientID = recipientID.String
+	if verifiedAt.Valid {
+		b.VerifiedAt = &verifiedAt.Time
+	}
+	return &b, nil
+}
+
+// GetBankAccounts returns a user's payout accounts, newest first
+func (ur *UserRepository) GetBankAccounts(ctx context.Context, userID int) ([]models.BankAccount, error) {
+	query := `SELECT ` + bankAccountColumns + ` FROM bank_accounts WHERE user_id = ? ORDER BY id DESC`
+	rows, err := ur.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying bank accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.BankAccount{}
+	for rows.Next() {
+		b, err := scanBankAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning bank account: %w", err)
+		}
+		accounts = append(accounts, *b)
+	}
+	return accounts, rows.Err()
+}
+
+// GetBankAccountByID returns one of a user's payout accounts, or nil if the
+// user has no account with that ID
+func (ur *UserRepository) GetBankAccountByID(ctx context.Context, userID int, accountID int) (*models.BankAccount, error) {
+	query := `SELECT ` + bankAccountColumns + ` FROM bank_accounts WHERE id = ? AND user_id = ?`
+	b, err := scanBankAccount(ur.db.QueryRowContext(ctx, query, accountID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bank account: %w", err)
+	}
+	return b, nil
+}
+
+// UpdateBankAccount saves a payout account's details and recipient
+func (ur *UserRepository) UpdateBankAccount(ctx context.Context, bank *models.BankAccount) error {
+	query := `
+		UPDATE bank_accounts
+		SET bank_name = ?, account_number_masked = ?, account_holder_name = ?, omise_recipient_id = ?,
+		    verification_status = ?, verified_at = ?, updated_at = NOW()
+		WHERE id = ? AND user_id = ?
+	`
+	_, err := ur.db.ExecContext(ctx, query, bank.BankName, bank.AccountNumberMasked, bank.AccountHolderName,
+		nullString(bank.OmiseRecipientID), bank.VerificationStatus, bank.VerifiedAt, bank.ID, bank.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update bank account: %w", err)
+	}
+	return nil
+}
+
+// UpdateBankAccountVerification records a payout account's latest recipient status
+func (ur *UserRepository) UpdateBankAccountVerification(ctx context.Context, accountID int, status string) error {
+	query := `
+		UPDATE bank_accounts
+		SET verification_status = ?,
+		    verified_at = CASE WHEN ? = 'verified' THEN COALESCE(verified_at, NOW()) ELSE NULL END
+		WHERE id = ?
+	`
+	_, err := ur.db.ExecContext(ctx, query, status, status, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to update bank account verification: %w", err)
+	}
+	return nil
+}
+
+// DeleteBankAccount removes one of a user's payout accounts. It returns false
+// if the user has no account with that ID.
+func (ur *UserRepository) DeleteBankAccount(ctx context.Context, userID int, accountID int) (bool, error) {
+	result, err := ur.db.ExecContext(ctx, `DELETE FROM bank_accounts WHERE id = ? AND user_id = ?`, accountID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete bank account: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
 func (ur *UserRepository) CreateBookRequest(ctx context.Context, req *models.BookRequest) (int, error) {
 	query := `
 		INSERT INTO book_requests (user_id, title, isbn, note, created_at, updated_at)
@@ -214,6 +331,25 @@ func (ur *UserRepository) GetGender(ctx context.Context, userID int) (string, er
 	return gender, nil
 }
 
+// GetPreferredPaymentProvider returns the buyer's saved payment provider, or "" if none
+func (ur *UserRepository) GetPreferredPaymentProvider(ctx context.Context, userID int) (string, error) {
+	var provider sql.NullString
+	query := "SELECT preferred_payment_provider FROM users WHERE id = ?"
+	if err := ur.db.QueryRowContext(ctx, query, userID).Scan(&provider); err != nil {
+		return "", fmt.Errorf("failed to get preferred payment provider: %w", err)
+	}
+	return provider.String, nil
+}
+
+// SetPreferredPaymentProvider saves the provider a buyer's checkouts use by default
+func (ur *UserRepository) SetPreferredPaymentProvider(ctx context.Context, userID int, provider string) error {
+	query := "UPDATE users SET preferred_payment_provider = ? WHERE id = ?"
+	if _, err := ur.db.ExecContext(ctx, query, provider, userID); err != nil {
+		return fmt.Errorf("failed to set preferred payment provider: %w", err)
+	}
+	return nil
+}
+
 // Updated UserRepository
 func (ur *UserRepository) GetAllUserReview(ctx context.Context) ([]models.UserReview, error) {
 	query := `
@@ -339,19 +475,33 @@ func (ur *UserRepository) AddBookToLibrary(ctx context.Context, userID int, book
 	return false, nil
 }
 
-func (ur *UserRepository) AddBookToListing(ctx context.Context, userID int, bookID int, price float32, allowOffer bool, imageURLs []string, sellerNote string, phone_number string) (bool, error) {
+// AddBookToListing lists a book for sale, or puts the seller's existing
+// listing of it back up, and returns the listing's ID
+func (ur *UserRepository) AddBookToListing(ctx context.Context, userID int, bookID int, price float32, allowOffer bool, imageURLs []string, sellerNote string, phone_number string, condition models.ListingCondition, thresholds models.OfferThresholds) (int, error) {
 
-	query := `INSERT INTO listings (seller_id, book_id, price, allow_offers, seller_note, phone_number, created_at, updated_at) 
-                  VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW()) 
-                  ON DUPLICATE KEY UPDATE price = VALUES(price), allow_offers = VALUES(allow_offers), status = 'for_sale', updated_at = NOW()`
+	query := `INSERT INTO listings (seller_id, book_id, price, allow_offers, seller_note, phone_number,
+                  condition_grade, condition_defects, edition, format, min_offer_price, auto_accept_price, created_at, updated_at) 
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW()) 
+                  ON DUPLICATE KEY UPDATE price = VALUES(price), allow_offers = VALUES(allow_offers),
+                  condition_grade = VALUES(condition_grade), condition_defects = VALUES(condition_defects),
+                  edition = VALUES(edition), format = VALUES(format),
+                  min_offer_price = VALUES(min_offer_price), auto_accept_price = VALUES(auto_accept_price),
+                  status = 'for_sale', updated_at = NOW(), id = LAST_INSERT_ID(id)`
 
-	result, err := ur.db.ExecContext(ctx, query, userID, bookID, price, allowOffer, sellerNote, phone_number)
+	args := append([]interface{}{userID, bookID, price, allowOffer, sellerNote, phone_number}, conditionArgs(condition)...)
+	args = append(args, thresholds.MinOfferPrice, thresholds.AutoAcceptPrice)
+	result, err := ur.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return false, fmt.Errorf("failed to insert into listings: %v", err)
+		return 0, fmt.Errorf("failed to insert into listings: %v", err)
 	}
 	listingID, err := result.LastInsertId()
 	if err != nil {
-		return false, fmt.Errorf("failed to get listing ID: %v", err)
+		return 0, fmt.Errorf("failed to get listing ID: %v", err)
+	}
+
+	// Start the price history with the listing's initial price
+	if _, err := ur.db.ExecContext(ctx, insertPriceHistoryQuery, listingID, nil, price, userID); err != nil {
+		return 0, fmt.Errorf("failed to record listing price: %v", err)
 	}
 
 	// Add images to listing_images
@@ -360,12 +510,12 @@ func (ur *UserRepository) AddBookToListing(ctx context.Context, userID int, book
 			"INSERT INTO listing_images (listing_id, image_url, created_at) VALUES (?, ?, NOW())",
 			listingID, url)
 		if err != nil {
-			return false, fmt.Errorf("failed to add image: %v", err)
+			return 0, fmt.Errorf("failed to add image: %v", err)
 		}
 	}
 	log.Println("✅ Listing added/updated for user:", userID, "BookID:", bookID)
 
-	return false, nil
+	return int(listingID), nil
 }
 
 func (ur *UserRepository) FindByID(ctx context.Context, userID int) (*models.GetMe, error) {
@@ -373,7 +523,7 @@ func (ur *UserRepository) FindByID(ctx context.Context, userID int) (*models.Get
 
 	query := `
 	SELECT id, email, first_name, last_name, picture_profile, picture_background, 
-	phone_number, quote, bio, role, gender, address
+	phone_number, quote, bio, role, gender, address, province
 	FROM users 
 	WHERE id = ?
 	`
@@ -391,6 +541,7 @@ func (ur *UserRepository) FindByID(ctx context.Context, userID int) (*models.Get
 		&getMe.Role,
 		&getMe.Gender,
 		&getMe.Address,
+		&getMe.Province,
 	)
 	if err != nil {
 		return nil, err
@@ -403,14 +554,19 @@ func (ur *UserRepository) FindByID(ctx context.Context, userID int) (*models.Get
 		return nil, err
 	}
 
-	var bankID int
-	err = ur.db.QueryRowContext(ctx, "SELECT id FROM bank_accounts WHERE user_id = ? LIMIT 1", userID).Scan(&bankID)
+	// Report the user's best payout account, verified ones first
+	var payoutStatus string
+	err = ur.db.QueryRowContext(ctx, `
+		SELECT verification_status FROM bank_accounts WHERE user_id = ?
+		ORDER BY FIELD(verification_status, 'verified', 'pending', 'rejected', 'unregistered'), id DESC
+		LIMIT 1`, userID).Scan(&payoutStatus)
 	if err == sql.ErrNoRows {
 		getMe.HasBankAccount = false
 	} else if err != nil {
 		return nil, err
 	} else {
 		getMe.HasBankAccount = true
+		getMe.PayoutAccountStatus = payoutStatus
 	}
 	
 	return &getMe, nil
@@ -632,20 +788,23 @@ func (ur *UserRepository) EditName(ctx context.Context, userID int, firstName st
 	return nil
 }
 
-func (ur *UserRepository) EditProfile(ctx context.Context, userID int, first_name string, last_name string, address string, quote string, bio string, phone_number string) error {
+// EditProfile updates a user's profile. An empty province keeps the current
+// one, so clients that don't send it yet don't clear it.
+func (ur *UserRepository) EditProfile(ctx context.Context, userID int, first_name string, last_name string, address string, province string, quote string, bio string, phone_number string) error {
 	query := `
 		UPDATE users
 		SET
 		first_name = COALESCE(?, first_name),
 		last_name = COALESCE(?, last_name),
 		address = COALESCE(?, address),
+		province = COALESCE(NULLIF(?, ''), province),
 		quote = COALESCE(?, quote), 
 		bio = COALESCE(?, bio),
 		phone_number = COALESCE(?, phone_number),
 		updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 		`
-	_, err := ur.db.ExecContext(ctx, query, first_name, last_name, address, quote, bio, phone_number, userID)
+	_, err := ur.db.ExecContext(ctx, query, first_name, last_name, address, province, quote, bio, phone_number, userID)
 	if err != nil {
 		return err
 	}
@@ -700,27 +859,196 @@ func (ur *UserRepository) GetUserLibrary(ctx context.Context, userID int) ([]mod
 	return libraries, nil
 }
 
-func (ur *UserRepository) GetAllListings(ctx context.Context) ([]models.UserListing, error) {
-	query := `SELECT id, seller_id, book_id, price, status, allow_offers, created_at, updated_at 
-	          FROM listings 
-	          WHERE status = 'for_sale'`
+// GetAllListings returns one page of listings that are for sale
+func (ur *UserRepository) GetAllListings(ctx context.Context, page models.PageRequest) ([]models.UserListing, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, listingSortKeys, "created_at", "l.id")
+	if err != nil {
+		return nil, nil, err
+	}
 
-	rows, err := ur.db.QueryContext(ctx, query)
+	query := `SELECT l.id, l.seller_id, l.book_id, l.price, l.status, l.allow_offers, ` + kp.SortValue + `
+	          FROM listings l
+	          WHERE l.status = 'for_sale'` + kp.Where + `
+	          ORDER BY ` + kp.OrderBy + `
+	          LIMIT ?`
+	args := append(kp.Args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var listings []models.UserListing
+	listings := []models.UserListing{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var listing models.UserListing
-		if err := rows.Scan(&listing.ID, &listing.SellerID, &listing.BookID, &listing.Price, &listing.Status, &listing.AllowOffer); err != nil {
-			return nil, err
+		var sortValue string
+		if err := rows.Scan(&listing.ID, &listing.SellerID, &listing.BookID, &listing.Price, &listing.Status, &listing.AllowOffer, &sortValue); err != nil {
+			return nil, nil, err
 		}
 		listings = append(listings, listing)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, listing.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
 
-	return listings, nil
+	listings, info := trimPage(kp, listings, sortValues, ids)
+	return listings, info, nil
+}
+
+// SearchListings finds listings across all sellers, combining book filters
+// (title, author, genre) with listing filters, one keyset page at a time.
+func (ur *UserRepository) SearchListings(ctx context.Context, params models.ListingSearchParams, page models.PageRequest) ([]models.ListingSearchItem, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, listingSortKeys, "created_at", "l.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conditions, args := listingSearchConditions(params)
+
+	query := `
+		SELECT l.id, l.seller_id, l.book_id, l.price, l.status, l.allow_offers,
+			   ` + listingConditionColumns + `, l.created_at,
+			   b.title, b.cover_image_url,
+			   COALESCE((SELECT li.image_url
+				FROM listing_images li
+				WHERE li.listing_id = l.id
+				ORDER BY li.id ASC
+				LIMIT 1), ''),
+			   u.first_name, u.last_name, u.province,
+			   ` + kp.SortValue + `
+		FROM listings l
+		JOIN books b ON l.book_id = b.id
+		JOIN users u ON l.seller_id = u.id
+		WHERE ` + strings.Join(conditions, " AND ") + kp.Where + `
+		ORDER BY ` + kp.OrderBy + `
+		LIMIT ?
+	`
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching listings: %w", err)
+	}
+	defer rows.Close()
+
+	listings := []models.ListingSearchItem{}
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var item models.ListingSearchItem
+		var condition conditionScan
+		var sortValue string
+		err := rows.Scan(
+			&item.ListingID, &item.SellerID, &item.BookID, &item.Price, &item.Status, &item.AllowOffers,
+			&condition.Grade, &condition.Defects, &condition.Edition, &condition.Format, &item.CreatedAt,
+			&item.Title, &item.CoverImageURL,
+			&item.ImageURL,
+			&item.SellerFirstName, &item.SellerLastName, &item.SellerProvince,
+			&sortValue,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning listing: %w", err)
+		}
+		item.Condition = condition.toModel()
+		listings = append(listings, item)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, item.ListingID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating listings: %w", err)
+	}
+
+	listings, info := trimPage(kp, listings, sortValues, ids)
+
+	bookIDs := make([]int, len(listings))
+	for i := range listings {
+		bookIDs[i] = listings[i].BookID
+	}
+	authors, err := authorsByBookIDs(ctx, ur.db, bookIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range listings {
+		listings[i].Author = authors[listings[i].BookID]
+	}
+
+	return listings, info, nil
+}
+
+// listingSearchConditions turns search filters into WHERE conditions on
+// listings l joined with their book b and seller u
+func listingSearchConditions(params models.ListingSearchParams) ([]string, []interface{}) {
+	conditions := []string{"l.status = ?"}
+	args := []interface{}{params.Status}
+
+	if params.Title != "" {
+		conditions = append(conditions, "b.title LIKE ?")
+		args = append(args, "%"+params.Title+"%")
+	}
+	if params.Language != "" {
+		conditions = append(conditions, "b.language = ?")
+		args = append(args, params.Language)
+	}
+	if params.Author != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id AND a.name LIKE ?)`)
+		args = append(args, "%"+params.Author+"%")
+	}
+	if len(params.Genres) > 0 {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM book_genres bg
+			JOIN genres g ON g.id = bg.genre_id
+			WHERE bg.book_id = b.id AND g.name IN (`+placeholders(len(params.Genres))+`))`)
+		for _, genre := range params.Genres {
+			args = append(args, genre)
+		}
+	}
+	if params.MinPrice != nil {
+		conditions = append(conditions, "l.price >= ?")
+		args = append(args, *params.MinPrice)
+	}
+	if params.MaxPrice != nil {
+		conditions = append(conditions, "l.price <= ?")
+		args = append(args, *params.MaxPrice)
+	}
+	if params.AllowOffers != nil {
+		conditions = append(conditions, "l.allow_offers = ?")
+		args = append(args, *params.AllowOffers)
+	}
+	if params.SellerID != nil {
+		conditions = append(conditions, "l.seller_id = ?")
+		args = append(args, *params.SellerID)
+	}
+	if len(params.ConditionGrades) > 0 {
+		conditions = append(conditions, "l.condition_grade IN ("+placeholders(len(params.ConditionGrades))+")")
+		for _, grade := range params.ConditionGrades {
+			args = append(args, grade)
+		}
+	}
+	if len(params.Formats) > 0 {
+		conditions = append(conditions, "l.format IN ("+placeholders(len(params.Formats))+")")
+		for _, format := range params.Formats {
+			args = append(args, format)
+		}
+	}
+	for _, defect := range params.WithoutDefects {
+		conditions = append(conditions, "FIND_IN_SET(?, l.condition_defects) = 0")
+		args = append(args, defect)
+	}
+	if params.Location != "" {
+		// Only the seller's province is public; their address never is
+		conditions = append(conditions, "u.province = ?")
+		args = append(args, params.Location)
+	}
+	return conditions, args
 }
 
 func (ur *UserRepository) GetAllListingsByBookID(ctx context.Context, userID int, bookID int) ([]models.UserListing, error) {
@@ -825,12 +1153,17 @@ func (ur *UserRepository) GetPurchasedListingsByUserID(ctx context.Context, user
 			u.first_name,
 			u.last_name,
 			u.picture_profile,
-			t.created_at AS transaction_time
+			t.created_at AS transaction_time,
+			COALESCE(o.id, 0),
+			COALESCE(o.status, ''),
+			COALESCE(o.carrier, ''),
+			COALESCE(o.tracking_number, '')
 		FROM transactions t
 		JOIN listings l ON t.listing_id = l.id
 		JOIN users u ON l.seller_id = u.id
 		JOIN books b ON l.book_id = b.id
-		WHERE t.buyer_id = ? AND t.payment_status = 'completed'
+		LEFT JOIN orders o ON o.transaction_id = t.id
+		WHERE t.buyer_id = ? AND t.payment_status IN ('completed', 'partially_refunded')
 	`
 
 	rows, err := ur.db.QueryContext(ctx, query, userID)
@@ -854,6 +1187,10 @@ func (ur *UserRepository) GetPurchasedListingsByUserID(ctx context.Context, user
 			&p.SellerLastName,
 			&p.SellerProfileImg,
 			&p.TransactionTime,
+			&p.OrderID,
+			&p.OrderStatus,
+			&p.Carrier,
+			&p.TrackingNumber,
 		)
 		if err != nil {
 			return nil, err
@@ -892,12 +1229,17 @@ func (ur *UserRepository) GetMyOrders(ctx context.Context, sellerID int) ([]mode
 			u.phone_number AS buyer_phone,
 			u.address AS buyer_address,
 			u.picture_profile AS buyer_profile_image,
-			b.id AS book_id
+			b.id AS book_id,
+			COALESCE(o.id, 0),
+			COALESCE(o.status, ''),
+			COALESCE(o.carrier, ''),
+			COALESCE(o.tracking_number, '')
 		FROM transactions t
 		JOIN listings l ON t.listing_id = l.id
 		JOIN books b ON l.book_id = b.id
 		JOIN users u ON t.buyer_id = u.id
-		WHERE l.seller_id = ? AND t.payment_status = 'completed'
+		LEFT JOIN orders o ON o.transaction_id = t.id
+		WHERE l.seller_id = ? AND t.payment_status IN ('completed', 'partially_refunded')
 		ORDER BY t.created_at DESC;
 	`
 
@@ -923,6 +1265,10 @@ func (ur *UserRepository) GetMyOrders(ctx context.Context, sellerID int) ([]mode
 			&o.BuyerAddress,
 			&o.BuyerProfileImage,
 			&o.BookID,
+			&o.OrderID,
+			&o.OrderStatus,
+			&o.Carrier,
+			&o.TrackingNumber,
 		)
 		if err != nil {
 			return nil, err
@@ -960,28 +1306,161 @@ func (ur *UserRepository) GetUsersByBookInWishlist(ctx context.Context, bookID i
 }
 
 
-func (ur *UserRepository) RemoveListing(ctx context.Context, userID int, listingID int) error {
-	// Verify the user owns the listing and it's not already sold or removed
-	query := `
+// RemoveListing takes a seller's listing off the market and rejects the offers
+// still open on it, which are returned
+func (ur *UserRepository) RemoveListing(ctx context.Context, userID int, listingID int) ([]models.OfferUpdate, error) {
+	var rejected []models.OfferUpdate
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+
+		// Verify the user owns the listing and it's not already sold or removed
+		query := `
         UPDATE listings 
         SET status = 'removed', updated_at = NOW()
         WHERE id = ? AND seller_id = ? AND status NOT IN ('sold', 'removed')
     `
-	result, err := ur.db.ExecContext(ctx, query, listingID, userID)
+		result, err := tx.ExecContext(ctx, query, listingID, userID)
+		if err != nil {
+			return fmt.Errorf("error removing listing: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error checking rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("listing not found, already sold/removed, or not owned by user")
+		}
+
+		rejected, err = rejectCompetingOffers(ctx, tx, listingID, 0)
+		if err != nil {
+			return err
+		}
+		if err := resolveHolds(ctx, tx, listingID, 0, models.HoldReleased); err != nil {
+			return err
+		}
+		return closeWaitlist(ctx, tx, listingID)
+	})
 	if err != nil {
-		return fmt.Errorf("error removing listing: %w", err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
+	log.Printf("Listing %d marked as removed for user %d (%d offers rejected)", listingID, userID, len(rejected))
+	return rejected, nil
+}
+
+// SetWishlistMaxPrice sets the most a user will pay for a book on their
+// wishlist, adding the book when it isn't there yet. A nil maxPrice alerts the
+// user about every listing of the book.
+func (ur *UserRepository) SetWishlistMaxPrice(ctx context.Context, userID int, bookID int, maxPrice *float64) error {
+	return runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+
+		var count int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM user_wishlist WHERE user_id = ? AND book_id = ? FOR UPDATE`, userID, bookID).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("error checking wishlist: %w", err)
+		}
+		if count == 0 {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO user_wishlist (user_id, book_id, max_price, created_at, updated_at)
+				VALUES (?, ?, ?, NOW(), NOW())`, userID, bookID, maxPrice)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE user_wishlist SET max_price = ?, updated_at = NOW()
+				WHERE user_id = ? AND book_id = ?`, maxPrice, userID, bookID)
+		}
+		if err != nil {
+			return fmt.Errorf("error saving wishlist max price: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetWishlistMaxPrice returns the max price a user set for a wishlisted book,
+// or nil when there is none
+func (ur *UserRepository) GetWishlistMaxPrice(ctx context.Context, userID int, bookID int) (*float64, error) {
+	var maxPrice sql.NullFloat64
+	err := ur.db.QueryRowContext(ctx, `
+		SELECT max_price FROM user_wishlist WHERE user_id = ? AND book_id = ? LIMIT 1`, userID, bookID).Scan(&maxPrice)
+	if err == sql.ErrNoRows || (err == nil && !maxPrice.Valid) {
+		return nil, nil
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("listing not found, already sold/removed, or not owned by user")
+	if err != nil {
+		return nil, err
 	}
+	return &maxPrice.Float64, nil
+}
+
+// ClaimWishlistAlerts finds the users whose wishlist a for-sale listing
+// matches and records an alert of alertType for each, so the caller can
+// notify them. A listing matches when it is at or below the user's max price.
+// Within cooldown of an alert about the same book a user is only alerted
+// again for a cheaper copy, and never more than dailyLimit times a day.
+func (ur *UserRepository) ClaimWishlistAlerts(ctx context.Context, listingID int, alertType string, cooldown time.Duration, dailyLimit int) ([]models.WishlistAlert, error) {
+	var alerts []models.WishlistAlert
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+
+		// Locking the wishlist entries keeps concurrent listings of the same
+		// book from both alerting a user
+		rows, err := tx.QueryContext(ctx, `
+			SELECT uw.user_id, l.book_id, b.title, ROUND(l.price, 2)
+			FROM listings l
+			JOIN books b ON b.id = l.book_id
+			JOIN user_wishlist uw ON uw.book_id = l.book_id
+			WHERE l.id = ? AND l.status = 'for_sale' AND uw.user_id <> l.seller_id
+			  AND (uw.max_price IS NULL OR ROUND(l.price, 2) <= uw.max_price)
+			  AND NOT EXISTS (
+			      SELECT 1 FROM wishlist_alerts wa
+			      WHERE wa.user_id = uw.user_id AND wa.book_id = l.book_id
+			        AND wa.created_at > NOW() - INTERVAL ? SECOND AND wa.price <= ROUND(l.price, 2))
+			  AND (
+			      SELECT COUNT(*) FROM wishlist_alerts wa
+			      WHERE wa.user_id = uw.user_id AND wa.created_at > NOW() - INTERVAL 1 DAY) < ?
+			FOR UPDATE OF uw`, listingID, int(cooldown.Seconds()), dailyLimit)
+		if err != nil {
+			return fmt.Errorf("error matching wishlists: %w", err)
+		}
+		defer rows.Close()
 
-	log.Printf("Listing %d marked as removed for user %d", listingID, userID)
-	return nil
+		for rows.Next() {
+			alert := models.WishlistAlert{ListingID: listingID}
+			if err := rows.Scan(&alert.UserID, &alert.BookID, &alert.Title, &alert.Price); err != nil {
+				return fmt.Errorf("error scanning wishlist match: %w", err)
+			}
+			alerts = append(alerts, alert)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating wishlist matches: %w", err)
+		}
+		rows.Close()
+
+		// A user with the book on their wishlist twice is alerted once
+		seen := map[int]bool{}
+		unique := alerts[:0]
+		for _, alert := range alerts {
+			if seen[alert.UserID] {
+				continue
+			}
+			seen[alert.UserID] = true
+			unique = append(unique, alert)
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO wishlist_alerts (user_id, book_id, listing_id, type, price)
+				VALUES (?, ?, ?, ?, ?)`, alert.UserID, alert.BookID, listingID, alertType, alert.Price)
+			if err != nil {
+				return fmt.Errorf("error recording wishlist alert: %w", err)
+			}
+		}
+		alerts = unique
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
 }
 
 func (ur *UserRepository) IsBookInWishlist(ctx context.Context, userID int, bookID int) (bool, error) {
@@ -1044,6 +1523,8 @@ func (ur *UserRepository) GetListingByID(ctx context.Context, listingID int) (*m
 	query := `
         SELECT 
             l.id AS listing_id, l.seller_id, l.book_id, l.price, l.status, l.allow_offers, l.seller_note, l.phone_number,
+            ` + listingConditionColumns + `,
+            l.min_offer_price, l.auto_accept_price,
             b.title, b.description, b.language, b.isbn, b.publisher, 
             b.publish_date, b.cover_image_url, 
             COALESCE(br.average_rating, 0) AS average_rating, 
@@ -1057,9 +1538,12 @@ func (ur *UserRepository) GetListingByID(ctx context.Context, listingID int) (*m
     `
 
 	var listing models.ListingDetails
+	var condition conditionScan
 	err := ur.db.QueryRowContext(ctx, query, listingID).Scan(
 		&listing.ListingID, &listing.SellerID, &listing.BookID,
 		&listing.Price, &listing.Status, &listing.AllowOffers, &listing.SellerNote, &listing.PhoneNumber,
+		&condition.Grade, &condition.Defects, &condition.Edition, &condition.Format,
+		&listing.MinOfferPrice, &listing.AutoAcceptPrice,
 		&listing.Title, &listing.Description,
 		&listing.Language, &listing.ISBN, &listing.Publisher,
 		&listing.PublishDate, &listing.CoverImageURL,
@@ -1069,6 +1553,7 @@ func (ur *UserRepository) GetListingByID(ctx context.Context, listingID int) (*m
 	if err != nil {
 		return nil, err
 	}
+	listing.Condition = condition.toModel()
 
 	// Get listing image URLs
 	imageQuery := `SELECT image_url FROM listing_images WHERE listing_id = ?`
@@ -1095,95 +1580,421 @@ func (ur *UserRepository) GetListingByID(ctx context.Context, listingID int) (*m
 	}
 	listing.Author = authors
 
+	priceHistory, err := ur.GetListingPriceHistory(ctx, listingID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching price history: %w", err)
+	}
+	listing.PriceHistory = priceHistory
+
 	return &listing, nil
 }
 
-// AddToCart adds a listing to a user's cart
-func (ur *UserRepository) AddToCart(ctx context.Context, userID int, listingID int) (int, error) {
-	// First, verify that the listing exists and is available
-	var status string
-	checkQuery := `
-        SELECT status 
-        FROM listings 
-        WHERE id = ? AND status = 'for_sale'
-    `
-	err := ur.db.QueryRowContext(ctx, checkQuery, listingID).Scan(&status)
-	if err == sql.ErrNoRows {
-		return 0, fmt.Errorf("listing %d is not available or does not exist", listingID)
-	}
-	if err != nil {
-		return 0, fmt.Errorf("error checking listing availability: %w", err)
-	}
+const insertPriceHistoryQuery = `
+	INSERT INTO listing_price_history (listing_id, old_price, new_price, changed_by)
+	VALUES (?, ?, ?, ?)
+`
 
-	// Check if the listing is already in the user's cart
-	var existingCount int
-	countQuery := `
-        SELECT COUNT(*) 
-        FROM cart 
-        WHERE user_id = ? AND listing_id = ?
+// GetListingPriceHistory returns every price a listing has had, oldest first
+func (ur *UserRepository) GetListingPriceHistory(ctx context.Context, listingID int) ([]models.ListingPriceChange, error) {
+	query := `
+        SELECT old_price, new_price, created_at
+        FROM listing_price_history
+        WHERE listing_id = ?
+        ORDER BY created_at ASC, id ASC
     `
-	err = ur.db.QueryRowContext(ctx, countQuery, userID, listingID).Scan(&existingCount)
+	rows, err := ur.db.QueryContext(ctx, query, listingID)
 	if err != nil {
-		return 0, fmt.Errorf("error checking existing cart entry: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	if existingCount > 0 {
-		return 0, fmt.Errorf("listing %d is already in user %d's cart", listingID, userID)
+	history := []models.ListingPriceChange{}
+	for rows.Next() {
+		var change models.ListingPriceChange
+		var oldPrice sql.NullFloat64
+		if err := rows.Scan(&oldPrice, &change.NewPrice, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		if oldPrice.Valid {
+			price := float32(oldPrice.Float64)
+			change.OldPrice = &price
+		}
+		history = append(history, change)
 	}
+	return history, rows.Err()
+}
 
-	// Insert the listing into the cart
-	insertQuery := `
-        INSERT INTO cart (user_id, listing_id, created_at)
-        VALUES (?, ?, NOW())
-    `
-	result, err := ur.db.ExecContext(ctx, insertQuery, userID, listingID)
+// GetListingOfferThresholds returns a listing's seller and the thresholds for
+// answering its offers automatically
+func (ur *UserRepository) GetListingOfferThresholds(ctx context.Context, listingID int) (int, models.OfferThresholds, error) {
+	var sellerID int
+	var t models.OfferThresholds
+	err := conn(ctx, ur.db).QueryRowContext(ctx, `
+        SELECT seller_id, min_offer_price, auto_accept_price FROM listings WHERE id = ?`, listingID).Scan(&sellerID, &t.MinOfferPrice, &t.AutoAcceptPrice)
 	if err != nil {
-		return 0, fmt.Errorf("failed to add listing to cart: %w", err)
+		return 0, t, fmt.Errorf("error loading offer thresholds: %w", err)
 	}
+	return sellerID, t, nil
+}
 
-	id, err := result.LastInsertId()
+// UpdateListing applies a seller's edit to their own for-sale listing. When the
+// price changes it is recorded in the price history, and pending offers above
+// the new price are rejected since the buyer can now simply buy outright.
+// Raising the minimum offer price likewise rejects pending offers below it.
+func (ur *UserRepository) UpdateListing(ctx context.Context, sellerID int, listingID int, form models.ListingUpdateForm, newImageURLs []string) (*models.ListingUpdateResult, error) {
+	var result *models.ListingUpdateResult
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		var err error
+		result, err = ur.updateListing(ctx, sellerID, listingID, form, newImageURLs)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get cart entry ID: %w", err)
+		return nil, err
 	}
 
-	log.Printf("Successfully added listing %d to user %d's cart with cart ID %d", listingID, userID, id)
-	return int(id), nil
+	log.Printf("Listing %d updated by seller %d (%d offers auto-rejected)", listingID, sellerID, len(result.RejectedOffers))
+	return result, nil
 }
 
-// GetCart retrieves all listings in a user's cart
-func (ur *UserRepository) GetCart(ctx context.Context, userID int) ([]models.CartItem, error) {
-	query := `
-        SELECT 
-            c.id,
-            c.user_id,
-            c.listing_id,
-            l.book_id,
-            l.price,
-            l.allow_offers,
-            l.seller_id,
-            b.title,
-            b.cover_image_url,
-            (SELECT image_url 
-             FROM listing_images li 
-             WHERE li.listing_id = l.id 
-             ORDER BY li.id ASC 
-             LIMIT 1) AS image_url,
-            l.status
-        FROM cart c
-        JOIN listings l ON c.listing_id = l.id
-        JOIN books b ON l.book_id = b.id
-        WHERE c.user_id = ? AND l.status IN ('for_sale', 'sold', 'reserved')
-    `
+func (ur *UserRepository) updateListing(ctx context.Context, sellerID int, listingID int, form models.ListingUpdateForm, newImageURLs []string) (*models.ListingUpdateResult, error) {
+	tx := conn(ctx, ur.db)
 
-	rows, err := ur.db.QueryContext(ctx, query, userID)
+	var currentPrice float32
+	var status string
+	var thresholds models.OfferThresholds
+	err := tx.QueryRowContext(ctx, `
+		SELECT price, status, min_offer_price, auto_accept_price
+		FROM listings WHERE id = ? AND seller_id = ? FOR UPDATE`, listingID, sellerID).Scan(&currentPrice, &status, &thresholds.MinOfferPrice, &thresholds.AutoAcceptPrice)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("listing not found or not owned by user")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error querying cart: %w", err)
+		return nil, fmt.Errorf("error loading listing: %w", err)
+	}
+	if status != "for_sale" {
+		return nil, fmt.Errorf("only listings that are for sale can be edited (listing is %s)", status)
+	}
+
+	// A threshold of 0 removes it
+	if form.MinOfferPrice != nil {
+		thresholds.MinOfferPrice = form.MinOfferPrice
+		if *form.MinOfferPrice == 0 {
+			thresholds.MinOfferPrice = nil
+		}
+	}
+	if form.AutoAcceptPrice != nil {
+		thresholds.AutoAcceptPrice = form.AutoAcceptPrice
+		if *form.AutoAcceptPrice == 0 {
+			thresholds.AutoAcceptPrice = nil
+		}
+	}
+	price := currentPrice
+	if form.Price != nil {
+		price = *form.Price
+	}
+	if err := thresholds.Validate(float64(price)); err != nil {
+		return nil, err
+	}
+
+	sets := []string{"updated_at = NOW()"}
+	var args []interface{}
+	if form.Price != nil {
+		sets = append(sets, "price = ?")
+		args = append(args, *form.Price)
+	}
+	if form.SellerNote != nil {
+		sets = append(sets, "seller_note = ?")
+		args = append(args, *form.SellerNote)
+	}
+	if form.AllowOffers != nil {
+		sets = append(sets, "allow_offers = ?")
+		args = append(args, *form.AllowOffers)
+	}
+	if form.PhoneNumber != nil {
+		sets = append(sets, "phone_number = ?")
+		args = append(args, *form.PhoneNumber)
+	}
+	if form.Condition != nil {
+		sets = append(sets, "condition_grade = ?", "condition_defects = ?", "edition = ?", "format = ?")
+		args = append(args, conditionArgs(*form.Condition)...)
+	}
+	if form.MinOfferPrice != nil {
+		sets = append(sets, "min_offer_price = ?")
+		args = append(args, thresholds.MinOfferPrice)
+	}
+	if form.AutoAcceptPrice != nil {
+		sets = append(sets, "auto_accept_price = ?")
+		args = append(args, thresholds.AutoAcceptPrice)
+	}
+
+	query := `UPDATE listings SET ` + strings.Join(sets, ", ") + ` WHERE id = ?`
+	args = append(args, listingID)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("error updating listing: %w", err)
+	}
+
+	result := &models.ListingUpdateResult{OldPrice: currentPrice, RejectedOffers: []models.RejectedOffer{}}
+	if form.Price != nil && *form.Price != currentPrice {
+		result.PriceChanged = true
+
+		if _, err := tx.ExecContext(ctx, insertPriceHistoryQuery, listingID, currentPrice, *form.Price, sellerID); err != nil {
+			return nil, fmt.Errorf("error recording price change: %w", err)
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, buyer_id FROM offers
+			WHERE listing_id = ? AND status IN ('pending', 'countered', 'suspended') AND offered_price > ?
+			FOR UPDATE`, listingID, *form.Price)
+		if err != nil {
+			return nil, fmt.Errorf("error loading pending offers: %w", err)
+		}
+		for rows.Next() {
+			offer := models.RejectedOffer{Reason: "price_changed"}
+			if err := rows.Scan(&offer.OfferID, &offer.BuyerID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning pending offer: %w", err)
+			}
+			result.RejectedOffers = append(result.RejectedOffers, offer)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error iterating pending offers: %w", err)
+		}
+		rows.Close()
+
+		if len(result.RejectedOffers) > 0 {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO offer_history (offer_id, actor_id, actor_role, action, price)
+				SELECT id, ?, 'seller', 'rejected', offered_price
+				FROM offers
+				WHERE listing_id = ? AND status IN ('pending', 'countered', 'suspended') AND offered_price > ?`, sellerID, listingID, *form.Price)
+			if err != nil {
+				return nil, fmt.Errorf("error recording rejected offers: %w", err)
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE offers SET status = 'rejected', updated_at = NOW()
+				WHERE listing_id = ? AND status IN ('pending', 'countered', 'suspended') AND offered_price > ?`, listingID, *form.Price)
+			if err != nil {
+				return nil, fmt.Errorf("error rejecting offers above new price: %w", err)
+			}
+		}
+	}
+
+	if form.MinOfferPrice != nil && thresholds.MinOfferPrice != nil {
+		rejected, err := rejectOffersBelowMinimum(ctx, tx, sellerID, listingID, *thresholds.MinOfferPrice)
+		if err != nil {
+			return nil, err
+		}
+		result.RejectedOffers = append(result.RejectedOffers, rejected...)
+	}
+
+	if len(form.RemoveImageURLs) > 0 {
+		deleteArgs := []interface{}{listingID}
+		for _, url := range form.RemoveImageURLs {
+			deleteArgs = append(deleteArgs, url)
+		}
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM listing_images WHERE listing_id = ? AND image_url IN (`+placeholders(len(form.RemoveImageURLs))+`)`,
+			deleteArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("error removing listing images: %w", err)
+		}
+	}
+	for _, url := range newImageURLs {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO listing_images (listing_id, image_url, created_at) VALUES (?, ?, NOW())",
+			listingID, url)
+		if err != nil {
+			return nil, fmt.Errorf("error adding listing image: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// rejectOffersBelowMinimum rejects the pending offers on a listing that are
+// below its new minimum offer price
+func rejectOffersBelowMinimum(ctx context.Context, tx dbtx, sellerID int, listingID int, minPrice float64) ([]models.RejectedOffer, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, buyer_id, offered_price FROM offers
+		WHERE listing_id = ? AND status = 'pending' AND offered_price < ?
+		FOR UPDATE`, listingID, minPrice)
+	if err != nil {
+		return nil, fmt.Errorf("error loading pending offers: %w", err)
+	}
+	var rejected []models.RejectedOffer
+	var prices []float64
+	for rows.Next() {
+		offer := models.RejectedOffer{Reason: "below_minimum"}
+		var price float64
+		if err := rows.Scan(&offer.OfferID, &offer.BuyerID, &price); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning pending offer: %w", err)
+		}
+		rejected = append(rejected, offer)
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("error iterating pending offers: %w", err)
+	}
+	rows.Close()
+
+	for i, offer := range rejected {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE offers SET status = 'rejected', expires_at = NULL, updated_at = NOW() WHERE id = ?`, offer.OfferID)
+		if err != nil {
+			return nil, fmt.Errorf("error rejecting offer below minimum: %w", err)
+		}
+		if err := addOfferHistory(ctx, tx, offer.OfferID, &sellerID, models.OfferRoleSeller, models.OfferActionRejected, prices[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rejected, nil
+}
+
+// RelistListing puts a removed listing back up for sale, optionally at a new price
+func (ur *UserRepository) RelistListing(ctx context.Context, sellerID int, listingID int, price *float32) error {
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		return ur.relistListing(ctx, sellerID, listingID, price)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listing %d relisted by seller %d", listingID, sellerID)
+	return nil
+}
+
+func (ur *UserRepository) relistListing(ctx context.Context, sellerID int, listingID int, price *float32) error {
+	tx := conn(ctx, ur.db)
+
+	var currentPrice float32
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT price, status FROM listings WHERE id = ? AND seller_id = ? FOR UPDATE`, listingID, sellerID).Scan(&currentPrice, &status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("listing not found or not owned by user")
+	}
+	if err != nil {
+		return fmt.Errorf("error loading listing: %w", err)
+	}
+	if status != "removed" {
+		return fmt.Errorf("only removed listings can be relisted (listing is %s)", status)
+	}
+
+	newPrice := currentPrice
+	if price != nil {
+		newPrice = *price
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE listings
+		SET status = 'for_sale', price = ?, reserved_expires_at = NULL, reserved_by = NULL, updated_at = NOW()
+		WHERE id = ?`, newPrice, listingID)
+	if err != nil {
+		return fmt.Errorf("error relisting listing: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, forgetSavedSearchMatchesQuery, listingID); err != nil {
+		return fmt.Errorf("error resetting saved search matches: %w", err)
+	}
+
+	if newPrice != currentPrice {
+		if _, err := tx.ExecContext(ctx, insertPriceHistoryQuery, listingID, currentPrice, newPrice, sellerID); err != nil {
+			return fmt.Errorf("error recording price change: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddToCart adds a listing to a user's cart
+func (ur *UserRepository) AddToCart(ctx context.Context, userID int, listingID int) (int, error) {
+	// First, verify that the listing exists and is available
+	var status string
+	checkQuery := `
+        SELECT status 
+        FROM listings 
+        WHERE id = ? AND status = 'for_sale'
+    `
+	err := ur.db.QueryRowContext(ctx, checkQuery, listingID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("listing %d is not available or does not exist", listingID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error checking listing availability: %w", err)
+	}
+
+	// Check if the listing is already in the user's cart
+	var existingCount int
+	countQuery := `
+        SELECT COUNT(*) 
+        FROM cart 
+        WHERE user_id = ? AND listing_id = ?
+    `
+	err = ur.db.QueryRowContext(ctx, countQuery, userID, listingID).Scan(&existingCount)
+	if err != nil {
+		return 0, fmt.Errorf("error checking existing cart entry: %w", err)
+	}
+
+	if existingCount > 0 {
+		return 0, fmt.Errorf("listing %d is already in user %d's cart", listingID, userID)
+	}
+
+	// Insert the listing into the cart
+	insertQuery := `
+        INSERT INTO cart (user_id, listing_id, created_at)
+        VALUES (?, ?, NOW())
+    `
+	result, err := ur.db.ExecContext(ctx, insertQuery, userID, listingID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add listing to cart: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cart entry ID: %w", err)
+	}
+
+	log.Printf("Successfully added listing %d to user %d's cart with cart ID %d", listingID, userID, id)
+	return int(id), nil
+}
+
+// GetCart retrieves all listings in a user's cart
+func (ur *UserRepository) GetCart(ctx context.Context, userID int) ([]models.CartItem, error) {
+	query := `
+        SELECT 
+            c.id,
+            c.user_id,
+            c.listing_id,
+            l.book_id,
+            l.price,
+            l.allow_offers,
+            l.seller_id,
+            b.title,
+            b.cover_image_url,
+            (SELECT image_url 
+             FROM listing_images li 
+             WHERE li.listing_id = l.id 
+             ORDER BY li.id ASC 
+             LIMIT 1) AS image_url,
+            l.status,
+            ` + listingConditionColumns + `
+        FROM cart c
+        JOIN listings l ON c.listing_id = l.id
+        JOIN books b ON l.book_id = b.id
+        WHERE c.user_id = ? AND l.status IN ('for_sale', 'sold', 'reserved')
+    `
+
+	rows, err := ur.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cart: %w", err)
 	}
 	defer rows.Close()
 
 	var cartItems []models.CartItem
 	for rows.Next() {
 		var item models.CartItem
+		var condition conditionScan
 		err := rows.Scan(
 			&item.ID,
 			&item.UserID,
@@ -1196,10 +2007,12 @@ func (ur *UserRepository) GetCart(ctx context.Context, userID int) ([]models.Car
 			&item.CoverImageURL,
 			&item.ImageURL,
 			&item.Status,
+			&condition.Grade, &condition.Defects, &condition.Edition, &condition.Format,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning cart item: %w", err)
 		}
+		item.Condition = condition.toModel()
 
 		authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
 		if err != nil {
@@ -1222,7 +2035,7 @@ func (ur *UserRepository) RemoveFromCart(ctx context.Context, userID int, listin
         DELETE FROM cart 
         WHERE user_id = ? AND listing_id = ?
     `
-	result, err := ur.db.ExecContext(ctx, query, userID, listingID)
+	result, err := conn(ctx, ur.db).ExecContext(ctx, query, userID, listingID)
 	if err != nil {
 		return fmt.Errorf("failed to remove from cart: %w", err)
 	}
@@ -1239,8 +2052,9 @@ func (ur *UserRepository) RemoveFromCart(ctx context.Context, userID int, listin
 	return nil
 }
 
-// AddToOffers adds an offer for a listing by a buyer
-func (ur *UserRepository) AddToOffers(ctx context.Context, buyerID int, listingID int, offeredPrice float64) (int, error) {
+// AddToOffers adds an offer for a listing by a buyer. The seller has
+// expiryHours to answer it.
+func (ur *UserRepository) AddToOffers(ctx context.Context, buyerID int, listingID int, offeredPrice float64, expiryHours int) (int, error) {
 	// Verify that the listing exists and allows offers
 	var allowOffers bool
 	var status string
@@ -1265,7 +2079,7 @@ func (ur *UserRepository) AddToOffers(ctx context.Context, buyerID int, listingI
 	countQuery := `
         SELECT COUNT(*)
         FROM offers
-        WHERE buyer_id = ? AND listing_id = ? AND status IN ('pending', 'accepted')
+        WHERE buyer_id = ? AND listing_id = ? AND status IN ('pending', 'countered', 'accepted', 'suspended')
     `
 	err = ur.db.QueryRowContext(ctx, countQuery, buyerID, listingID).Scan(&existingCount)
 	if err != nil {
@@ -1277,25 +2091,52 @@ func (ur *UserRepository) AddToOffers(ctx context.Context, buyerID int, listingI
 
 	// Insert the offer
 	insertQuery := `
-        INSERT INTO offers (listing_id, buyer_id, offered_price, status, created_at)
-        VALUES (?, ?, ?, 'pending', NOW())
+        INSERT INTO offers (listing_id, buyer_id, offered_price, status, expires_at, created_at)
+        VALUES (?, ?, ?, 'pending', NOW() + INTERVAL ? HOUR, NOW())
     `
-	result, err := ur.db.ExecContext(ctx, insertQuery, listingID, buyerID, offeredPrice)
-	if err != nil {
-		return 0, fmt.Errorf("failed to add offer: %w", err)
-	}
-
-	id, err := result.LastInsertId()
+	var id int64
+	err = runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+		result, err := tx.ExecContext(ctx, insertQuery, listingID, buyerID, offeredPrice, expiryHours)
+		if err != nil {
+			return fmt.Errorf("failed to add offer: %w", err)
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get offer ID: %w", err)
+		}
+		return addOfferHistory(ctx, tx, int(id), &buyerID, models.OfferRoleBuyer, models.OfferActionOffered, offeredPrice)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get offer ID: %w", err)
+		return 0, err
 	}
 
 	log.Printf("Successfully added offer for listing %d by buyer %d with offer ID %d", listingID, buyerID, id)
 	return int(id), nil
 }
 
-// GetOffers retrieves all offers made by a buyer
-func (ur *UserRepository) GetBuyerOffers(ctx context.Context, buyerID int) ([]models.OfferItem, error) {
+// loadOfferAuthors fills in the book authors of a page of offers
+func (ur *UserRepository) loadOfferAuthors(ctx context.Context, offers []models.OfferItem) error {
+	bookIDs := make([]int, len(offers))
+	for i := range offers {
+		bookIDs[i] = offers[i].BookID
+	}
+	authors, err := authorsByBookIDs(ctx, ur.db, bookIDs)
+	if err != nil {
+		return err
+	}
+	for i := range offers {
+		offers[i].BookAuthor = authors[offers[i].BookID]
+	}
+	return nil
+}
+
+// GetBuyerOffers retrieves one page of offers made by a buyer
+func (ur *UserRepository) GetBuyerOffers(ctx context.Context, buyerID int, page models.PageRequest) ([]models.OfferItem, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, offerSortKeys, "created_at", "o.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
 	query := `
         SELECT 
             o.id,
@@ -1303,6 +2144,8 @@ func (ur *UserRepository) GetBuyerOffers(ctx context.Context, buyerID int) ([]mo
             o.buyer_id,
             o.offered_price,
             o.status,
+            o.expires_at,
+            o.payment_due_at,
             l.book_id,
             b.title,
             b.cover_image_url,
@@ -1313,27 +2156,40 @@ func (ur *UserRepository) GetBuyerOffers(ctx context.Context, buyerID int) ([]mo
              LIMIT 1) AS image_url,
             l.seller_id,
 			l.price AS initial_price,
-			l.status AS avaibility
+			l.status AS avaibility,
+			` + listingConditionColumns + `,
+			` + kp.SortValue + `
         FROM offers o
         JOIN listings l ON o.listing_id = l.id
         JOIN books b ON l.book_id = b.id
-        WHERE o.buyer_id = ?
+        WHERE o.buyer_id = ?` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + `
+        LIMIT ?
     `
-	rows, err := ur.db.QueryContext(ctx, query, buyerID)
+	args := append([]interface{}{buyerID}, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying offers: %w", err)
+		return nil, nil, fmt.Errorf("error querying offers: %w", err)
 	}
 	defer rows.Close()
 
-	var offers []models.OfferItem
+	offers := []models.OfferItem{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var item models.OfferItem
+		var condition conditionScan
+		var sortValue string
 		err := rows.Scan(
 			&item.ID,
 			&item.ListingID,
 			&item.BuyerID,
 			&item.OfferedPrice,
 			&item.Status,
+			&item.ExpiresAt,
+			&item.PaymentDueAt,
 			&item.BookID,
 			&item.BookTitle,
 			&item.CoverImageURL,
@@ -1341,30 +2197,37 @@ func (ur *UserRepository) GetBuyerOffers(ctx context.Context, buyerID int) ([]mo
 			&item.SellerID,
 			&item.InitialPrice,
 			&item.Avaibility,
-
+			&condition.Grade, &condition.Defects, &condition.Edition, &condition.Format,
+			&sortValue,
 		)
 
 		if err != nil {
-			return nil, fmt.Errorf("error scanning offer item: %w", err)
-		}
-
-		authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
-		if err != nil {
-			return nil, err
+			return nil, nil, fmt.Errorf("error scanning offer item: %w", err)
 		}
-		item.BookAuthor = authors
+		item.Condition = condition.toModel()
 		offers = append(offers, item)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, item.ID)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating offers: %w", err)
+		return nil, nil, fmt.Errorf("error iterating offers: %w", err)
 	}
 
-	return offers, nil
+	offers, info := trimPage(kp, offers, sortValues, ids)
+	if err := ur.loadOfferAuthors(ctx, offers); err != nil {
+		return nil, nil, err
+	}
+	return offers, info, nil
 }
 
 // repository/user_repository.go
-func (ur *UserRepository) GetSellerOffers(ctx context.Context, sellerID int) ([]models.OfferItem, error) {
+func (ur *UserRepository) GetSellerOffers(ctx context.Context, sellerID int, page models.PageRequest) ([]models.OfferItem, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, offerSortKeys, "created_at", "o.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
 	query := `
         SELECT 
             o.id,
@@ -1372,6 +2235,8 @@ func (ur *UserRepository) GetSellerOffers(ctx context.Context, sellerID int) ([]
             o.buyer_id,
             o.offered_price,
             o.status,
+            o.expires_at,
+            o.payment_due_at,
             l.book_id,
             b.title,
             b.cover_image_url,
@@ -1384,28 +2249,41 @@ func (ur *UserRepository) GetSellerOffers(ctx context.Context, sellerID int) ([]
             u.first_name AS buyer_first_name,
             u.last_name AS buyer_last_name,
             u.picture_profile AS buyer_picture_profile,
-			l.price AS initial_price
+			l.price AS initial_price,
+			` + listingConditionColumns + `,
+			` + kp.SortValue + `
         FROM offers o
         JOIN listings l ON o.listing_id = l.id
         JOIN books b ON l.book_id = b.id
         JOIN users u ON o.buyer_id = u.id
-        WHERE l.seller_id = ?
+        WHERE l.seller_id = ?` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + `
+        LIMIT ?
     `
-	rows, err := ur.db.QueryContext(ctx, query, sellerID)
+	args := append([]interface{}{sellerID}, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying seller offers: %w", err)
+		return nil, nil, fmt.Errorf("error querying seller offers: %w", err)
 	}
 	defer rows.Close()
 
-	var offers []models.OfferItem
+	offers := []models.OfferItem{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var item models.OfferItem
+		var condition conditionScan
+		var sortValue string
 		err := rows.Scan(
 			&item.ID,
 			&item.ListingID,
 			&item.BuyerID,
 			&item.OfferedPrice,
 			&item.Status,
+			&item.ExpiresAt,
+			&item.PaymentDueAt,
 			&item.BookID,
 			&item.BookTitle,
 			&item.CoverImageURL,
@@ -1415,32 +2293,34 @@ func (ur *UserRepository) GetSellerOffers(ctx context.Context, sellerID int) ([]
 			&item.BuyerLastName,
 			&item.BuyerPicture,
 			&item.InitialPrice,
+			&condition.Grade, &condition.Defects, &condition.Edition, &condition.Format,
+			&sortValue,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning seller offer item: %w", err)
+			return nil, nil, fmt.Errorf("error scanning seller offer item: %w", err)
 		}
-
-		authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
-		if err != nil {
-			return nil, err
-		}
-		item.BookAuthor = authors
-
+		item.Condition = condition.toModel()
 		offers = append(offers, item)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, item.ID)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating seller offers: %w", err)
+		return nil, nil, fmt.Errorf("error iterating seller offers: %w", err)
 	}
 
-	return offers, nil
+	offers, info := trimPage(kp, offers, sortValues, ids)
+	if err := ur.loadOfferAuthors(ctx, offers); err != nil {
+		return nil, nil, err
+	}
+	return offers, info, nil
 }
 
 // RemoveFromOffers removes an offer (e.g., buyer retracts it)
 func (ur *UserRepository) RemoveFromOffers(ctx context.Context, buyerID int, listingID int) error {
 	query := `
         DELETE FROM offers
-        WHERE buyer_id = ? AND listing_id = ? AND status = 'pending'
+        WHERE buyer_id = ? AND listing_id = ? AND status IN ('pending', 'countered', 'suspended')
     `
 	result, err := ur.db.ExecContext(ctx, query, buyerID, listingID)
 	if err != nil {
@@ -1454,47 +2334,322 @@ func (ur *UserRepository) RemoveFromOffers(ctx context.Context, buyerID int, lis
 	if rowsAffected == 0 {
 		return fmt.Errorf("no pending offer found for buyer %d and listing %d", buyerID, listingID)
 	}
-
-	log.Printf("Removed offer for listing %d by buyer %d", listingID, buyerID)
-	return nil
+
+	log.Printf("Removed offer for listing %d by buyer %d", listingID, buyerID)
+	return nil
+}
+
+// addOfferHistory records one negotiation step. actorID is nil for steps the
+// system takes.
+func addOfferHistory(ctx context.Context, q dbtx, offerID int, actorID *int, role string, action string, price float64) error {
+	_, err := q.ExecContext(ctx, `
+        INSERT INTO offer_history (offer_id, actor_id, actor_role, action, price)
+        VALUES (?, ?, ?, ?, ?)`, offerID, actorID, role, action, price)
+	if err != nil {
+		return fmt.Errorf("failed to record offer history: %w", err)
+	}
+	return nil
+}
+
+// respondToOffer applies the next negotiation step to an offer that is
+// waiting on userID: a 'pending' offer on the seller, a 'countered' one on the
+// buyer. action is OfferActionAccepted, OfferActionRejected or
+// OfferActionCountered; price and hours are the counter price and how long it
+// stays open, or for an acceptance how long the buyer has to pay.
+func (ur *UserRepository) respondToOffer(ctx context.Context, userID int, offerID int, action string, price float64, hours int) (*models.OfferUpdate, error) {
+	var update *models.OfferUpdate
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+
+		u := models.OfferUpdate{OfferID: offerID, Action: action, ActorID: userID}
+		var status, listingStatus string
+		var expired bool
+		err := tx.QueryRowContext(ctx, `
+            SELECT o.listing_id, o.buyer_id, l.seller_id, o.offered_price, o.status, l.status,
+                   o.expires_at IS NOT NULL AND o.expires_at <= NOW()
+            FROM offers o
+            JOIN listings l ON o.listing_id = l.id
+            WHERE o.id = ?
+            FOR UPDATE`, offerID).Scan(&u.ListingID, &u.BuyerID, &u.SellerID, &u.Price, &status, &listingStatus, &expired)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no offer found with ID %d", offerID)
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching offer: %w", err)
+		}
+
+		var role string
+		switch {
+		case userID == u.SellerID && status == models.OfferPending:
+			role = models.OfferRoleSeller
+		case userID == u.BuyerID && status == models.OfferCountered:
+			role = models.OfferRoleBuyer
+		default:
+			return fmt.Errorf("offer %d is not waiting on your response", offerID)
+		}
+		if expired {
+			return fmt.Errorf("offer %d has expired", offerID)
+		}
+		if action != models.OfferActionRejected && listingStatus != "for_sale" {
+			return fmt.Errorf("listing %d is no longer for sale", u.ListingID)
+		}
+		if action == models.OfferActionAccepted {
+			// Only one buyer at a time can be promised the listing
+			var promised bool
+			err := tx.QueryRowContext(ctx, `
+                SELECT EXISTS (
+                    SELECT 1 FROM offers
+                    WHERE listing_id = ? AND id != ? AND status = 'accepted'
+                      AND (payment_due_at IS NULL OR payment_due_at > NOW()))`, u.ListingID, offerID).Scan(&promised)
+			if err != nil {
+				return fmt.Errorf("error checking accepted offers: %w", err)
+			}
+			if promised {
+				return fmt.Errorf("listing %d already has an accepted offer awaiting payment", u.ListingID)
+			}
+		}
+
+		switch action {
+		case models.OfferActionAccepted:
+			u.Status = models.OfferAccepted
+			_, err = tx.ExecContext(ctx, `
+                UPDATE offers
+                SET status = 'accepted', expires_at = NULL, payment_due_at = NOW() + INTERVAL ? HOUR, updated_at = NOW()
+                WHERE id = ?`, hours, offerID)
+		case models.OfferActionRejected:
+			u.Status = models.OfferRejected
+			_, err = tx.ExecContext(ctx, `
+                UPDATE offers SET status = 'rejected', expires_at = NULL, updated_at = NOW()
+                WHERE id = ?`, offerID)
+		case models.OfferActionCountered:
+			// The counter hands the turn to the other side
+			u.Status = models.OfferCountered
+			if role == models.OfferRoleBuyer {
+				u.Status = models.OfferPending
+			}
+			u.Price = price
+			_, err = tx.ExecContext(ctx, `
+                UPDATE offers
+                SET status = ?, offered_price = ?, expires_at = NOW() + INTERVAL ? HOUR, updated_at = NOW()
+                WHERE id = ?`, u.Status, price, hours, offerID)
+		default:
+			return fmt.Errorf("unknown offer action %q", action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update offer: %w", err)
+		}
+
+		if err := addOfferHistory(ctx, tx, offerID, &userID, role, action, u.Price); err != nil {
+			return err
+		}
+		if u.Status == models.OfferAccepted {
+			if u.Competing, err = suspendCompetingOffers(ctx, tx, u.ListingID, u.BuyerID); err != nil {
+				return err
+			}
+		}
+		update = &u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d %s offer %d", userID, action, offerID)
+	return update, nil
+}
+
+// AcceptOffer accepts an offer waiting on the user. The buyer then has
+// paymentHours to pay.
+func (ur *UserRepository) AcceptOffer(ctx context.Context, userID int, offerID int, paymentHours int) (*models.OfferUpdate, error) {
+	return ur.respondToOffer(ctx, userID, offerID, models.OfferActionAccepted, 0, paymentHours)
+}
+
+// RejectOffer rejects an offer waiting on the user
+func (ur *UserRepository) RejectOffer(ctx context.Context, userID int, offerID int) (*models.OfferUpdate, error) {
+	return ur.respondToOffer(ctx, userID, offerID, models.OfferActionRejected, 0, 0)
+}
+
+// CounterOffer answers an offer waiting on the user with a new price, which
+// the other side then has expiryHours to answer
+func (ur *UserRepository) CounterOffer(ctx context.Context, userID int, offerID int, price float64, expiryHours int) (*models.OfferUpdate, error) {
+	return ur.respondToOffer(ctx, userID, offerID, models.OfferActionCountered, price, expiryHours)
+}
+
+// GetOfferHistory returns an offer's negotiation steps, oldest first
+func (ur *UserRepository) GetOfferHistory(ctx context.Context, offerID int) ([]models.OfferHistoryEntry, error) {
+	rows, err := ur.db.QueryContext(ctx, `
+        SELECT id, offer_id, actor_id, actor_role, action, price, created_at
+        FROM offer_history
+        WHERE offer_id = ?
+        ORDER BY created_at, id`, offerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying offer history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.OfferHistoryEntry{}
+	for rows.Next() {
+		var h models.OfferHistoryEntry
+		var actorID sql.NullInt64
+		var price sql.NullFloat64
+		if err := rows.Scan(&h.ID, &h.OfferID, &actorID, &h.ActorRole, &h.Action, &price, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning offer history: %w", err)
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			h.ActorID = &id
+		}
+		if price.Valid {
+			h.Price = &price.Float64
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
 }
 
-// AcceptOffer: Seller accepts an offer
-
-// repository/user_repository.go
-func (ur *UserRepository) AcceptOffer(ctx context.Context, sellerID int, offerID int) (int, error) {
-	query := `
-        UPDATE offers o
-        JOIN listings l ON o.listing_id = l.id
-        SET o.status = 'accepted',
-            o.updated_at = NOW()
-        WHERE o.id = ? 
-        AND l.seller_id = ? 
-        AND o.status = 'pending'
-        AND l.status = 'for_sale'
-    `
-	result, err := ur.db.ExecContext(ctx, query, offerID, sellerID)
+// moveOffers moves the offers query selects (id, listing ID, buyer, seller
+// and price, locked FOR UPDATE) to status, applying the extra assignments in
+// set first, and records action in their history as a system step.
+func moveOffers(ctx context.Context, q dbtx, status string, action string, set string, query string, args ...interface{}) ([]models.OfferUpdate, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to accept offer: %w", err)
+		return nil, fmt.Errorf("error querying offers: %w", err)
+	}
+	var updates []models.OfferUpdate
+	for rows.Next() {
+		u := models.OfferUpdate{Status: status, Action: action}
+		if err := rows.Scan(&u.OfferID, &u.ListingID, &u.BuyerID, &u.SellerID, &u.Price); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning offer: %w", err)
+		}
+		updates = append(updates, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	for _, u := range updates {
+		_, err := q.ExecContext(ctx, `UPDATE offers SET `+set+`status = ?, updated_at = NOW() WHERE id = ?`, status, u.OfferID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update offer %d: %w", u.OfferID, err)
+		}
+		if err := addOfferHistory(ctx, q, u.OfferID, nil, models.OfferRoleSystem, action, u.Price); err != nil {
+			return nil, err
+		}
 	}
-	if rowsAffected == 0 {
-		return 0, fmt.Errorf("no pending offer found with ID %d for seller %d or listing not for sale", offerID, sellerID)
+	return updates, nil
+}
+
+// suspendCompetingOffers puts other buyers' open offers on a listing on hold
+// while it is promised to buyerID. Their expiry is paused.
+func suspendCompetingOffers(ctx context.Context, q dbtx, listingID int, buyerID int) ([]models.OfferUpdate, error) {
+	// MySQL assigns left to right, so suspended_from gets the old status
+	return moveOffers(ctx, q, models.OfferSuspended, models.OfferActionSuspended,
+		`suspended_from = status, suspended_at = NOW(), `, `
+        SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price
+        FROM offers o
+        JOIN listings l ON o.listing_id = l.id
+        WHERE o.listing_id = ? AND o.buyer_id != ? AND o.status IN ('pending', 'countered')
+        FOR UPDATE`, listingID, buyerID)
+}
+
+// reinstateCompetingOffers puts suspended offers on a listing back to where
+// they were once it is for sale again, no accepted offer is waiting on
+// payment and nobody is on its waitlist. Their expiry is pushed back by the
+// time they spent suspended.
+func reinstateCompetingOffers(ctx context.Context, q dbtx, listingID int) ([]models.OfferUpdate, error) {
+	var reinstated []models.OfferUpdate
+	for _, status := range []string{models.OfferPending, models.OfferCountered} {
+		updates, err := moveOffers(ctx, q, status, models.OfferActionReinstated, `
+            expires_at = expires_at + INTERVAL TIMESTAMPDIFF(SECOND, suspended_at, NOW()) SECOND,
+            suspended_from = NULL, suspended_at = NULL, `, `
+        SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price
+        FROM offers o
+        JOIN listings l ON o.listing_id = l.id
+        WHERE o.listing_id = ? AND o.status = 'suspended' AND o.suspended_from = ?
+          AND l.status = 'for_sale'
+          AND NOT EXISTS (
+              SELECT 1 FROM offers a
+              WHERE a.listing_id = o.listing_id AND a.status = 'accepted'
+                AND (a.payment_due_at IS NULL OR a.payment_due_at > NOW()))
+          AND NOT EXISTS (
+              SELECT 1 FROM listing_waitlist w
+              WHERE w.listing_id = o.listing_id AND w.status = 'waiting')
+        FOR UPDATE`, listingID, status)
+		if err != nil {
+			return nil, err
+		}
+		reinstated = append(reinstated, updates...)
 	}
+	return reinstated, nil
+}
 
-	log.Printf("Seller %d accepted offer %d", sellerID, offerID)
+// rejectCompetingOffers rejects every open offer on a listing that's gone,
+// except those of exceptBuyerID (0 rejects them all)
+func rejectCompetingOffers(ctx context.Context, q dbtx, listingID int, exceptBuyerID int) ([]models.OfferUpdate, error) {
+	return moveOffers(ctx, q, models.OfferRejected, models.OfferActionRejected,
+		`expires_at = NULL, payment_due_at = NULL, suspended_from = NULL, suspended_at = NULL, `, `
+        SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price
+        FROM offers o
+        JOIN listings l ON o.listing_id = l.id
+        WHERE o.listing_id = ? AND o.buyer_id != ?
+          AND o.status IN ('pending', 'countered', 'accepted', 'suspended')
+        FOR UPDATE`, listingID, exceptBuyerID)
+}
 
-	buyer_id, err := ur.GetBuyerIDFromOfferID(ctx, offerID)
+// expireOffers expires the offers query selects. Competing offers that an
+// unpaid acceptance held up are reinstated.
+func (ur *UserRepository) expireOffers(ctx context.Context, action string, query string, args ...interface{}) ([]models.OfferUpdate, error) {
+	var updates []models.OfferUpdate
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
 
+		var err error
+		updates, err = moveOffers(ctx, tx, models.OfferExpired, action, ``, query, args...)
+		if err != nil {
+			return err
+		}
+		if action != models.OfferActionPaymentExpired {
+			return nil
+		}
+		for i := range updates {
+			if updates[i].Competing, err = reinstateCompetingOffers(ctx, tx, updates[i].ListingID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error get buyer_id: %w", err)
+		return nil, err
 	}
+	return updates, nil
+}
+
+// ExpireStaleOffers expires pending and countered offers nobody answered in
+// time. Offers from before expiry was tracked get expiryHours from their last
+// update.
+func (ur *UserRepository) ExpireStaleOffers(ctx context.Context, expiryHours int) ([]models.OfferUpdate, error) {
+	return ur.expireOffers(ctx, models.OfferActionExpired, `
+        SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price
+        FROM offers o
+        JOIN listings l ON o.listing_id = l.id
+        WHERE o.status IN ('pending', 'countered')
+          AND COALESCE(o.expires_at, o.updated_at + INTERVAL ? HOUR) <= NOW()
+        FOR UPDATE`, expiryHours)
+}
 
-	return buyer_id, nil
+// ExpireUnpaidOffers expires accepted offers whose payment deadline passed.
+// Offers whose buyer is in the middle of paying are left for the next run.
+func (ur *UserRepository) ExpireUnpaidOffers(ctx context.Context, paymentHours int) ([]models.OfferUpdate, error) {
+	return ur.expireOffers(ctx, models.OfferActionPaymentExpired, `
+        SELECT o.id, o.listing_id, o.buyer_id, l.seller_id, o.offered_price
+        FROM offers o
+        JOIN listings l ON o.listing_id = l.id
+        WHERE o.status = 'accepted'
+          AND COALESCE(o.payment_due_at, o.updated_at + INTERVAL ? HOUR) <= NOW()
+          AND NOT (l.status = 'reserved' AND l.reserved_by = o.buyer_id AND l.reserved_expires_at > NOW())
+        FOR UPDATE`, paymentHours)
 }
 
 func (ur *UserRepository) GetBuyerIDFromOfferID(ctx context.Context, offerID int) (int, error) {
@@ -1513,41 +2668,6 @@ func (ur *UserRepository) GetBuyerIDFromOfferID(ctx context.Context, offerID int
 }
 
 
-// RejectOffer: Seller rejects an offer
-func (ur *UserRepository) RejectOffer(ctx context.Context, sellerID int, offerID int) (int, error) {
-	query := `
-        UPDATE offers o
-        JOIN listings l ON o.listing_id = l.id
-        SET o.status = 'rejected',
-            o.updated_at = NOW()
-        WHERE o.id = ? 
-        AND l.seller_id = ? 
-        AND o.status = 'pending'
-    `
-	result, err := ur.db.ExecContext(ctx, query, offerID, sellerID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to reject offer: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, fmt.Errorf("error checking rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return 0, fmt.Errorf("no pending offer found with ID %d for seller %d", offerID, sellerID)
-	}
-
-	log.Printf("Seller %d rejected offer %d", sellerID, offerID)
-
-	buyer_id, err := ur.GetBuyerIDFromOfferID(ctx, offerID)
-
-	if err != nil {
-		return 0, fmt.Errorf("error get buyer_id: %w", err)
-	}
-
-	return buyer_id, nil
-}
-
 // repository/user_repository.go
 func (ur *UserRepository) GetAcceptedOffer(ctx context.Context, offerID int) (*models.OfferItem, error) {
 	query := `
@@ -1557,6 +2677,8 @@ func (ur *UserRepository) GetAcceptedOffer(ctx context.Context, offerID int) (*m
             o.buyer_id,
             o.offered_price,
             o.status,
+            o.expires_at,
+            o.payment_due_at,
             l.book_id,
             b.title,
             b.cover_image_url,
@@ -1582,9 +2704,10 @@ func (ur *UserRepository) GetAcceptedOffer(ctx context.Context, offerID int) (*m
 		&item.BuyerID,
 		&item.OfferedPrice,
 		&item.Status,
+		&item.ExpiresAt,
+		&item.PaymentDueAt,
 		&item.BookID,
 		&item.BookTitle,
-		&item.BookAuthor,
 		&item.CoverImageURL,
 		&item.ImageURL,
 		&item.SellerID,
@@ -1592,17 +2715,17 @@ func (ur *UserRepository) GetAcceptedOffer(ctx context.Context, offerID int) (*m
 		&item.BuyerLastName,
 		&item.BuyerPicture,
 	)
-	authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
-		if err != nil {
-			return nil, err
-		}
-	item.BookAuthor = authors
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no accepted offer found with ID %d", offerID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("error fetching accepted offer: %w", err)
 	}
+	authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
+	if err != nil {
+		return nil, err
+	}
+	item.BookAuthor = authors
 	return &item, nil
 }
 
@@ -1614,6 +2737,8 @@ func (ur *UserRepository) GetOfferByID(ctx context.Context, offerID int) (*model
             o.buyer_id,
             o.offered_price,
             o.status,
+            o.expires_at,
+            o.payment_due_at,
             l.book_id,
             b.title,
             b.cover_image_url,
@@ -1639,6 +2764,8 @@ func (ur *UserRepository) GetOfferByID(ctx context.Context, offerID int) (*model
 		&item.BuyerID,
 		&item.OfferedPrice,
 		&item.Status,
+		&item.ExpiresAt,
+		&item.PaymentDueAt,
 		&item.BookID,
 		&item.BookTitle,
 		&item.CoverImageURL,
@@ -1648,209 +2775,107 @@ func (ur *UserRepository) GetOfferByID(ctx context.Context, offerID int) (*model
 		&item.BuyerLastName,
 		&item.BuyerPicture,
 	)
-	authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
-		if err != nil {
-			return nil, err
-		}
-	item.BookAuthor = authors
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no offer found with ID %d", offerID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("error fetching offer: %w", err)
 	}
-	return &item, nil
-}
-
-// repository/user_repository.go
-// repository/user_repository.go
-func (ur *UserRepository) ReserveListingForOffer(ctx context.Context, listingID int, buyerID int) (bool, error) {
-	query := `
-        UPDATE listings l
-        JOIN offers o ON o.listing_id = l.id
-        SET l.status = 'reserved',
-            l.reserved_expires_at = NOW() + INTERVAL 2 MINUTE,
-            l.updated_at = NOW()
-        WHERE l.id = ?
-        AND o.buyer_id = ?
-        AND o.status = 'accepted'
-        AND l.status = 'for_sale'
-    `
-	result, err := ur.db.ExecContext(ctx, query, listingID, buyerID)
-	if err != nil {
-		return false, fmt.Errorf("failed to reserve listing for offer: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
+	authors, err := ur.getAuthorsByBookID(ctx, item.BookID)
 	if err != nil {
-		return false, fmt.Errorf("error checking rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return false, nil // Listing wasn’t reserved (e.g., not for_sale or offer not accepted)
+		return nil, err
 	}
-
-	log.Printf("Listing %d reserved for buyer %d via offer, expires at %s", listingID, buyerID, time.Now().Add(2*time.Minute))
-	return true, nil
+	item.BookAuthor = authors
+	return &item, nil
 }
 
+// MarkListingAsSold updates the listing status to sold
 // repository/user_repository.go
 // repository/user_repository.go
-func (ur *UserRepository) RevertOfferReservation(ctx context.Context, listingID int, offerID int) error {
-	query := `
-        UPDATE listings 
-        SET status = 'for_sale', 
-            reserved_expires_at = NULL, 
-            updated_at = NOW()
-        WHERE id = ? 
-        AND status = 'reserved'
-    `
-	result, err := ur.db.ExecContext(ctx, query, listingID)
-	if err != nil {
-		return fmt.Errorf("failed to revert listing: %w", err)
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no reserved listing found with ID %d", listingID)
-	}
-
-	// Offer stays 'accepted'—buyer can try again
-	return nil
-}
-
-// ReserveListing reserves a listing atomically with a timeout
-// repository/user_repository.go
-func (ur *UserRepository) ReserveListing(ctx context.Context, listingID int, buyerID int) (bool, error) {
-	query := `
-        UPDATE listings 
-        SET status = 'reserved',
-            reserved_expires_at = NOW() + INTERVAL 2 MINUTE,
-            updated_at = NOW()
-        WHERE id = ?
-        AND status = 'for_sale'
-    `
-	result, err := ur.db.ExecContext(ctx, query, listingID)
-	if err != nil {
-		return false, fmt.Errorf("failed to reserve listing: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
+// MarkListingAsSold also rejects the other buyers' offers, which are returned
+func (ur *UserRepository) MarkListingAsSold(ctx context.Context, listingID, buyerID int) ([]models.OfferUpdate, error) {
+	var rejected []models.OfferUpdate
+	err := runInTx(ctx, ur.db, func(ctx context.Context) error {
+		var err error
+		rejected, err = ur.markListingAsSold(ctx, listingID, buyerID)
+		return err
+	})
 	if err != nil {
-		return false, fmt.Errorf("error checking rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return false, nil // Listing wasn’t reserved (e.g., not for_sale)
+		return nil, err
 	}
 
-	log.Printf("Listing %d reserved for buyer %d, expires at %s", listingID, buyerID, time.Now().Add(2*time.Minute))
-	return true, nil
+	log.Printf("Listing %d marked as sold for buyer %d, %d offers rejected", listingID, buyerID, len(rejected))
+	return rejected, nil
 }
 
-// MarkListingAsSold updates the listing status to sold
-// repository/user_repository.go
-// repository/user_repository.go
-func (ur *UserRepository) MarkListingAsSold(ctx context.Context, listingID, buyerID int) error {
-	tx, err := ur.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer tx.Rollback()
+func (ur *UserRepository) markListingAsSold(ctx context.Context, listingID, buyerID int) ([]models.OfferUpdate, error) {
+	tx := conn(ctx, ur.db)
 
 	// Step 1: Mark the listing as sold
 	queryListing := `
         UPDATE listings 
         SET status = 'sold',
             reserved_expires_at = NULL,
+            reserved_by = NULL,
             updated_at = NOW()
         WHERE id = ?
         AND status = 'reserved'
     `
 	result, err := tx.ExecContext(ctx, queryListing, listingID)
 	if err != nil {
-		return fmt.Errorf("failed to mark listing as sold: %w", err)
+		return nil, fmt.Errorf("failed to mark listing as sold: %w", err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error checking rows affected for listing: %w", err)
+		return nil, fmt.Errorf("error checking rows affected for listing: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("listing %d is not in reserved state", listingID)
+		return nil, fmt.Errorf("listing %d: %w", listingID, models.ErrListingNotReserved)
 	}
 
 	// Step 2: Handle offers
-	// - If this is an offer payment, keep the winning offer 'accepted' (or update to 'completed')
-	// - Reject all other offers
-	queryOffers := `
-        UPDATE offers 
-        SET status = 'rejected',
-            updated_at = NOW()
-        WHERE listing_id = ?
-        AND buyer_id != ?
-        AND status IN ('pending', 'accepted')
-    `
-	_, err = tx.ExecContext(ctx, queryOffers, listingID, buyerID)
+	// - Reject all other offers, including suspended ones
+	// - If this was an offer payment, the winning offer is 'completed' so its
+	//   payment deadline no longer applies
+	rejected, err := rejectCompetingOffers(ctx, tx, listingID, buyerID)
 	if err != nil {
-		return fmt.Errorf("failed to reject other offers: %w", err)
-	}
-
-	// // Optional: Update the winning offer to 'completed' if it’s an offer payment
-	// queryWinningOffer := `
-    //     UPDATE offers 
-    //     SET status = 'completed',
-    //         updated_at = NOW()
-    //     WHERE listing_id = ?
-    //     AND buyer_id = ?
-    //     AND status = 'accepted'
-    // `
-	// _, err = tx.ExecContext(ctx, queryWinningOffer, listingID, buyerID)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to update winning offer: %w", err)
-	// }
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to reject other offers: %w", err)
 	}
 
-	log.Printf("Listing %d marked as sold for buyer %d, offers updated", listingID, buyerID)
-	return nil
-}
-
-// ExpireReservedListing reverts a listing to for_sale if payment isn’t completed
-// repository/user_repository.go
-func (ur *UserRepository) ExpireReservedListing(ctx context.Context, listingID int) error {
-	query := `
-        UPDATE listings 
-        SET status = 'for_sale',
-            reserved_expires_at = NULL,
+	queryWinningOffer := `
+        UPDATE offers 
+        SET status = 'completed',
             updated_at = NOW()
-        WHERE id = ?
-        AND status = 'reserved'
-        AND reserved_expires_at <= NOW()
+        WHERE listing_id = ?
+        AND buyer_id = ?
+        AND status = 'accepted'
     `
-	result, err := ur.db.ExecContext(ctx, query, listingID)
+	_, err = tx.ExecContext(ctx, queryWinningOffer, listingID, buyerID)
 	if err != nil {
-		return fmt.Errorf("failed to expire listing: %w", err)
+		return nil, fmt.Errorf("failed to update winning offer: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
+	// Step 3: The buyer's hold converted; nobody else gets a turn
+	if err := resolveHolds(ctx, tx, listingID, buyerID, models.HoldConverted); err != nil {
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no expired reserved listing found with ID %d", listingID)
+	if err := resolveHolds(ctx, tx, listingID, 0, models.HoldReleased); err != nil {
+		return nil, err
+	}
+	if err := closeWaitlist(ctx, tx, listingID); err != nil {
+		return nil, err
 	}
 
-	log.Printf("Listing %d reservation expired", listingID)
-	return nil
+	return rejected, nil
 }
 
-// CreateTransaction records a new transaction
-func (ur *UserRepository) CreateTransaction(ctx context.Context, stripe_session_id string, buyerID int, listingID int, offer_id *int, amount float64, status string) error {
+// CreateTransaction records a new transaction. stripe_session_id holds the
+// provider's checkout reference: a Stripe session ID, or an Omise charge ID
+// when provider is "omise".
+func (ur *UserRepository) CreateTransaction(ctx context.Context, stripe_session_id string, buyerID int, listingID int, offer_id *int, amount float64, status string, provider string) error {
 
-	query := `INSERT INTO transactions (stripe_session_id, buyer_id, listing_id, offer_id, transaction_amount, payment_status, created_at, updated_at)
-             VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	query := `INSERT INTO transactions (stripe_session_id, payment_provider, buyer_id, seller_id, listing_id, offer_id, transaction_amount, payment_status, created_at, updated_at)
+             VALUES (?, ?, ?, (SELECT seller_id FROM listings WHERE id = ?), ?, ?, ?, ?, NOW(), NOW())`
 	
 	var offerValue interface{}
 	if offer_id != nil {
@@ -1859,10 +2884,12 @@ func (ur *UserRepository) CreateTransaction(ctx context.Context, stripe_session_
 		offerValue = nil
 	}
 
-	_, err := ur.db.ExecContext(ctx, query,
+	_, err := conn(ctx, ur.db).ExecContext(ctx, query,
 		stripe_session_id,
+		provider,
 		buyerID,
 		listingID,
+		listingID,
 		offerValue,
 		amount,
 		status,
@@ -1872,85 +2899,152 @@ func (ur *UserRepository) CreateTransaction(ctx context.Context, stripe_session_
 	return err
 }
 
-// UpdateTransactionStatus updates the transaction status
-func (ur *UserRepository) UpdateTransactionStatus(ctx context.Context, listingID int, status string) error {
-	query := `UPDATE transactions SET payment_status = ?, updated_at = NOW() 
-	          WHERE listing_id = ? AND payment_status = 'reserved'`
-	_, err := ur.db.ExecContext(ctx, query, status, listingID)
-	return err
+// CreateCartTransactions records one pending transaction per listing, all tied
+// to the same payment session.
+func (ur *UserRepository) CreateCartTransactions(ctx context.Context, sessionID string, provider string, buyerID int, items []models.CartCheckoutItem) error {
+	return runInTx(ctx, ur.db, func(ctx context.Context) error {
+		tx := conn(ctx, ur.db)
+		query := `INSERT INTO transactions (stripe_session_id, payment_provider, buyer_id, seller_id, listing_id, offer_id, transaction_amount, payment_status, created_at, updated_at)
+	             VALUES (?, ?, ?, ?, ?, NULL, ?, 'pending', NOW(), NOW())`
+		for _, item := range items {
+			if _, err := tx.ExecContext(ctx, query, sessionID, provider, buyerID, item.SellerID, item.ListingID, item.Price); err != nil {
+				return fmt.Errorf("failed to record transaction for listing %d: %w", item.ListingID, err)
+			}
+		}
+		return nil
+	})
 }
 
+// GetSessionTransactions returns the per-listing transactions of a payment session
+func (ur *UserRepository) GetSessionTransactions(ctx context.Context, sessionID string) ([]models.SessionTransaction, error) {
+	query := `
+        SELECT t.id, t.buyer_id, COALESCE(t.seller_id, l.seller_id), t.listing_id, t.offer_id,
+               t.transaction_amount, t.payment_status
+        FROM transactions t
+        JOIN listings l ON t.listing_id = l.id
+        WHERE t.stripe_session_id = ?
+        ORDER BY t.id
+    `
+	rows, err := conn(ctx, ur.db).QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying session transactions: %w", err)
+	}
+	defer rows.Close()
 
-
-// CleanupExpiredListings runs as a background job
-// repository/user_repository.go
-func (ur *UserRepository) CleanupExpiredListings(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second) // Less frequent since webhook handles most cases
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			query := `
-                SELECT id 
-                FROM listings 
-                WHERE status = 'reserved' 
-                AND reserved_expires_at IS NOT NULL 
-                AND reserved_expires_at <= NOW()
-            `
-			rows, err := ur.db.QueryContext(ctx, query)
-			if err != nil {
-				log.Println("❌ Cleanup Error:", err)
-				continue
-			}
-			var listingIDs []int
-			for rows.Next() {
-				var id int
-				if err := rows.Scan(&id); err != nil {
-					log.Println("❌ Scan Error:", err)
-					continue
-				}
-				listingIDs = append(listingIDs, id)
-			}
-			if err := rows.Close(); err != nil {
-				log.Println("❌ Rows Close Error:", err)
-			}
-			for _, id := range listingIDs {
-				if err := ur.ExpireReservedListing(ctx, id); err != nil {
-					log.Println("❌ Expire Error for listing", id, ":", err)
-				} else {
-					log.Printf("Cleanup: Expired listing %d reverted to for_sale", id)
-				}
-			}
-		case <-ctx.Done():
-			log.Println("CleanupExpiredListings stopped")
-			return
+	var transactions []models.SessionTransaction
+	for rows.Next() {
+		var t models.SessionTransaction
+		var offerID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.BuyerID, &t.SellerID, &t.ListingID, &offerID, &t.Amount, &t.Status); err != nil {
+			return nil, fmt.Errorf("error scanning session transaction: %w", err)
+		}
+		if offerID.Valid {
+			id := int(offerID.Int64)
+			t.OfferID = &id
 		}
+		transactions = append(transactions, t)
 	}
+	return transactions, rows.Err()
 }
 
-// IsListingReserved checks if a listing is reserved and still active
-// repository/user_repository.go
-func (ur *UserRepository) IsListingReserved(ctx context.Context, listingID int) (bool, bool, error) {
-	var status string
-	var reservedExpiresAt *time.Time
+// SetTransactionStatus sets the status of a single transaction
+func (ur *UserRepository) SetTransactionStatus(ctx context.Context, transactionID int, status string) error {
+	query := `UPDATE transactions SET payment_status = ?, updated_at = NOW() WHERE id = ?`
+	_, err := conn(ctx, ur.db).ExecContext(ctx, query, status, transactionID)
+	return err
+}
+
+// UpdateSessionTransactionsStatus moves a session's pending transactions to status
+func (ur *UserRepository) UpdateSessionTransactionsStatus(ctx context.Context, sessionID string, status string) error {
+	query := `UPDATE transactions SET payment_status = ?, updated_at = NOW()
+	          WHERE stripe_session_id = ? AND payment_status = 'pending'`
+	_, err := conn(ctx, ur.db).ExecContext(ctx, query, status, sessionID)
+	return err
+}
+
+// SetSessionPaymentReference stores the provider's payment reference (the
+// Stripe payment intent) on a session's transactions, so later charge events
+// such as refunds and disputes can be matched back to them.
+func (ur *UserRepository) SetSessionPaymentReference(ctx context.Context, sessionID string, reference string) error {
+	query := `UPDATE transactions SET payment_reference = ?, updated_at = NOW()
+	          WHERE stripe_session_id = ?`
+	_, err := conn(ctx, ur.db).ExecContext(ctx, query, reference, sessionID)
+	return err
+}
+
+// GetTransactionsByPaymentReference returns the transactions paid with a given payment reference
+func (ur *UserRepository) GetTransactionsByPaymentReference(ctx context.Context, reference string) ([]models.SessionTransaction, error) {
 	query := `
-        SELECT status, reserved_expires_at 
-        FROM listings 
-        WHERE id = ?
+        SELECT t.id, t.buyer_id, COALESCE(t.seller_id, l.seller_id), t.listing_id, t.offer_id,
+               t.transaction_amount, t.payment_status
+        FROM transactions t
+        JOIN listings l ON t.listing_id = l.id
+        WHERE t.payment_reference = ?
+        ORDER BY t.id
     `
-	err := ur.db.QueryRowContext(ctx, query, listingID).Scan(&status, &reservedExpiresAt)
+	rows, err := conn(ctx, ur.db).QueryContext(ctx, query, reference)
 	if err != nil {
-		return false, false, fmt.Errorf("failed to check listing status: %w", err)
+		return nil, fmt.Errorf("error querying transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.SessionTransaction
+	for rows.Next() {
+		var t models.SessionTransaction
+		var offerID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.BuyerID, &t.SellerID, &t.ListingID, &offerID, &t.Amount, &t.Status); err != nil {
+			return nil, fmt.Errorf("error scanning transaction: %w", err)
+		}
+		if offerID.Valid {
+			id := int(offerID.Int64)
+			t.OfferID = &id
+		}
+		transactions = append(transactions, t)
 	}
-	if status != "reserved" {
-		return false, false, nil
+	return transactions, rows.Err()
+}
+
+// MarkPaymentReversed moves completed transactions for a payment reference, and
+// their listings, into status ('refunded' or 'disputed').
+func (ur *UserRepository) MarkPaymentReversed(ctx context.Context, reference string, status string) error {
+	return runInTx(ctx, ur.db, func(ctx context.Context) error {
+		return ur.markPaymentReversed(ctx, reference, status)
+	})
+}
+
+func (ur *UserRepository) markPaymentReversed(ctx context.Context, reference string, status string) error {
+	tx := conn(ctx, ur.db)
+
+	_, err := tx.ExecContext(ctx, `
+        UPDATE listings l
+        JOIN transactions t ON t.listing_id = l.id
+        SET l.status = ?, l.updated_at = NOW()
+        WHERE t.payment_reference = ? AND l.status IN ('sold', 'disputed')`, status, reference)
+	if err != nil {
+		return fmt.Errorf("failed to update listings: %w", err)
 	}
-	if reservedExpiresAt == nil || time.Now().Before(*reservedExpiresAt) {
-		return true, false, nil // Reserved and not expired
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE transactions
+        SET payment_status = ?, updated_at = NOW()
+        WHERE payment_reference = ? AND payment_status IN ('completed', 'disputed', 'partially_refunded')`, status, reference)
+	if err != nil {
+		return fmt.Errorf("failed to update transactions: %w", err)
 	}
-	return true, true, nil // Reserved but expired
+
+	return nil
+}
+
+// UpdateTransactionStatus updates the transaction status
+func (ur *UserRepository) UpdateTransactionStatus(ctx context.Context, listingID int, status string) error {
+	query := `UPDATE transactions SET payment_status = ?, updated_at = NOW() 
+	          WHERE listing_id = ? AND payment_status = 'reserved'`
+	_, err := ur.db.ExecContext(ctx, query, status, listingID)
+	return err
 }
 
+
+
 // repository/user_repository.go
 func (ur *UserRepository) CreatePost(ctx context.Context, userID int, content string, imageURLs []string, genreID *int, bookID *int) (models.Post, error) {
 	// Insert post
@@ -1990,25 +3084,38 @@ func (ur *UserRepository) CreatePost(ctx context.Context, userID int, content st
 	return post, nil
 }
 
-func (ur *UserRepository) GetAllPosts(ctx context.Context) ([]models.Post, error) {
-	// Fetch all posts
+func (ur *UserRepository) GetAllPosts(ctx context.Context, page models.PageRequest) ([]models.Post, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, postSortKeys, "created_at", "p.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Fetch one page of posts, newest first by default
 	query := `
-        SELECT id, user_id, content, genre_id, book_id, created_at, updated_at
-        FROM posts ORDER BY created_at DESC
+        SELECT p.id, p.user_id, p.content, p.genre_id, p.book_id, p.created_at, p.updated_at, ` + kp.SortValue + `
+        FROM posts p
+        WHERE 1 = 1` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + `
+        LIMIT ?
     `
-	rows, err := ur.db.QueryContext(ctx, query)
+	args := append(kp.Args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var posts []models.Post
+	posts := []models.Post{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var post models.Post
 		var genreID sql.NullInt64
 		var bookID sql.NullInt64
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &genreID, &bookID, &post.CreatedAt, &post.UpdatedAt); err != nil {
-			return nil, err
+		var sortValue string
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &genreID, &bookID, &post.CreatedAt, &post.UpdatedAt, &sortValue); err != nil {
+			return nil, nil, err
 		}
 		if genreID.Valid {
 			id := int(genreID.Int64)
@@ -2022,7 +3129,7 @@ func (ur *UserRepository) GetAllPosts(ctx context.Context) ([]models.Post, error
 		// Fetch image URLs for this post
 		imageRows, err := ur.db.QueryContext(ctx, "SELECT image_url FROM post_images WHERE post_id = ?", post.ID)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		defer imageRows.Close()
 
@@ -2030,19 +3137,22 @@ func (ur *UserRepository) GetAllPosts(ctx context.Context) ([]models.Post, error
 		for imageRows.Next() {
 			var url string
 			if err := imageRows.Scan(&url); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			imageURLs = append(imageURLs, url)
 		}
 		post.ImageURLs = imageURLs
 
 		posts = append(posts, post)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, post.ID)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return posts, nil
+	posts, info := trimPage(kp, posts, sortValues, ids)
+	return posts, info, nil
 }
 
 // Optional: Fetch post with images
@@ -2128,26 +3238,38 @@ func (ur *UserRepository) GetPost(ctx context.Context, id int) (models.Post, err
 
 // GetPostsByUserID fetches all posts by a specific user with their image URLs
 // repository/user_repository.go
-func (ur *UserRepository) GetPostsByUserID(ctx context.Context, userID int) ([]models.Post, error) {
+func (ur *UserRepository) GetPostsByUserID(ctx context.Context, userID int, page models.PageRequest) ([]models.Post, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, postSortKeys, "created_at", "p.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
 	query := `
-        SELECT id, user_id, content, genre_id, book_id, created_at, updated_at
-        FROM posts
-        WHERE user_id = ?
-        ORDER BY created_at DESC
+        SELECT p.id, p.user_id, p.content, p.genre_id, p.book_id, p.created_at, p.updated_at, ` + kp.SortValue + `
+        FROM posts p
+        WHERE p.user_id = ?` + kp.Where + `
+        ORDER BY ` + kp.OrderBy + `
+        LIMIT ?
     `
-	rows, err := ur.db.QueryContext(ctx, query, userID)
+	args := append([]interface{}{userID}, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch posts for user %d: %v", userID, err)
+		return nil, nil, fmt.Errorf("failed to fetch posts for user %d: %v", userID, err)
 	}
 	defer rows.Close()
 
-	var posts []models.Post
+	posts := []models.Post{}
+	var sortValues []string
+	var ids []int
 	for rows.Next() {
 		var post models.Post
 		var genreID sql.NullInt64
 		var bookID sql.NullInt64
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &genreID, &bookID, &post.CreatedAt, &post.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan post: %v", err)
+		var sortValue string
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &genreID, &bookID, &post.CreatedAt, &post.UpdatedAt, &sortValue); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan post: %v", err)
 		}
 		if genreID.Valid {
 			id := int(genreID.Int64)
@@ -2161,7 +3283,7 @@ func (ur *UserRepository) GetPostsByUserID(ctx context.Context, userID int) ([]m
 		// Fetch image URLs
 		imageRows, err := ur.db.QueryContext(ctx, "SELECT image_url FROM post_images WHERE post_id = ?", post.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch images for post %d: %v", post.ID, err)
+			return nil, nil, fmt.Errorf("failed to fetch images for post %d: %v", post.ID, err)
 		}
 		defer imageRows.Close()
 
@@ -2169,22 +3291,25 @@ func (ur *UserRepository) GetPostsByUserID(ctx context.Context, userID int) ([]m
 		for imageRows.Next() {
 			var url string
 			if err := imageRows.Scan(&url); err != nil {
-				return nil, fmt.Errorf("failed to scan image URL: %v", err)
+				return nil, nil, fmt.Errorf("failed to scan image URL: %v", err)
 			}
 			imageURLs = append(imageURLs, url)
 		}
 		if err = imageRows.Err(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		post.ImageURLs = imageURLs
 
 		posts = append(posts, post)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, post.ID)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return posts, nil // Return empty slice if no posts, not nil
+	posts, info := trimPage(kp, posts, sortValues, ids)
+	return posts, info, nil // Return empty slice if no posts, not nil
 }
 
 // GetPostByPostID fetches a single post by its ID with image URLs
@@ -2262,6 +3387,16 @@ func (ur *UserRepository) CreateComment(ctx context.Context, postID, userID int,
 	return comment, nil
 }
 
+// GetPostAuthorID returns the user who wrote a post
+func (ur *UserRepository) GetPostAuthorID(ctx context.Context, postID int) (int, error) {
+	var authorID int
+	err := ur.db.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID)
+	if err != nil {
+		return 0, fmt.Errorf("error loading post author: %w", err)
+	}
+	return authorID, nil
+}
+
 // GetCommentsByPostID fetches all comments for a post
 func (ur *UserRepository) GetCommentsByPostID(ctx context.Context, postID int) ([]models.Comment, error) {
     rows, err := ur.db.QueryContext(ctx, `
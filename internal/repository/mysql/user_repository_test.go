@@ -0,0 +1,242 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"used2book-backend/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	testOfferID   = 21
+	testListingID = 3
+	testBuyerID   = 9
+	testSellerID  = 5
+)
+
+// expectOffer expects respondToOffer to lock testOfferID
+func expectOffer(mock sqlmock.Sqlmock, status string, listingStatus string, expired bool) {
+	mock.ExpectQuery(`SELECT o.listing_id, o.buyer_id, l.seller_id, o.offered_price, o.status, l.status`).
+		WithArgs(testOfferID).
+		WillReturnRows(sqlmock.NewRows([]string{"listing_id", "buyer_id", "seller_id", "offered_price", "status", "listing_status", "expired"}).
+			AddRow(testListingID, testBuyerID, testSellerID, 100.0, status, listingStatus, expired))
+}
+
+// expectHistory expects one offer_history row for offerID
+func expectHistory(mock sqlmock.Sqlmock, offerID int, actorID interface{}, role string, action string, price float64) {
+	mock.ExpectExec(`INSERT INTO offer_history`).
+		WithArgs(offerID, actorID, role, action, price).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestRespondToOffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  int
+		action  string
+		price   float64
+		expect  func(mock sqlmock.Sqlmock)
+		want    models.OfferUpdate
+		wantErr bool
+	}{
+		{
+			name:   "seller accepts",
+			userID: testSellerID,
+			action: models.OfferActionAccepted,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOffer(mock, models.OfferPending, "for_sale", false)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testListingID, testOfferID).
+					WillReturnRows(sqlmock.NewRows([]string{"promised"}).AddRow(false))
+				mock.ExpectExec(`UPDATE offers\s+SET status = 'accepted'`).
+					WithArgs(24, testOfferID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHistory(mock, testOfferID, testSellerID, models.OfferRoleSeller, models.OfferActionAccepted, 100.0)
+				mock.ExpectQuery(`WHERE o.listing_id = \? AND o.buyer_id != \? AND o.status IN \('pending', 'countered'\)`).
+					WithArgs(testListingID, testBuyerID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "seller_id", "offered_price"}).
+						AddRow(22, testListingID, 11, testSellerID, 90.0))
+				mock.ExpectExec(`UPDATE offers SET suspended_from = status, suspended_at = NOW\(\), status = \?`).
+					WithArgs(models.OfferSuspended, 22).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHistory(mock, 22, nil, models.OfferRoleSystem, models.OfferActionSuspended, 90.0)
+			},
+			want: models.OfferUpdate{Status: models.OfferAccepted, Price: 100, Competing: []models.OfferUpdate{
+				{OfferID: 22, ListingID: testListingID, BuyerID: 11, SellerID: testSellerID, Price: 90, Status: models.OfferSuspended, Action: models.OfferActionSuspended},
+			}},
+		},
+		{
+			name:   "seller counters",
+			userID: testSellerID,
+			action: models.OfferActionCountered,
+			price:  110,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOffer(mock, models.OfferPending, "for_sale", false)
+				mock.ExpectExec(`UPDATE offers\s+SET status = \?, offered_price = \?`).
+					WithArgs(models.OfferCountered, 110.0, 24, testOfferID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHistory(mock, testOfferID, testSellerID, models.OfferRoleSeller, models.OfferActionCountered, 110.0)
+			},
+			want: models.OfferUpdate{Status: models.OfferCountered, Price: 110},
+		},
+		{
+			name:   "buyer counters back",
+			userID: testBuyerID,
+			action: models.OfferActionCountered,
+			price:  105,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOffer(mock, models.OfferCountered, "for_sale", false)
+				mock.ExpectExec(`UPDATE offers\s+SET status = \?, offered_price = \?`).
+					WithArgs(models.OfferPending, 105.0, 24, testOfferID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHistory(mock, testOfferID, testBuyerID, models.OfferRoleBuyer, models.OfferActionCountered, 105.0)
+			},
+			want: models.OfferUpdate{Status: models.OfferPending, Price: 105},
+		},
+		{
+			name:   "reject a listing that is no longer for sale",
+			userID: testSellerID,
+			action: models.OfferActionRejected,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOffer(mock, models.OfferPending, "reserved", false)
+				mock.ExpectExec(`UPDATE offers SET status = 'rejected'`).
+					WithArgs(testOfferID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHistory(mock, testOfferID, testSellerID, models.OfferRoleSeller, models.OfferActionRejected, 100.0)
+			},
+			want: models.OfferUpdate{Status: models.OfferRejected, Price: 100},
+		},
+		{
+			name:    "not the user's turn",
+			userID:  testBuyerID,
+			action:  models.OfferActionAccepted,
+			expect:  func(mock sqlmock.Sqlmock) { expectOffer(mock, models.OfferPending, "for_sale", false) },
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			userID:  testSellerID,
+			action:  models.OfferActionAccepted,
+			expect:  func(mock sqlmock.Sqlmock) { expectOffer(mock, models.OfferPending, "for_sale", true) },
+			wantErr: true,
+		},
+		{
+			name:    "accept a listing that is no longer for sale",
+			userID:  testSellerID,
+			action:  models.OfferActionAccepted,
+			expect:  func(mock sqlmock.Sqlmock) { expectOffer(mock, models.OfferPending, "sold", false) },
+			wantErr: true,
+		},
+		{
+			name:   "another buyer is already promised the listing",
+			userID: testSellerID,
+			action: models.OfferActionAccepted,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOffer(mock, models.OfferPending, "for_sale", false)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testListingID, testOfferID).
+					WillReturnRows(sqlmock.NewRows([]string{"promised"}).AddRow(true))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			tt.expect(mock)
+			if tt.wantErr {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			got, err := NewUserRepository(db).respondToOffer(context.Background(), tt.userID, testOfferID, tt.action, tt.price, 24)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("respondToOffer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := tt.want
+			want.OfferID, want.ListingID, want.BuyerID, want.SellerID = testOfferID, testListingID, testBuyerID, testSellerID
+			want.Action, want.ActorID = tt.action, tt.userID
+			if !sameOfferUpdate(*got, want) {
+				t.Errorf("update = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestReinstateCompetingOffers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	offerRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "seller_id", "offered_price"})
+	}
+	mock.ExpectQuery(`o.status = 'suspended' AND o.suspended_from = \?`).
+		WithArgs(testListingID, models.OfferPending).
+		WillReturnRows(offerRows().AddRow(22, testListingID, 11, testSellerID, 90.0))
+	mock.ExpectExec(`UPDATE offers SET\s+expires_at = expires_at \+ INTERVAL TIMESTAMPDIFF\(SECOND, suspended_at, NOW\(\)\) SECOND,\s+suspended_from = NULL, suspended_at = NULL, status = \?`).
+		WithArgs(models.OfferPending, 22).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectHistory(mock, 22, nil, models.OfferRoleSystem, models.OfferActionReinstated, 90.0)
+	mock.ExpectQuery(`o.status = 'suspended' AND o.suspended_from = \?`).
+		WithArgs(testListingID, models.OfferCountered).
+		WillReturnRows(offerRows().AddRow(23, testListingID, 12, testSellerID, 95.0))
+	mock.ExpectExec(`UPDATE offers SET\s+expires_at = expires_at`).
+		WithArgs(models.OfferCountered, 23).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectHistory(mock, 23, nil, models.OfferRoleSystem, models.OfferActionReinstated, 95.0)
+
+	got, err := reinstateCompetingOffers(context.Background(), db, testListingID)
+	if err != nil {
+		t.Fatalf("reinstateCompetingOffers: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	want := []models.OfferUpdate{
+		{OfferID: 22, ListingID: testListingID, BuyerID: 11, SellerID: testSellerID, Price: 90, Status: models.OfferPending, Action: models.OfferActionReinstated},
+		{OfferID: 23, ListingID: testListingID, BuyerID: 12, SellerID: testSellerID, Price: 95, Status: models.OfferCountered, Action: models.OfferActionReinstated},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("reinstated = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !sameOfferUpdate(got[i], want[i]) {
+			t.Errorf("reinstated[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// sameOfferUpdate compares two updates and the offers they moved
+func sameOfferUpdate(a models.OfferUpdate, b models.OfferUpdate) bool {
+	if len(a.Competing) != len(b.Competing) {
+		return false
+	}
+	for i := range a.Competing {
+		if !sameOfferUpdate(a.Competing[i], b.Competing[i]) {
+			return false
+		}
+	}
+	a.Competing, b.Competing = nil, nil
+	return a.OfferID == b.OfferID && a.ListingID == b.ListingID && a.BuyerID == b.BuyerID &&
+		a.SellerID == b.SellerID && a.Price == b.Price && a.Status == b.Status &&
+		a.Action == b.Action && a.ActorID == b.ActorID && a.Automatic == b.Automatic
+}
@@ -0,0 +1,202 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"used2book-backend/internal/models"
+)
+
+// A delivery stuck in 'processing' longer than this is assumed to have died
+// mid-way (its transaction rolled back) and may be claimed again.
+const webhookProcessingTimeoutMinutes = 5
+
+var webhookEventSortKeys = map[string]string{
+	"received_at": "w.received_at",
+}
+
+type WebhookEventRepository struct {
+	txRunner
+}
+
+func NewWebhookEventRepository(db *sql.DB) *WebhookEventRepository {
+	if db == nil {
+		log.Fatal("database connection is nil")
+	}
+	return &WebhookEventRepository{txRunner{db}}
+}
+
+// RecordEvent stores a webhook delivery in the ledger and tries to claim it for
+// processing. claimed is false when the event was already processed, or is
+// being processed right now by another delivery; the caller should then
+// acknowledge it without doing anything.
+func (wr *WebhookEventRepository) RecordEvent(ctx context.Context, provider string, eventID string, eventType string, payload []byte) (event *models.WebhookEvent, claimed bool, err error) {
+	query := `
+        INSERT INTO webhook_events (provider, event_id, event_type, payload, status, attempts)
+        VALUES (?, ?, ?, ?, 'processing', 1)
+        ON DUPLICATE KEY UPDATE id = id
+    `
+	result, err := wr.db.ExecContext(ctx, query, provider, eventID, eventType, string(payload))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+
+	// 1 row affected means a fresh insert, 0 means we've seen this event before
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+
+	var id int
+	err = wr.db.QueryRowContext(ctx, `SELECT id FROM webhook_events WHERE provider = ? AND event_id = ?`, provider, eventID).Scan(&id)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load webhook event: %w", err)
+	}
+
+	claimed = inserted == 1
+	if !claimed {
+		if claimed, err = wr.ClaimEvent(ctx, id); err != nil {
+			return nil, false, err
+		}
+	}
+
+	event, err = wr.GetEventByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	return event, claimed, nil
+}
+
+// ClaimEvent moves a failed (or abandoned) event back to 'processing' so it can
+// be run again. It returns false if the event is processed or in flight.
+func (wr *WebhookEventRepository) ClaimEvent(ctx context.Context, id int) (bool, error) {
+	query := `
+        UPDATE webhook_events
+        SET status = 'processing', attempts = attempts + 1, last_error = NULL
+        WHERE id = ?
+        AND (status = 'failed'
+             OR (status = 'processing' AND updated_at < NOW() - INTERVAL ? MINUTE))
+    `
+	result, err := wr.db.ExecContext(ctx, query, id, webhookProcessingTimeoutMinutes)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// MarkEventProcessed records a successful run. Call it with the processing
+// transaction's ctx so the outcome commits together with the side effects.
+func (wr *WebhookEventRepository) MarkEventProcessed(ctx context.Context, id int) error {
+	query := `UPDATE webhook_events SET status = 'processed', processed_at = NOW() WHERE id = ?`
+	_, err := conn(ctx, wr.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook event processed: %w", err)
+	}
+	return nil
+}
+
+// MarkEventFailed records why processing failed, leaving the event replayable
+func (wr *WebhookEventRepository) MarkEventFailed(ctx context.Context, id int, reason string) error {
+	query := `UPDATE webhook_events SET status = 'failed', last_error = ? WHERE id = ?`
+	_, err := wr.db.ExecContext(ctx, query, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook event failed: %w", err)
+	}
+	return nil
+}
+
+// GetEventByID returns a ledger entry with its raw payload, or nil if not found
+func (wr *WebhookEventRepository) GetEventByID(ctx context.Context, id int) (*models.WebhookEvent, error) {
+	query := `
+        SELECT id, provider, event_id, event_type, payload, status, attempts,
+               last_error, received_at, processed_at
+        FROM webhook_events
+        WHERE id = ?
+    `
+	var e models.WebhookEvent
+	var payload string
+	var lastError sql.NullString
+	var processedAt sql.NullTime
+	err := wr.db.QueryRowContext(ctx, query, id).Scan(
+		&e.ID, &e.Provider, &e.EventID, &e.EventType, &payload, &e.Status, &e.Attempts,
+		&lastError, &e.ReceivedAt, &processedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching webhook event: %w", err)
+	}
+
+	e.Payload = []byte(payload)
+	if lastError.Valid {
+		e.LastError = &lastError.String
+	}
+	if processedAt.Valid {
+		e.ProcessedAt = &processedAt.Time
+	}
+	return &e, nil
+}
+
+// ListEvents returns one page of ledger entries, newest first by default,
+// optionally filtered by status. Payloads are left out of the list.
+func (wr *WebhookEventRepository) ListEvents(ctx context.Context, status string, page models.PageRequest) ([]models.WebhookEvent, *models.PageInfo, error) {
+	kp, err := newKeysetPage(page, webhookEventSortKeys, "received_at", "w.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+        SELECT w.id, w.provider, w.event_id, w.event_type, w.status, w.attempts,
+               w.last_error, w.received_at, w.processed_at, ` + kp.SortValue + `
+        FROM webhook_events w
+        WHERE 1 = 1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND w.status = ?`
+		args = append(args, status)
+	}
+	query += kp.Where + ` ORDER BY ` + kp.OrderBy + ` LIMIT ?`
+	args = append(args, kp.Args...)
+	args = append(args, kp.LimitArg())
+
+	rows, err := wr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying webhook events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.WebhookEvent
+	var sortValues []string
+	var ids []int
+	for rows.Next() {
+		var e models.WebhookEvent
+		var lastError sql.NullString
+		var processedAt sql.NullTime
+		var sortValue string
+		if err := rows.Scan(&e.ID, &e.Provider, &e.EventID, &e.EventType, &e.Status, &e.Attempts,
+			&lastError, &e.ReceivedAt, &processedAt, &sortValue); err != nil {
+			return nil, nil, fmt.Errorf("error scanning webhook event: %w", err)
+		}
+		if lastError.Valid {
+			e.LastError = &lastError.String
+		}
+		if processedAt.Valid {
+			e.ProcessedAt = &processedAt.Time
+		}
+		events = append(events, e)
+		sortValues = append(sortValues, sortValue)
+		ids = append(ids, e.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	events, info := trimPage(kp, events, sortValues, ids)
+	return events, info, nil
+}
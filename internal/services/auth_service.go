@@ -23,7 +23,7 @@ func (as *AuthService) Signup(ctx context.Context, reqUser models.AuthUser) (*mo
 	if err != nil {
 		return nil, err
 	}
-	log.Println("user provider %s", reqUser.Provider)
+	log.Printf("user provider %s", reqUser.Provider)
 	if existing != nil {
 		return nil, fmt.Errorf("user already exists")
 	}
@@ -71,7 +71,7 @@ func (as *AuthService) Login(ctx context.Context, reqUser models.AuthUser) (*mod
 	}
 
 	if user == nil {
-		return nil, fmt.Errorf("there is no this account: ", reqUser.Email)
+		return nil, fmt.Errorf("there is no this account: %s", reqUser.Email)
 	}
 
 	// Verify the password
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+
+	"github.com/omise/omise-go"
+)
+
+// ErrInvalidBankAccount wraps validation failures of a payout account request
+var ErrInvalidBankAccount = errors.New("invalid bank account")
+
+// ErrPayoutAccountsUnavailable is returned when Omise isn't configured, since
+// payout accounts can't be stored without a recipient to hold the number
+var ErrPayoutAccountsUnavailable = errors.New("payout accounts are not available")
+
+// omiseBankCodes maps the bank names sellers enter to Omise bank brand codes
+var omiseBankCodes = map[string]string{
+	"bangkok bank":            "bbl",
+	"kasikorn bank":           "kbank",
+	"kasikornbank":            "kbank",
+	"krung thai bank":         "ktb",
+	"siam commercial bank":    "scb",
+	"bank of ayudhya":         "bay",
+	"krungsri":                "bay",
+	"tmbthanachart":           "ttb",
+	"ttb":                     "ttb",
+	"government savings bank": "gsb",
+	"cimb thai":               "cimb",
+	"uob":                     "uob",
+	"kiatnakin phatra":        "kk",
+	"tisco":                   "tisco",
+	"land and houses":         "lhb",
+}
+
+// BankAccountService manages sellers' payout accounts. Each account is backed
+// by an Omise recipient, whose verification decides whether it can be paid.
+type BankAccountService struct {
+	userRepo *mysql.UserRepository
+	omise    *OmiseService // nil when Omise isn't configured
+}
+
+func NewBankAccountService(repo *mysql.UserRepository) *BankAccountService {
+	bs := &BankAccountService{userRepo: repo}
+	if os.Getenv("OMISE_SECRET_KEY") != "" {
+		bs.omise = NewOmiseService()
+	}
+	return bs
+}
+
+// ListBankAccounts returns the user's payout accounts, first refreshing any
+// whose verification is still pending
+func (bs *BankAccountService) ListBankAccounts(ctx context.Context, userID int) ([]models.BankAccount, error) {
+	accounts, err := bs.userRepo.GetBankAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		bs.refreshVerification(ctx, &accounts[i])
+	}
+	return accounts, nil
+}
+
+// CreateBankAccount registers an Omise recipient for the account and stores
+// the account with its masked number
+func (bs *BankAccountService) CreateBankAccount(ctx context.Context, userID int, req models.BankAccountRequest) (*models.BankAccount, error) {
+	if bs.omise == nil {
+		return nil, ErrPayoutAccountsUnavailable
+	}
+	number, err := validateBankAccountRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientID, err := bs.omise.CreateRecipient(number, req.AccountHolderName, omiseBankCode(req.BankName))
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.BankAccount{
+		UserID:              userID,
+		BankName:            req.BankName,
+		AccountNumberMasked: maskAccountNumber(number),
+		AccountHolderName:   req.AccountHolderName,
+		OmiseRecipientID:    recipientID,
+		VerificationStatus:  models.BankAccountPending,
+	}
+	bs.applyRecipientStatus(account)
+
+	if account.ID, err = bs.userRepo.CreateBankAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// UpdateBankAccount changes an account's details, updating its Omise
+// recipient (or registering one for accounts that predate recipients).
+// Changed bank details have to be verified again. It returns nil if the user
+// has no account with that ID.
+func (bs *BankAccountService) UpdateBankAccount(ctx context.Context, userID int, accountID int, req models.BankAccountRequest) (*models.BankAccount, error) {
+	if bs.omise == nil {
+		return nil, ErrPayoutAccountsUnavailable
+	}
+	number, err := validateBankAccountRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := bs.userRepo.GetBankAccountByID(ctx, userID, accountID)
+	if err != nil || account == nil {
+		return nil, err
+	}
+
+	bankCode := omiseBankCode(req.BankName)
+	if account.OmiseRecipientID != "" {
+		account.OmiseRecipientID, err = bs.omise.UpdateRecipient(account.OmiseRecipientID, number, req.AccountHolderName, bankCode)
+	} else {
+		account.OmiseRecipientID, err = bs.omise.CreateRecipient(number, req.AccountHolderName, bankCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account.BankName = req.BankName
+	account.AccountNumberMasked = maskAccountNumber(number)
+	account.AccountHolderName = req.AccountHolderName
+	account.VerificationStatus = models.BankAccountPending
+	account.VerifiedAt = nil
+	bs.applyRecipientStatus(account)
+
+	if err := bs.userRepo.UpdateBankAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// DeleteBankAccount removes an account and its Omise recipient. It returns
+// false if the user has no account with that ID.
+func (bs *BankAccountService) DeleteBankAccount(ctx context.Context, userID int, accountID int) (bool, error) {
+	account, err := bs.userRepo.GetBankAccountByID(ctx, userID, accountID)
+	if err != nil || account == nil {
+		return false, err
+	}
+
+	if account.OmiseRecipientID != "" && bs.omise != nil {
+		if err := bs.omise.DeleteRecipient(account.OmiseRecipientID); err != nil {
+			// The local account goes regardless; an orphaned recipient is harmless
+			log.Println("⚠️  DeleteRecipient Error:", err)
+		}
+	}
+	return bs.userRepo.DeleteBankAccount(ctx, userID, accountID)
+}
+
+// HasVerifiedPayoutAccount reports whether the user can be paid out, checking
+// pending accounts with Omise first
+func (bs *BankAccountService) HasVerifiedPayoutAccount(ctx context.Context, userID int) (bool, error) {
+	accounts, err := bs.ListBankAccounts(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, account := range accounts {
+		if account.VerificationStatus == models.BankAccountVerified {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// refreshVerification asks Omise whether a pending recipient has been
+// verified yet and stores the outcome
+func (bs *BankAccountService) refreshVerification(ctx context.Context, account *models.BankAccount) {
+	if bs.omise == nil || account.OmiseRecipientID == "" || account.VerificationStatus != models.BankAccountPending {
+		return
+	}
+
+	recipient, err := bs.omise.GetRecipient(account.OmiseRecipientID)
+	if err != nil {
+		log.Println("⚠️  GetRecipient Error:", err)
+		return
+	}
+	status := recipientStatus(recipient)
+	if status == account.VerificationStatus {
+		return
+	}
+
+	if err := bs.userRepo.UpdateBankAccountVerification(ctx, account.ID, status); err != nil {
+		log.Println("❌ UpdateBankAccountVerification Error:", err)
+		return
+	}
+	account.VerificationStatus = status
+	if status == models.BankAccountVerified {
+		now := time.Now()
+		account.VerifiedAt = &now
+	}
+}
+
+// applyRecipientStatus sets a freshly registered account's status from its
+// recipient; Omise test keys verify recipients immediately
+func (bs *BankAccountService) applyRecipientStatus(account *models.BankAccount) {
+	recipient, err := bs.omise.GetRecipient(account.OmiseRecipientID)
+	if err != nil {
+		log.Println("⚠️  GetRecipient Error:", err)
+		return
+	}
+	account.VerificationStatus = recipientStatus(recipient)
+	if account.VerificationStatus == models.BankAccountVerified {
+		now := time.Now()
+		account.VerifiedAt = &now
+	}
+}
+
+func recipientStatus(recipient *omise.Recipient) string {
+	switch {
+	case recipient.Verified && recipient.Active:
+		return models.BankAccountVerified
+	case recipient.FailureCode != nil:
+		return models.BankAccountRejected
+	default:
+		return models.BankAccountPending
+	}
+}
+
+// validateBankAccountRequest trims the request and returns the account number
+// with separators removed
+func validateBankAccountRequest(req *models.BankAccountRequest) (string, error) {
+	req.BankName = strings.TrimSpace(req.BankName)
+	req.AccountHolderName = strings.TrimSpace(req.AccountHolderName)
+	if req.BankName == "" || req.AccountHolderName == "" {
+		return "", fmt.Errorf("%w: bank_name and account_holder_name are required", ErrInvalidBankAccount)
+	}
+
+	number := strings.NewReplacer("-", "", " ", "").Replace(req.AccountNumber)
+	if len(number) < 10 || len(number) > 15 {
+		return "", fmt.Errorf("%w: account_number must be 10 to 15 digits", ErrInvalidBankAccount)
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("%w: account_number must be 10 to 15 digits", ErrInvalidBankAccount)
+		}
+	}
+	return number, nil
+}
+
+// maskAccountNumber keeps only the last four digits
+func maskAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("x", len(number)-4) + number[len(number)-4:]
+}
+
+func omiseBankCode(bankName string) string {
+	name := strings.ToLower(strings.TrimSpace(bankName))
+	if code, ok := omiseBankCodes[name]; ok {
+		return code
+	}
+	// Assume the seller picked the brand code itself, e.g. "kbank"
+	return name
+}
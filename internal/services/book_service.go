@@ -21,8 +21,8 @@ func NewBookService(bookRepo *mysql.BookRepository) *BookService {
 	return &BookService{bookRepo: bookRepo}
 }
 
-func (bs *BookService) GetAllBooks(ctx context.Context) ([]models.Book, error) {
-	return bs.bookRepo.GetAllBooks(ctx)
+func (bs *BookService) GetAllBooks(ctx context.Context, page models.PageRequest) ([]models.Book, *models.PageInfo, error) {
+	return bs.bookRepo.GetAllBooks(ctx, page)
 }
 
 
@@ -30,6 +30,11 @@ func (bs *BookService) GetBookByID(ctx context.Context, bookID int) (*models.Boo
 	return bs.bookRepo.GetBookByID(ctx, bookID)
 }
 
+// SearchBooks runs a full-text search with filters and facet counts
+func (bs *BookService) SearchBooks(ctx context.Context, params models.BookSearchParams) (*models.BookSearchResult, error) {
+	return bs.bookRepo.SearchBooks(ctx, params)
+}
+
 func (bs *BookService) GetAllBookGenres(ctx context.Context) ([]models.BookGenre, error) {
 	return bs.bookRepo.GetAllBookGenres(ctx)
 }
@@ -77,8 +82,8 @@ func (bs *BookService) AddBookReview(ctx context.Context, userID int, bookID int
 	return bs.bookRepo.AddBookReview(ctx, userID, bookID, rating, comment)
 }
 
-func (bs *BookService) GetReviewsByBookID(ctx context.Context, bookID int) ([]models.BookReview, error) {
-	return bs.bookRepo.GetReviewsByBookID(ctx, bookID)
+func (bs *BookService) GetReviewsByBookID(ctx context.Context, bookID int, page models.PageRequest) ([]models.BookReview, *models.PageInfo, error) {
+	return bs.bookRepo.GetReviewsByBookID(ctx, bookID, page)
 }
 
 func (bs *BookService) GetReviewsByUserID(ctx context.Context, bookID int) ([]models.BookReview, error) {
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const (
+	// defaultDisputeWindowDays is how long after completion a buyer can still
+	// dispute an order (DISPUTE_WINDOW_DAYS)
+	defaultDisputeWindowDays = 14
+	maxDisputeTextLength     = 5000
+)
+
+var (
+	// ErrDisputeNotFound is returned for a dispute that doesn't exist or that
+	// the user isn't a party to
+	ErrDisputeNotFound = errors.New("dispute not found")
+	// ErrDisputeNotAllowed is returned when the order can't be disputed
+	ErrDisputeNotAllowed = errors.New("order can't be disputed")
+	// ErrDisputeResolved is returned for changes to a resolved dispute
+	ErrDisputeResolved = errors.New("dispute is already resolved")
+	// ErrInvalidDisputeRequest wraps validation failures
+	ErrInvalidDisputeRequest = errors.New("invalid dispute request")
+)
+
+// DisputeService runs the buyer–seller dispute workflow. Every step is
+// written to the dispute's message thread; an admin's resolution refunds the
+// buyer through the payment provider and settles the order and its escrow.
+type DisputeService struct {
+	disputeRepo *mysql.DisputeRepository
+	orderRepo   *mysql.OrderRepository
+	escrow      *EscrowService
+	providers   *PaymentProviderRegistry
+	windowDays  int
+}
+
+func NewDisputeService(repo *mysql.DisputeRepository, orderRepo *mysql.OrderRepository, escrow *EscrowService, providers *PaymentProviderRegistry) *DisputeService {
+	ds := &DisputeService{
+		disputeRepo: repo,
+		orderRepo:   orderRepo,
+		escrow:      escrow,
+		providers:   providers,
+		windowDays:  defaultDisputeWindowDays,
+	}
+	if v := os.Getenv("DISPUTE_WINDOW_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			log.Printf("⚠️  Invalid DISPUTE_WINDOW_DAYS %q, using %d", v, defaultDisputeWindowDays)
+		} else {
+			ds.windowDays = days
+		}
+	}
+	return ds
+}
+
+// Open lets the buyer dispute a shipped, delivered or recently completed
+// order. The order is held in 'disputed' and its unpaid funds are frozen.
+func (ds *DisputeService) Open(ctx context.Context, buyerID int, req models.OpenDisputeRequest, imageURLs []string) (*models.Dispute, error) {
+	description := strings.TrimSpace(req.Description)
+	if !models.IsValidDisputeReason(req.Reason) {
+		return nil, fmt.Errorf("%w: reason must be not_received, damaged, not_as_described or other", ErrInvalidDisputeRequest)
+	}
+	if description == "" || len(description) > maxDisputeTextLength {
+		return nil, fmt.Errorf("%w: description is required and must be at most %d characters", ErrInvalidDisputeRequest, maxDisputeTextLength)
+	}
+
+	order, err := ds.orderRepo.GetOrderByID(ctx, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.BuyerID != buyerID {
+		return nil, ErrOrderNotFound
+	}
+	exists, err := ds.disputeRepo.ExistsForOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: it has already been disputed", ErrDisputeNotAllowed)
+	}
+
+	var disputeID int
+	err = ds.disputeRepo.RunInTx(ctx, func(ctx context.Context) error {
+		ok, err := ds.orderRepo.OpenDispute(ctx, order.ID, buyerID, ds.windowDays)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: only shipped orders, or orders completed in the last %d days, can be disputed", ErrDisputeNotAllowed, ds.windowDays)
+		}
+		if err := ds.escrow.DisputeTransactionFunds(ctx, order.TransactionID); err != nil {
+			return err
+		}
+		disputeID, err = ds.disputeRepo.CreateDispute(ctx, order, req.Reason, description)
+		if err != nil {
+			return err
+		}
+		return ds.disputeRepo.AddMessage(ctx, disputeID, buyerID, models.DisputeRoleBuyer, models.DisputeActionOpened, description, imageURLs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+}
+
+func (ds *DisputeService) ListDisputes(ctx context.Context, userID int, status string, page models.PageRequest) ([]models.Dispute, *models.PageInfo, error) {
+	return ds.disputeRepo.ListDisputes(ctx, userID, status, page)
+}
+
+// GetDispute returns a dispute the user is the buyer or seller in
+func (ds *DisputeService) GetDispute(ctx context.Context, disputeID int, userID int) (*models.Dispute, error) {
+	d, err := ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || (d.BuyerID != userID && d.SellerID != userID) {
+		return nil, ErrDisputeNotFound
+	}
+	return d, nil
+}
+
+// GetDisputeForAdmin returns any dispute
+func (ds *DisputeService) GetDisputeForAdmin(ctx context.Context, disputeID int) (*models.Dispute, error) {
+	d, err := ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrDisputeNotFound
+	}
+	return d, nil
+}
+
+// Reply adds the buyer's or seller's message to an unresolved dispute. The
+// seller's first reply marks the dispute responded.
+func (ds *DisputeService) Reply(ctx context.Context, disputeID int, userID int, body string, imageURLs []string) (*models.Dispute, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > maxDisputeTextLength {
+		return nil, fmt.Errorf("%w: body is required and must be at most %d characters", ErrInvalidDisputeRequest, maxDisputeTextLength)
+	}
+
+	d, err := ds.GetDispute(ctx, disputeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == models.DisputeResolved {
+		return nil, ErrDisputeResolved
+	}
+
+	role, action := models.DisputeRoleBuyer, models.DisputeActionCommented
+	if userID == d.SellerID {
+		role = models.DisputeRoleSeller
+		if d.Status == models.DisputeOpen {
+			action = models.DisputeActionResponded
+		}
+	}
+
+	err = ds.disputeRepo.RunInTx(ctx, func(ctx context.Context) error {
+		if action == models.DisputeActionResponded {
+			if err := ds.disputeRepo.MarkResponded(ctx, disputeID); err != nil {
+				return err
+			}
+		}
+		return ds.disputeRepo.AddMessage(ctx, disputeID, userID, role, action, body, imageURLs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+}
+
+// AddAdminNote adds an admin's message to an unresolved dispute
+func (ds *DisputeService) AddAdminNote(ctx context.Context, disputeID int, adminID int, body string) (*models.Dispute, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > maxDisputeTextLength {
+		return nil, fmt.Errorf("%w: body is required and must be at most %d characters", ErrInvalidDisputeRequest, maxDisputeTextLength)
+	}
+
+	d, err := ds.GetDisputeForAdmin(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == models.DisputeResolved {
+		return nil, ErrDisputeResolved
+	}
+
+	if err := ds.disputeRepo.AddMessage(ctx, disputeID, adminID, models.DisputeRoleAdmin, models.DisputeActionCommented, body, nil); err != nil {
+		return nil, err
+	}
+	return ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+}
+
+// Resolve settles a dispute. A full refund returns the whole order amount to
+// the buyer and closes the order as refunded; a partial refund returns part
+// of it and completes the order; a rejection completes the order as is. The
+// seller is paid whatever isn't refunded.
+func (ds *DisputeService) Resolve(ctx context.Context, disputeID int, adminID int, req models.ResolveDisputeRequest) (*models.Dispute, error) {
+	d, err := ds.GetDisputeForAdmin(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == models.DisputeResolved {
+		return nil, ErrDisputeResolved
+	}
+
+	var refundAmount float64
+	switch req.Resolution {
+	case models.DisputeFullRefund:
+		refundAmount = d.OrderAmount
+	case models.DisputePartialRefund:
+		if req.RefundAmount <= 0 || req.RefundAmount >= d.OrderAmount {
+			return nil, fmt.Errorf("%w: refund_amount must be more than 0 and less than %.2f", ErrInvalidDisputeRequest, d.OrderAmount)
+		}
+		refundAmount = req.RefundAmount
+	case models.DisputeRejected:
+	default:
+		return nil, fmt.Errorf("%w: resolution must be full_refund, partial_refund or rejected", ErrInvalidDisputeRequest)
+	}
+	note := strings.TrimSpace(req.Note)
+	if len(note) > maxDisputeTextLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrInvalidDisputeRequest, maxDisputeTextLength)
+	}
+	if note == "" {
+		note = "Resolved: " + req.Resolution
+	}
+
+	order, err := ds.orderRepo.GetOrderByID(ctx, d.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	var provider PaymentProvider
+	if refundAmount > 0 {
+		if provider, err = ds.providers.Get(order.PaymentProvider); err != nil {
+			return nil, err
+		}
+		if order.PaymentReference == "" {
+			return nil, fmt.Errorf("order %d has no payment reference to refund", order.ID)
+		}
+	}
+
+	paidOut, err := ds.escrow.IsTransactionPaidOut(ctx, order.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The refund goes last so a failure rolls the resolution back
+	err = ds.disputeRepo.RunInTx(ctx, func(ctx context.Context) error {
+		ok, err := ds.disputeRepo.ResolveDispute(ctx, disputeID, adminID, req.Resolution, refundAmount)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDisputeResolved
+		}
+
+		if req.Resolution == models.DisputeFullRefund {
+			ok, err = ds.orderRepo.RefundDisputedOrder(ctx, order)
+			if err == nil && ok {
+				err = ds.escrow.RefundTransactionFunds(ctx, order.TransactionID)
+			}
+		} else {
+			ok, err = ds.orderRepo.SettleDisputedOrder(ctx, order, refundAmount)
+			if err == nil && ok {
+				err = ds.escrow.ReleaseDisputedFunds(ctx, order.TransactionID, refundAmount)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrOrderTransition
+		}
+
+		if err := ds.disputeRepo.AddMessage(ctx, disputeID, adminID, models.DisputeRoleAdmin, models.DisputeActionResolved, note, nil); err != nil {
+			return err
+		}
+		if provider == nil {
+			return nil
+		}
+		return provider.Refund(ctx, order.PaymentReference, refundAmount)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if paidOut && refundAmount > 0 {
+		// The seller already has the money; recovering it is manual
+		log.Printf("⚠️  Dispute %d refunded %.2f after order %d was paid out to the seller", disputeID, refundAmount, order.ID)
+	}
+	return ds.disputeRepo.GetDisputeByID(ctx, disputeID)
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	testDisputeID     = 4
+	testOrderID       = 8
+	testTransactionID = 15
+	testAdminID       = 1
+)
+
+// expectDispute expects GetDisputeByID for testDisputeID in status
+func expectDispute(mock sqlmock.Sqlmock, status string) {
+	now := time.Now()
+	mock.ExpectQuery(`FROM disputes d\s+JOIN orders o`).
+		WithArgs(testDisputeID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "order_id", "transaction_id", "buyer_id", "seller_id",
+			"reason", "description", "status", "resolution", "refund_amount", "resolved_by", "resolved_at",
+			"amount", "title", "created_at", "updated_at",
+		}).AddRow(
+			testDisputeID, testOrderID, testTransactionID, 9, 5,
+			models.DisputeReasonDamaged, "Cover torn", status, nil, nil, nil, nil,
+			120.0, "Dune", now, now,
+		))
+	mock.ExpectQuery(`FROM dispute_messages m`).
+		WithArgs(testDisputeID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "dispute_id", "author_id", "author_role", "action", "body", "created_at", "images"}))
+}
+
+// expectOrder expects GetOrderByID for testOrderID, paid through the fake
+// provider under reference
+func expectOrder(mock sqlmock.Sqlmock, reference string) {
+	now := time.Now()
+	mock.ExpectQuery(`FROM orders o\s+JOIN transactions t`).
+		WithArgs(testOrderID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "transaction_id", "listing_id", "buyer_id", "seller_id",
+			"amount", "status", "carrier", "tracking_number", "cancel_reason",
+			"title", "image_url",
+			"shipped_at", "delivered_at", "completed_at", "cancelled_at", "auto_complete_at",
+			"created_at", "updated_at", "payment_provider", "payment_reference",
+		}).AddRow(
+			testOrderID, testTransactionID, 3, 9, 5,
+			120.0, "disputed", nil, nil, nil,
+			"Dune", "",
+			now, nil, nil, nil, nil,
+			now, now, models.PaymentProviderFake, reference,
+		))
+}
+
+func TestResolveDispute(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.ResolveDisputeRequest
+		expect  func(mock sqlmock.Sqlmock, reference string)
+		wantErr error
+		// wantStatus is the fake payment's status afterwards
+		wantStatus string
+	}{
+		{
+			name: "full refund",
+			req:  models.ResolveDisputeRequest{Resolution: models.DisputeFullRefund},
+			expect: func(mock sqlmock.Sqlmock, reference string) {
+				expectDispute(mock, models.DisputeResponded)
+				expectOrder(mock, reference)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testTransactionID).
+					WillReturnRows(sqlmock.NewRows([]string{"paid_out"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE disputes\s+SET status = 'resolved'`).
+					WithArgs(models.DisputeFullRefund, 120.0, testAdminID, testDisputeID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders SET status = 'refunded'`).
+					WithArgs(testOrderID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE transactions\s+SET payment_status = 'refunded'`).
+					WithArgs(testTransactionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE escrow_entries SET status = 'refunded'`).
+					WithArgs(testTransactionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO dispute_messages`).
+					WithArgs(testDisputeID, testAdminID, models.DisputeRoleAdmin, models.DisputeActionResolved, "Resolved: full_refund").
+					WillReturnResult(sqlmock.NewResult(30, 1))
+				mock.ExpectCommit()
+				expectDispute(mock, models.DisputeResolved)
+			},
+			wantStatus: models.PaymentStatusRefunded,
+		},
+		{
+			name: "partial refund",
+			req:  models.ResolveDisputeRequest{Resolution: models.DisputePartialRefund, RefundAmount: 30, Note: "  Keep the book  "},
+			expect: func(mock sqlmock.Sqlmock, reference string) {
+				expectDispute(mock, models.DisputeOpen)
+				expectOrder(mock, reference)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testTransactionID).
+					WillReturnRows(sqlmock.NewRows([]string{"paid_out"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE disputes\s+SET status = 'resolved'`).
+					WithArgs(models.DisputePartialRefund, 30.0, testAdminID, testDisputeID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders\s+SET status = 'completed'`).
+					WithArgs(testOrderID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE transactions\s+SET payment_status = 'partially_refunded'`).
+					WithArgs(30.0, testTransactionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE escrow_entries\s+SET status = 'released'`).
+					WithArgs(30.0, testTransactionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO dispute_messages`).
+					WithArgs(testDisputeID, testAdminID, models.DisputeRoleAdmin, models.DisputeActionResolved, "Keep the book").
+					WillReturnResult(sqlmock.NewResult(30, 1))
+				mock.ExpectCommit()
+				expectDispute(mock, models.DisputeResolved)
+			},
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+		{
+			name: "rejected releases the funds without a refund",
+			req:  models.ResolveDisputeRequest{Resolution: models.DisputeRejected},
+			expect: func(mock sqlmock.Sqlmock, reference string) {
+				expectDispute(mock, models.DisputeResponded)
+				expectOrder(mock, reference)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testTransactionID).
+					WillReturnRows(sqlmock.NewRows([]string{"paid_out"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE disputes\s+SET status = 'resolved'`).
+					WithArgs(models.DisputeRejected, 0.0, testAdminID, testDisputeID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders\s+SET status = 'completed'`).
+					WithArgs(testOrderID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE escrow_entries\s+SET status = 'released'`).
+					WithArgs(0.0, testTransactionID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO dispute_messages`).
+					WithArgs(testDisputeID, testAdminID, models.DisputeRoleAdmin, models.DisputeActionResolved, "Resolved: rejected").
+					WillReturnResult(sqlmock.NewResult(30, 1))
+				mock.ExpectCommit()
+				expectDispute(mock, models.DisputeResolved)
+			},
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+		{
+			name: "failed refund rolls the resolution back",
+			req:  models.ResolveDisputeRequest{Resolution: models.DisputeFullRefund},
+			expect: func(mock sqlmock.Sqlmock, reference string) {
+				expectDispute(mock, models.DisputeResponded)
+				expectOrder(mock, "fake_unknown")
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testTransactionID).
+					WillReturnRows(sqlmock.NewRows([]string{"paid_out"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE disputes\s+SET status = 'resolved'`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders SET status = 'refunded'`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE transactions\s+SET payment_status = 'refunded'`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE escrow_entries SET status = 'refunded'`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO dispute_messages`).
+					WillReturnResult(sqlmock.NewResult(30, 1))
+				mock.ExpectRollback()
+			},
+			wantErr:    errAny,
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+		{
+			name: "order no longer disputed",
+			req:  models.ResolveDisputeRequest{Resolution: models.DisputeRejected},
+			expect: func(mock sqlmock.Sqlmock, reference string) {
+				expectDispute(mock, models.DisputeOpen)
+				expectOrder(mock, reference)
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(testTransactionID).
+					WillReturnRows(sqlmock.NewRows([]string{"paid_out"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE disputes\s+SET status = 'resolved'`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders\s+SET status = 'completed'`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantErr:    ErrOrderTransition,
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+		{
+			name:       "already resolved",
+			req:        models.ResolveDisputeRequest{Resolution: models.DisputeFullRefund},
+			expect:     func(mock sqlmock.Sqlmock, reference string) { expectDispute(mock, models.DisputeResolved) },
+			wantErr:    ErrDisputeResolved,
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+		{
+			name:       "partial refund of the whole amount",
+			req:        models.ResolveDisputeRequest{Resolution: models.DisputePartialRefund, RefundAmount: 120},
+			expect:     func(mock sqlmock.Sqlmock, reference string) { expectDispute(mock, models.DisputeOpen) },
+			wantErr:    ErrInvalidDisputeRequest,
+			wantStatus: models.PaymentStatusSucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			fake := NewFakePaymentProvider("")
+			session, err := fake.CreateCheckout(context.Background(), models.CheckoutSessionRequest{
+				Items:            []models.CheckoutLineItem{{ListingID: 3, Title: "Dune", Amount: 120}},
+				ExpiresInMinutes: 30,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fake.EventPayload(session.SessionID, models.PaymentEventSucceeded); err != nil {
+				t.Fatal(err)
+			}
+			providers := NewPaymentProviderRegistry(models.PaymentProviderFake)
+			providers.Register(fake)
+			ds := NewDisputeService(mysql.NewDisputeRepository(db), mysql.NewOrderRepository(db),
+				NewEscrowService(mysql.NewEscrowRepository(db)), providers)
+
+			tt.expect(mock, session.SessionID)
+
+			d, err := ds.Resolve(context.Background(), testDisputeID, testAdminID, tt.req)
+			switch {
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("Resolve succeeded, want error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Resolve: %v", err)
+			case tt.wantErr == nil && d.Status != models.DisputeResolved:
+				t.Errorf("dispute status = %q", d.Status)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if status, _ := fake.GetStatus(context.Background(), session.SessionID); status != tt.wantStatus {
+				t.Errorf("payment status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in table tests
+var errAny = errors.New("any error")
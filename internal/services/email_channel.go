@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const defaultFrontendURL = "http://localhost:3000"
+
+// NotificationChannel delivers stored notifications outside the app
+type NotificationChannel interface {
+	// Name is the models.NotificationChannel* the channel delivers on
+	Name() string
+	// Accepts reports whether the channel has something to say about n
+	Accepts(n models.Notification) bool
+	// Deliver sends n to its recipient. Notifications the channel doesn't
+	// accept are ignored.
+	Deliver(ctx context.Context, n models.Notification) error
+}
+
+// EmailChannel emails the notifications worth an email in the recipient's
+// language. It can also collect them into a daily digest.
+type EmailChannel struct {
+	mailer           Mailer
+	templates        *EmailTemplates
+	notificationRepo *mysql.NotificationRepository
+	// frontendURL is where links in emails point
+	frontendURL string
+}
+
+func NewEmailChannel(mailer Mailer, templates *EmailTemplates, repo *mysql.NotificationRepository) *EmailChannel {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = defaultFrontendURL
+	}
+	return &EmailChannel{
+		mailer:           mailer,
+		templates:        templates,
+		notificationRepo: repo,
+		frontendURL:      strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+func (ec *EmailChannel) Name() string {
+	return models.NotificationChannelEmail
+}
+
+func (ec *EmailChannel) Deliver(ctx context.Context, n models.Notification) error {
+	name, data, err := ec.emailFor(n)
+	if err != nil || name == "" {
+		return err
+	}
+
+	return ec.send(ctx, n.UserID, name, data)
+}
+
+// DeliverDigest emails a user the notifications collected for their daily
+// digest in one message
+func (ec *EmailChannel) DeliverDigest(ctx context.Context, userID int, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	data := emailData{Link: ec.frontendURL}
+	for _, n := range notifications {
+		data.Items = append(data.Items, digestItem{Message: n.Message, CreatedAt: n.CreatedAt})
+	}
+	return ec.send(ctx, userID, "digest", data)
+}
+
+func (ec *EmailChannel) send(ctx context.Context, userID int, name string, data emailData) error {
+	recipient, err := ec.notificationRepo.GetRecipient(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if recipient.Email == "" {
+		return nil
+	}
+
+	data.Name = recipient.FirstName
+	msg, err := ec.templates.Render(name, recipient.Language, data)
+	if err != nil {
+		return err
+	}
+	msg.To = recipient.Email
+	return ec.mailer.Send(ctx, msg)
+}
+
+func (ec *EmailChannel) Accepts(n models.Notification) bool {
+	name, _, err := ec.emailFor(n)
+	return err == nil && name != ""
+}
+
+// emailFor picks the template for a notification and decodes its payload.
+// It returns no name for notifications that aren't emailed.
+func (ec *EmailChannel) emailFor(n models.Notification) (string, emailData, error) {
+	var data emailData
+	var name string
+	var payload interface{}
+
+	switch n.Type {
+	case models.NotificationOffer:
+		if err := json.Unmarshal(n.Data, &data.Offer); err != nil {
+			return "", data, fmt.Errorf("invalid offer notification data: %w", err)
+		}
+		switch data.Offer.Action {
+		case models.OfferActionOffered:
+			name = "offer_received"
+		case models.OfferActionAccepted:
+			name = "offer_accepted"
+		case models.OfferActionRejected:
+			name = "offer_rejected"
+		default:
+			return "", data, nil
+		}
+		data.Link = ec.listingLink(data.Offer.ListingID)
+		return name, data, nil
+	case models.NotificationPaymentSuccess:
+		name, payload = "payment_success", &data.Payment
+		data.Link = ec.frontendURL + "/user/account/purchase"
+	case models.NotificationPaymentReceived:
+		name, payload = "payment_received", &data.Payment
+	case models.NotificationReservationExpiring:
+		name, payload = "reservation_expiring", &data.Reservation
+	case models.NotificationWishlistMatch:
+		name, payload = "wishlist_match", &data.Wishlist
+	case models.NotificationPriceDrop:
+		name, payload = "price_drop", &data.Wishlist
+	case "order_" + models.OrderShipped:
+		name, payload = "order_shipped", &data.Order
+		data.Link = ec.frontendURL + "/user/account/purchase"
+	default:
+		if models.NotificationCategoryOf(n.Type) == "" {
+			return "", data, nil
+		}
+		// Anything else the user asked to be emailed about
+		data.Message = n.Message
+		data.Link = ec.frontendURL
+		return "notification", data, nil
+	}
+
+	if err := json.Unmarshal(n.Data, payload); err != nil {
+		return "", data, fmt.Errorf("invalid %s notification data: %w", n.Type, err)
+	}
+	switch {
+	case n.Type == models.NotificationReservationExpiring:
+		data.Link = ec.listingLink(data.Reservation.ListingID)
+	case n.Type == models.NotificationWishlistMatch, n.Type == models.NotificationPriceDrop:
+		data.Link = ec.listingLink(data.Wishlist.ListingID)
+	case n.Type == models.NotificationPaymentReceived && len(data.Payment.ListingIDs) == 1:
+		data.Link = ec.listingLink(data.Payment.ListingIDs[0])
+	}
+	return name, data, nil
+}
+
+func (ec *EmailChannel) listingLink(listingID int) string {
+	return fmt.Sprintf("%s/listing/%d", ec.frontendURL, listingID)
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"strings"
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func mustJSON(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestEmailChannelTemplates(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://used2book.test/")
+
+	templates, err := LoadEmailTemplates()
+	if err != nil {
+		t.Fatalf("LoadEmailTemplates: %v", err)
+	}
+
+	oldPrice := 350.0
+	carrier, tracking := "Kerry", "KEX123"
+	// 10:30 UTC is 17:30 in Bangkok; 17:05 UTC is already 00:05 the next day
+	expiresAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	afterMidnight := time.Date(2024, 5, 1, 17, 5, 0, 0, time.UTC)
+
+	type rendered struct {
+		subject string
+		text    []string
+	}
+	tests := []struct {
+		name   string
+		n      models.Notification
+		digest []models.Notification
+		link   string
+		want   map[string]rendered
+	}{
+		{
+			name: "offer_received",
+			n: models.Notification{Type: models.NotificationOffer, Data: mustJSON(t, models.OfferEventData{
+				ListingID: 12, Action: models.OfferActionOffered, Price: 250,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"New offer on your book", []string{"Hi Somchai,", "A buyer offered ฿250.00 for your book."}},
+				models.LanguageThai:    {"มีข้อเสนอใหม่สำหรับหนังสือของคุณ", []string{"สวัสดีคุณ Somchai", "มีผู้ซื้อเสนอราคา ฿250.00"}},
+			},
+		},
+		{
+			name: "offer_accepted",
+			n: models.Notification{Type: models.NotificationOffer, Data: mustJSON(t, models.OfferEventData{
+				ListingID: 12, Action: models.OfferActionAccepted, Price: 300, Automatic: true,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Offer accepted", []string{"The offer of ฿300.00 was accepted automatically."}},
+				models.LanguageThai:    {"ข้อเสนอได้รับการยอมรับแล้ว", []string{"ข้อเสนอราคา ฿300.00 ได้รับการยอมรับโดยอัตโนมัติแล้ว"}},
+			},
+		},
+		{
+			name: "offer_rejected",
+			n: models.Notification{Type: models.NotificationOffer, Data: mustJSON(t, models.OfferEventData{
+				ListingID: 12, Action: models.OfferActionRejected, Price: 100, Automatic: true, Reason: "below_minimum",
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Offer rejected", []string{"The offer of ฿100.00 was rejected automatically. It is below the seller"}},
+				models.LanguageThai:    {"ข้อเสนอถูกปฏิเสธ", []string{"ถูกปฏิเสธโดยอัตโนมัติ เนื่องจากต่ำกว่าราคาขั้นต่ำ"}},
+			},
+		},
+		{
+			name: "payment_success",
+			n: models.Notification{Type: models.NotificationPaymentSuccess, Data: mustJSON(t, models.PaymentEventData{
+				ListingIDs: []int{12, 13}, Amount: 480.5,
+			})},
+			link: "https://used2book.test/user/account/purchase",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Payment received, thank you!", []string{"We received your payment of ฿480.50 for 2 book(s)."}},
+				models.LanguageThai:    {"ชำระเงินสำเร็จ ขอบคุณค่ะ", []string{"฿480.50 สำหรับหนังสือ 2 เล่มแล้ว"}},
+			},
+		},
+		{
+			name: "payment_received for one listing",
+			n: models.Notification{Type: models.NotificationPaymentReceived, Data: mustJSON(t, models.PaymentEventData{
+				ListingIDs: []int{12}, Amount: 200,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"You sold a book!", []string{"A buyer paid ฿200.00 for 1 of your book(s)."}},
+				models.LanguageThai:    {"หนังสือของคุณขายได้แล้ว!", []string{"ผู้ซื้อได้ชำระเงิน ฿200.00 สำหรับหนังสือของคุณ 1 เล่ม"}},
+			},
+		},
+		{
+			name: "payment_received for a cart has no link",
+			n: models.Notification{Type: models.NotificationPaymentReceived, Data: mustJSON(t, models.PaymentEventData{
+				ListingIDs: []int{12, 13}, Amount: 400,
+			})},
+			want: map[string]rendered{
+				models.LanguageEnglish: {"You sold a book!", []string{"for 2 of your book(s)."}},
+				models.LanguageThai:    {"หนังสือของคุณขายได้แล้ว!", []string{"สำหรับหนังสือของคุณ 2 เล่ม"}},
+			},
+		},
+		{
+			name: "order_shipped",
+			n: models.Notification{Type: "order_" + models.OrderShipped, Data: mustJSON(t, models.OrderEventData{
+				OrderID: 77, ListingID: 12, Status: models.OrderShipped, Carrier: &carrier, TrackingNumber: &tracking,
+			})},
+			link: "https://used2book.test/user/account/purchase",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Your book is on its way", []string{"The seller shipped your order #77.", "Carrier: Kerry\nTracking number: KEX123"}},
+				models.LanguageThai:    {"หนังสือของคุณถูกจัดส่งแล้ว", []string{"คำสั่งซื้อ #77", "ขนส่ง: Kerry\nหมายเลขพัสดุ: KEX123"}},
+			},
+		},
+		{
+			name: "reservation_expiring",
+			n: models.Notification{Type: models.NotificationReservationExpiring, Data: mustJSON(t, models.ReservationEventData{
+				ListingID: 12, ExpiresAt: expiresAt,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Your reservation is about to expire", []string{"held for you until 17:30 (Bangkok time)."}},
+				models.LanguageThai:    {"การจองของคุณใกล้หมดเวลาแล้ว", []string{"ถึงเวลา 17:30 น."}},
+			},
+		},
+		{
+			name: "wishlist_match",
+			n: models.Notification{Type: models.NotificationWishlistMatch, Data: mustJSON(t, models.WishlistEventData{
+				ListingID: 12, Title: "Dune", Price: 299,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"A book on your wishlist is for sale", []string{"Dune from your wishlist was just listed for ฿299.00."}},
+				models.LanguageThai:    {"หนังสือในรายการที่อยากได้ของคุณมีวางขายแล้ว", []string{"Dune ในรายการที่อยากได้ของคุณเพิ่งวางขายในราคา ฿299.00"}},
+			},
+		},
+		{
+			name: "price_drop",
+			n: models.Notification{Type: models.NotificationPriceDrop, Data: mustJSON(t, models.WishlistEventData{
+				ListingID: 12, Title: "Dune", Price: 299, OldPrice: &oldPrice,
+			})},
+			link: "https://used2book.test/listing/12",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Price drop on a book on your wishlist", []string{"Dune from your wishlist dropped from ฿350.00 to ฿299.00."}},
+				models.LanguageThai:    {"หนังสือในรายการที่อยากได้ของคุณลดราคาแล้ว", []string{"ลดราคาจาก ฿350.00 เหลือ ฿299.00"}},
+			},
+		},
+		{
+			name: "notification",
+			n:    models.Notification{Type: models.NotificationPaymentRefunded, Message: "Your payment was refunded."},
+			link: "https://used2book.test",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"You have a new notification", []string{"Your payment was refunded."}},
+				models.LanguageThai:    {"คุณมีการแจ้งเตือนใหม่", []string{"Your payment was refunded."}},
+			},
+		},
+		{
+			name: "digest",
+			digest: []models.Notification{
+				{Message: "An offer was rejected.", CreatedAt: expiresAt},
+				{Message: "You have a new offer.", CreatedAt: afterMidnight},
+			},
+			link: "https://used2book.test",
+			want: map[string]rendered{
+				models.LanguageEnglish: {"Your Used2Book daily digest", []string{"- 17:30 An offer was rejected.\n- 00:05 You have a new offer."}},
+				models.LanguageThai:    {"สรุปการแจ้งเตือนประจำวันจาก Used2Book", []string{"- 17:30 น. An offer was rejected.\n- 00:05 น. You have a new offer."}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, lang := range []string{models.LanguageEnglish, models.LanguageThai} {
+			t.Run(tt.name+"/"+lang, func(t *testing.T) {
+				want := tt.want[lang]
+
+				db, mock, err := sqlmock.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+				mock.ExpectQuery(`SELECT u.email, u.phone_number, u.first_name`).
+					WithArgs(42).
+					WillReturnRows(sqlmock.NewRows([]string{"email", "phone_number", "first_name", "language"}).
+						AddRow("somchai@example.com", nil, "Somchai", lang))
+
+				mailer := NewMemoryMailer(false)
+				channel := NewEmailChannel(mailer, templates, mysql.NewNotificationRepository(db))
+
+				if tt.digest != nil {
+					err = channel.DeliverDigest(context.Background(), 42, tt.digest)
+				} else {
+					n := tt.n
+					n.UserID = 42
+					if !channel.Accepts(n) {
+						t.Fatalf("channel does not accept %s", n.Type)
+					}
+					err = channel.Deliver(context.Background(), n)
+				}
+				if err != nil {
+					t.Fatalf("deliver: %v", err)
+				}
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Error(err)
+				}
+
+				sent := mailer.Messages()
+				if len(sent) != 1 {
+					t.Fatalf("sent %d messages, want 1", len(sent))
+				}
+				msg := sent[0]
+				if msg.To != "somchai@example.com" {
+					t.Errorf("To = %q", msg.To)
+				}
+				if msg.Subject != want.subject {
+					t.Errorf("Subject = %q, want %q", msg.Subject, want.subject)
+				}
+				for _, fragment := range want.text {
+					if !strings.Contains(msg.Text, fragment) {
+						t.Errorf("Text does not contain %q:\n%s", fragment, msg.Text)
+					}
+					// Lines of a paragraph are joined with <br> in the layout
+					htmlFragment := strings.ReplaceAll(html.EscapeString(fragment), "\n", "<br>")
+					if !strings.Contains(msg.HTML, htmlFragment) {
+						t.Errorf("HTML does not contain %q:\n%s", htmlFragment, msg.HTML)
+					}
+				}
+
+				if !strings.Contains(msg.HTML, `<html lang="`+lang+`">`) {
+					t.Errorf("HTML is not the %s layout:\n%s", lang, msg.HTML)
+				}
+				if !strings.Contains(msg.HTML, "<title>"+html.EscapeString(want.subject)+"</title>") ||
+					!strings.Contains(msg.HTML, `<h2 style="margin-top:0;">`+html.EscapeString(want.subject)+"</h2>") {
+					t.Errorf("HTML does not show the subject %q:\n%s", want.subject, msg.HTML)
+				}
+				if tt.link != "" {
+					if !strings.HasSuffix(msg.Text, "\n\n"+tt.link) {
+						t.Errorf("Text does not end with link %q:\n%s", tt.link, msg.Text)
+					}
+					if !strings.Contains(msg.HTML, `<a href="`+tt.link+`"`) {
+						t.Errorf("HTML has no button to %q:\n%s", tt.link, msg.HTML)
+					}
+				} else if strings.Contains(msg.HTML, "<a href=") {
+					t.Errorf("HTML has a button but no link was expected:\n%s", msg.HTML)
+				}
+			})
+		}
+	}
+}
+
+func TestEmailTemplatesFallBackToThai(t *testing.T) {
+	templates, err := LoadEmailTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := templates.Render("notification", "fr", emailData{Message: "Bonjour"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Subject != "คุณมีการแจ้งเตือนใหม่" || !strings.Contains(msg.HTML, `<html lang="th">`) {
+		t.Errorf("untranslated language rendered %q in\n%s", msg.Subject, msg.HTML)
+	}
+
+	if _, err := templates.Render("no_such_email", models.LanguageEnglish, emailData{}); err == nil {
+		t.Error("rendering an unknown template succeeded")
+	}
+}
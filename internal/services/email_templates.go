@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+//go:embed email_templates
+var emailTemplateFS embed.FS
+
+// bangkok is the time zone times in emails are shown in
+var bangkok = time.FixedZone("ICT", 7*60*60)
+
+var emailTemplateFuncs = texttemplate.FuncMap{
+	"baht": func(amount float64) string {
+		return fmt.Sprintf("%.2f", amount)
+	},
+	"clock": func(t time.Time) string {
+		return t.In(bangkok).Format("15:04")
+	},
+}
+
+// emailData is what the email templates are rendered with. Only the payload
+// of the notification's type is filled in.
+type emailData struct {
+	Name        string
+	Link        string
+	Message     string
+	Offer       models.OfferEventData
+	Payment     models.PaymentEventData
+	Order       models.OrderEventData
+	Reservation models.ReservationEventData
+	Wishlist    models.WishlistEventData
+	// Items are the notifications in a digest
+	Items []digestItem
+}
+
+type digestItem struct {
+	Message   string
+	CreatedAt time.Time
+}
+
+// emailLayoutData is what an HTML layout is rendered with
+type emailLayoutData struct {
+	Subject string
+	// Paragraphs are the lines of each paragraph of the text body
+	Paragraphs [][]string
+	Link       string
+}
+
+// EmailTemplates renders notification emails. Each email has a text template
+// per language, email_templates/<name>.<lang>.txt, defining "subject" and
+// "text"; the HTML part is the text body set in that language's layout.
+type EmailTemplates struct {
+	text    map[string]*texttemplate.Template
+	layouts map[string]*htmltemplate.Template
+}
+
+// LoadEmailTemplates parses the embedded templates
+func LoadEmailTemplates() (*EmailTemplates, error) {
+	t := &EmailTemplates{
+		text:    map[string]*texttemplate.Template{},
+		layouts: map[string]*htmltemplate.Template{},
+	}
+
+	entries, err := emailTemplateFS.ReadDir("email_templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		file := path.Join("email_templates", name)
+		switch {
+		case strings.HasPrefix(name, "layout.") && strings.HasSuffix(name, ".html"):
+			lang := strings.TrimSuffix(strings.TrimPrefix(name, "layout."), ".html")
+			layout, err := htmltemplate.ParseFS(emailTemplateFS, file)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", name, err)
+			}
+			t.layouts[lang] = layout
+		case strings.HasSuffix(name, ".txt"):
+			tmpl, err := texttemplate.New(name).Funcs(emailTemplateFuncs).ParseFS(emailTemplateFS, file)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", name, err)
+			}
+			t.text[strings.TrimSuffix(name, ".txt")] = tmpl
+		}
+	}
+	return t, nil
+}
+
+// Render builds the email name in lang, falling back to Thai when there is
+// no translation
+func (t *EmailTemplates) Render(name string, lang string, data emailData) (models.EmailMessage, error) {
+	tmpl, ok := t.text[name+"."+lang]
+	if !ok {
+		lang = models.LanguageThai
+		tmpl, ok = t.text[name+"."+lang]
+	}
+	layout := t.layouts[lang]
+	if !ok || layout == nil {
+		return models.EmailMessage{}, fmt.Errorf("no email template %q", name)
+	}
+
+	var subject, text bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return models.EmailMessage{}, fmt.Errorf("error rendering %s subject: %w", name, err)
+	}
+	if err := tmpl.ExecuteTemplate(&text, "text", data); err != nil {
+		return models.EmailMessage{}, fmt.Errorf("error rendering %s: %w", name, err)
+	}
+
+	msg := models.EmailMessage{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()),
+	}
+	if data.Link != "" {
+		msg.Text += "\n\n" + data.Link
+	}
+
+	layoutData := emailLayoutData{Subject: msg.Subject, Link: data.Link}
+	for _, paragraph := range strings.Split(strings.TrimSpace(text.String()), "\n\n") {
+		layoutData.Paragraphs = append(layoutData.Paragraphs, strings.Split(paragraph, "\n"))
+	}
+	var html bytes.Buffer
+	if err := layout.Execute(&html, layoutData); err != nil {
+		return models.EmailMessage{}, fmt.Errorf("error rendering %s HTML: %w", name, err)
+	}
+	msg.HTML = html.String()
+	return msg, nil
+}
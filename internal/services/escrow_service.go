@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const (
+	// defaultPlatformFeePercent is taken from every sale unless
+	// PLATFORM_FEE_PERCENT says otherwise
+	defaultPlatformFeePercent = 5.0
+	payoutInterval            = 10 * time.Minute
+)
+
+// EscrowService holds sellers' money between a completed payment and the
+// Omise transfer that pays them out.
+type EscrowService struct {
+	escrowRepo *mysql.EscrowRepository
+	omise      *OmiseService // nil when Omise isn't configured; payouts then wait
+	feePercent float64
+}
+
+func NewEscrowService(repo *mysql.EscrowRepository) *EscrowService {
+	es := &EscrowService{
+		escrowRepo: repo,
+		feePercent: defaultPlatformFeePercent,
+	}
+
+	if v := os.Getenv("PLATFORM_FEE_PERCENT"); v != "" {
+		fee, err := strconv.ParseFloat(v, 64)
+		if err != nil || fee < 0 || fee >= 100 {
+			log.Printf("⚠️  Invalid PLATFORM_FEE_PERCENT %q, using %.1f", v, defaultPlatformFeePercent)
+		} else {
+			es.feePercent = fee
+		}
+	}
+	if os.Getenv("OMISE_SECRET_KEY") != "" {
+		es.omise = NewOmiseService()
+	}
+	return es
+}
+
+// FeePercent is the platform's cut of each sale
+func (es *EscrowService) FeePercent() float64 {
+	return es.feePercent
+}
+
+// HoldSessionFunds opens escrow entries for a paid checkout session. Call it
+// with the webhook's transaction ctx.
+func (es *EscrowService) HoldSessionFunds(ctx context.Context, sessionID string) error {
+	return es.escrowRepo.HoldSessionFunds(ctx, sessionID, es.feePercent)
+}
+
+func (es *EscrowService) ReverseFunds(ctx context.Context, reference string, status string) (int, error) {
+	return es.escrowRepo.ReverseFunds(ctx, reference, status)
+}
+
+func (es *EscrowService) ReleaseTransactionFunds(ctx context.Context, transactionID int) error {
+	return es.escrowRepo.ReleaseTransactionFunds(ctx, transactionID)
+}
+
+func (es *EscrowService) RefundTransactionFunds(ctx context.Context, transactionID int) error {
+	return es.escrowRepo.RefundTransactionFunds(ctx, transactionID)
+}
+
+func (es *EscrowService) DisputeTransactionFunds(ctx context.Context, transactionID int) error {
+	return es.escrowRepo.DisputeTransactionFunds(ctx, transactionID)
+}
+
+func (es *EscrowService) ReleaseDisputedFunds(ctx context.Context, transactionID int, refundAmount float64) error {
+	return es.escrowRepo.ReleaseDisputedFunds(ctx, transactionID, refundAmount)
+}
+
+func (es *EscrowService) IsTransactionPaidOut(ctx context.Context, transactionID int) (bool, error) {
+	return es.escrowRepo.IsTransactionPaidOut(ctx, transactionID)
+}
+
+func (es *EscrowService) GetSellerBalance(ctx context.Context, sellerID int) (*models.SellerBalance, error) {
+	return es.escrowRepo.GetSellerBalance(ctx, sellerID)
+}
+
+func (es *EscrowService) ListPayouts(ctx context.Context, sellerID int, page models.PageRequest) ([]models.Payout, *models.PageInfo, error) {
+	return es.escrowRepo.ListPayouts(ctx, sellerID, page)
+}
+
+// RunPayoutWorker periodically transfers released funds to sellers. It
+// stops when ctx is cancelled.
+func (es *EscrowService) RunPayoutWorker(ctx context.Context) {
+	if es.omise == nil {
+		log.Println("⚠️  OMISE_SECRET_KEY not set, seller payouts disabled")
+		return
+	}
+
+	ticker := time.NewTicker(payoutInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			es.processPayouts(ctx)
+		case <-ctx.Done():
+			log.Println("Payout worker stopped")
+			return
+		}
+	}
+}
+
+func (es *EscrowService) processPayouts(ctx context.Context) {
+	sellerIDs, err := es.escrowRepo.GetSellersWithReleasedFunds(ctx)
+	if err != nil {
+		log.Println("❌ Payout Error:", err)
+		return
+	}
+	for _, sellerID := range sellerIDs {
+		if err := es.payOut(ctx, sellerID); err != nil {
+			log.Printf("❌ Payout Error for seller %d: %v", sellerID, err)
+		}
+	}
+}
+
+// payOut transfers all of a seller's released funds in one Omise transfer
+func (es *EscrowService) payOut(ctx context.Context, sellerID int) error {
+	recipientID, err := es.escrowRepo.GetPayoutRecipient(ctx, sellerID)
+	if err != nil {
+		return err
+	}
+	if recipientID == "" {
+		return errors.New("seller has no verified payout account")
+	}
+
+	payout, err := es.escrowRepo.CreatePayout(ctx, sellerID, recipientID)
+	if err != nil || payout == nil {
+		return err
+	}
+
+	transfer, err := es.omise.CreateTransfer(recipientID, toSatang(payout.Amount), map[string]interface{}{
+		"payout_id": payout.ID,
+		"seller_id": sellerID,
+	})
+	if err != nil {
+		if failErr := es.escrowRepo.FailPayout(ctx, payout.ID, err.Error()); failErr != nil {
+			log.Println("❌ FailPayout Error:", failErr)
+		}
+		return err
+	}
+
+	if err := es.escrowRepo.CompletePayout(ctx, payout.ID, transfer.ID); err != nil {
+		// The money has gone out; leave the entries in 'paying_out' rather than retry
+		return fmt.Errorf("transfer %s sent but payout %d not recorded: %w", transfer.ID, payout.ID, err)
+	}
+
+	log.Printf("💸 Paid out %.2f THB to seller %d (transfer %s, %d sales)", payout.Amount, sellerID, transfer.ID, payout.EntryCount)
+	return nil
+}
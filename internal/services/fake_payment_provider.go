@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+// FakePaymentProvider is an in-memory provider for local development and
+// offline tests. Nothing is charged: a checkout is settled by posting the
+// payload from EventPayload to the provider's webhook endpoint.
+type FakePaymentProvider struct {
+	mu       sync.Mutex
+	secret   string
+	seq      int
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	status   string
+	amount   float64
+	metadata map[string]string
+}
+
+// fakeEvent is the webhook body the fake provider understands
+type fakeEvent struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	SessionID string            `json:"session_id"`
+	Amount    float64           `json:"amount"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// NewFakePaymentProvider returns an empty fake. When secret is set, webhook
+// deliveries must carry it in the X-Fake-Signature header.
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	return &FakePaymentProvider{secret: secret, payments: map[string]*fakePayment{}}
+}
+
+func (fp *FakePaymentProvider) Name() string {
+	return models.PaymentProviderFake
+}
+
+func (fp *FakePaymentProvider) CreateCheckout(ctx context.Context, req models.CheckoutSessionRequest) (*models.CheckoutSession, error) {
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrUnsupportedCheckout)
+	}
+
+	var amount float64
+	for _, item := range req.Items {
+		amount += item.Amount
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.seq++
+	id := fmt.Sprintf("fake_%d", fp.seq)
+	fp.payments[id] = &fakePayment{status: models.PaymentStatusPending, amount: amount, metadata: req.Metadata}
+
+	return &models.CheckoutSession{
+		Provider:    fp.Name(),
+		SessionID:   id,
+		CheckoutURL: "fake://checkout/" + id,
+		ExpiresAt:   time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute),
+	}, nil
+}
+
+func (fp *FakePaymentProvider) ExpireCheckout(ctx context.Context, sessionID string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	payment, ok := fp.payments[sessionID]
+	if !ok {
+		return fmt.Errorf("unknown fake checkout %s", sessionID)
+	}
+	if payment.status != models.PaymentStatusPending {
+		return fmt.Errorf("fake checkout %s is %s, not pending", sessionID, payment.status)
+	}
+	payment.status = models.PaymentStatusFailed
+	return nil
+}
+
+func (fp *FakePaymentProvider) VerifyWebhook(payload []byte, header http.Header) error {
+	if fp.secret == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(header.Get("X-Fake-Signature")), []byte(fp.secret)) != 1 {
+		return errors.New("webhook signature mismatch")
+	}
+	return nil
+}
+
+func (fp *FakePaymentProvider) ParseWebhookEvent(payload []byte) (*models.PaymentEvent, error) {
+	var event fakeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if event.ID == "" {
+		return nil, errors.New("event has no ID")
+	}
+
+	switch event.Type {
+	case models.PaymentEventSucceeded, models.PaymentEventFailed, models.PaymentEventRefunded, models.PaymentEventDisputed:
+	default:
+		event.Type = models.PaymentEventIgnored
+	}
+
+	return &models.PaymentEvent{
+		Provider:  fp.Name(),
+		EventID:   event.ID,
+		RawType:   event.Type,
+		Type:      event.Type,
+		SessionID: event.SessionID,
+		Reference: event.SessionID,
+		Metadata:  event.Metadata,
+		Amount:    event.Amount,
+	}, nil
+}
+
+// EventPayload moves a fake checkout to the outcome of eventType (one of the
+// models.PaymentEvent* types) and returns the webhook body announcing it.
+func (fp *FakePaymentProvider) EventPayload(sessionID string, eventType string) ([]byte, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	payment, ok := fp.payments[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake checkout %s", sessionID)
+	}
+
+	switch eventType {
+	case models.PaymentEventSucceeded, models.PaymentEventDisputed:
+		payment.status = models.PaymentStatusSucceeded
+	case models.PaymentEventFailed:
+		payment.status = models.PaymentStatusFailed
+	case models.PaymentEventRefunded:
+		payment.status = models.PaymentStatusRefunded
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+
+	fp.seq++
+	return json.Marshal(fakeEvent{
+		ID:        fmt.Sprintf("fake_evt_%d", fp.seq),
+		Type:      eventType,
+		SessionID: sessionID,
+		Amount:    payment.amount,
+		Metadata:  payment.metadata,
+	})
+}
+
+func (fp *FakePaymentProvider) Refund(ctx context.Context, reference string, amount float64) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	payment, ok := fp.payments[reference]
+	if !ok {
+		return fmt.Errorf("unknown fake payment %s", reference)
+	}
+	if payment.status != models.PaymentStatusSucceeded {
+		return fmt.Errorf("fake payment %s is %s, not refundable", reference, payment.status)
+	}
+	if amount == 0 || amount >= payment.amount {
+		payment.status = models.PaymentStatusRefunded
+	}
+	return nil
+}
+
+func (fp *FakePaymentProvider) GetStatus(ctx context.Context, reference string) (string, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	payment, ok := fp.payments[reference]
+	if !ok {
+		return "", fmt.Errorf("unknown fake payment %s", reference)
+	}
+	return payment.status, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"used2book-backend/internal/models"
+)
+
+func newFakeCheckout(t *testing.T, fp *FakePaymentProvider) *models.CheckoutSession {
+	t.Helper()
+	session, err := fp.CreateCheckout(context.Background(), models.CheckoutSessionRequest{
+		Items: []models.CheckoutLineItem{
+			{ListingID: 3, Title: "Dune", Amount: 120},
+			{ListingID: 4, Title: "Emma", Amount: 80},
+		},
+		ExpiresInMinutes: 30,
+		Metadata:         map[string]string{"listing_id": "3", "buyer_id": "9"},
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout: %v", err)
+	}
+	return session
+}
+
+func TestFakeProviderEvents(t *testing.T) {
+	tests := []struct {
+		eventType  string
+		wantStatus string
+	}{
+		{models.PaymentEventSucceeded, models.PaymentStatusSucceeded},
+		{models.PaymentEventFailed, models.PaymentStatusFailed},
+		{models.PaymentEventRefunded, models.PaymentStatusRefunded},
+		{models.PaymentEventDisputed, models.PaymentStatusSucceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			fp := NewFakePaymentProvider("")
+			session := newFakeCheckout(t, fp)
+			if session.Provider != models.PaymentProviderFake || session.SessionID == "" {
+				t.Fatalf("session = %+v", session)
+			}
+
+			payload, err := fp.EventPayload(session.SessionID, tt.eventType)
+			if err != nil {
+				t.Fatalf("EventPayload: %v", err)
+			}
+			ev, err := fp.ParseWebhookEvent(payload)
+			if err != nil {
+				t.Fatalf("ParseWebhookEvent: %v", err)
+			}
+			if ev.Type != tt.eventType || ev.SessionID != session.SessionID || ev.Reference != session.SessionID {
+				t.Errorf("event = %+v, want %s for %s", ev, tt.eventType, session.SessionID)
+			}
+			if ev.Amount != 200 || ev.Metadata["listing_id"] != "3" || ev.Metadata["buyer_id"] != "9" {
+				t.Errorf("event amount %.2f, metadata %v", ev.Amount, ev.Metadata)
+			}
+
+			status, err := fp.GetStatus(context.Background(), session.SessionID)
+			if err != nil || status != tt.wantStatus {
+				t.Errorf("GetStatus = %q, %v, want %q", status, err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFakeProviderParseWebhookEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "unknown type is ignored", payload: `{"id":"evt_1","type":"charge.pending"}`, wantType: models.PaymentEventIgnored},
+		{name: "missing ID", payload: `{"type":"succeeded"}`, wantErr: true},
+		{name: "not JSON", payload: `succeeded`, wantErr: true},
+	}
+
+	fp := NewFakePaymentProvider("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := fp.ParseWebhookEvent([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWebhookEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ev.Type != tt.wantType {
+				t.Errorf("Type = %q, want %q", ev.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestFakeProviderVerifyWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		wantErr   bool
+	}{
+		{name: "no secret configured", secret: ""},
+		{name: "matching signature", secret: "s3cret", signature: "s3cret"},
+		{name: "wrong signature", secret: "s3cret", signature: "guess", wantErr: true},
+		{name: "missing signature", secret: "s3cret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("X-Fake-Signature", tt.signature)
+			}
+			err := NewFakePaymentProvider(tt.secret).VerifyWebhook([]byte(`{}`), header)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeProviderExpireAndRefund(t *testing.T) {
+	ctx := context.Background()
+	fp := NewFakePaymentProvider("")
+
+	expired := newFakeCheckout(t, fp)
+	if err := fp.ExpireCheckout(ctx, expired.SessionID); err != nil {
+		t.Fatalf("ExpireCheckout: %v", err)
+	}
+	if err := fp.ExpireCheckout(ctx, expired.SessionID); err == nil {
+		t.Error("expiring an expired checkout succeeded")
+	}
+	if err := fp.Refund(ctx, expired.SessionID, 0); err == nil {
+		t.Error("refunding an unpaid checkout succeeded")
+	}
+
+	paid := newFakeCheckout(t, fp)
+	if _, err := fp.EventPayload(paid.SessionID, models.PaymentEventSucceeded); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.ExpireCheckout(ctx, paid.SessionID); err == nil {
+		t.Error("expiring a paid checkout succeeded")
+	}
+
+	// A partial refund leaves the payment open for the rest
+	if err := fp.Refund(ctx, paid.SessionID, 80); err != nil {
+		t.Fatalf("partial Refund: %v", err)
+	}
+	if status, _ := fp.GetStatus(ctx, paid.SessionID); status != models.PaymentStatusSucceeded {
+		t.Errorf("status after partial refund = %q", status)
+	}
+	if err := fp.Refund(ctx, paid.SessionID, 0); err != nil {
+		t.Fatalf("full Refund: %v", err)
+	}
+	if status, _ := fp.GetStatus(ctx, paid.SessionID); status != models.PaymentStatusRefunded {
+		t.Errorf("status after full refund = %q", status)
+	}
+
+	if err := fp.ExpireCheckout(ctx, "fake_missing"); err == nil {
+		t.Error("expiring an unknown checkout succeeded")
+	}
+}
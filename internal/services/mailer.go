@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"used2book-backend/internal/models"
+)
+
+const (
+	defaultSMTPPort = 587
+	defaultMailFrom = "Used2Book <no-reply@used2book.local>"
+)
+
+// Mailer sends email. The notification email channel only talks to this
+// interface, so SMTP and the in-memory mailer are interchangeable.
+type Mailer interface {
+	Send(ctx context.Context, msg models.EmailMessage) error
+}
+
+// NewMailerFromEnv returns the mailer configured in the environment:
+// MAIL_DRIVER=memory keeps mail in memory and logs it, otherwise SMTP is used
+// when SMTP_HOST is set. It returns nil when email isn't configured.
+func NewMailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	if os.Getenv("MAIL_DRIVER") == "memory" {
+		return NewMemoryMailer(true)
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("⚠️  SMTP_HOST not set, email notifications disabled")
+		return nil
+	}
+	port := defaultSMTPPort
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			log.Printf("⚠️  Invalid SMTP_PORT %q, using %d", v, defaultSMTPPort)
+		} else {
+			port = parsed
+		}
+	}
+	return NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+}
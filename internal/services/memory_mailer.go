@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"used2book-backend/internal/models"
+)
+
+// MemoryMailer keeps sent mail in memory instead of delivering it, for local
+// development and offline tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	logSent  bool
+	messages []models.EmailMessage
+}
+
+// NewMemoryMailer returns an empty mailer. With logSent every message is also
+// written to the log.
+func NewMemoryMailer(logSent bool) *MemoryMailer {
+	return &MemoryMailer{logSent: logSent}
+}
+
+func (mm *MemoryMailer) Send(ctx context.Context, msg models.EmailMessage) error {
+	mm.mu.Lock()
+	mm.messages = append(mm.messages, msg)
+	mm.mu.Unlock()
+
+	if mm.logSent {
+		log.Printf("📧 Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	}
+	return nil
+}
+
+// Messages returns the mail sent so far, oldest first
+func (mm *MemoryMailer) Messages() []models.EmailMessage {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return append([]models.EmailMessage(nil), mm.messages...)
+}
+
+// Reset forgets the mail sent so far
+func (mm *MemoryMailer) Reset() {
+	mm.mu.Lock()
+	mm.messages = nil
+	mm.mu.Unlock()
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+// ErrConversationNotFound is returned for a conversation that doesn't exist
+// or that the user isn't in
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrCannotMessage is returned when a user tries to start a conversation
+// they can't have, e.g. about their own listing
+var ErrCannotMessage = errors.New("you can't message about this listing")
+
+// ErrUserBlocked is returned when either user blocked the other
+var ErrUserBlocked = errors.New("messaging between these users is blocked")
+
+// ErrInvalidMessage is returned for a message that can't be sent
+var ErrInvalidMessage = errors.New("invalid message")
+
+// ErrUserNotFound is returned for a user that doesn't exist
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrNotBlocked is returned when unblocking a user who isn't blocked
+var ErrNotBlocked = errors.New("user isn't blocked")
+
+// MessageService lets buyers and sellers talk about a listing without
+// sharing their phone numbers
+type MessageService struct {
+	messageRepo *mysql.MessageRepository
+}
+
+func NewMessageService(repo *mysql.MessageRepository) *MessageService {
+	return &MessageService{messageRepo: repo}
+}
+
+// StartConversation opens the user's conversation about a listing, or about
+// an offer when offerID is set. Buyers open conversations about listings;
+// either side of an offer can open one about it.
+func (ms *MessageService) StartConversation(ctx context.Context, userID int, listingID int, offerID *int) (*models.Conversation, error) {
+	var buyerID, sellerID int
+	if offerID != nil {
+		offerListingID, offerBuyerID, offerSellerID, found, err := ms.messageRepo.GetOfferParties(ctx, *offerID)
+		if err != nil {
+			return nil, err
+		}
+		if !found || (userID != offerBuyerID && userID != offerSellerID) {
+			return nil, fmt.Errorf("%w: offer not found", ErrCannotMessage)
+		}
+		listingID, buyerID, sellerID = offerListingID, offerBuyerID, offerSellerID
+	} else {
+		seller, found, err := ms.messageRepo.GetListingSeller(ctx, listingID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: listing not found", ErrCannotMessage)
+		}
+		buyerID, sellerID = userID, seller
+	}
+	if buyerID == sellerID {
+		return nil, fmt.Errorf("%w: it is your own listing", ErrCannotMessage)
+	}
+
+	blocked, err := ms.messageRepo.IsBlocked(ctx, buyerID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserBlocked
+	}
+
+	conversationID, err := ms.messageRepo.OpenConversation(ctx, listingID, offerID, buyerID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	return ms.GetConversation(ctx, userID, conversationID)
+}
+
+func (ms *MessageService) GetConversation(ctx context.Context, userID int, conversationID int) (*models.Conversation, error) {
+	c, err := ms.messageRepo.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrConversationNotFound
+	}
+	return c, nil
+}
+
+func (ms *MessageService) ListConversations(ctx context.Context, userID int, page models.PageRequest) ([]models.Conversation, *models.PageInfo, error) {
+	return ms.messageRepo.ListConversations(ctx, userID, page)
+}
+
+// ListMessages returns one page of a conversation the user is in
+func (ms *MessageService) ListMessages(ctx context.Context, userID int, conversationID int, page models.PageRequest) ([]models.Message, *models.PageInfo, error) {
+	if _, err := ms.GetConversation(ctx, userID, conversationID); err != nil {
+		return nil, nil, err
+	}
+	return ms.messageRepo.ListMessages(ctx, conversationID, page)
+}
+
+// CanSend returns the conversation when the user may write in it
+func (ms *MessageService) CanSend(ctx context.Context, userID int, conversationID int) (*models.Conversation, error) {
+	c, err := ms.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Blocked {
+		return nil, ErrUserBlocked
+	}
+	return c, nil
+}
+
+// SendMessage writes a message with text, an image or both into a
+// conversation and returns it with the conversation it went to
+func (ms *MessageService) SendMessage(ctx context.Context, userID int, conversationID int, body string, imageURL string) (*models.Message, *models.Conversation, error) {
+	body = strings.TrimSpace(body)
+	if body == "" && imageURL == "" {
+		return nil, nil, fmt.Errorf("%w: a message needs text or an image", ErrInvalidMessage)
+	}
+	if len([]rune(body)) > models.MaxMessageLength {
+		return nil, nil, fmt.Errorf("%w: messages can be at most %d characters", ErrInvalidMessage, models.MaxMessageLength)
+	}
+
+	c, err := ms.CanSend(ctx, userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := ms.messageRepo.CreateMessage(ctx, conversationID, userID, body, imageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, c, nil
+}
+
+// MarkRead marks what the user was sent in a conversation read and returns
+// how many messages were unread
+func (ms *MessageService) MarkRead(ctx context.Context, userID int, conversationID int) (int, error) {
+	if _, err := ms.GetConversation(ctx, userID, conversationID); err != nil {
+		return 0, err
+	}
+	return ms.messageRepo.MarkConversationRead(ctx, conversationID, userID)
+}
+
+func (ms *MessageService) CountUnread(ctx context.Context, userID int) (int, error) {
+	return ms.messageRepo.CountUnreadMessages(ctx, userID)
+}
+
+// BlockUser stops another user from messaging the user, in both directions
+func (ms *MessageService) BlockUser(ctx context.Context, userID int, blockedID int) error {
+	if userID == blockedID {
+		return fmt.Errorf("%w: you can't block yourself", ErrInvalidMessage)
+	}
+	exists, err := ms.messageRepo.UserExists(ctx, blockedID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return ms.messageRepo.BlockUser(ctx, userID, blockedID)
+}
+
+func (ms *MessageService) UnblockUser(ctx context.Context, userID int, blockedID int) error {
+	found, err := ms.messageRepo.UnblockUser(ctx, userID, blockedID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+func (ms *MessageService) ListBlockedUsers(ctx context.Context, userID int) ([]models.BlockedUser, error) {
+	return ms.messageRepo.ListBlockedUsers(ctx, userID)
+}
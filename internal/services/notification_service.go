@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+
+	"github.com/streadway/amqp"
+)
+
+// notificationPrefetch bounds how many unacknowledged messages each queue
+// hands the consumer at once
+const notificationPrefetch = 20
+
+// streamCatchUpLimit bounds how many missed notifications a reconnecting
+// stream is sent
+const streamCatchUpLimit = 50
+
+const (
+	// deliveryInterval is how often held back notifications are checked
+	deliveryInterval = time.Minute
+	// deliveryBatch bounds how many held back notifications go out per claim
+	deliveryBatch = 100
+)
+
+// ErrNotificationNotFound is returned for a notification that doesn't exist
+// or belongs to someone else
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// ErrStreamUnavailable is returned when live notifications aren't set up
+var ErrStreamUnavailable = errors.New("notification stream unavailable")
+
+// ErrInvalidNotificationSettings is returned for settings that can't be saved
+var ErrInvalidNotificationSettings = errors.New("invalid notification settings")
+
+// NotificationService stores the events published on the notification
+// queues as each user's in-app notifications and serves their inbox.
+type NotificationService struct {
+	notificationRepo *mysql.NotificationRepository
+	// stream pushes new notifications to connected users; nil disables it
+	stream *NotificationStream
+	// channels deliver new notifications outside the app, e.g. by email
+	channels []NotificationChannel
+}
+
+func NewNotificationService(repo *mysql.NotificationRepository, stream *NotificationStream, channels ...NotificationChannel) *NotificationService {
+	return &NotificationService{notificationRepo: repo, stream: stream, channels: channels}
+}
+
+// Store saves an event for its recipient and sends it on the channels their
+// preferences allow: the inbox and open streams, then email and SMS, which
+// are held back during quiet hours or for the daily digest. Events already
+// stored are skipped.
+func (ns *NotificationService) Store(ctx context.Context, e models.NotificationEvent) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	settings, err := ns.notificationRepo.GetNotificationSettings(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	category := models.NotificationCategoryOf(e.Type)
+
+	// Muted notifications are stored hidden, so a redelivered event is still
+	// recognised as a duplicate
+	inApp := settings.Wants(category, models.NotificationChannelInApp)
+	id, err := ns.notificationRepo.CreateNotification(ctx, e, !inApp)
+	if err != nil || id == 0 {
+		return err
+	}
+
+	n := models.Notification{
+		ID:        id,
+		UserID:    e.UserID,
+		Type:      e.Type,
+		Message:   e.Message,
+		Data:      e.Data,
+		CreatedAt: e.CreatedAt,
+	}
+	if inApp && ns.stream != nil {
+		if err := ns.stream.Publish(ctx, n); err != nil {
+			// It is stored; the user sees it on their next catch-up
+			log.Println("❌ Stream notification Error:", err)
+		}
+	}
+
+	// The notification is stored, so a failed delivery isn't retried: the
+	// redelivered event would be skipped as a duplicate anyway
+	now := time.Now()
+	for _, channel := range ns.channels {
+		if !channel.Accepts(n) || !settings.Wants(category, channel.Name()) {
+			continue
+		}
+		if err := ns.deliverOrHold(ctx, channel, n, settings, category, now); err != nil {
+			log.Printf("❌ %s notification Error for notification %d: %v", channel.Name(), n.ID, err)
+		}
+	}
+	return nil
+}
+
+// deliverOrHold sends n on channel now, or holds it back when the user wants
+// email in a daily digest or is in their quiet hours. Only notifications in a
+// category go into the digest.
+func (ns *NotificationService) deliverOrHold(ctx context.Context, channel NotificationChannel, n models.Notification, settings models.NotificationSettings, category string, now time.Time) error {
+	hold := models.NotificationDelivery{
+		NotificationID: &n.ID,
+		UserID:         n.UserID,
+		Channel:        channel.Name(),
+		Type:           n.Type,
+		Message:        n.Message,
+		Data:           n.Data,
+	}
+	if _, ok := channel.(digestChannel); ok && settings.Digest.Enabled && category != "" {
+		hold.Digest = true
+		hold.DeliverAfter = nextDigest(settings.Digest.Hour, now)
+		return ns.notificationRepo.CreateDelivery(ctx, hold)
+	}
+	if end, quiet := quietHoursEnd(settings.QuietHours, now); quiet {
+		hold.DeliverAfter = end
+		return ns.notificationRepo.CreateDelivery(ctx, hold)
+	}
+	return channel.Deliver(ctx, n)
+}
+
+// digestChannel is a channel that can send many notifications as one
+// message
+type digestChannel interface {
+	DeliverDigest(ctx context.Context, userID int, notifications []models.Notification) error
+}
+
+// parseClock reads an "HH:MM" time of day
+func parseClock(clock string) (int, int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// quietHoursEnd reports whether now falls in the quiet hours and, if so,
+// when they end
+func quietHoursEnd(q models.QuietHours, now time.Time) (time.Time, bool) {
+	if !q.Enabled {
+		return time.Time{}, false
+	}
+	startHour, startMinute, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	endHour, endMinute, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(bangkok)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, bangkok)
+	start := day.Add(time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute)
+	end := day.Add(time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute)
+
+	if !end.After(start) {
+		// The window runs past midnight: either it started yesterday and
+		// ends today, or it started today and ends tomorrow
+		if local.Before(end) {
+			return end, true
+		}
+		if !local.Before(start) {
+			return end.AddDate(0, 0, 1), true
+		}
+		return time.Time{}, false
+	}
+	if !local.Before(start) && local.Before(end) {
+		return end, true
+	}
+	return time.Time{}, false
+}
+
+// nextDigest is the next time the daily digest at hour o'clock goes out
+func nextDigest(hour int, now time.Time) time.Time {
+	local := now.In(bangkok)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, bangkok)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunDeliveryWorker sends held back notifications once quiet hours are over
+// and the daily digests once they are due. A notification whose channel the
+// user turned off in the meantime is dropped. It stops when ctx is
+// cancelled.
+func (ns *NotificationService) RunDeliveryWorker(ctx context.Context) {
+	ticker := time.NewTicker(deliveryInterval)
+	defer ticker.Stop()
+
+	for {
+		ns.deliverHeld(ctx)
+		ns.deliverDigests(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Notification delivery worker stopped")
+			return
+		}
+	}
+}
+
+func (ns *NotificationService) channel(name string) NotificationChannel {
+	for _, channel := range ns.channels {
+		if channel.Name() == name {
+			return channel
+		}
+	}
+	return nil
+}
+
+func (ns *NotificationService) deliverHeld(ctx context.Context) {
+	for {
+		deliveries, err := ns.notificationRepo.ClaimDueDeliveries(ctx, deliveryBatch)
+		if err != nil {
+			log.Println("❌ Notification delivery Error:", err)
+			return
+		}
+		for _, d := range deliveries {
+			channel := ns.channel(d.Channel)
+			if channel == nil {
+				continue
+			}
+			settings, err := ns.notificationRepo.GetNotificationSettings(ctx, d.UserID)
+			if err != nil {
+				log.Println("❌ Notification delivery Error:", err)
+				ns.failDelivery(ctx, d.ID)
+				continue
+			}
+			if !settings.Wants(models.NotificationCategoryOf(d.Type), d.Channel) {
+				continue
+			}
+			if err := channel.Deliver(ctx, heldNotification(d)); err != nil {
+				log.Printf("❌ %s notification Error for delivery %d: %v", d.Channel, d.ID, err)
+				ns.failDelivery(ctx, d.ID)
+			}
+		}
+		if len(deliveries) < deliveryBatch {
+			return
+		}
+	}
+}
+
+func (ns *NotificationService) deliverDigests(ctx context.Context) {
+	userIDs, err := ns.notificationRepo.ListDueDigests(ctx)
+	if err != nil {
+		log.Println("❌ Notification digest Error:", err)
+		return
+	}
+	for _, userID := range userIDs {
+		deliveries, err := ns.notificationRepo.ClaimDigest(ctx, userID)
+		if err != nil {
+			log.Println("❌ Notification digest Error:", err)
+			continue
+		}
+
+		// Digests are per channel, though only email collects them today
+		byChannel := map[string][]models.NotificationDelivery{}
+		for _, d := range deliveries {
+			byChannel[d.Channel] = append(byChannel[d.Channel], d)
+		}
+		for name, held := range byChannel {
+			channel, ok := ns.channel(name).(digestChannel)
+			if !ok {
+				continue
+			}
+			notifications := make([]models.Notification, len(held))
+			for i, d := range held {
+				notifications[i] = heldNotification(d)
+			}
+			if err := channel.DeliverDigest(ctx, userID, notifications); err != nil {
+				log.Printf("❌ %s digest Error for user %d: %v", name, userID, err)
+				for _, d := range held {
+					ns.failDelivery(ctx, d.ID)
+				}
+			}
+		}
+	}
+}
+
+func (ns *NotificationService) failDelivery(ctx context.Context, deliveryID int) {
+	if err := ns.notificationRepo.MarkDeliveryFailed(ctx, deliveryID); err != nil {
+		log.Println("❌ Notification delivery Error:", err)
+	}
+}
+
+// heldNotification rebuilds the notification a delivery holds back
+func heldNotification(d models.NotificationDelivery) models.Notification {
+	n := models.Notification{
+		UserID:    d.UserID,
+		Type:      d.Type,
+		Message:   d.Message,
+		Data:      d.Data,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.NotificationID != nil {
+		n.ID = *d.NotificationID
+	}
+	return n
+}
+
+// Subscribe opens a live stream of the user's new notifications. The
+// returned function closes it.
+func (ns *NotificationService) Subscribe(userID int) (<-chan models.Notification, func(), error) {
+	if ns.stream == nil {
+		return nil, nil, ErrStreamUnavailable
+	}
+	ch, unsubscribe := ns.stream.Subscribe(userID)
+	return ch, unsubscribe, nil
+}
+
+// ListMissed returns the notifications a reconnecting stream missed after
+// lastID, oldest first
+func (ns *NotificationService) ListMissed(ctx context.Context, userID int, lastID int) ([]models.Notification, error) {
+	return ns.notificationRepo.ListNotificationsAfter(ctx, userID, lastID, streamCatchUpLimit)
+}
+
+func (ns *NotificationService) ListNotifications(ctx context.Context, userID int, unreadOnly bool, page models.PageRequest) ([]models.Notification, *models.PageInfo, error) {
+	return ns.notificationRepo.ListNotifications(ctx, userID, unreadOnly, page)
+}
+
+func (ns *NotificationService) CountUnread(ctx context.Context, userID int) (int, error) {
+	return ns.notificationRepo.CountUnread(ctx, userID)
+}
+
+func (ns *NotificationService) MarkRead(ctx context.Context, userID int, notificationID int) error {
+	found, err := ns.notificationRepo.MarkRead(ctx, userID, notificationID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every notification of the user read and returns how many
+// were unread
+func (ns *NotificationService) MarkAllRead(ctx context.Context, userID int) (int, error) {
+	return ns.notificationRepo.MarkAllRead(ctx, userID)
+}
+
+func (ns *NotificationService) GetSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	return ns.notificationRepo.GetNotificationSettings(ctx, userID)
+}
+
+// UpdateSettings validates and stores a user's notification settings
+func (ns *NotificationService) UpdateSettings(ctx context.Context, userID int, settings models.NotificationSettings) error {
+	if err := validateNotificationSettings(settings); err != nil {
+		return err
+	}
+	return ns.notificationRepo.SaveNotificationSettings(ctx, userID, settings)
+}
+
+func validateNotificationSettings(settings models.NotificationSettings) error {
+	if settings.Language != models.LanguageThai && settings.Language != models.LanguageEnglish {
+		return fmt.Errorf("%w: language must be %q or %q", ErrInvalidNotificationSettings, models.LanguageThai, models.LanguageEnglish)
+	}
+	if settings.QuietHours.Enabled {
+		if _, _, err := parseClock(settings.QuietHours.Start); err != nil {
+			return fmt.Errorf("%w: quiet hours start must be HH:MM", ErrInvalidNotificationSettings)
+		}
+		if _, _, err := parseClock(settings.QuietHours.End); err != nil {
+			return fmt.Errorf("%w: quiet hours end must be HH:MM", ErrInvalidNotificationSettings)
+		}
+		if settings.QuietHours.Start == settings.QuietHours.End {
+			return fmt.Errorf("%w: quiet hours must not start and end at the same time", ErrInvalidNotificationSettings)
+		}
+	}
+	if settings.Digest.Hour < 0 || settings.Digest.Hour > 23 {
+		return fmt.Errorf("%w: digest hour must be between 0 and 23", ErrInvalidNotificationSettings)
+	}
+	for category, channels := range settings.Preferences {
+		if !slices.Contains(models.NotificationCategories, category) {
+			return fmt.Errorf("%w: unknown category %q", ErrInvalidNotificationSettings, category)
+		}
+		for channel := range channels {
+			if !slices.Contains(models.NotificationChannels, channel) {
+				return fmt.Errorf("%w: unknown channel %q", ErrInvalidNotificationSettings, channel)
+			}
+		}
+	}
+	return nil
+}
+
+// RunConsumer reads the notification queues and stores every event. A
+// message is acknowledged once stored; malformed ones are dropped and ones
+// that failed to store are requeued. It stops when ctx is cancelled or the
+// RabbitMQ channel closes.
+func (ns *NotificationService) RunConsumer(ctx context.Context, conn *amqp.Connection) {
+	if conn == nil {
+		log.Println("⚠️  RabbitMQ connection is nil, notification consumer disabled")
+		return
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Println("❌ RabbitMQ Channel Error:", err)
+		return
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(notificationPrefetch, 0, false); err != nil {
+		log.Println("❌ RabbitMQ Qos Error:", err)
+		return
+	}
+	for _, queue := range models.NotificationQueues {
+		if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+			log.Println("❌ Queue Declare Error:", err)
+			return
+		}
+		deliveries, err := ch.Consume(queue, "", false, false, false, false, nil)
+		if err != nil {
+			log.Println("❌ Queue Consume Error:", err)
+			return
+		}
+		go func(deliveries <-chan amqp.Delivery) {
+			for d := range deliveries {
+				ns.handleDelivery(ctx, d)
+			}
+		}(deliveries)
+	}
+
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	select {
+	case err := <-closed:
+		log.Println("❌ Notification consumer channel closed:", err)
+	case <-ctx.Done():
+		log.Println("Notification consumer stopped")
+	}
+}
+
+func (ns *NotificationService) handleDelivery(ctx context.Context, d amqp.Delivery) {
+	var e models.NotificationEvent
+	if err := json.Unmarshal(d.Body, &e); err != nil {
+		log.Printf("❌ Dropping malformed notification on %s: %v", d.RoutingKey, err)
+		d.Nack(false, false)
+		return
+	}
+	if err := e.Validate(); err != nil {
+		log.Printf("❌ Dropping invalid notification on %s: %v", d.RoutingKey, err)
+		d.Nack(false, false)
+		return
+	}
+	if err := ns.Store(ctx, e); err != nil {
+		log.Println("❌ Store notification Error:", err)
+		// Back off a little so a database outage doesn't spin the queue
+		time.Sleep(time.Second)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
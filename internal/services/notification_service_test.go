@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+)
+
+// bkk is a Bangkok wall clock time; tests pass it on in UTC, as the worker
+// sees it, so the day can differ from the Bangkok one
+func bkk(day int, hour int, minute int) time.Time {
+	return time.Date(2024, time.May, day, hour, minute, 0, 0, bangkok)
+}
+
+func TestQuietHoursEnd(t *testing.T) {
+	overnight := models.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}
+	afternoon := models.QuietHours{Enabled: true, Start: "13:00", End: "15:00"}
+	fromMidnight := models.QuietHours{Enabled: true, Start: "00:00", End: "06:00"}
+
+	tests := []struct {
+		name      string
+		quiet     models.QuietHours
+		now       time.Time
+		wantQuiet bool
+		wantEnd   time.Time
+	}{
+		{name: "disabled", quiet: models.QuietHours{Start: "22:00", End: "07:00"}, now: bkk(1, 23, 0)},
+		{name: "malformed start", quiet: models.QuietHours{Enabled: true, Start: "10pm", End: "07:00"}, now: bkk(1, 23, 0)},
+		{name: "malformed end", quiet: models.QuietHours{Enabled: true, Start: "22:00", End: "25:00"}, now: bkk(1, 23, 0)},
+
+		{name: "overnight, just before start", quiet: overnight, now: bkk(1, 21, 59)},
+		{name: "overnight, at start", quiet: overnight, now: bkk(1, 22, 0), wantQuiet: true, wantEnd: bkk(2, 7, 0)},
+		{name: "overnight, before Bangkok midnight", quiet: overnight, now: bkk(1, 23, 59), wantQuiet: true, wantEnd: bkk(2, 7, 0)},
+		// 17:00 UTC on May 1 is already May 2 in Bangkok
+		{name: "overnight, at Bangkok midnight", quiet: overnight, now: bkk(2, 0, 0), wantQuiet: true, wantEnd: bkk(2, 7, 0)},
+		{name: "overnight, after Bangkok midnight", quiet: overnight, now: bkk(2, 0, 30), wantQuiet: true, wantEnd: bkk(2, 7, 0)},
+		{name: "overnight, just before end", quiet: overnight, now: bkk(2, 6, 59), wantQuiet: true, wantEnd: bkk(2, 7, 0)},
+		{name: "overnight, at end", quiet: overnight, now: bkk(2, 7, 0)},
+
+		{name: "same day, before", quiet: afternoon, now: bkk(1, 12, 59)},
+		{name: "same day, inside", quiet: afternoon, now: bkk(1, 13, 0), wantQuiet: true, wantEnd: bkk(1, 15, 0)},
+		{name: "same day, at end", quiet: afternoon, now: bkk(1, 15, 0)},
+
+		{name: "from midnight, before Bangkok midnight", quiet: fromMidnight, now: bkk(1, 23, 59)},
+		{name: "from midnight, at Bangkok midnight", quiet: fromMidnight, now: bkk(2, 0, 0), wantQuiet: true, wantEnd: bkk(2, 6, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, quiet := quietHoursEnd(tt.quiet, tt.now.UTC())
+			if quiet != tt.wantQuiet {
+				t.Fatalf("quiet = %v, want %v", quiet, tt.wantQuiet)
+			}
+			if quiet && !end.Equal(tt.wantEnd) {
+				t.Errorf("end = %v, want %v", end.In(bangkok), tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	tests := []struct {
+		name string
+		hour int
+		now  time.Time
+		want time.Time
+	}{
+		{name: "later today", hour: 8, now: bkk(2, 7, 59), want: bkk(2, 8, 0)},
+		{name: "at the hour goes tomorrow", hour: 8, now: bkk(2, 8, 0), want: bkk(3, 8, 0)},
+		{name: "before Bangkok midnight", hour: 8, now: bkk(1, 23, 30), want: bkk(2, 8, 0)},
+		// Still May 1 in UTC, but the May 2 digest hasn't gone out yet
+		{name: "after Bangkok midnight", hour: 8, now: bkk(2, 0, 30), want: bkk(2, 8, 0)},
+		{name: "midnight digest, a minute before", hour: 0, now: bkk(1, 23, 59), want: bkk(2, 0, 0)},
+		{name: "midnight digest, at midnight", hour: 0, now: bkk(2, 0, 0), want: bkk(3, 0, 0)},
+		{name: "last hour of the day", hour: 23, now: bkk(2, 0, 0), want: bkk(2, 23, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextDigest(tt.hour, tt.now.UTC())
+			if !got.Equal(tt.want) {
+				t.Errorf("nextDigest(%d, %v) = %v, want %v", tt.hour, tt.now.In(bangkok), got.In(bangkok), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"used2book-backend/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// notificationChannel is the Redis pub/sub channel new notifications are
+// fanned out on. Every backend instance subscribes, so a notification stored
+// by one instance reaches users streaming from any other.
+const notificationChannel = "notifications"
+
+// streamBuffer is how many notifications a slow stream may fall behind
+// before further ones are dropped for it
+const streamBuffer = 16
+
+// NotificationStream delivers new notifications to the users connected to
+// this instance. Notifications are published on Redis and handed to local
+// subscribers by Run.
+type NotificationStream struct {
+	redis *redis.Client
+
+	mu          sync.Mutex
+	subscribers map[int]map[chan models.Notification]struct{}
+}
+
+func NewNotificationStream(client *redis.Client) *NotificationStream {
+	return &NotificationStream{
+		redis:       client,
+		subscribers: make(map[int]map[chan models.Notification]struct{}),
+	}
+}
+
+// Publish announces a stored notification to every instance
+func (s *NotificationStream) Publish(ctx context.Context, n models.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return s.redis.Publish(ctx, notificationChannel, body).Err()
+}
+
+// Subscribe registers a stream for a user. The returned function unregisters
+// it and must be called when the stream ends.
+func (s *NotificationStream) Subscribe(userID int) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, streamBuffer)
+
+	s.mu.Lock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan models.Notification]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers[userID], ch)
+		if len(s.subscribers[userID]) == 0 {
+			delete(s.subscribers, userID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// deliver hands a notification to the recipient's local streams
+func (s *NotificationStream) deliver(n models.Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+			// The client can catch up from its inbox; don't block the others
+			log.Printf("⚠️  Notification stream for user %d is full, dropping notification %d", n.UserID, n.ID)
+		}
+	}
+}
+
+// Run relays notifications published on Redis to the local streams until
+// ctx is cancelled.
+func (s *NotificationStream) Run(ctx context.Context) {
+	sub := s.redis.Subscribe(ctx, notificationChannel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Notification stream stopped")
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				log.Println("❌ Notification stream subscription closed")
+				return
+			}
+			var n models.Notification
+			if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+				log.Println("❌ Malformed streamed notification:", err)
+				continue
+			}
+			s.deliver(n)
+		}
+	}
+}
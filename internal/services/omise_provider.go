@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"used2book-backend/internal/models"
+
+	"github.com/omise/omise-go"
+)
+
+// OmiseProvider takes PromptPay QR payments through Omise. A PromptPay charge
+// covers one listing, so cart checkouts aren't supported.
+type OmiseProvider struct {
+	omise *OmiseService
+}
+
+func NewOmiseProvider(omiseService *OmiseService) *OmiseProvider {
+	return &OmiseProvider{omise: omiseService}
+}
+
+// omiseEvent is the envelope Omise posts to the webhook endpoint
+type omiseEvent struct {
+	ID   string          `json:"id"`
+	Key  string          `json:"key"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (op *OmiseProvider) Name() string {
+	return models.PaymentProviderOmise
+}
+
+func (op *OmiseProvider) CreateCheckout(ctx context.Context, req models.CheckoutSessionRequest) (*models.CheckoutSession, error) {
+	if len(req.Items) != 1 {
+		return nil, fmt.Errorf("%w: PromptPay pays for one listing at a time", ErrUnsupportedCheckout)
+	}
+	item := req.Items[0]
+
+	metadata := make(map[string]interface{}, len(req.Metadata))
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+
+	description := fmt.Sprintf("Book purchase for listing %d", item.ListingID)
+	charge, err := op.omise.CreatePromptPayChargeWithMetadata(toSatang(item.Amount), description, req.ExpiresInMinutes, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.CheckoutSession{
+		Provider:  op.Name(),
+		SessionID: charge.ID,
+		ExpiresAt: charge.ExpiresAt,
+	}
+	if charge.Source != nil && charge.Source.ScannableCode != nil && charge.Source.ScannableCode.Image != nil {
+		session.QRCodeURL = charge.Source.ScannableCode.Image.DownloadURI
+	}
+	return session, nil
+}
+
+func (op *OmiseProvider) ExpireCheckout(ctx context.Context, sessionID string) error {
+	return op.omise.ExpireCharge(sessionID)
+}
+
+func (op *OmiseProvider) VerifyWebhook(payload []byte, header http.Header) error {
+	return op.omise.VerifyWebhookSignature(payload, header.Get("Omise-Signature"), header.Get("Omise-Signature-Timestamp"))
+}
+
+// ParseWebhookEvent handles charge.complete (successful or failed) and
+// charge.expire for PromptPay charges
+func (op *OmiseProvider) ParseWebhookEvent(payload []byte) (*models.PaymentEvent, error) {
+	var event omiseEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if event.ID == "" {
+		return nil, fmt.Errorf("event has no ID")
+	}
+
+	pe := &models.PaymentEvent{
+		Provider: op.Name(),
+		EventID:  event.ID,
+		RawType:  event.Key,
+		Type:     models.PaymentEventIgnored,
+	}
+	if event.Key != "charge.complete" && event.Key != "charge.expire" {
+		return pe, nil
+	}
+
+	var charge omise.Charge
+	if err := json.Unmarshal(event.Data, &charge); err != nil {
+		return nil, fmt.Errorf("failed to parse charge: %w", err)
+	}
+	if charge.Source == nil || charge.Source.Type != "promptpay" {
+		return pe, nil
+	}
+
+	switch omiseChargeStatus(&charge) {
+	case models.PaymentStatusSucceeded:
+		pe.Type = models.PaymentEventSucceeded
+	case models.PaymentStatusFailed:
+		pe.Type = models.PaymentEventFailed
+	default:
+		return pe, nil
+	}
+
+	pe.SessionID = charge.ID
+	pe.Reference = charge.ID
+	pe.Amount = float64(charge.Amount) / 100
+	// Metadata values come back as JSON numbers or strings
+	pe.Metadata = make(map[string]string, len(charge.Metadata))
+	for k, v := range charge.Metadata {
+		pe.Metadata[k] = fmt.Sprint(v)
+	}
+	return pe, nil
+}
+
+func (op *OmiseProvider) Refund(ctx context.Context, reference string, amount float64) error {
+	satang := toSatang(amount)
+	if satang == 0 {
+		charge, err := op.omise.GetCharge(reference)
+		if err != nil {
+			return err
+		}
+		satang = charge.Amount - charge.Refunded
+	}
+	return op.omise.RefundCharge(reference, satang)
+}
+
+func (op *OmiseProvider) GetStatus(ctx context.Context, reference string) (string, error) {
+	charge, err := op.omise.GetCharge(reference)
+	if err != nil {
+		return "", err
+	}
+	return omiseChargeStatus(charge), nil
+}
+
+func omiseChargeStatus(charge *omise.Charge) string {
+	switch charge.Status {
+	case omise.ChargeSuccessful:
+		if charge.Refunded > 0 && charge.Refunded >= charge.Amount {
+			return models.PaymentStatusRefunded
+		}
+		return models.PaymentStatusSucceeded
+	case omise.ChargeFailed, omise.ChargeReversed, "expired":
+		return models.PaymentStatusFailed
+	default:
+		return models.PaymentStatusPending
+	}
+}
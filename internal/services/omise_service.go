@@ -1,9 +1,19 @@
 package services
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/omise/omise-go"
@@ -12,20 +22,35 @@ import (
 
 // OmiseService handles Omise API interactions
 type OmiseService struct {
-	Client *omise.Client
+	Client    *omise.Client
+	secretKey string
 }
 
 // NewOmiseService initializes Omise with API keys
 func NewOmiseService() *OmiseService {
-	client, err := omise.NewClient(os.Getenv("OMISE_PUBLIC_KEY"), os.Getenv("OMISE_SECRET_KEY"))
+	secretKey := os.Getenv("OMISE_SECRET_KEY")
+	client, err := omise.NewClient(os.Getenv("OMISE_PUBLIC_KEY"), secretKey)
 	if err != nil {
 		log.Fatal("Omise client error:", err)
 	}
-	return &OmiseService{Client: client}
+	return &OmiseService{Client: client, secretKey: secretKey}
 }
 
 // services/omise_service.go
 func (o *OmiseService) CreatePromptPayCharge(amount int64, listingID int, sellerRecipientID string, buyerID int, expiresInMinutes int, offerID *int) (*omise.Charge, error) {
+    metadata := map[string]interface{}{
+        "listing_id": listingID,
+        "buyer_id":   buyerID,
+    }
+    if offerID != nil {
+        metadata["offer_id"] = *offerID
+    }
+    return o.CreatePromptPayChargeWithMetadata(amount, fmt.Sprintf("Book purchase for listing %d", listingID), expiresInMinutes, metadata)
+}
+
+// CreatePromptPayChargeWithMetadata creates a PromptPay source and a charge on
+// it that expires after expiresInMinutes. The charge's source carries the QR code.
+func (o *OmiseService) CreatePromptPayChargeWithMetadata(amount int64, description string, expiresInMinutes int, metadata map[string]interface{}) (*omise.Charge, error) {
     source := &omise.Source{}
     createSource := &operations.CreateSource{
         Type:     "promptpay",
@@ -42,15 +67,9 @@ func (o *OmiseService) CreatePromptPayCharge(amount int64, listingID int, seller
         Amount:      amount,
         Currency:    "THB",
         Source:      source.ID,
-        Description: fmt.Sprintf("Book purchase for listing %d", listingID),
+        Description: description,
         ExpiresAt:   &expiresAt,
-        Metadata: map[string]interface{}{
-            "listing_id": listingID,
-            "buyer_id":   buyerID,
-        },
-    }
-    if offerID != nil {
-        createCharge.Metadata["offer_id"] = *offerID
+        Metadata:    metadata,
     }
     if err := o.Client.Do(charge, createCharge); err != nil {
         return nil, fmt.Errorf("failed to create PromptPay charge: %v", err)
@@ -58,6 +77,85 @@ func (o *OmiseService) CreatePromptPayCharge(amount int64, listingID int, seller
     return charge, nil
 }
 
+// GetCharge fetches a charge's current state from Omise
+func (o *OmiseService) GetCharge(chargeID string) (*omise.Charge, error) {
+	charge := &omise.Charge{}
+	if err := o.Client.Do(charge, &operations.RetrieveCharge{ChargeID: chargeID}); err != nil {
+		return nil, fmt.Errorf("failed to retrieve charge: %v", err)
+	}
+	return charge, nil
+}
+
+// RefundCharge refunds amount satangs of a charge
+func (o *OmiseService) RefundCharge(chargeID string, amount int64) error {
+	refund := &omise.Refund{}
+	if err := o.Client.Do(refund, &operations.CreateRefund{ChargeID: chargeID, Amount: amount}); err != nil {
+		return fmt.Errorf("failed to refund charge: %v", err)
+	}
+	return nil
+}
+
+// ExpireCharge expires a pending charge so its PromptPay QR code can no longer
+// be paid. omise-go has no operation for this endpoint, so it is called
+// directly.
+func (o *OmiseService) ExpireCharge(chargeID string) error {
+	req, err := http.NewRequest(http.MethodPost, "https://api.omise.co/charges/"+url.PathEscape(chargeID)+"/expire", nil)
+	if err != nil {
+		return fmt.Errorf("failed to build expire request: %v", err)
+	}
+	req.SetBasicAuth(o.secretKey, "")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to expire charge: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to expire charge %s: %s %s", chargeID, resp.Status, body)
+	}
+	return nil
+}
+
+// omiseWebhookTolerance is how old a signed webhook timestamp may be before
+// the delivery is treated as a replay.
+const omiseWebhookTolerance = 5 * time.Minute
+
+// VerifyWebhookSignature checks the Omise-Signature header against the raw
+// request body. Omise signs "<timestamp>.<body>" with HMAC-SHA256 using the
+// base64-decoded OMISE_WEBHOOK_SECRET; the header may carry several
+// comma-separated signatures while a secret is being rotated.
+func (o *OmiseService) VerifyWebhookSignature(payload []byte, signatureHeader string, timestamp string) error {
+	secret, err := base64.StdEncoding.DecodeString(os.Getenv("OMISE_WEBHOOK_SECRET"))
+	if err != nil || len(secret) == 0 {
+		return errors.New("OMISE_WEBHOOK_SECRET is not configured")
+	}
+	if signatureHeader == "" || timestamp == "" {
+		return errors.New("missing webhook signature headers")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp: %v", err)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > omiseWebhookTolerance || age < -omiseWebhookTolerance {
+		return errors.New("webhook timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, sig := range strings.Split(signatureHeader, ",") {
+		decoded, err := hex.DecodeString(strings.TrimSpace(sig))
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return errors.New("webhook signature mismatch")
+}
+
 // GetRecipient fetches a recipient's details from Omise
 func (o *OmiseService) GetRecipient(recipientID string) (*omise.Recipient, error) {
 	recipient := &omise.Recipient{}
@@ -105,4 +203,27 @@ func (o *OmiseService) UpdateRecipient(recipientID, bankAccountNumber, bankAccou
 		return "", fmt.Errorf("failed to update recipient: %v", err)
 	}
 	return recipient.ID, nil
-}
\ No newline at end of file
+}
+// CreateTransfer sends amount satangs from the platform's Omise balance to a
+// recipient's bank account
+func (o *OmiseService) CreateTransfer(recipientID string, amount int64, metadata map[string]interface{}) (*omise.Transfer, error) {
+	transfer := &omise.Transfer{}
+	createTransfer := &operations.CreateTransfer{
+		Amount:    amount,
+		Recipient: recipientID,
+		Metadata:  metadata,
+	}
+	if err := o.Client.Do(transfer, createTransfer); err != nil {
+		return nil, fmt.Errorf("failed to create transfer: %v", err)
+	}
+	return transfer, nil
+}
+
+// DeleteRecipient removes a recipient from Omise
+func (o *OmiseService) DeleteRecipient(recipientID string) error {
+	deletion := &omise.Deletion{}
+	if err := o.Client.Do(deletion, &operations.DestroyRecipient{RecipientID: recipientID}); err != nil {
+		return fmt.Errorf("failed to delete recipient: %v", err)
+	}
+	return nil
+}
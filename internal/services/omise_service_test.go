@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signOmise signs a webhook body the way Omise does
+func signOmise(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestOmiseVerifyWebhook(t *testing.T) {
+	secret := []byte("webhook-secret")
+	otherSecret := []byte("rotated-secret")
+	t.Setenv("OMISE_WEBHOOK_SECRET", base64.StdEncoding.EncodeToString(secret))
+
+	payload := []byte(`{"id":"evnt_test_1","key":"charge.complete"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*omiseWebhookTolerance).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(2*omiseWebhookTolerance).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		payload   []byte
+		wantErr   bool
+	}{
+		{name: "valid", signature: signOmise(secret, now, payload), timestamp: now, payload: payload},
+		{name: "one of several signatures", signature: signOmise(otherSecret, now, payload) + ", " + signOmise(secret, now, payload), timestamp: now, payload: payload},
+		{name: "wrong secret", signature: signOmise(otherSecret, now, payload), timestamp: now, payload: payload, wantErr: true},
+		{name: "tampered body", signature: signOmise(secret, now, payload), timestamp: now, payload: []byte(`{"id":"evnt_test_2"}`), wantErr: true},
+		{name: "timestamp not signed", signature: signOmise(secret, stale, payload), timestamp: now, payload: payload, wantErr: true},
+		{name: "stale timestamp", signature: signOmise(secret, stale, payload), timestamp: stale, payload: payload, wantErr: true},
+		{name: "future timestamp", signature: signOmise(secret, future, payload), timestamp: future, payload: payload, wantErr: true},
+		{name: "malformed timestamp", signature: signOmise(secret, "yesterday", payload), timestamp: "yesterday", payload: payload, wantErr: true},
+		{name: "missing signature", timestamp: now, payload: payload, wantErr: true},
+		{name: "missing timestamp", signature: signOmise(secret, now, payload), payload: payload, wantErr: true},
+	}
+
+	provider := NewOmiseProvider(&OmiseService{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("Omise-Signature", tt.signature)
+			}
+			if tt.timestamp != "" {
+				header.Set("Omise-Signature-Timestamp", tt.timestamp)
+			}
+			err := provider.VerifyWebhook(tt.payload, header)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOmiseVerifyWebhookWithoutSecret(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", "")
+
+	payload := []byte(`{"id":"evnt_test_1"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	// An empty key still produces an HMAC; it must not be accepted
+	header := http.Header{}
+	header.Set("Omise-Signature", signOmise(nil, now, payload))
+	header.Set("Omise-Signature-Timestamp", now)
+
+	if err := NewOmiseProvider(&OmiseService{}).VerifyWebhook(payload, header); err == nil {
+		t.Error("VerifyWebhook() accepted a delivery with no secret configured")
+	}
+}
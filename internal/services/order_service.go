@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const (
+	// defaultOrderAutoCompleteDays is how long after shipping an order
+	// completes on its own if the buyer never confirms receipt
+	// (ORDER_AUTO_COMPLETE_DAYS)
+	defaultOrderAutoCompleteDays = 7
+	orderAutoCompleteInterval    = 15 * time.Minute
+)
+
+var (
+	// ErrOrderNotFound is returned for an order that doesn't exist or that the
+	// user isn't a party to
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderTransition is returned when an order isn't in a state that
+	// allows the requested change
+	ErrOrderTransition = errors.New("order can't be changed from its current status")
+	// ErrInvalidOrderRequest wraps validation failures
+	ErrInvalidOrderRequest = errors.New("invalid order request")
+)
+
+// OrderService moves orders through fulfilment. Completing an order releases
+// its escrowed funds to the seller; cancelling one refunds the buyer.
+type OrderService struct {
+	orderRepo        *mysql.OrderRepository
+	escrow           *EscrowService
+	providers        *PaymentProviderRegistry
+	autoCompleteDays int
+}
+
+func NewOrderService(repo *mysql.OrderRepository, escrow *EscrowService, providers *PaymentProviderRegistry) *OrderService {
+	ors := &OrderService{
+		orderRepo:        repo,
+		escrow:           escrow,
+		providers:        providers,
+		autoCompleteDays: defaultOrderAutoCompleteDays,
+	}
+	if v := os.Getenv("ORDER_AUTO_COMPLETE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			log.Printf("⚠️  Invalid ORDER_AUTO_COMPLETE_DAYS %q, using %d", v, defaultOrderAutoCompleteDays)
+		} else {
+			ors.autoCompleteDays = days
+		}
+	}
+	return ors
+}
+
+// CreateSessionOrders opens orders for a paid checkout session. Call it with
+// the webhook's transaction ctx.
+func (ors *OrderService) CreateSessionOrders(ctx context.Context, sessionID string) error {
+	return ors.orderRepo.CreateSessionOrders(ctx, sessionID)
+}
+
+func (ors *OrderService) ListOrders(ctx context.Context, userID int, asSeller bool, status string, page models.PageRequest) ([]models.Order, *models.PageInfo, error) {
+	return ors.orderRepo.ListOrders(ctx, userID, asSeller, status, page)
+}
+
+// GetOrder returns an order the user is the buyer or seller of
+func (ors *OrderService) GetOrder(ctx context.Context, orderID int, userID int) (*models.Order, error) {
+	order, err := ors.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || (order.BuyerID != userID && order.SellerID != userID) {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// Ship adds the seller's carrier and tracking number, moving a paid order to
+// shipped. Tracking on an already shipped order can be corrected.
+func (ors *OrderService) Ship(ctx context.Context, orderID int, sellerID int, req models.ShipOrderRequest) (*models.Order, error) {
+	carrier := strings.TrimSpace(req.Carrier)
+	trackingNumber := strings.TrimSpace(req.TrackingNumber)
+	if carrier == "" || trackingNumber == "" {
+		return nil, fmt.Errorf("%w: carrier and tracking_number are required", ErrInvalidOrderRequest)
+	}
+	if len(carrier) > 100 || len(trackingNumber) > 100 {
+		return nil, fmt.Errorf("%w: carrier and tracking_number must be at most 100 characters", ErrInvalidOrderRequest)
+	}
+
+	order, err := ors.sellerOrder(ctx, orderID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderPaid && order.Status != models.OrderShipped {
+		return nil, ErrOrderTransition
+	}
+
+	ok, err := ors.orderRepo.ShipOrder(ctx, orderID, sellerID, carrier, trackingNumber, ors.autoCompleteDays)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && order.Status == models.OrderPaid {
+		return nil, ErrOrderTransition
+	}
+	return ors.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// MarkDelivered records that the carrier delivered a shipped order
+func (ors *OrderService) MarkDelivered(ctx context.Context, orderID int, sellerID int) (*models.Order, error) {
+	if _, err := ors.sellerOrder(ctx, orderID, sellerID); err != nil {
+		return nil, err
+	}
+
+	ok, err := ors.orderRepo.MarkDelivered(ctx, orderID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrOrderTransition
+	}
+	return ors.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// ConfirmReceipt completes an order for the buyer and releases the seller's
+// funds in the same transaction
+func (ors *OrderService) ConfirmReceipt(ctx context.Context, orderID int, buyerID int) (*models.Order, error) {
+	order, err := ors.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.BuyerID != buyerID {
+		return nil, ErrOrderNotFound
+	}
+
+	err = ors.orderRepo.RunInTx(ctx, func(ctx context.Context) error {
+		ok, err := ors.orderRepo.CompleteOrder(ctx, orderID, buyerID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrOrderTransition
+		}
+		return ors.escrow.ReleaseTransactionFunds(ctx, order.TransactionID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ors.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// Cancel cancels an order that hasn't shipped and refunds the buyer through
+// the provider that took the payment. Either party may cancel.
+func (ors *OrderService) Cancel(ctx context.Context, orderID int, userID int, reason string) (*models.Order, error) {
+	order, err := ors.GetOrder(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderPaid {
+		return nil, ErrOrderTransition
+	}
+	provider, err := ors.providers.Get(order.PaymentProvider)
+	if err != nil {
+		return nil, err
+	}
+	if order.PaymentReference == "" {
+		return nil, fmt.Errorf("order %d has no payment reference to refund", orderID)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > 255 {
+		return nil, fmt.Errorf("%w: reason must be at most 255 characters", ErrInvalidOrderRequest)
+	}
+
+	// The refund goes last so a failure rolls the cancellation back
+	err = ors.orderRepo.RunInTx(ctx, func(ctx context.Context) error {
+		ok, err := ors.orderRepo.CancelOrder(ctx, order, reason)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrOrderTransition
+		}
+		if err := ors.escrow.RefundTransactionFunds(ctx, order.TransactionID); err != nil {
+			return err
+		}
+		return provider.Refund(ctx, order.PaymentReference, order.Amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ors.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// CancelPaymentOrders cancels the open orders of a payment the provider
+// refunded. Call it with the webhook's transaction ctx.
+func (ors *OrderService) CancelPaymentOrders(ctx context.Context, reference string, reason string) ([]models.Order, error) {
+	return ors.orderRepo.CancelPaymentOrders(ctx, reference, reason)
+}
+
+// RunAutoCompleteWorker periodically completes shipped orders whose buyer
+// never confirmed receipt, releasing their funds. notify is called for each
+// completed order. It stops when ctx is cancelled.
+func (ors *OrderService) RunAutoCompleteWorker(ctx context.Context, notify func(order *models.Order)) {
+	ticker := time.NewTicker(orderAutoCompleteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ids, err := ors.orderRepo.GetOrdersDueForCompletion(ctx)
+			if err != nil {
+				log.Println("❌ Order auto-complete Error:", err)
+				continue
+			}
+			for _, id := range ids {
+				order, err := ors.autoComplete(ctx, id)
+				if err != nil {
+					log.Println("❌ Auto-complete Error for order", id, ":", err)
+					continue
+				}
+				if order != nil {
+					log.Printf("Order %d auto-completed", id)
+					notify(order)
+				}
+			}
+		case <-ctx.Done():
+			log.Println("Order auto-complete worker stopped")
+			return
+		}
+	}
+}
+
+func (ors *OrderService) autoComplete(ctx context.Context, orderID int) (*models.Order, error) {
+	order, err := ors.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil || order == nil {
+		return nil, err
+	}
+
+	completed := false
+	err = ors.orderRepo.RunInTx(ctx, func(ctx context.Context) error {
+		ok, err := ors.orderRepo.AutoCompleteOrder(ctx, orderID)
+		if err != nil || !ok {
+			// !ok: the buyer confirmed in the meantime
+			return err
+		}
+		completed = true
+		return ors.escrow.ReleaseTransactionFunds(ctx, order.TransactionID)
+	})
+	if err != nil || !completed {
+		return nil, err
+	}
+	return ors.orderRepo.GetOrderByID(ctx, orderID)
+}
+
+// sellerOrder loads an order belonging to the seller
+func (ors *OrderService) sellerOrder(ctx context.Context, orderID int, sellerID int) (*models.Order, error) {
+	order, err := ors.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.SellerID != sellerID {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
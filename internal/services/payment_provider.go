@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"used2book-backend/internal/models"
+)
+
+// ErrUnsupportedCheckout is returned when a provider can't take a checkout of
+// the requested shape, e.g. several listings in one PromptPay charge.
+var ErrUnsupportedCheckout = errors.New("checkout not supported by this payment provider")
+
+// ErrUnknownPaymentProvider is returned for a provider name that isn't configured
+var ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+
+// PaymentProvider is a payment gateway the marketplace can take money through.
+// Checkout and webhook flows only talk to this interface, so Stripe, Omise and
+// the in-memory fake are interchangeable.
+type PaymentProvider interface {
+	// Name is the provider key stored on transactions and the webhook ledger
+	Name() string
+	// CreateCheckout starts a payment for the given listings
+	CreateCheckout(ctx context.Context, req models.CheckoutSessionRequest) (*models.CheckoutSession, error)
+	// ExpireCheckout closes an unpaid checkout so it can no longer be paid
+	ExpireCheckout(ctx context.Context, sessionID string) error
+	// VerifyWebhook checks a webhook delivery's signature against its raw body
+	VerifyWebhook(payload []byte, header http.Header) error
+	// ParseWebhookEvent translates an already verified payload. It is also
+	// used to replay stored events, which no longer have their headers.
+	ParseWebhookEvent(payload []byte) (*models.PaymentEvent, error)
+	// Refund returns amount (in THB) of a payment; 0 refunds all of it
+	Refund(ctx context.Context, reference string, amount float64) error
+	// GetStatus asks the provider for a payment's current models.PaymentStatus*
+	GetStatus(ctx context.Context, reference string) (string, error)
+}
+
+// PaymentProviderRegistry holds the configured providers and picks one for a
+// checkout.
+type PaymentProviderRegistry struct {
+	providers map[string]PaymentProvider
+	fallback  string
+}
+
+func NewPaymentProviderRegistry(fallback string) *PaymentProviderRegistry {
+	return &PaymentProviderRegistry{providers: map[string]PaymentProvider{}, fallback: fallback}
+}
+
+func (pr *PaymentProviderRegistry) Register(provider PaymentProvider) {
+	pr.providers[provider.Name()] = provider
+}
+
+// Get returns a configured provider by name
+func (pr *PaymentProviderRegistry) Get(name string) (PaymentProvider, error) {
+	provider, ok := pr.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPaymentProvider, name)
+	}
+	return provider, nil
+}
+
+// Resolve picks the provider for a checkout: the one asked for in the request,
+// else the buyer's saved preference if it is still configured, else the
+// default.
+func (pr *PaymentProviderRegistry) Resolve(requested string, preferred string) (PaymentProvider, error) {
+	if requested != "" {
+		return pr.Get(requested)
+	}
+	if provider, ok := pr.providers[preferred]; ok {
+		return provider, nil
+	}
+	return pr.Get(pr.fallback)
+}
+
+// Names lists the configured providers
+func (pr *PaymentProviderRegistry) Names() []string {
+	names := make([]string, 0, len(pr.providers))
+	for name := range pr.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPaymentProvidersFromEnv registers every provider that has credentials in
+// the environment. Stripe stays the default. The fake provider is only added
+// when PAYMENT_FAKE_PROVIDER=true, for local development.
+func NewPaymentProvidersFromEnv() *PaymentProviderRegistry {
+	registry := NewPaymentProviderRegistry(models.PaymentProviderStripe)
+
+	if key := os.Getenv("STRIPE_SECRET_KEY"); key != "" {
+		registry.Register(NewStripeProvider(key, os.Getenv("STRIPE_WEBHOOK_SECRET")))
+	} else {
+		log.Println("⚠️  STRIPE_SECRET_KEY not set, Stripe payments disabled")
+	}
+
+	if os.Getenv("OMISE_SECRET_KEY") != "" {
+		registry.Register(NewOmiseProvider(NewOmiseService()))
+	}
+
+	if os.Getenv("PAYMENT_FAKE_PROVIDER") == "true" {
+		registry.Register(NewFakePaymentProvider(os.Getenv("PAYMENT_FAKE_WEBHOOK_SECRET")))
+	}
+
+	return registry
+}
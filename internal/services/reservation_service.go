@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const (
+	// defaultHoldMinutes is how long a listing is held while the buyer picks
+	// how to pay (RESERVATION_HOLD_MINUTES)
+	defaultHoldMinutes = 2
+	// defaultStripeHoldMinutes and defaultOmiseHoldMinutes are how long a
+	// checkout with each provider stays payable; the listing is held for the
+	// same time (RESERVATION_HOLD_MINUTES_STRIPE, RESERVATION_HOLD_MINUTES_OMISE)
+	defaultStripeHoldMinutes = 30
+	defaultOmiseHoldMinutes  = 15
+	// minStripeHoldMinutes and maxStripeHoldMinutes bound the Stripe hold:
+	// Stripe Checkout rejects an expires_at outside 30 minutes to 24 hours
+	minStripeHoldMinutes = 30
+	maxStripeHoldMinutes = 24 * 60
+	// defaultWaitlistHoldMinutes is how long a buyer promoted off the
+	// waitlist has to start paying (RESERVATION_WAITLIST_HOLD_MINUTES)
+	defaultWaitlistHoldMinutes = 15
+	// maxReservationSweepInterval caps how long the expiry worker sleeps, so
+	// waitlists held up by an unpaid offer move on soon after it expires
+	maxReservationSweepInterval = 30 * time.Second
+	// defaultReminderMinutes is how long before a hold runs out its buyer is
+	// reminded to pay
+	defaultReminderMinutes = 5
+)
+
+var (
+	// ErrWaitlistUnavailable is returned when joining the waitlist of a
+	// listing that isn't reserved by another buyer
+	ErrWaitlistUnavailable = errors.New("only listings reserved by another buyer have a waitlist")
+	// ErrNotOnWaitlist is returned when the user isn't waiting for the listing
+	ErrNotOnWaitlist = errors.New("not on the waitlist for this listing")
+)
+
+// ReservationService holds listings for buyers while they pay. Each hold runs
+// for a configurable time per payment method; when one ends without a sale
+// the listing goes to the next buyer on its waitlist or, when nobody is
+// waiting, the offers the hold suspended come back.
+type ReservationService struct {
+	reservationRepo     *mysql.ReservationRepository
+	holdMinutes         map[string]int
+	defaultHoldMinutes  int
+	waitlistHoldMinutes int
+	reminderWindow      time.Duration
+}
+
+func NewReservationService(repo *mysql.ReservationRepository) *ReservationService {
+	return &ReservationService{
+		reservationRepo: repo,
+		holdMinutes: map[string]int{
+			models.PaymentProviderStripe: stripeHoldMinutes(),
+			models.PaymentProviderOmise:  envPositiveInt("RESERVATION_HOLD_MINUTES_OMISE", defaultOmiseHoldMinutes),
+		},
+		defaultHoldMinutes:  envPositiveInt("RESERVATION_HOLD_MINUTES", defaultHoldMinutes),
+		waitlistHoldMinutes: envPositiveInt("RESERVATION_WAITLIST_HOLD_MINUTES", defaultWaitlistHoldMinutes),
+		reminderWindow:      time.Duration(envPositiveInt("RESERVATION_REMINDER_MINUTES", defaultReminderMinutes)) * time.Minute,
+	}
+}
+
+// stripeHoldMinutes reads RESERVATION_HOLD_MINUTES_STRIPE, clamped to what
+// Stripe accepts so a bad value can't make every Stripe checkout fail
+func stripeHoldMinutes() int {
+	minutes := envPositiveInt("RESERVATION_HOLD_MINUTES_STRIPE", defaultStripeHoldMinutes)
+	clamped := min(max(minutes, minStripeHoldMinutes), maxStripeHoldMinutes)
+	if clamped != minutes {
+		log.Printf("⚠️  RESERVATION_HOLD_MINUTES_STRIPE %d is outside the %d-%d minutes Stripe accepts, using %d",
+			minutes, minStripeHoldMinutes, maxStripeHoldMinutes, clamped)
+	}
+	return clamped
+}
+
+// HoldMinutes is how long a checkout with provider stays payable and the
+// listing is held for. Unknown providers get the Stripe time.
+func (rs *ReservationService) HoldMinutes(provider string) int {
+	if minutes, ok := rs.holdMinutes[provider]; ok {
+		return minutes
+	}
+	return rs.holdMinutes[models.PaymentProviderStripe]
+}
+
+// ReserveListing holds a listing for a buyer, for their accepted offer when
+// offerID is set, until they start a checkout. It returns the competing
+// offers that were suspended.
+func (rs *ReservationService) ReserveListing(ctx context.Context, listingID int, buyerID int, offerID *int) (bool, []models.OfferUpdate, error) {
+	var suspended []models.OfferUpdate
+	reserved := false
+	err := rs.reservationRepo.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		reserved, err = rs.reservationRepo.ReserveListing(ctx, listingID, buyerID, offerID, models.HoldSourceCheckout, rs.defaultHoldMinutes)
+		if err != nil || !reserved {
+			return err
+		}
+		suspended, err = rs.reservationRepo.SuspendCompetingOffers(ctx, listingID, buyerID)
+		return err
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return reserved, suspended, nil
+}
+
+// ExtendReservation stretches a buyer's hold to the lifetime of the checkout
+// they started with provider
+func (rs *ReservationService) ExtendReservation(ctx context.Context, listingID int, buyerID int, provider string) (bool, error) {
+	return rs.reservationRepo.ExtendReservation(ctx, listingID, buyerID, rs.HoldMinutes(provider), provider)
+}
+
+func (rs *ReservationService) IsListingReserved(ctx context.Context, listingID int) (bool, bool, error) {
+	return rs.reservationRepo.IsListingReserved(ctx, listingID)
+}
+
+// ReserveCartListings reserves the selected cart listings all-or-nothing for
+// a checkout with provider and returns the competing offers that were
+// suspended
+func (rs *ReservationService) ReserveCartListings(ctx context.Context, buyerID int, listingIDs []int, provider string) ([]models.CartCheckoutItem, []models.OfferUpdate, error) {
+	var items []models.CartCheckoutItem
+	var suspended []models.OfferUpdate
+	err := rs.reservationRepo.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		items, err = rs.reservationRepo.ReserveCartListings(ctx, buyerID, listingIDs, rs.HoldMinutes(provider), provider)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			updates, err := rs.reservationRepo.SuspendCompetingOffers(ctx, item.ListingID, buyerID)
+			if err != nil {
+				return err
+			}
+			suspended = append(suspended, updates...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, suspended, nil
+}
+
+// afterRelease hands a listing that's for sale again to the next buyer on
+// its waitlist or, failing that, reinstates the offers suspended on it
+func (rs *ReservationService) afterRelease(ctx context.Context, listingID int) (*models.HoldRelease, error) {
+	res := &models.HoldRelease{}
+	hold, err := rs.reservationRepo.PromoteNextWaiting(ctx, listingID, rs.waitlistHoldMinutes)
+	if err != nil {
+		return nil, err
+	}
+	if hold != nil {
+		res.Promoted = append(res.Promoted, *hold)
+		res.Suspended, err = rs.reservationRepo.SuspendCompetingOffers(ctx, listingID, hold.BuyerID)
+		return res, err
+	}
+	res.Reinstated, err = rs.reservationRepo.ReinstateCompetingOffers(ctx, listingID)
+	return res, err
+}
+
+// release runs a repository release and, when it freed the listing, moves it
+// on with afterRelease
+func (rs *ReservationService) release(ctx context.Context, listingID int, fn func(ctx context.Context) (bool, error)) (*models.HoldRelease, error) {
+	var res *models.HoldRelease
+	err := rs.reservationRepo.RunInTx(ctx, func(ctx context.Context) error {
+		released, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if !released {
+			return fmt.Errorf("no reserved listing found with ID %d", listingID)
+		}
+		res, err = rs.afterRelease(ctx, listingID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExpireReservedListing ends a hold. With a nil buyerID only a lapsed hold is
+// ended. With a buyerID the hold is released right away, but only if that
+// buyer still has it (their payment session is over, and the listing may
+// since have been reserved by someone else).
+func (rs *ReservationService) ExpireReservedListing(ctx context.Context, listingID int, buyerID *int) (*models.HoldRelease, error) {
+	return rs.release(ctx, listingID, func(ctx context.Context) (bool, error) {
+		if buyerID == nil {
+			return rs.reservationRepo.ExpireReservation(ctx, listingID)
+		}
+		return rs.reservationRepo.ReleaseReservation(ctx, listingID, *buyerID)
+	})
+}
+
+// RevertOfferReservation releases the hold an accepted offer's buyer has on a
+// listing. The offer stays accepted so the buyer can try again.
+func (rs *ReservationService) RevertOfferReservation(ctx context.Context, listingID int, offerID int) (*models.HoldRelease, error) {
+	return rs.release(ctx, listingID, func(ctx context.Context) (bool, error) {
+		return rs.reservationRepo.ReleaseOfferReservation(ctx, listingID, offerID)
+	})
+}
+
+// ReleaseReservedListings releases the buyer's holds on several listings, e.g.
+// when the cart checkout for them could not be created. A listing that can't
+// be released doesn't stop the rest; the errors are returned together.
+func (rs *ReservationService) ReleaseReservedListings(ctx context.Context, buyerID int, listingIDs []int) (*models.HoldRelease, error) {
+	res := &models.HoldRelease{}
+	var errs []error
+	for _, id := range listingIDs {
+		r, err := rs.ExpireReservedListing(ctx, id, &buyerID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing %d: %w", id, err))
+			continue
+		}
+		res.Add(r)
+	}
+	return res, errors.Join(errs...)
+}
+
+// JoinWaitlist queues a buyer for a listing someone else has reserved
+func (rs *ReservationService) JoinWaitlist(ctx context.Context, listingID int, userID int) (*models.WaitlistEntry, error) {
+	joined, err := rs.reservationRepo.JoinWaitlist(ctx, listingID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !joined {
+		return nil, ErrWaitlistUnavailable
+	}
+	return rs.GetWaitlistEntry(ctx, listingID, userID)
+}
+
+func (rs *ReservationService) LeaveWaitlist(ctx context.Context, listingID int, userID int) error {
+	left, err := rs.reservationRepo.LeaveWaitlist(ctx, listingID, userID)
+	if err != nil {
+		return err
+	}
+	if !left {
+		return ErrNotOnWaitlist
+	}
+	return nil
+}
+
+// GetWaitlistEntry returns the user's place on a listing's waitlist
+func (rs *ReservationService) GetWaitlistEntry(ctx context.Context, listingID int, userID int) (*models.WaitlistEntry, error) {
+	entry, err := rs.reservationRepo.GetWaitlistEntry(ctx, listingID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, ErrNotOnWaitlist
+	}
+	return entry, nil
+}
+
+// GetMetrics reports how the holds of the last days ended
+func (rs *ReservationService) GetMetrics(ctx context.Context, days int) (*models.ReservationMetrics, error) {
+	return rs.reservationRepo.GetMetrics(ctx, time.Now().AddDate(0, 0, -days))
+}
+
+// RunExpiryWorker ends holds as they lapse, handing each listing to the next
+// buyer on its waitlist, and moves on waitlists an unpaid offer held up.
+// Instead of polling on a fixed tick it sleeps until the next hold is due.
+// notify is called for every release that promoted a buyer or reinstated
+// offers, and remind for every hold about to run out. It stops when ctx is
+// cancelled.
+func (rs *ReservationService) RunExpiryWorker(ctx context.Context, notify func(res models.HoldRelease), remind func(hold models.ListingHold)) {
+	for {
+		rs.sweep(ctx, notify)
+		rs.remind(ctx, remind)
+
+		timer := time.NewTimer(rs.nextSweep(ctx))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("Reservation expiry worker stopped")
+			return
+		}
+	}
+}
+
+func (rs *ReservationService) sweep(ctx context.Context, notify func(res models.HoldRelease)) {
+	expired, err := rs.reservationRepo.ListExpiredReservations(ctx)
+	if err != nil {
+		log.Println("❌ Reservation expiry Error:", err)
+	}
+	for _, id := range expired {
+		res, err := rs.ExpireReservedListing(ctx, id, nil)
+		if err != nil {
+			log.Println("❌ Expire Error for listing", id, ":", err)
+			continue
+		}
+		log.Printf("Reservation on listing %d expired, %d buyers promoted, %d offers reinstated", id, len(res.Promoted), len(res.Reinstated))
+		notify(*res)
+	}
+
+	stalled, err := rs.reservationRepo.ListStalledWaitlists(ctx)
+	if err != nil {
+		log.Println("❌ Waitlist Error:", err)
+	}
+	for _, id := range stalled {
+		var res *models.HoldRelease
+		err := rs.reservationRepo.RunInTx(ctx, func(ctx context.Context) error {
+			var err error
+			res, err = rs.afterRelease(ctx, id)
+			return err
+		})
+		if err != nil {
+			log.Println("❌ Waitlist Error for listing", id, ":", err)
+			continue
+		}
+		notify(*res)
+	}
+}
+
+// remind hands the holds about to run out to remind. Reminders go out at
+// the latest one sweep interval after a hold enters the window.
+func (rs *ReservationService) remind(ctx context.Context, remind func(hold models.ListingHold)) {
+	holds, err := rs.reservationRepo.ClaimExpiringReservations(ctx, rs.reminderWindow)
+	if err != nil {
+		log.Println("❌ Reservation reminder Error:", err)
+	}
+	for _, hold := range holds {
+		remind(hold)
+	}
+}
+
+// nextSweep is how long to sleep until the next hold lapses
+func (rs *ReservationService) nextSweep(ctx context.Context) time.Duration {
+	next, err := rs.reservationRepo.NextReservationExpiry(ctx)
+	if err != nil {
+		log.Println("❌ Reservation expiry Error:", err)
+		return maxReservationSweepInterval
+	}
+	if next == nil {
+		return maxReservationSweepInterval
+	}
+	wait := time.Until(*next) + 100*time.Millisecond
+	if wait < time.Second {
+		// Don't spin when our clock and the database's disagree
+		wait = time.Second
+	}
+	if wait > maxReservationSweepInterval {
+		wait = maxReservationSweepInterval
+	}
+	return wait
+}
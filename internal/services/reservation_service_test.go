@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	testHoldListingID = 3
+	testWaitingID     = 12
+)
+
+// expectLapsedRelease expects ExpireReservation to put testHoldListingID
+// back on sale
+func expectLapsedRelease(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`UPDATE listings\s+SET status = 'for_sale'.*AND reserved_expires_at <= NOW\(\)`).
+		WithArgs(testHoldListingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE listing_holds SET status = \?, resolved_at = NOW\(\)`).
+		WithArgs(models.HoldExpired, testHoldListingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// offerRows returns rows the offer queries select
+func offerRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "seller_id", "offered_price"})
+}
+
+func TestExpireReservedListing(t *testing.T) {
+	tests := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		wantPromoted   []int // buyers
+		wantSuspended  []int // offers
+		wantReinstated []int // offers
+		wantErr        bool
+	}{
+		{
+			name: "hands the listing to the next buyer waiting",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLapsedRelease(mock)
+				mock.ExpectQuery(`SELECT w.id, w.user_id\s+FROM listing_waitlist w`).
+					WithArgs(testHoldListingID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(70, testWaitingID))
+				mock.ExpectExec(`UPDATE listings l\s+SET l.status = 'reserved'`).
+					WithArgs(testWaitingID, defaultWaitlistHoldMinutes, testHoldListingID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE listing_waitlist SET status = 'promoted'`).
+					WithArgs(70).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT id FROM listing_holds\s+WHERE listing_id = \? AND buyer_id = \? AND status = 'active'\s+FOR UPDATE`).
+					WithArgs(testHoldListingID, testWaitingID).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec(`UPDATE listing_holds SET status = \?`).
+					WithArgs(models.HoldExpired, testHoldListingID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO listing_holds`).
+					WithArgs(testWaitingID, nil, models.HoldSourceWaitlist, nil, testHoldListingID).
+					WillReturnResult(sqlmock.NewResult(90, 1))
+				mock.ExpectQuery(`SELECT id FROM listing_holds WHERE listing_id = \? AND buyer_id = \? AND status = 'active'$`).
+					WithArgs(testHoldListingID, testWaitingID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(90))
+				now := time.Now()
+				mock.ExpectQuery(`FROM listing_holds WHERE id = \?`).
+					WithArgs(90).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "listing_id", "buyer_id", "offer_id", "source", "payment_provider", "status", "expires_at", "created_at", "resolved_at"}).
+						AddRow(90, testHoldListingID, testWaitingID, nil, models.HoldSourceWaitlist, nil, "active", now.Add(15*time.Minute), now, nil))
+				mock.ExpectQuery(`o.buyer_id != \? AND o.status IN \('pending', 'countered'\)`).
+					WithArgs(testHoldListingID, testWaitingID).
+					WillReturnRows(offerRows().AddRow(22, testHoldListingID, 11, 5, 90.0))
+				mock.ExpectExec(`UPDATE offers SET suspended_from = status`).
+					WithArgs(models.OfferSuspended, 22).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO offer_history`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantPromoted:  []int{testWaitingID},
+			wantSuspended: []int{22},
+		},
+		{
+			name: "reinstates suspended offers when nobody is waiting",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLapsedRelease(mock)
+				mock.ExpectQuery(`SELECT w.id, w.user_id\s+FROM listing_waitlist w`).
+					WithArgs(testHoldListingID).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`o.status = 'suspended' AND o.suspended_from = \?`).
+					WithArgs(testHoldListingID, models.OfferPending).
+					WillReturnRows(offerRows().AddRow(22, testHoldListingID, 11, 5, 90.0))
+				mock.ExpectExec(`UPDATE offers SET\s+expires_at = expires_at`).
+					WithArgs(models.OfferPending, 22).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO offer_history`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`o.status = 'suspended' AND o.suspended_from = \?`).
+					WithArgs(testHoldListingID, models.OfferCountered).
+					WillReturnRows(offerRows())
+				mock.ExpectCommit()
+			},
+			wantReinstated: []int{22},
+		},
+		{
+			name: "hold that hasn't lapsed",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE listings\s+SET status = 'for_sale'`).
+					WithArgs(testHoldListingID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			rs := NewReservationService(mysql.NewReservationRepository(db))
+			mock.ExpectBegin()
+			tt.expect(mock)
+
+			res, err := rs.ExpireReservedListing(context.Background(), testHoldListingID, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpireReservedListing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var promoted, suspended, reinstated []int
+			for _, h := range res.Promoted {
+				promoted = append(promoted, h.BuyerID)
+			}
+			for _, u := range res.Suspended {
+				suspended = append(suspended, u.OfferID)
+			}
+			for _, u := range res.Reinstated {
+				reinstated = append(reinstated, u.OfferID)
+			}
+			if !sameIDs(promoted, tt.wantPromoted) || !sameIDs(suspended, tt.wantSuspended) || !sameIDs(reinstated, tt.wantReinstated) {
+				t.Errorf("promoted %v, suspended %v, reinstated %v; want %v, %v, %v",
+					promoted, suspended, reinstated, tt.wantPromoted, tt.wantSuspended, tt.wantReinstated)
+			}
+		})
+	}
+}
+
+func sameIDs(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+const (
+	// defaultSavedSearchIntervalMinutes is how often saved searches are
+	// checked for new listings (SAVED_SEARCH_INTERVAL_MINUTES)
+	defaultSavedSearchIntervalMinutes = 15
+	// savedSearchBatch bounds how many searches are checked per claim
+	savedSearchBatch = 100
+	// savedSearchListingLimit is how many new listings an alert points to
+	savedSearchListingLimit = 5
+	maxSavedSearchName      = 100
+)
+
+// ErrSavedSearchNotFound is returned for a saved search that doesn't exist or
+// belongs to someone else
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+// ErrSavedSearchLimit is returned when a user already has as many saved
+// searches as they can
+var ErrSavedSearchLimit = fmt.Errorf("you can save at most %d searches", models.MaxSavedSearches)
+
+// ErrInvalidSavedSearch is returned for a saved search that can't be saved
+var ErrInvalidSavedSearch = errors.New("invalid saved search")
+
+// SavedSearchService keeps users' saved searches and alerts them about new
+// listings that match
+type SavedSearchService struct {
+	savedSearchRepo *mysql.SavedSearchRepository
+	interval        time.Duration
+}
+
+func NewSavedSearchService(repo *mysql.SavedSearchRepository) *SavedSearchService {
+	return &SavedSearchService{
+		savedSearchRepo: repo,
+		interval:        time.Duration(envPositiveInt("SAVED_SEARCH_INTERVAL_MINUTES", defaultSavedSearchIntervalMinutes)) * time.Minute,
+	}
+}
+
+func (ss *SavedSearchService) ListSavedSearches(ctx context.Context, userID int) ([]models.SavedSearch, error) {
+	return ss.savedSearchRepo.ListSavedSearches(ctx, userID)
+}
+
+func (ss *SavedSearchService) GetSavedSearch(ctx context.Context, userID int, searchID int) (*models.SavedSearch, error) {
+	s, err := ss.savedSearchRepo.GetSavedSearch(ctx, userID, searchID)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrSavedSearchNotFound
+	}
+	return s, nil
+}
+
+// CreateSavedSearch saves a search for the user. Alerts are on unless the
+// form turns them off.
+func (ss *SavedSearchService) CreateSavedSearch(ctx context.Context, userID int, form models.SavedSearchForm) (*models.SavedSearch, error) {
+	if form.Query == nil {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidSavedSearch)
+	}
+	s := models.SavedSearch{UserID: userID, Query: *form.Query, Notify: true}
+	if form.Name != nil {
+		s.Name = *form.Name
+	}
+	if form.Notify != nil {
+		s.Notify = *form.Notify
+	}
+	if err := validateSavedSearch(&s); err != nil {
+		return nil, err
+	}
+
+	count, err := ss.savedSearchRepo.CountSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= models.MaxSavedSearches {
+		return nil, ErrSavedSearchLimit
+	}
+
+	id, err := ss.savedSearchRepo.CreateSavedSearch(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return ss.GetSavedSearch(ctx, userID, id)
+}
+
+// UpdateSavedSearch applies the fields set in form to one of the user's
+// saved searches. Changing the query or turning alerts back on only alerts
+// about listings created from then on.
+func (ss *SavedSearchService) UpdateSavedSearch(ctx context.Context, userID int, searchID int, form models.SavedSearchForm) (*models.SavedSearch, error) {
+	s, err := ss.GetSavedSearch(ctx, userID, searchID)
+	if err != nil {
+		return nil, err
+	}
+
+	skipExisting := false
+	if form.Name != nil {
+		s.Name = *form.Name
+	}
+	if form.Query != nil {
+		s.Query = *form.Query
+		skipExisting = true
+	}
+	if form.Notify != nil {
+		skipExisting = skipExisting || (*form.Notify && !s.Notify)
+		s.Notify = *form.Notify
+	}
+	if err := validateSavedSearch(s); err != nil {
+		return nil, err
+	}
+
+	if err := ss.savedSearchRepo.UpdateSavedSearch(ctx, *s, skipExisting); err != nil {
+		return nil, err
+	}
+	return ss.GetSavedSearch(ctx, userID, searchID)
+}
+
+func (ss *SavedSearchService) DeleteSavedSearch(ctx context.Context, userID int, searchID int) error {
+	found, err := ss.savedSearchRepo.DeleteSavedSearch(ctx, userID, searchID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+func validateSavedSearch(s *models.SavedSearch) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSavedSearch)
+	}
+	if len([]rune(s.Name)) > maxSavedSearchName {
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalidSavedSearch, maxSavedSearchName)
+	}
+	if err := s.Query.Normalize(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSavedSearch, err)
+	}
+	return nil
+}
+
+// RunMatchWorker periodically checks saved searches against the listings
+// put up or changed since their last check. notify is called for every
+// search that found new listings. It stops when ctx is cancelled.
+func (ss *SavedSearchService) RunMatchWorker(ctx context.Context, notify func(match models.SavedSearchMatch)) {
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ss.runSavedSearches(ctx, notify)
+		case <-ctx.Done():
+			log.Println("Saved search worker stopped")
+			return
+		}
+	}
+}
+
+func (ss *SavedSearchService) runSavedSearches(ctx context.Context, notify func(match models.SavedSearchMatch)) {
+	for ctx.Err() == nil {
+		// Half an interval keeps searches checked this tick out of the next
+		// claim while leaving them due again by the next tick
+		matches, run, err := ss.savedSearchRepo.RunSavedSearches(ctx, ss.interval/2, savedSearchBatch, savedSearchListingLimit)
+		if err != nil {
+			log.Println("❌ Saved search Error:", err)
+			return
+		}
+		for _, match := range matches {
+			log.Printf("Saved search %d matched %d new listings", match.SavedSearchID, match.Count)
+			notify(match)
+		}
+		if run < savedSearchBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+	"used2book-backend/internal/twiliootp"
+)
+
+// SMSChannel texts the notification's message to the recipient's phone
+// through Twilio. SMS is opt-in per category.
+type SMSChannel struct {
+	notificationRepo *mysql.NotificationRepository
+}
+
+func NewSMSChannel(repo *mysql.NotificationRepository) *SMSChannel {
+	return &SMSChannel{notificationRepo: repo}
+}
+
+func (sc *SMSChannel) Name() string {
+	return models.NotificationChannelSMS
+}
+
+func (sc *SMSChannel) Accepts(n models.Notification) bool {
+	return n.Message != ""
+}
+
+func (sc *SMSChannel) Deliver(ctx context.Context, n models.Notification) error {
+	if !sc.Accepts(n) {
+		return nil
+	}
+	recipient, err := sc.notificationRepo.GetRecipient(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	if recipient.PhoneNumber == "" {
+		return nil
+	}
+	return twiliootp.SendSMS(ctx, recipient.PhoneNumber, "Used2Book: "+n.Message)
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+	"used2book-backend/internal/models"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/client"
+	"github.com/stripe/stripe-go/v76/webhook"
+)
+
+// StripeProvider takes card payments through Stripe Checkout
+type StripeProvider struct {
+	api           *client.API
+	webhookSecret string
+	successURL    string
+	cancelURL     string
+}
+
+func NewStripeProvider(secretKey string, webhookSecret string) *StripeProvider {
+	api := &client.API{}
+	api.Init(secretKey, nil)
+	return &StripeProvider{
+		api:           api,
+		webhookSecret: webhookSecret,
+		successURL:    "http://localhost:3000/user/account/purchase",
+		cancelURL:     "http://localhost:3000/user/cancel",
+	}
+}
+
+func (sp *StripeProvider) Name() string {
+	return models.PaymentProviderStripe
+}
+
+func (sp *StripeProvider) CreateCheckout(ctx context.Context, req models.CheckoutSessionRequest) (*models.CheckoutSession, error) {
+	lineItems := make([]*stripe.CheckoutSessionLineItemParams, len(req.Items))
+	for i, item := range req.Items {
+		lineItems[i] = &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:   stripe.String("thb"),
+				UnitAmount: stripe.Int64(toSatang(item.Amount)),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(item.Title),
+				},
+			},
+			Quantity: stripe.Int64(1),
+		}
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+	params := &stripe.CheckoutSessionParams{
+		SuccessURL: stripe.String(sp.successURL),
+		CancelURL:  stripe.String(sp.cancelURL),
+		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems:  lineItems,
+		ExpiresAt:  stripe.Int64(expiresAt.Unix()),
+		Metadata:   req.Metadata,
+	}
+	params.Context = ctx
+
+	session, err := sp.api.CheckoutSessions.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Stripe session: %w", err)
+	}
+
+	return &models.CheckoutSession{
+		Provider:    sp.Name(),
+		SessionID:   session.ID,
+		CheckoutURL: session.URL,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+func (sp *StripeProvider) ExpireCheckout(ctx context.Context, sessionID string) error {
+	params := &stripe.CheckoutSessionExpireParams{}
+	params.Context = ctx
+	if _, err := sp.api.CheckoutSessions.Expire(sessionID, params); err != nil {
+		return fmt.Errorf("failed to expire Stripe session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+func (sp *StripeProvider) VerifyWebhook(payload []byte, header http.Header) error {
+	_, err := webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), sp.webhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	return err
+}
+
+func (sp *StripeProvider) ParseWebhookEvent(payload []byte) (*models.PaymentEvent, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	pe := &models.PaymentEvent{
+		Provider: sp.Name(),
+		EventID:  event.ID,
+		RawType:  string(event.Type),
+		Type:     models.PaymentEventIgnored,
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.expired", "checkout.session.async_payment_failed":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, fmt.Errorf("failed to parse session: %w", err)
+		}
+		pe.Type = models.PaymentEventFailed
+		if event.Type == "checkout.session.completed" {
+			pe.Type = models.PaymentEventSucceeded
+		}
+		pe.SessionID = session.ID
+		pe.Metadata = session.Metadata
+		pe.Amount = float64(session.AmountTotal) / 100
+		if session.PaymentIntent != nil {
+			pe.Reference = session.PaymentIntent.ID
+		}
+
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("failed to parse charge: %w", err)
+		}
+		// Partial refunds leave the sale in place; only a full refund reverses it
+		if charge.Refunded && charge.PaymentIntent != nil {
+			pe.Type = models.PaymentEventRefunded
+			pe.Reference = charge.PaymentIntent.ID
+			pe.Amount = float64(charge.AmountRefunded) / 100
+		}
+
+	case "charge.dispute.created":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return nil, fmt.Errorf("failed to parse dispute: %w", err)
+		}
+		if dispute.PaymentIntent != nil {
+			pe.Type = models.PaymentEventDisputed
+			pe.Reference = dispute.PaymentIntent.ID
+			pe.Amount = float64(dispute.Amount) / 100
+		}
+	}
+
+	return pe, nil
+}
+
+func (sp *StripeProvider) Refund(ctx context.Context, reference string, amount float64) error {
+	params := &stripe.RefundParams{PaymentIntent: stripe.String(reference)}
+	if amount > 0 {
+		params.Amount = stripe.Int64(toSatang(amount))
+	}
+	params.Context = ctx
+	if _, err := sp.api.Refunds.New(params); err != nil {
+		return fmt.Errorf("failed to refund Stripe payment %s: %w", reference, err)
+	}
+	return nil
+}
+
+func (sp *StripeProvider) GetStatus(ctx context.Context, reference string) (string, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.AddExpand("latest_charge")
+	params.Context = ctx
+	intent, err := sp.api.PaymentIntents.Get(reference, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Stripe payment %s: %w", reference, err)
+	}
+
+	switch intent.Status {
+	case stripe.PaymentIntentStatusSucceeded:
+		if intent.LatestCharge != nil && intent.LatestCharge.Refunded {
+			return models.PaymentStatusRefunded, nil
+		}
+		return models.PaymentStatusSucceeded, nil
+	case stripe.PaymentIntentStatusCanceled:
+		return models.PaymentStatusFailed, nil
+	default:
+		return models.PaymentStatusPending, nil
+	}
+}
+
+// toSatang converts a THB amount to the smallest currency unit
+func toSatang(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
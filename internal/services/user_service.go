@@ -2,20 +2,75 @@ package services
 
 import (
 	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
 	"used2book-backend/internal/models"
 	"used2book-backend/internal/repository/mysql"
 )
 
+const (
+	// defaultOfferExpiryHours is how long an offer or counter-offer waits for
+	// an answer (OFFER_EXPIRY_HOURS)
+	defaultOfferExpiryHours = 48
+	// defaultOfferPaymentHours is how long the buyer has to pay once an offer
+	// is accepted (OFFER_PAYMENT_HOURS)
+	defaultOfferPaymentHours = 24
+	offerExpiryInterval      = time.Minute
+
+	// defaultWishlistAlertCooldownHours is how long a user who was alerted
+	// about a wishlisted book only hears about cheaper copies of it
+	// (WISHLIST_ALERT_COOLDOWN_HOURS)
+	defaultWishlistAlertCooldownHours = 24
+	// defaultWishlistAlertDailyLimit caps the wishlist alerts a user gets a
+	// day (WISHLIST_ALERT_DAILY_LIMIT)
+	defaultWishlistAlertDailyLimit = 10
+)
+
+// ErrInvalidOfferPrice is returned for an offer or counter price that isn't
+// positive
+var ErrInvalidOfferPrice = errors.New("offer price must be greater than 0")
+
+// ErrInvalidMaxPrice is returned for a wishlist max price that isn't positive
+var ErrInvalidMaxPrice = errors.New("max price must be greater than 0")
+
 type UserService struct {
-	userRepo *mysql.UserRepository
+	userRepo                *mysql.UserRepository
+	offerExpiryHours        int
+	offerPaymentHours       int
+	wishlistAlertCooldown   time.Duration
+	wishlistAlertDailyLimit int
 }
 
 func NewUserService(repo *mysql.UserRepository) *UserService {
-	return &UserService{userRepo: repo}
+	return &UserService{
+		userRepo:                repo,
+		offerExpiryHours:        envPositiveInt("OFFER_EXPIRY_HOURS", defaultOfferExpiryHours),
+		offerPaymentHours:       envPositiveInt("OFFER_PAYMENT_HOURS", defaultOfferPaymentHours),
+		wishlistAlertCooldown:   time.Duration(envPositiveInt("WISHLIST_ALERT_COOLDOWN_HOURS", defaultWishlistAlertCooldownHours)) * time.Hour,
+		wishlistAlertDailyLimit: envPositiveInt("WISHLIST_ALERT_DAILY_LIMIT", defaultWishlistAlertDailyLimit),
+	}
 }
 
-func (us *UserService) GetAllUsers(ctx context.Context) ([]models.GetAllUsers, error) {
-	return us.userRepo.GetAllUsers(ctx)
+// envPositiveInt reads a positive number, e.g. of hours or minutes, from the
+// environment, falling back to def when it's unset or invalid
+func envPositiveInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("⚠️  Invalid %s %q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+func (us *UserService) GetAllUsers(ctx context.Context, page models.PageRequest) ([]models.GetAllUsers, *models.PageInfo, error) {
+	return us.userRepo.GetAllUsers(ctx, page)
 }
 
 // ✅ Fetch user by ID
@@ -32,10 +87,6 @@ func (us *UserService) GetUserPreferences(ctx context.Context, userID int) ([]mo
 	return us.userRepo.GetUserPreferredGenres(ctx, userID)
 }
 
-func (us *UserService) CreateBankAccount(ctx context.Context, bank *models.BankAccount) (int, error) {
-	return us.userRepo.CreateBankAccount(ctx, bank)
-}
-
 func (us *UserService) GetMe(ctx context.Context, userID int) (*models.GetMe, error) {
 
 	user, err := us.userRepo.FindByID(ctx, userID)
@@ -62,8 +113,8 @@ func (us *UserService) EditName(ctx context.Context, userID int, firstName strin
 	return us.userRepo.EditName(ctx, userID, firstName, lastName)
 }
 
-func (us *UserService) EditProfile(ctx context.Context, userID int, first_name string, last_name string, address string, quote string, bio string, phone_number string) error {
-	return us.userRepo.EditProfile(ctx, userID, first_name, last_name, address, quote, bio, phone_number)
+func (us *UserService) EditProfile(ctx context.Context, userID int, first_name string, last_name string, address string, province string, quote string, bio string, phone_number string) error {
+	return us.userRepo.EditProfile(ctx, userID, first_name, last_name, address, province, quote, bio, phone_number)
 }
 
 
@@ -75,8 +126,8 @@ func (us *UserService) AddBookToWishlist(ctx context.Context, userID int, bookID
 	return us.userRepo.AddBookToWishlist(ctx , userID, bookID)
 }
 
-func (us *UserService) AddBookToListing(ctx context.Context, userID int, bookID int, price float32, allow_offer bool, imageURLs []string, seller_note string, phone_number string)  (bool, error) {
-	return us.userRepo.AddBookToListing(ctx , userID, bookID, price, allow_offer, imageURLs, seller_note, phone_number)
+func (us *UserService) AddBookToListing(ctx context.Context, userID int, bookID int, price float32, allow_offer bool, imageURLs []string, seller_note string, phone_number string, condition models.ListingCondition, thresholds models.OfferThresholds)  (int, error) {
+	return us.userRepo.AddBookToListing(ctx , userID, bookID, price, allow_offer, imageURLs, seller_note, phone_number, condition, thresholds)
 }
 
 func (us *UserService) CountUsers() (int, error) {
@@ -87,8 +138,8 @@ func (us *UserService) GetUserLibrary(ctx context.Context, userID int) ([]models
 	return us.userRepo.GetUserLibrary(ctx, userID)
 }
 
-func (us *UserService) GetAllListings(ctx context.Context) ([]models.UserListing, error){
-	return us.userRepo.GetAllListings(ctx)
+func (us *UserService) GetAllListings(ctx context.Context, page models.PageRequest) ([]models.UserListing, *models.PageInfo, error){
+	return us.userRepo.GetAllListings(ctx, page)
 }
 
 func (us *UserService) GetPurchasedListingsByUserID(ctx context.Context, userID int) ([]models.MyPurchase, error) {
@@ -116,6 +167,26 @@ func (us *UserService) GetWishlistByUserID(ctx context.Context, userID int) ([]m
 	return us.userRepo.GetWishlistByUserID(ctx, userID)
 }
 
+// SetWishlistMaxPrice sets the most a user will pay for a wishlisted book.
+// nil removes the limit.
+func (us *UserService) SetWishlistMaxPrice(ctx context.Context, userID int, bookID int, maxPrice *float64) error {
+	if maxPrice != nil && *maxPrice <= 0 {
+		return ErrInvalidMaxPrice
+	}
+	return us.userRepo.SetWishlistMaxPrice(ctx, userID, bookID, maxPrice)
+}
+
+func (us *UserService) GetWishlistMaxPrice(ctx context.Context, userID int, bookID int) (*float64, error) {
+	return us.userRepo.GetWishlistMaxPrice(ctx, userID, bookID)
+}
+
+// ClaimWishlistAlerts returns the users to alert about a listing, applying the
+// configured rate limits. alertType is models.NotificationWishlistMatch or
+// models.NotificationPriceDrop.
+func (us *UserService) ClaimWishlistAlerts(ctx context.Context, listingID int, alertType string) ([]models.WishlistAlert, error) {
+	return us.userRepo.ClaimWishlistAlerts(ctx, listingID, alertType, us.wishlistAlertCooldown, us.wishlistAlertDailyLimit)
+}
+
 func (us *UserService) IsBookInWishlist(ctx context.Context, userID int, bookID int) (bool, error) {
 	return us.userRepo.IsBookInWishlist(ctx, userID, bookID)
 }
@@ -134,11 +205,24 @@ func (us *UserService) GetListingByID(ctx context.Context, listingID int) (*mode
     return us.userRepo.GetListingByID(ctx, listingID)
 }
 
-func (us *UserService) RemoveListing(ctx context.Context, userID int, listingID int) error {
+// RemoveListing takes a listing off the market and returns the offers on it
+// that were rejected
+func (us *UserService) RemoveListing(ctx context.Context, userID int, listingID int) ([]models.OfferUpdate, error) {
     return us.userRepo.RemoveListing(ctx, userID, listingID)
 }
 
-func (us *UserService) MarkListingAsSold(ctx context.Context, listingID int, buyerID int) error {
+// UpdateListing edits a seller's listing and reports auto-rejected offers
+func (us *UserService) UpdateListing(ctx context.Context, sellerID int, listingID int, form models.ListingUpdateForm, newImageURLs []string) (*models.ListingUpdateResult, error) {
+    return us.userRepo.UpdateListing(ctx, sellerID, listingID, form, newImageURLs)
+}
+
+// RelistListing puts a removed listing back up for sale
+func (us *UserService) RelistListing(ctx context.Context, sellerID int, listingID int, price *float32) error {
+    return us.userRepo.RelistListing(ctx, sellerID, listingID, price)
+}
+
+// MarkListingAsSold returns the other buyers' offers that were rejected
+func (us *UserService) MarkListingAsSold(ctx context.Context, listingID int, buyerID int) ([]models.OfferUpdate, error) {
 	return us.userRepo.MarkListingAsSold(ctx, listingID, buyerID)
 }
 
@@ -150,6 +234,14 @@ func (us *UserService) GetGender(ctx context.Context, userID int) (string, error
     return us.userRepo.GetGender(ctx, userID)
 }
 
+func (us *UserService) GetPreferredPaymentProvider(ctx context.Context, userID int) (string, error) {
+	return us.userRepo.GetPreferredPaymentProvider(ctx, userID)
+}
+
+func (us *UserService) SetPreferredPaymentProvider(ctx context.Context, userID int, provider string) error {
+	return us.userRepo.SetPreferredPaymentProvider(ctx, userID, provider)
+}
+
 func (us *UserService) AddToCart(ctx context.Context, userID int, listingID int) (int, error) {
 	return us.userRepo.AddToCart(ctx, userID, listingID)
 }
@@ -162,32 +254,130 @@ func (us *UserService) GetCart(ctx context.Context, userID int) ([]models.CartIt
 	return us.userRepo.GetCart(ctx, userID)
 }
 
-func (us *UserService) AddToOffers(ctx context.Context, buyerID int, listingID int, offeredPrice float64) (int, error) {
-    return us.userRepo.AddToOffers(ctx, buyerID, listingID, offeredPrice)
+// AddToOffers makes an offer on a listing. When the listing's offer thresholds
+// answer it straight away, the automatic step is returned as well.
+func (us *UserService) AddToOffers(ctx context.Context, buyerID int, listingID int, offeredPrice float64) (int, *models.OfferUpdate, error) {
+	if offeredPrice <= 0 {
+		return 0, nil, ErrInvalidOfferPrice
+	}
+	id, err := us.userRepo.AddToOffers(ctx, buyerID, listingID, offeredPrice, us.offerExpiryHours)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, us.applyOfferThresholds(ctx, id, listingID, offeredPrice), nil
+}
+
+// applyOfferThresholds answers a pending offer on the seller's behalf when its
+// price is outside the listing's negotiable band: at or above the auto-accept
+// price it's accepted, below the minimum it's rejected. It returns nil when
+// the offer is left for the seller.
+func (us *UserService) applyOfferThresholds(ctx context.Context, offerID int, listingID int, price float64) *models.OfferUpdate {
+	sellerID, t, err := us.userRepo.GetListingOfferThresholds(ctx, listingID)
+	if err != nil {
+		log.Printf("⚠️  Offer %d left for the seller: %v", offerID, err)
+		return nil
+	}
+
+	var update *models.OfferUpdate
+	switch {
+	case t.AutoAcceptPrice != nil && price >= *t.AutoAcceptPrice:
+		update, err = us.userRepo.AcceptOffer(ctx, sellerID, offerID, us.offerPaymentHours)
+	case t.MinOfferPrice != nil && price < *t.MinOfferPrice:
+		update, err = us.userRepo.RejectOffer(ctx, sellerID, offerID)
+	default:
+		return nil
+	}
+	if err != nil {
+		// e.g. the listing sold in the meantime; the seller still sees it
+		log.Printf("⚠️  Offer %d left for the seller: %v", offerID, err)
+		return nil
+	}
+	update.Automatic = true
+	return update
 }
 
-func (us *UserService) GetBuyerOffers(ctx context.Context, buyerID int) ([]models.OfferItem, error) {
-    return us.userRepo.GetBuyerOffers(ctx, buyerID)
+// SearchListings searches the marketplace across sellers
+func (us *UserService) SearchListings(ctx context.Context, params models.ListingSearchParams, page models.PageRequest) ([]models.ListingSearchItem, *models.PageInfo, error) {
+	return us.userRepo.SearchListings(ctx, params, page)
 }
 
-func (us *UserService) GetSellerOffers(ctx context.Context, sellerID int) ([]models.OfferItem, error) {
-    return us.userRepo.GetSellerOffers(ctx, sellerID)
+func (us *UserService) GetBuyerOffers(ctx context.Context, buyerID int, page models.PageRequest) ([]models.OfferItem, *models.PageInfo, error) {
+    return us.userRepo.GetBuyerOffers(ctx, buyerID, page)
+}
+
+func (us *UserService) GetSellerOffers(ctx context.Context, sellerID int, page models.PageRequest) ([]models.OfferItem, *models.PageInfo, error) {
+    return us.userRepo.GetSellerOffers(ctx, sellerID, page)
 }
 
 func (us *UserService) RemoveFromOffers(ctx context.Context, buyerID int, listingID int) error {
     return us.userRepo.RemoveFromOffers(ctx, buyerID, listingID)
 }
 
-func (us *UserService) AcceptOffer(ctx context.Context, sellerID int, offerID int) (int, error) {
-    return us.userRepo.AcceptOffer(ctx, sellerID, offerID)
+// AcceptOffer accepts an offer waiting on the user: the seller accepts a
+// pending offer, the buyer a counter-offer
+func (us *UserService) AcceptOffer(ctx context.Context, userID int, offerID int) (*models.OfferUpdate, error) {
+	return us.userRepo.AcceptOffer(ctx, userID, offerID, us.offerPaymentHours)
 }
 
-func (us *UserService) RejectOffer(ctx context.Context, sellerID int, offerID int) (int, error) {
-    return us.userRepo.RejectOffer(ctx, sellerID, offerID)
+// RejectOffer rejects an offer waiting on the user
+func (us *UserService) RejectOffer(ctx context.Context, userID int, offerID int) (*models.OfferUpdate, error) {
+	return us.userRepo.RejectOffer(ctx, userID, offerID)
 }
 
-func (us *UserService) ReserveListing(ctx context.Context, listingID int, buyerID int) (bool, error) {
-	return us.userRepo.ReserveListing(ctx, listingID, buyerID)
+// CounterOffer answers an offer waiting on the user with a new price
+func (us *UserService) CounterOffer(ctx context.Context, userID int, offerID int, price float64) (*models.OfferUpdate, error) {
+	if price <= 0 {
+		return nil, ErrInvalidOfferPrice
+	}
+	update, err := us.userRepo.CounterOffer(ctx, userID, offerID, price, us.offerExpiryHours)
+	if err != nil {
+		return nil, err
+	}
+	// A buyer's counter is a new offer for the seller, so the thresholds apply
+	if update.Status == models.OfferPending {
+		if auto := us.applyOfferThresholds(ctx, offerID, update.ListingID, price); auto != nil {
+			return auto, nil
+		}
+	}
+	return update, nil
+}
+
+func (us *UserService) GetOfferHistory(ctx context.Context, offerID int) ([]models.OfferHistoryEntry, error) {
+	return us.userRepo.GetOfferHistory(ctx, offerID)
+}
+
+// RunOfferExpiryWorker periodically expires offers nobody answered in time
+// and accepted offers the buyer didn't pay for. A reservation the latter left
+// behind runs out on its own. notify is called for every expired offer. It
+// stops when ctx is cancelled.
+func (us *UserService) RunOfferExpiryWorker(ctx context.Context, notify func(update models.OfferUpdate)) {
+	ticker := time.NewTicker(offerExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stale, err := us.userRepo.ExpireStaleOffers(ctx, us.offerExpiryHours)
+			if err != nil {
+				log.Println("❌ Offer expiry Error:", err)
+			}
+			for _, update := range stale {
+				log.Printf("Offer %d expired unanswered", update.OfferID)
+				notify(update)
+			}
+
+			unpaid, err := us.userRepo.ExpireUnpaidOffers(ctx, us.offerPaymentHours)
+			if err != nil {
+				log.Println("❌ Offer payment expiry Error:", err)
+			}
+			for _, update := range unpaid {
+				log.Printf("Offer %d expired unpaid", update.OfferID)
+				notify(update)
+			}
+		case <-ctx.Done():
+			log.Println("Offer expiry worker stopped")
+			return
+		}
+	}
 }
 
 // service/user_service.go
@@ -199,29 +389,41 @@ func (us *UserService) GetOfferByID(ctx context.Context, offerID int) (*models.O
     return us.userRepo.GetOfferByID(ctx, offerID)
 }
 
-func (us *UserService) ReserveListingForOffer(ctx context.Context, listingID int, buyerID int) (bool, error) {
-    return us.userRepo.ReserveListingForOffer(ctx, listingID, buyerID)
+func (us *UserService) CreateTransaction(ctx context.Context, stripe_session_id string, buyerID int, listingID int, offer_id *int, amount float64, status string, provider string) error {
+	return us.userRepo.CreateTransaction(ctx, stripe_session_id, buyerID, listingID, offer_id, amount, status, provider)
 }
 
-func (us *UserService) ExpireReservedListing(ctx context.Context, listingID int) error {
-	return us.userRepo.ExpireReservedListing(ctx, listingID)
+func (us *UserService) CreateCartTransactions(ctx context.Context, sessionID string, provider string, buyerID int, items []models.CartCheckoutItem) error {
+	return us.userRepo.CreateCartTransactions(ctx, sessionID, provider, buyerID, items)
 }
 
-// service/user_service.go
-func (us *UserService) RevertOfferReservation(ctx context.Context, listingID int, offerID int) error {
-    return us.userRepo.RevertOfferReservation(ctx, listingID, offerID)
+func (us *UserService) GetSessionTransactions(ctx context.Context, sessionID string) ([]models.SessionTransaction, error) {
+	return us.userRepo.GetSessionTransactions(ctx, sessionID)
 }
 
-func (us *UserService) CreateTransaction(ctx context.Context, stripe_session_id string, buyerID int, listingID int, offer_id *int, amount float64, status string) error {
-	return us.userRepo.CreateTransaction(ctx, stripe_session_id, buyerID, listingID, offer_id, amount, status)
+func (us *UserService) SetSessionPaymentReference(ctx context.Context, sessionID string, reference string) error {
+	return us.userRepo.SetSessionPaymentReference(ctx, sessionID, reference)
 }
 
-func (us *UserService) UpdateTransactionStatus(ctx context.Context, listingID int, status string) error {
-	return us.userRepo.UpdateTransactionStatus(ctx, listingID, status)
+func (us *UserService) GetTransactionsByPaymentReference(ctx context.Context, reference string) ([]models.SessionTransaction, error) {
+	return us.userRepo.GetTransactionsByPaymentReference(ctx, reference)
+}
+
+// MarkPaymentReversed flags a refunded or disputed payment's transactions and listings
+func (us *UserService) MarkPaymentReversed(ctx context.Context, reference string, status string) error {
+	return us.userRepo.MarkPaymentReversed(ctx, reference, status)
+}
+
+func (us *UserService) SetTransactionStatus(ctx context.Context, transactionID int, status string) error {
+	return us.userRepo.SetTransactionStatus(ctx, transactionID, status)
 }
 
-func (us *UserService) IsListingReserved(ctx context.Context, listingID int) (bool, bool, error) {
-	return us.userRepo.IsListingReserved(ctx, listingID)
+func (us *UserService) UpdateSessionTransactionsStatus(ctx context.Context, sessionID string, status string) error {
+	return us.userRepo.UpdateSessionTransactionsStatus(ctx, sessionID, status)
+}
+
+func (us *UserService) UpdateTransactionStatus(ctx context.Context, listingID int, status string) error {
+	return us.userRepo.UpdateTransactionStatus(ctx, listingID, status)
 }
 
 func (us *UserService) GetAllUserReview(ctx context.Context) ([]models.UserReview, error) {
@@ -237,14 +439,14 @@ func (us *UserService) CreatePost(ctx context.Context, userID int, content strin
     return us.userRepo.CreatePost(ctx, userID, content, imageURLs, genreID, bookID)
 }
 
-// GetAllPosts retrieves all posts
-func (us *UserService) GetAllPosts(ctx context.Context) ([]models.Post, error) {
-    return us.userRepo.GetAllPosts(ctx)
+// GetAllPosts retrieves one page of posts
+func (us *UserService) GetAllPosts(ctx context.Context, page models.PageRequest) ([]models.Post, *models.PageInfo, error) {
+    return us.userRepo.GetAllPosts(ctx, page)
 }
 
 // GetPostsByUserID retrieves posts by user ID
-func (us *UserService) GetPostsByUserID(ctx context.Context, userID int) ([]models.Post, error) {
-    return us.userRepo.GetPostsByUserID(ctx, userID)
+func (us *UserService) GetPostsByUserID(ctx context.Context, userID int, page models.PageRequest) ([]models.Post, *models.PageInfo, error) {
+    return us.userRepo.GetPostsByUserID(ctx, userID, page)
 }
 
 // GetPostByPostID retrieves a post by its ID
@@ -257,6 +459,11 @@ func (us *UserService) CreateComment(ctx context.Context, postID, userID int, co
     return us.userRepo.CreateComment(ctx, postID, userID, content)
 }
 
+// GetPostAuthorID returns the user who wrote a post
+func (us *UserService) GetPostAuthorID(ctx context.Context, postID int) (int, error) {
+    return us.userRepo.GetPostAuthorID(ctx, postID)
+}
+
 // GetCommentsByPostID retrieves comments for a post
 func (us *UserService) GetCommentsByPostID(ctx context.Context, postID int) ([]models.Comment, error) {
     return us.userRepo.GetCommentsByPostID(ctx, postID)
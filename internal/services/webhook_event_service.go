@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"used2book-backend/internal/models"
+	"used2book-backend/internal/repository/mysql"
+)
+
+type WebhookEventService struct {
+	webhookRepo *mysql.WebhookEventRepository
+}
+
+func NewWebhookEventService(repo *mysql.WebhookEventRepository) *WebhookEventService {
+	return &WebhookEventService{webhookRepo: repo}
+}
+
+func (ws *WebhookEventService) RecordEvent(ctx context.Context, provider string, eventID string, eventType string, payload []byte) (*models.WebhookEvent, bool, error) {
+	return ws.webhookRepo.RecordEvent(ctx, provider, eventID, eventType, payload)
+}
+
+func (ws *WebhookEventService) ClaimEvent(ctx context.Context, id int) (bool, error) {
+	return ws.webhookRepo.ClaimEvent(ctx, id)
+}
+
+func (ws *WebhookEventService) MarkEventFailed(ctx context.Context, id int, reason string) error {
+	return ws.webhookRepo.MarkEventFailed(ctx, id, reason)
+}
+
+func (ws *WebhookEventService) GetEventByID(ctx context.Context, id int) (*models.WebhookEvent, error) {
+	return ws.webhookRepo.GetEventByID(ctx, id)
+}
+
+func (ws *WebhookEventService) ListEvents(ctx context.Context, status string, page models.PageRequest) ([]models.WebhookEvent, *models.PageInfo, error) {
+	return ws.webhookRepo.ListEvents(ctx, status, page)
+}
+
+// Process runs fn for a claimed event inside one database transaction and
+// marks the event processed in that same transaction, so either every side
+// effect lands together with the ledger entry or none do. On failure the
+// event is marked failed and can be replayed.
+func (ws *WebhookEventService) Process(ctx context.Context, event *models.WebhookEvent, fn func(ctx context.Context) error) error {
+	err := ws.webhookRepo.RunInTx(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		return ws.webhookRepo.MarkEventProcessed(ctx, event.ID)
+	})
+	if err != nil {
+		if markErr := ws.webhookRepo.MarkEventFailed(ctx, event.ID, err.Error()); markErr != nil {
+			return markErr
+		}
+		return err
+	}
+	return nil
+}
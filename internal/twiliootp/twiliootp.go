@@ -112,19 +112,25 @@ func SendOTP(ctx context.Context, phoneNumber string) error {
 		return fmt.Errorf("failed to store OTP in Redis: %w", err)
 	}
 
+	// Send the OTP by SMS.
+	return SendSMS(ctx, phoneNumber, fmt.Sprintf("Your OTP code is: %s", otp))
+}
+
+// SendSMS sends a text message from the Twilio number.
+func SendSMS(ctx context.Context, phoneNumber string, body string) error {
+	if twilioClient == nil {
+		return errors.New("twilio client is not initialized")
+	}
 	acc_phone, err := getTwilioPhoneNumber()
 	if err != nil {
-        return fmt.Errorf("failed to get TWILIO_PHONE_NUMBER: %v", err)
-    } 
+		return fmt.Errorf("failed to get TWILIO_PHONE_NUMBER: %v", err)
+	}
 
-	// Prepare the SMS message.
-	messageBody := fmt.Sprintf("Your OTP code is: %s", otp)
 	params := &openapi.CreateMessageParams{}
 	params.SetTo(phoneNumber)
 	params.SetFrom(acc_phone)
-	params.SetBody(messageBody)
+	params.SetBody(body)
 
-	// Send the SMS using Twilio.
 	resp, err := twilioClient.Api.CreateMessage(params)
 	if err != nil {
 		return fmt.Errorf("failed to send SMS via Twilio: %w", err)
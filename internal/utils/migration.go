@@ -1,6 +1,7 @@
 package utils
 
 import (
+    "database/sql"
     "log"
 )
 
@@ -44,8 +45,11 @@ func RunMigrations() {
             id INT AUTO_INCREMENT PRIMARY KEY,
             user_id INT NOT NULL,
             bank_name VARCHAR(100) NOT NULL,
-            account_number VARCHAR(50) NOT NULL,
+            account_number_masked VARCHAR(50) NOT NULL DEFAULT '',
             account_holder_name VARCHAR(100) NOT NULL,
+            omise_recipient_id VARCHAR(255) DEFAULT NULL,
+            verification_status ENUM('unregistered', 'pending', 'verified', 'rejected') NOT NULL DEFAULT 'unregistered',
+            verified_at TIMESTAMP NULL DEFAULT NULL,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -286,6 +290,341 @@ func RunMigrations() {
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
         );`,
+
+        `CREATE TABLE IF NOT EXISTS listing_price_history (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            listing_id INT NOT NULL,
+            old_price FLOAT DEFAULT NULL,
+            new_price FLOAT NOT NULL,
+            changed_by INT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+            FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_price_history_listing (listing_id, created_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS webhook_events (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            provider VARCHAR(50) NOT NULL,
+            event_id VARCHAR(255) NOT NULL,
+            event_type VARCHAR(100) NOT NULL,
+            payload LONGTEXT NOT NULL,
+            status ENUM('processing', 'processed', 'failed') NOT NULL DEFAULT 'processing',
+            attempts INT NOT NULL DEFAULT 1,
+            last_error TEXT DEFAULT NULL,
+            received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            processed_at TIMESTAMP NULL DEFAULT NULL,
+            UNIQUE KEY uniq_webhook_event (provider, event_id),
+            INDEX idx_webhook_events_status (status, received_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS payouts (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            seller_id INT NOT NULL,
+            amount DECIMAL(10,2) NOT NULL,
+            recipient_id VARCHAR(255) NOT NULL,
+            omise_transfer_id VARCHAR(255) DEFAULT NULL,
+            status ENUM('pending', 'sent', 'failed') NOT NULL DEFAULT 'pending',
+            failure_reason TEXT DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_payouts_seller (seller_id, created_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS escrow_entries (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            transaction_id INT NOT NULL,
+            seller_id INT NOT NULL,
+            buyer_id INT DEFAULT NULL,
+            listing_id INT DEFAULT NULL,
+            gross_amount DECIMAL(10,2) NOT NULL,
+            fee_amount DECIMAL(10,2) NOT NULL,
+            net_amount DECIMAL(10,2) NOT NULL,
+            status ENUM('held', 'released', 'paying_out', 'paid_out', 'refunded', 'disputed') NOT NULL DEFAULT 'held',
+            released_at TIMESTAMP NULL DEFAULT NULL,
+            payout_id INT DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY uniq_escrow_transaction (transaction_id),
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+            FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (payout_id) REFERENCES payouts(id) ON DELETE SET NULL,
+            INDEX idx_escrow_seller_status (seller_id, status)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS orders (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            transaction_id INT NOT NULL,
+            listing_id INT DEFAULT NULL,
+            buyer_id INT DEFAULT NULL,
+            seller_id INT DEFAULT NULL,
+            amount DECIMAL(10,2) NOT NULL,
+            status ENUM('paid', 'shipped', 'delivered', 'completed', 'cancelled', 'disputed', 'refunded') NOT NULL DEFAULT 'paid',
+            carrier VARCHAR(100) DEFAULT NULL,
+            tracking_number VARCHAR(100) DEFAULT NULL,
+            cancel_reason VARCHAR(255) DEFAULT NULL,
+            shipped_at TIMESTAMP NULL DEFAULT NULL,
+            delivered_at TIMESTAMP NULL DEFAULT NULL,
+            completed_at TIMESTAMP NULL DEFAULT NULL,
+            cancelled_at TIMESTAMP NULL DEFAULT NULL,
+            auto_complete_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY uniq_order_transaction (transaction_id),
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE SET NULL,
+            FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE SET NULL,
+            FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE SET NULL,
+            INDEX idx_orders_buyer (buyer_id, created_at),
+            INDEX idx_orders_seller (seller_id, created_at),
+            INDEX idx_orders_auto_complete (status, auto_complete_at)
+        );`,
+
+        // Every step of an offer's negotiation
+        `CREATE TABLE IF NOT EXISTS offer_history (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            offer_id INT NOT NULL,
+            actor_id INT DEFAULT NULL,
+            actor_role ENUM('buyer', 'seller', 'system') NOT NULL,
+            action ENUM('offered', 'countered', 'accepted', 'rejected', 'expired', 'payment_expired', 'suspended', 'reinstated') NOT NULL,
+            price DECIMAL(10,2) DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (offer_id) REFERENCES offers(id) ON DELETE CASCADE,
+            FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+            INDEX idx_offer_history_offer (offer_id, created_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS disputes (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            order_id INT NOT NULL,
+            transaction_id INT NOT NULL,
+            buyer_id INT DEFAULT NULL,
+            seller_id INT DEFAULT NULL,
+            reason ENUM('not_received', 'damaged', 'not_as_described', 'other') NOT NULL,
+            description TEXT NOT NULL,
+            status ENUM('open', 'responded', 'resolved') NOT NULL DEFAULT 'open',
+            resolution ENUM('full_refund', 'partial_refund', 'rejected') DEFAULT NULL,
+            refund_amount DECIMAL(10,2) DEFAULT NULL,
+            resolved_by INT DEFAULT NULL,
+            resolved_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY uniq_dispute_order (order_id),
+            FOREIGN KEY (order_id) REFERENCES orders(id),
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id),
+            FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE SET NULL,
+            FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE SET NULL,
+            FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL,
+            INDEX idx_disputes_status (status, created_at),
+            INDEX idx_disputes_buyer (buyer_id, created_at),
+            INDEX idx_disputes_seller (seller_id, created_at)
+        );`,
+
+        // Append-only thread of everything said and done on a dispute
+        `CREATE TABLE IF NOT EXISTS dispute_messages (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            dispute_id INT NOT NULL,
+            author_id INT DEFAULT NULL,
+            author_role ENUM('buyer', 'seller', 'admin') NOT NULL,
+            action ENUM('opened', 'responded', 'commented', 'resolved') NOT NULL,
+            body TEXT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (dispute_id) REFERENCES disputes(id),
+            FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL,
+            INDEX idx_dispute_messages_dispute (dispute_id, created_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS dispute_message_images (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            message_id INT NOT NULL,
+            image_url VARCHAR(255) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (message_id) REFERENCES dispute_messages(id)
+        );`,
+
+        // Every hold a buyer has had on a listing, for reservation metrics.
+        // listings.reserved_by/reserved_expires_at mirror the active one.
+        `CREATE TABLE IF NOT EXISTS listing_holds (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            listing_id INT NOT NULL,
+            buyer_id INT NOT NULL,
+            offer_id INT DEFAULT NULL,
+            source ENUM('checkout', 'cart', 'waitlist') NOT NULL,
+            payment_provider VARCHAR(20) DEFAULT NULL,
+            status ENUM('active', 'converted', 'expired', 'released') NOT NULL DEFAULT 'active',
+            expires_at TIMESTAMP NOT NULL,
+            -- When the buyer was reminded that the hold is about to run out
+            reminded_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            resolved_at TIMESTAMP NULL DEFAULT NULL,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+            FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (offer_id) REFERENCES offers(id) ON DELETE SET NULL,
+            INDEX idx_listing_holds_listing (listing_id, status),
+            INDEX idx_listing_holds_created (created_at)
+        );`,
+
+        // Buyers queued for a reserved listing, served oldest first
+        `CREATE TABLE IF NOT EXISTS listing_waitlist (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            listing_id INT NOT NULL,
+            user_id INT NOT NULL,
+            status ENUM('waiting', 'promoted', 'left', 'closed') NOT NULL DEFAULT 'waiting',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            promoted_at TIMESTAMP NULL DEFAULT NULL,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            UNIQUE KEY uq_listing_waitlist (listing_id, user_id),
+            INDEX idx_listing_waitlist_queue (listing_id, status, created_at)
+        );`,
+
+        // In-app notifications, stored by the consumer of the notification
+        // queues. event_id keeps redelivered messages from being stored twice.
+        `CREATE TABLE IF NOT EXISTS notifications (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            event_id VARCHAR(64) NOT NULL,
+            user_id INT NOT NULL,
+            type VARCHAR(50) NOT NULL,
+            message VARCHAR(255) NOT NULL DEFAULT '',
+            data JSON DEFAULT NULL,
+            hidden BOOLEAN NOT NULL DEFAULT false,
+            is_read BOOLEAN NOT NULL DEFAULT false,
+            read_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            UNIQUE KEY uq_notifications_event (event_id),
+            INDEX idx_notifications_user (user_id, is_read, created_at)
+        );`,
+
+        // How each user wants to be notified outside the app. Users without
+        // a row get the defaults.
+        `CREATE TABLE IF NOT EXISTS notification_settings (
+            user_id INT PRIMARY KEY,
+            language ENUM('th', 'en') NOT NULL DEFAULT 'th',
+            email_enabled BOOLEAN NOT NULL DEFAULT true,
+            quiet_hours_start TIME DEFAULT NULL,
+            quiet_hours_end TIME DEFAULT NULL,
+            digest_enabled BOOLEAN NOT NULL DEFAULT false,
+            digest_hour TINYINT NOT NULL DEFAULT 8,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );`,
+
+        // Per category and channel choices; missing rows mean the default
+        `CREATE TABLE IF NOT EXISTS notification_preferences (
+            user_id INT NOT NULL,
+            category VARCHAR(30) NOT NULL,
+            channel VARCHAR(20) NOT NULL,
+            enabled BOOLEAN NOT NULL,
+            PRIMARY KEY (user_id, category, channel),
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );`,
+
+        // Notifications held back for a channel by quiet hours or the daily
+        // digest, with a copy of what to send
+        `CREATE TABLE IF NOT EXISTS notification_deliveries (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            notification_id INT DEFAULT NULL,
+            user_id INT NOT NULL,
+            channel VARCHAR(20) NOT NULL,
+            type VARCHAR(50) NOT NULL,
+            message VARCHAR(255) NOT NULL DEFAULT '',
+            data JSON DEFAULT NULL,
+            digest BOOLEAN NOT NULL DEFAULT false,
+            status ENUM('pending', 'sent', 'failed') NOT NULL DEFAULT 'pending',
+            deliver_after TIMESTAMP NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            sent_at TIMESTAMP NULL DEFAULT NULL,
+            FOREIGN KEY (notification_id) REFERENCES notifications(id) ON DELETE SET NULL,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_notification_deliveries_due (status, digest, deliver_after)
+        );`,
+        // Wishlist alerts sent, so a popular title doesn't alert the same
+        // user about every copy listed
+        `CREATE TABLE IF NOT EXISTS wishlist_alerts (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            user_id INT NOT NULL,
+            book_id INT NOT NULL,
+            listing_id INT NOT NULL,
+            type VARCHAR(50) NOT NULL,
+            price DECIMAL(10,2) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+            INDEX idx_wishlist_alerts_user (user_id, created_at)
+        );`,
+        // Searches users are alerted about new matches for. Listings changed
+        // before listed_after are not new to a search.
+        `CREATE TABLE IF NOT EXISTS saved_searches (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            user_id INT NOT NULL,
+            name VARCHAR(100) NOT NULL,
+            query JSON NOT NULL,
+            notify BOOLEAN NOT NULL DEFAULT true,
+            listed_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            last_run_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_saved_searches_user (user_id),
+            INDEX idx_saved_searches_due (notify, last_run_at)
+        );`,
+
+        // Listings a saved search has already alerted about. Relisting a
+        // listing clears its rows so it can match again.
+        `CREATE TABLE IF NOT EXISTS saved_search_matches (
+            saved_search_id INT NOT NULL,
+            listing_id INT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (saved_search_id, listing_id),
+            FOREIGN KEY (saved_search_id) REFERENCES saved_searches(id) ON DELETE CASCADE,
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE
+        );`,
+        // Buyer-seller conversations about a listing, one per buyer and
+        // listing. offer_id is the offer the conversation was last opened from.
+        `CREATE TABLE IF NOT EXISTS conversations (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            listing_id INT NOT NULL,
+            offer_id INT DEFAULT NULL,
+            buyer_id INT NOT NULL,
+            seller_id INT NOT NULL,
+            last_message_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY uq_conversations_listing_buyer (listing_id, buyer_id),
+            FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+            FOREIGN KEY (offer_id) REFERENCES offers(id) ON DELETE SET NULL,
+            FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_conversations_buyer (buyer_id, last_message_at),
+            INDEX idx_conversations_seller (seller_id, last_message_at)
+        );`,
+
+        `CREATE TABLE IF NOT EXISTS conversation_messages (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            conversation_id INT NOT NULL,
+            sender_id INT NOT NULL,
+            body TEXT NOT NULL,
+            image_url VARCHAR(512) DEFAULT NULL,
+            read_at TIMESTAMP NULL DEFAULT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+            FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+            INDEX idx_conversation_messages_conversation (conversation_id, created_at),
+            INDEX idx_conversation_messages_unread (conversation_id, read_at)
+        );`,
+
+        // Users who can no longer message the blocker
+        `CREATE TABLE IF NOT EXISTS user_blocks (
+            blocker_id INT NOT NULL,
+            blocked_id INT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (blocker_id, blocked_id),
+            FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+        );`,
 		// // Seller Reviews table
 		// `CREATE TABLE IF NOT EXISTS seller_reviews (
 		//     id INT AUTO_INCREMENT PRIMARY KEY,
@@ -308,15 +647,6 @@ func RunMigrations() {
             //     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
             //     FOREIGN KEY (book_id) REFERENCES books(id)
             //     );`,
-            // // Notifications table
-            // `CREATE TABLE IF NOT EXISTS notifications (
-            //         id INT AUTO_INCREMENT PRIMARY KEY,
-            //     user_id INT NOT NULL,
-            //     message VARCHAR(255),
-            //     is_read BOOLEAN DEFAULT false,
-            //     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            //     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-            //     );`,
         }
         
         for _, query := range queries {
@@ -325,5 +655,145 @@ func RunMigrations() {
 			log.Fatalf("Error running migration query: %v", err)
 		}
 	}
+
+	// Full-text indexes backing the catalog search (/book/search)
+	ensureIndex(db, "books", "ft_books_search", `CREATE FULLTEXT INDEX ft_books_search ON books (title, description, publisher)`)
+	ensureIndex(db, "books", "ft_books_title", `CREATE FULLTEXT INDEX ft_books_title ON books (title)`)
+	ensureIndex(db, "authors", "ft_authors_name", `CREATE FULLTEXT INDEX ft_authors_name ON authors (name)`)
+
+	// Columns added after the initial schema
+	ensureColumn(db, "listings", "condition_grade", `ALTER TABLE listings ADD COLUMN condition_grade ENUM('new', 'like_new', 'good', 'fair', 'poor') DEFAULT NULL AFTER allow_offers`)
+	ensureColumn(db, "listings", "condition_defects", `ALTER TABLE listings ADD COLUMN condition_defects SET('highlighting', 'underlining', 'notes_in_margin', 'torn_pages', 'missing_pages', 'water_damage', 'stains', 'loose_binding', 'cover_wear', 'name_written') NOT NULL DEFAULT '' AFTER condition_grade`)
+	ensureColumn(db, "listings", "edition", `ALTER TABLE listings ADD COLUMN edition VARCHAR(100) DEFAULT NULL AFTER condition_defects`)
+	ensureColumn(db, "listings", "format", `ALTER TABLE listings ADD COLUMN format ENUM('hardcover', 'paperback') DEFAULT NULL AFTER edition`)
+	ensureColumn(db, "transactions", "seller_id", `ALTER TABLE transactions ADD COLUMN seller_id INT DEFAULT NULL AFTER buyer_id`)
+	ensureIndex(db, "transactions", "idx_transactions_session", `CREATE INDEX idx_transactions_session ON transactions (stripe_session_id)`)
+	ensureColumn(db, "listings", "reserved_by", `ALTER TABLE listings ADD COLUMN reserved_by INT DEFAULT NULL AFTER reserved_expires_at`)
+	ensureColumn(db, "transactions", "payment_reference", `ALTER TABLE transactions ADD COLUMN payment_reference VARCHAR(255) DEFAULT NULL AFTER stripe_session_id`)
+	ensureColumn(db, "transactions", "payment_provider", `ALTER TABLE transactions ADD COLUMN payment_provider VARCHAR(20) NOT NULL DEFAULT 'stripe' AFTER payment_reference`)
+	ensureColumn(db, "users", "preferred_payment_provider", `ALTER TABLE users ADD COLUMN preferred_payment_provider VARCHAR(20) DEFAULT NULL AFTER role`)
+	ensureIndex(db, "transactions", "idx_transactions_payment_reference", `CREATE INDEX idx_transactions_payment_reference ON transactions (payment_reference)`)
+	ensureColumnType(db, "listings", "status",
+		"enum('for_sale','reserved','sold','removed','refunded','disputed')",
+		`ALTER TABLE listings MODIFY COLUMN status ENUM('for_sale', 'reserved', 'sold', 'removed', 'refunded', 'disputed') DEFAULT 'for_sale'`)
+	ensureColumnType(db, "transactions", "payment_status",
+		"enum('pending','completed','failed','refunded','disputed','partially_refunded')",
+		`ALTER TABLE transactions MODIFY COLUMN payment_status ENUM('pending', 'completed', 'failed', 'refunded', 'disputed', 'partially_refunded') DEFAULT 'pending'`)
+	ensureIndex(db, "listings", "idx_listings_status_created", `CREATE INDEX idx_listings_status_created ON listings (status, created_at, id)`)
+	ensureColumn(db, "bank_accounts", "omise_recipient_id", `ALTER TABLE bank_accounts ADD COLUMN omise_recipient_id VARCHAR(255) DEFAULT NULL AFTER account_holder_name`)
+	ensureColumn(db, "bank_accounts", "verification_status", `ALTER TABLE bank_accounts ADD COLUMN verification_status ENUM('unregistered', 'pending', 'verified', 'rejected') NOT NULL DEFAULT 'unregistered' AFTER omise_recipient_id`)
+	ensureColumn(db, "bank_accounts", "verified_at", `ALTER TABLE bank_accounts ADD COLUMN verified_at TIMESTAMP NULL DEFAULT NULL AFTER verification_status`)
+	ensureColumn(db, "bank_accounts", "account_number_masked", `ALTER TABLE bank_accounts ADD COLUMN account_number_masked VARCHAR(50) NOT NULL DEFAULT '' AFTER bank_name`)
+	// Full account numbers live only at Omise; databases that still store
+	// them keep just the last four digits
+	dropColumn(db, "bank_accounts", "account_number",
+		`UPDATE bank_accounts
+		 SET account_number_masked = CONCAT(REPEAT('x', GREATEST(CHAR_LENGTH(account_number) - 4, 0)), RIGHT(account_number, 4))
+		 WHERE account_number_masked = ''`,
+		`ALTER TABLE bank_accounts DROP COLUMN account_number`)
+	ensureColumnType(db, "offers", "status",
+		"enum('pending','accepted','rejected','completed','countered','expired','suspended')",
+		`ALTER TABLE offers MODIFY COLUMN status ENUM('pending', 'accepted', 'rejected', 'completed', 'countered', 'expired', 'suspended') DEFAULT 'pending'`)
+	ensureColumn(db, "offers", "expires_at", `ALTER TABLE offers ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL AFTER status`)
+	ensureColumn(db, "offers", "payment_due_at", `ALTER TABLE offers ADD COLUMN payment_due_at TIMESTAMP NULL DEFAULT NULL AFTER expires_at`)
+	// What a suspended offer goes back to, and since when its expiry is paused
+	ensureColumn(db, "offers", "suspended_from", `ALTER TABLE offers ADD COLUMN suspended_from ENUM('pending', 'countered') DEFAULT NULL AFTER payment_due_at`)
+	ensureColumn(db, "offers", "suspended_at", `ALTER TABLE offers ADD COLUMN suspended_at TIMESTAMP NULL DEFAULT NULL AFTER suspended_from`)
+	ensureColumn(db, "listings", "min_offer_price", `ALTER TABLE listings ADD COLUMN min_offer_price DECIMAL(10,2) DEFAULT NULL AFTER allow_offers`)
+	ensureColumn(db, "listings", "auto_accept_price", `ALTER TABLE listings ADD COLUMN auto_accept_price DECIMAL(10,2) DEFAULT NULL AFTER min_offer_price`)
+	ensureIndex(db, "offers", "idx_offers_status_expires", `CREATE INDEX idx_offers_status_expires ON offers (status, expires_at)`)
+	ensureColumn(db, "transactions", "refunded_amount", `ALTER TABLE transactions ADD COLUMN refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER transaction_amount`)
+	// The most a user will pay for a wishlisted book; alerts only fire at or below it
+	ensureColumn(db, "user_wishlist", "max_price", `ALTER TABLE user_wishlist ADD COLUMN max_price DECIMAL(10,2) DEFAULT NULL AFTER book_id`)
+	// Where a seller is, coarse enough to show on public listings unlike address
+	ensureColumn(db, "users", "province", `ALTER TABLE users ADD COLUMN province VARCHAR(100) NOT NULL DEFAULT '' AFTER address`)
+
 	log.Println("Migrations executed successfully!")
 }
+
+// ensureIndex creates an index only when it is missing, since MySQL has no
+// CREATE INDEX IF NOT EXISTS.
+func ensureIndex(db *sql.DB, table string, index string, createQuery string) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`,
+		table, index,
+	).Scan(&count)
+	if err != nil {
+		log.Fatalf("Error checking index %s on %s: %v", index, table, err)
+	}
+	if count > 0 {
+		return
+	}
+	if _, err := db.Exec(createQuery); err != nil {
+		log.Fatalf("Error creating index %s on %s: %v", index, table, err)
+	}
+}
+
+// ensureColumn adds a column to an existing table only when it is missing,
+// so older databases pick up new columns without a separate migration tool.
+func ensureColumn(db *sql.DB, table string, column string, alterQuery string) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		log.Fatalf("Error checking column %s on %s: %v", column, table, err)
+	}
+	if count > 0 {
+		return
+	}
+	if _, err := db.Exec(alterQuery); err != nil {
+		log.Fatalf("Error adding column %s to %s: %v", column, table, err)
+	}
+}
+
+// dropColumn runs the given statements, typically a backfill followed by the
+// DROP COLUMN itself, only while the column still exists.
+func dropColumn(db *sql.DB, table string, column string, queries ...string) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		log.Fatalf("Error checking column %s on %s: %v", column, table, err)
+	}
+	if count == 0 {
+		return
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			log.Fatalf("Error dropping column %s from %s: %v", column, table, err)
+		}
+	}
+}
+
+// ensureColumnType alters a column when its current type differs from
+// wantType (as reported by information_schema.columns.column_type), e.g. to
+// add values to an ENUM.
+func ensureColumnType(db *sql.DB, table string, column string, wantType string, alterQuery string) {
+	var columnType string
+	err := db.QueryRow(`
+		SELECT column_type
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column,
+	).Scan(&columnType)
+	if err != nil {
+		log.Fatalf("Error checking column %s on %s: %v", column, table, err)
+	}
+	if columnType == wantType {
+		return
+	}
+	if _, err := db.Exec(alterQuery); err != nil {
+		log.Fatalf("Error altering column %s on %s: %v", column, table, err)
+	}
+}